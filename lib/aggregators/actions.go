@@ -0,0 +1,34 @@
+package aggregators
+
+import (
+	"strings"
+)
+
+// normalizeAction folds actions that embed high-cardinality details
+// down to their base name, e.g., `exec_start: /bin/sh -c ls` becomes
+// `exec_start`. Any other action is returned untouched.
+func normalizeAction(action string) string {
+	if !strings.HasPrefix(action, "exec_") {
+		return action
+	}
+
+	if idx := strings.Index(action, ":"); idx != -1 {
+		return action[:idx]
+	}
+
+	return action
+}
+
+// parseHealthStatus extracts the state out of a `health_status: <state>`
+// action, returning false if the action isn't a health status one.
+func parseHealthStatus(action string) (status string, ok bool) {
+	const prefix = "health_status:"
+
+	if !strings.HasPrefix(action, prefix) {
+		return
+	}
+
+	status = strings.TrimSpace(action[len(prefix):])
+	ok = status != ""
+	return
+}
@@ -1,9 +1,28 @@
 package aggregators
 
 import (
+	"context"
+
 	"github.com/docker/docker/api/types/events"
 )
 
+// Aggregator is the contract every backend must satisfy in order
+// to be fed by the main event loop.
+//
+// Run blocks consuming events and errors from the given channels
+// until it's done, returning the error (if any) that made it stop.
 type Aggregator interface {
-	Run(<-chan events.Message, <-chan error)
+	Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) error
+}
+
+// Reloader is implemented by the aggregators able to reload parts
+// of their configuration (e.g., TLS certificates) while running.
+type Reloader interface {
+	Reload() error
+}
+
+// HealthChecker is implemented by the aggregators holding a
+// connection to their backend, reporting whether it's currently up.
+type HealthChecker interface {
+	Healthy() bool
 }
@@ -0,0 +1,94 @@
+package aggregators
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = 5 * time.Second
+)
+
+// batchConfig controls how events are grouped before being handed to
+// a backend: a batch is flushed once it holds Size events or when
+// Interval elapses, whichever comes first.
+type batchConfig struct {
+	Size     int
+	Interval time.Duration
+}
+
+// withDefaults fills the unset fields of the configuration.
+func (b batchConfig) withDefaults() batchConfig {
+	if b.Size <= 0 {
+		b.Size = defaultBatchSize
+	}
+
+	if b.Interval <= 0 {
+		b.Interval = defaultFlushInterval
+	}
+
+	return b
+}
+
+// runBatched implements the event loop of aggregators that deliver
+// events in batches. It accumulates events and calls `flush` with them
+// according to `cfg`, making sure that whatever is pending gets flushed
+// before returning.
+func runBatched(ctx context.Context, logger *log.Entry,
+	evs <-chan events.Message, errs <-chan error,
+	cfg batchConfig, flush func([]events.Message) error) (err error) {
+	var (
+		batch  = make([]events.Message, 0, cfg.Size)
+		ticker = time.NewTicker(cfg.Interval)
+	)
+	defer ticker.Stop()
+
+	var doFlush = func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		err := flush(batch)
+		if err != nil {
+			logger.
+				WithError(err).
+				WithField("events", len(batch)).
+				Error("Errored flushing batch")
+		}
+
+		batch = make([]events.Message, 0, cfg.Size)
+	}
+	defer doFlush()
+
+	logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			doFlush()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				logger.Info("events channel closed")
+				return
+			}
+
+			batch = append(batch, ev)
+			if len(batch) >= cfg.Size {
+				doFlush()
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package aggregators
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSubscriberBufferSize = 100
+	defaultWriteTimeout         = 10 * time.Second
+)
+
+// broadcaster fans events out to a dynamic set of subscribers (e.g.,
+// clients connected to a streaming endpoint).
+//
+// Publishing never blocks: a subscriber that can't keep up (its
+// buffer is full) is dropped, which closes its channel so that the
+// client gets disconnected.
+type broadcaster struct {
+	bufferSize int
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	evs    chan events.Message
+	filter eventFilter
+}
+
+func newBroadcaster(bufferSize int) *broadcaster {
+	if bufferSize <= 0 {
+		bufferSize = defaultSubscriberBufferSize
+	}
+
+	return &broadcaster{
+		bufferSize:  bufferSize,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// subscribe registers a subscriber receiving the events selected by
+// `filter`. The channel of a subscriber registered after close is
+// closed right away.
+func (b *broadcaster) subscribe(filter eventFilter) *subscriber {
+	var sub = &subscriber{
+		evs:    make(chan events.Message, b.bufferSize),
+		filter: filter,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.evs)
+		return sub
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe removes a subscriber, closing its channel.
+func (b *broadcaster) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, present := b.subscribers[sub]; present {
+		delete(b.subscribers, sub)
+		close(sub.evs)
+	}
+}
+
+// publish delivers the event to every subscriber selecting it,
+// returning the number of slow subscribers dropped.
+func (b *broadcaster) publish(ev events.Message) (dropped int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.matches(ev) {
+			continue
+		}
+
+		select {
+		case sub.evs <- ev:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.evs)
+			dropped++
+		}
+	}
+
+	return
+}
+
+// close drops every subscriber and rejects new ones.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.evs)
+	}
+
+	b.closed = true
+}
+
+// len returns the number of subscribers.
+func (b *broadcaster) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers)
+}
+
+// tokenAuth protects a handler with a static token, given either as
+// a bearer token or through the `token` query parameter (which is
+// what browsers can do for WebSocket and EventSource connections).
+func tokenAuth(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var given = r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP listens on `addr` and serves `handler` in the background,
+// returning a channel receiving the error that made the server stop
+// and a function that shuts it down gracefully.
+func serveHTTP(addr string, handler http.Handler) (serveErrs <-chan error, shutdown func(timeout time.Duration) error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't listen on %s", addr)
+		return
+	}
+
+	var (
+		errs      = make(chan error, 1)
+		serveDone = make(chan struct{})
+		server    = &http.Server{Handler: handler}
+	)
+
+	go func() {
+		defer close(serveDone)
+
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+
+	serveErrs = errs
+	shutdown = func(timeout time.Duration) (err error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		err = server.Shutdown(ctx)
+		if err != nil {
+			err = server.Close()
+		}
+
+		<-serveDone
+		return
+	}
+
+	return
+}
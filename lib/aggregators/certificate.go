@@ -0,0 +1,52 @@
+package aggregators
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// keyPair holds a TLS certificate loaded from files that can be
+// reloaded while it's being served, allowing certificates to be
+// renewed without restarting.
+type keyPair struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Value
+}
+
+func loadKeyPair(certFile, keyFile string) (pair *keyPair, err error) {
+	pair = &keyPair{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err = pair.reload()
+	return
+}
+
+// reload reads the certificate files again, keeping the current
+// certificate if they can't be loaded.
+func (k *keyPair) reload() (err error) {
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't load TLS key pair (cert=%s, key=%s)",
+			k.certFile, k.keyFile)
+		return
+	}
+
+	k.cert.Store(&cert)
+	return
+}
+
+// tlsConfig returns a server configuration that always serves the
+// latest certificate loaded.
+func (k *keyPair) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return k.cert.Load().(*tls.Certificate), nil
+		},
+	}
+}
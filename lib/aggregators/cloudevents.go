@@ -0,0 +1,123 @@
+package aggregators
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+const (
+	// cloudEventsSpecVersion is the version of the CloudEvents
+	// specification the events are encoded with.
+	cloudEventsSpecVersion = "1.0"
+
+	// cloudEventsContentType is the media type of events encoded
+	// in the structured mode of CloudEvents.
+	cloudEventsContentType = "application/cloudevents+json"
+
+	// cloudEventsTypePrefix prefixes the CloudEvents type of the
+	// docker events, followed by their type and action (e.g.,
+	// `com.docker.container.start`).
+	cloudEventsTypePrefix = "com.docker."
+
+	defaultCloudEventsSource = "devents"
+)
+
+// cloudEvent is a docker event encoded as a CloudEvent in its JSON
+// format, carrying the original event as its data.
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            string         `json:"time,omitempty"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            events.Message `json:"data"`
+}
+
+// eventEncoder encodes the events sent by the aggregators that push
+// them as messages (webhook, kafka, ...), either as plain JSON
+// (`json`) or as CloudEvents (`cloudevents`).
+type eventEncoder struct {
+	cloudEvents bool
+	source      string
+}
+
+func newEventEncoder(format, source string) (encoder eventEncoder, err error) {
+	switch format {
+	case "", "json":
+	case "cloudevents":
+		encoder.cloudEvents = true
+	default:
+		err = errors.Errorf(
+			"Unknown event format %s, expected json or cloudevents", format)
+		return
+	}
+
+	encoder.source = source
+	if encoder.source == "" {
+		encoder.source = defaultCloudEventsSource
+	}
+
+	return
+}
+
+// contentType is the media type of the encoded events.
+func (e eventEncoder) contentType() string {
+	if e.cloudEvents {
+		return cloudEventsContentType
+	}
+
+	return "application/json"
+}
+
+// encode encodes a single event.
+func (e eventEncoder) encode(ev events.Message) ([]byte, error) {
+	if !e.cloudEvents {
+		return json.Marshal(ev)
+	}
+
+	var ce = cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              cloudEventID(ev),
+		Source:          e.source,
+		Type:            cloudEventsTypePrefix + ev.Type + "." + normalizeAction(ev.Action),
+		Subject:         ev.Actor.ID,
+		DataContentType: "application/json",
+		Data:            ev,
+	}
+
+	if ev.TimeNano != 0 {
+		ce.Time = time.Unix(0, ev.TimeNano).UTC().Format(time.RFC3339Nano)
+	} else if ev.Time != 0 {
+		ce.Time = time.Unix(ev.Time, 0).UTC().Format(time.RFC3339Nano)
+	}
+
+	return json.Marshal(ce)
+}
+
+// cloudEventID identifies an event by hashing what tells it apart
+// from others, so that the same event always gets the same id (e.g.,
+// when retried or replayed), letting consumers deduplicate them.
+func cloudEventID(ev events.Message) string {
+	var hash = sha256.New()
+
+	for _, part := range []string{
+		strconv.FormatInt(ev.TimeNano, 10),
+		strconv.FormatInt(ev.Time, 10),
+		ev.Type,
+		ev.Action,
+		ev.Actor.ID,
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
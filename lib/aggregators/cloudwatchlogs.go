@@ -0,0 +1,284 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Limits of a single PutLogEvents call: the size of a batch is
+	// the sum of the size of the messages plus 26 bytes per event.
+	cloudWatchLogsMaxBatchEvents = 10000
+	cloudWatchLogsMaxBatchBytes  = 1048576
+	cloudWatchLogsEventOverhead  = 26
+
+	defaultCloudWatchLogsStream = "{{.Host}}"
+)
+
+var _ Aggregator = (*CloudWatchLogs)(nil)
+
+type CloudWatchLogsConfig struct {
+	Region   string
+	LogGroup string
+
+	// LogStream is a text/template rendered once at startup with
+	// `.Host` (the hostname) to name the log stream. Defaults to
+	// `{{.Host}}`.
+	LogStream string
+
+	// Endpoint overrides the address of the API (e.g., for testing
+	// against a local mock). Defaults to the regional endpoint.
+	Endpoint string
+
+	// BatchSize and FlushInterval control how many events are sent
+	// at once and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// CloudWatchLogs sends every event as a JSON log event to a stream of
+// a CloudWatch Logs group, creating both when missing. Credentials
+// are resolved by the default chain of the AWS SDK (environment,
+// shared file, ECS task role, EC2 instance profile).
+type CloudWatchLogs struct {
+	logger    *log.Entry
+	client    *cloudwatchlogs.CloudWatchLogs
+	logGroup  string
+	logStream string
+	batch     batchConfig
+
+	// sequenceToken is only required by older API versions but is
+	// still kept up to date as it's returned by every call.
+	sequenceToken *string
+}
+
+type cloudWatchLogsEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+func NewCloudWatchLogs(cfg CloudWatchLogsConfig) (agg CloudWatchLogs, err error) {
+	if cfg.Region == "" || cfg.LogGroup == "" {
+		err = errors.New(
+			"Both a cloudwatch logs region and log group must be specified")
+		return
+	}
+
+	var streamTemplate = cfg.LogStream
+	if streamTemplate == "" {
+		streamTemplate = defaultCloudWatchLogsStream
+	}
+
+	tmpl, err := template.New("stream").Parse(streamTemplate)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse cloudwatch logs stream template %s", streamTemplate)
+		return
+	}
+
+	var (
+		stream  bytes.Buffer
+		host, _ = os.Hostname()
+	)
+
+	err = tmpl.Execute(&stream, struct{ Host string }{host})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't render cloudwatch logs stream template %s", streamTemplate)
+		return
+	}
+
+	var awsCfg = aws.NewConfig().WithRegion(cfg.Region)
+	if cfg.Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create aws session for region %s", cfg.Region)
+		return
+	}
+
+	agg.client = cloudwatchlogs.New(sess)
+	agg.logGroup = cfg.LogGroup
+	agg.logStream = stream.String()
+	agg.sequenceToken = new(string)
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+	if agg.batch.Size > cloudWatchLogsMaxBatchEvents {
+		agg.batch.Size = cloudWatchLogsMaxBatchEvents
+	}
+
+	agg.logger = log.WithField("aggregator", "cloudwatchlogs")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (c CloudWatchLogs) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	err = c.ensureStream(ctx)
+	if err != nil {
+		return
+	}
+
+	return runBatched(ctx, c.logger, evs, errs, c.batch, func(batch []events.Message) error {
+		return c.write(ctx, batch)
+	})
+}
+
+// ensureStream creates the log group and stream, ignoring the
+// errors caused by them already existing.
+func (c CloudWatchLogs) ensureStream(ctx context.Context) (err error) {
+	_, err = c.client.CreateLogGroupWithContext(ctx, &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String(c.logGroup),
+	})
+	if err != nil && !alreadyExists(err) {
+		err = errors.Wrapf(err,
+			"Couldn't create log group %s", c.logGroup)
+		return
+	}
+
+	_, err = c.client.CreateLogStreamWithContext(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(c.logGroup),
+		LogStreamName: aws.String(c.logStream),
+	})
+	if err != nil && !alreadyExists(err) {
+		err = errors.Wrapf(err,
+			"Couldn't create log stream %s", c.logStream)
+		return
+	}
+
+	err = nil
+	return
+}
+
+func alreadyExists(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == cloudwatchlogs.ErrCodeResourceAlreadyExistsException
+}
+
+// write sends a batch of events, splitting it so that each call stays
+// within the limits of PutLogEvents.
+func (c CloudWatchLogs) write(ctx context.Context, batch []events.Message) (err error) {
+	var logEvents = make([]cloudWatchLogsEvent, 0, len(batch))
+
+	for _, ev := range batch {
+		message, err := json.Marshal(ev)
+		if err != nil {
+			return errors.Wrapf(err,
+				"Couldn't encode event")
+		}
+
+		var ts = ev.TimeNano / int64(time.Millisecond)
+		if ev.TimeNano == 0 {
+			ts = ev.Time * 1000
+		}
+
+		logEvents = append(logEvents, cloudWatchLogsEvent{
+			Timestamp: ts,
+			Message:   string(message),
+		})
+	}
+
+	// Events of a call must be in chronological order.
+	sort.SliceStable(logEvents, func(i, j int) bool {
+		return logEvents[i].Timestamp < logEvents[j].Timestamp
+	})
+
+	for _, chunk := range chunkCloudWatchLogsEvents(logEvents) {
+		err = c.put(ctx, chunk)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// chunkCloudWatchLogsEvents splits events into chunks that respect
+// the count and size limits of a PutLogEvents call.
+func chunkCloudWatchLogsEvents(logEvents []cloudWatchLogsEvent) (chunks [][]cloudWatchLogsEvent) {
+	var (
+		start = 0
+		size  = 0
+	)
+
+	for idx, ev := range logEvents {
+		var evSize = len(ev.Message) + cloudWatchLogsEventOverhead
+
+		if idx > start &&
+			(idx-start >= cloudWatchLogsMaxBatchEvents || size+evSize > cloudWatchLogsMaxBatchBytes) {
+			chunks = append(chunks, logEvents[start:idx])
+			start, size = idx, 0
+		}
+
+		size += evSize
+	}
+
+	if start < len(logEvents) {
+		chunks = append(chunks, logEvents[start:])
+	}
+
+	return
+}
+
+// put sends a single chunk, recovering from an outdated sequence
+// token by retrying with the one expected by the service. Throttling
+// and unavailability are retried by the SDK itself.
+func (c CloudWatchLogs) put(ctx context.Context, logEvents []cloudWatchLogsEvent) (err error) {
+	var input = &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(c.logGroup),
+		LogStreamName: aws.String(c.logStream),
+		LogEvents:     make([]*cloudwatchlogs.InputLogEvent, 0, len(logEvents)),
+	}
+
+	for _, ev := range logEvents {
+		input.LogEvents = append(input.LogEvents, &cloudwatchlogs.InputLogEvent{
+			Timestamp: aws.Int64(ev.Timestamp),
+			Message:   aws.String(ev.Message),
+		})
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		input.SequenceToken = nil
+		if *c.sequenceToken != "" {
+			input.SequenceToken = aws.String(*c.sequenceToken)
+		}
+
+		var resp *cloudwatchlogs.PutLogEventsOutput
+		resp, err = c.client.PutLogEventsWithContext(ctx, input)
+		if err == nil {
+			*c.sequenceToken = aws.StringValue(resp.NextSequenceToken)
+			return
+		}
+
+		switch cwErr := err.(type) {
+		case *cloudwatchlogs.InvalidSequenceTokenException:
+			*c.sequenceToken = aws.StringValue(cwErr.ExpectedSequenceToken)
+		case *cloudwatchlogs.DataAlreadyAcceptedException:
+			*c.sequenceToken = aws.StringValue(cwErr.ExpectedSequenceToken)
+			err = nil
+			return
+		default:
+			return
+		}
+	}
+
+	return
+}
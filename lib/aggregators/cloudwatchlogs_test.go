@@ -0,0 +1,302 @@
+package aggregators
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// cloudWatchLogsMock implements the parts of the CloudWatch Logs API
+// used by the aggregator, enforcing sequence tokens like older API
+// versions did.
+type cloudWatchLogsMock struct {
+	mu       sync.Mutex
+	token    int
+	puts     [][]cloudWatchLogsEvent
+	streams  map[string]bool
+	failNext string
+}
+
+// accepted returns the events of each accepted PutLogEvents call and
+// the current sequence token.
+func (m *cloudWatchLogsMock) accepted() (puts [][]cloudWatchLogsEvent, token string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([][]cloudWatchLogsEvent(nil), m.puts...), strconv.Itoa(m.token)
+}
+
+// hasStream reports whether the stream `name` was created.
+func (m *cloudWatchLogsMock) hasStream(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.streams[name]
+}
+
+func (m *cloudWatchLogsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	var (
+		target = strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+		req    struct {
+			LogGroupName  string                `json:"logGroupName"`
+			LogStreamName string                `json:"logStreamName"`
+			SequenceToken string                `json:"sequenceToken"`
+			LogEvents     []cloudWatchLogsEvent `json:"logEvents"`
+		}
+	)
+
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &req)
+
+	var fail = func(errType string, extra map[string]string) {
+		var resp = map[string]string{
+			"__type":  "com.amazonaws.logs#" + errType,
+			"message": errType,
+		}
+		for key, value := range extra {
+			resp[key] = value
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	switch target {
+	case "CreateLogGroup":
+		if m.streams != nil {
+			fail("ResourceAlreadyExistsException", nil)
+			return
+		}
+		m.streams = map[string]bool{}
+	case "CreateLogStream":
+		if m.streams[req.LogStreamName] {
+			fail("ResourceAlreadyExistsException", nil)
+			return
+		}
+		m.streams[req.LogStreamName] = true
+	case "PutLogEvents":
+		if !m.streams[req.LogStreamName] {
+			fail("ResourceNotFoundException", nil)
+			return
+		}
+
+		var expected = strconv.Itoa(m.token)
+		if m.failNext != "" {
+			fail(m.failNext, map[string]string{"expectedSequenceToken": expected})
+			m.failNext = ""
+			return
+		}
+
+		if m.token > 0 && req.SequenceToken != expected {
+			fail("InvalidSequenceTokenException", map[string]string{"expectedSequenceToken": expected})
+			return
+		}
+
+		m.token++
+		m.puts = append(m.puts, req.LogEvents)
+		json.NewEncoder(w).Encode(map[string]string{
+			"nextSequenceToken": strconv.Itoa(m.token),
+		})
+	}
+}
+
+func newTestCloudWatchLogs(t *testing.T, mock *cloudWatchLogsMock, cfg CloudWatchLogsConfig) CloudWatchLogs {
+	t.Helper()
+
+	var server = httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	cfg.Region = "eu-west-1"
+	cfg.LogGroup = "docker"
+	cfg.Endpoint = server.URL
+
+	agg, err := NewCloudWatchLogs(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return agg
+}
+
+// runCloudWatchLogs feeds `evs` to `agg` until they're all consumed.
+func runCloudWatchLogs(t *testing.T, agg CloudWatchLogs, evs ...events.Message) {
+	t.Helper()
+
+	var ch = make(chan events.Message, len(evs))
+	for _, ev := range evs {
+		ch <- ev
+	}
+	close(ch)
+
+	err := agg.Run(context.Background(), ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloudWatchLogs(t *testing.T) {
+	var (
+		mock = &cloudWatchLogsMock{}
+		agg  = newTestCloudWatchLogs(t, mock, CloudWatchLogsConfig{
+			LogStream: "devents-{{.Host}}",
+			BatchSize: 2,
+		})
+	)
+
+	runCloudWatchLogs(t, agg,
+		events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "late"}, TimeNano: 1500000002000000000},
+		events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "early"}, Time: 1500000001},
+		events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "abc"}, TimeNano: 1500000003000000000},
+	)
+
+	if !strings.HasPrefix(agg.logStream, "devents-") || !mock.hasStream(agg.logStream) {
+		t.Errorf("expected stream %s to be created", agg.logStream)
+	}
+
+	puts, token := mock.accepted()
+	if len(puts) != 2 || len(puts[0]) != 2 || len(puts[1]) != 1 {
+		t.Fatalf("expected puts of 2 and 1 events, got %v", puts)
+	}
+
+	// events are sorted chronologically within a call
+	var first = puts[0]
+	if first[0].Timestamp != 1500000001000 || first[1].Timestamp != 1500000002000 {
+		t.Errorf("expected the batch to be sorted by timestamp, got %v", first)
+	}
+
+	var ev events.Message
+	err := json.Unmarshal([]byte(first[0].Message), &ev)
+	if err != nil || ev.Actor.ID != "early" {
+		t.Errorf("expected the message to be the event as JSON, got %q", first[0].Message)
+	}
+
+	if *agg.sequenceToken != token {
+		t.Errorf("expected sequence token %s, got %s", token, *agg.sequenceToken)
+	}
+}
+
+func TestCloudWatchLogsSequenceTokens(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		failNext string
+		puts     int
+	}{
+		{desc: "outdated token", failNext: "InvalidSequenceTokenException", puts: 2},
+		{desc: "already accepted", failNext: "DataAlreadyAcceptedException", puts: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// an existing stream with a token that the new
+			// aggregator doesn't know about yet
+			var mock = &cloudWatchLogsMock{}
+			runCloudWatchLogs(t, newTestCloudWatchLogs(t, mock, CloudWatchLogsConfig{LogStream: "stream"}),
+				events.Message{Type: "container", Action: "start"},
+			)
+
+			mock.mu.Lock()
+			mock.failNext = tc.failNext
+			mock.mu.Unlock()
+
+			var agg = newTestCloudWatchLogs(t, mock, CloudWatchLogsConfig{LogStream: "stream"})
+			runCloudWatchLogs(t, agg, events.Message{Type: "container", Action: "die"})
+
+			puts, token := mock.accepted()
+			if len(puts) != tc.puts {
+				t.Errorf("expected %d accepted puts, got %d", tc.puts, len(puts))
+			}
+
+			if *agg.sequenceToken != token {
+				t.Errorf("expected sequence token %s, got %s", token, *agg.sequenceToken)
+			}
+		})
+	}
+}
+
+func TestChunkCloudWatchLogsEvents(t *testing.T) {
+	var logEvents = func(n, size int) (evs []cloudWatchLogsEvent) {
+		for i := 0; i < n; i++ {
+			evs = append(evs, cloudWatchLogsEvent{Message: strings.Repeat("a", size)})
+		}
+		return
+	}
+
+	var testCases = []struct {
+		desc     string
+		events   []cloudWatchLogsEvent
+		expected []int
+	}{
+		{desc: "empty", events: nil, expected: nil},
+		{desc: "within limits", events: logEvents(3, 10), expected: []int{3}},
+		{
+			desc:     "count limit",
+			events:   logEvents(cloudWatchLogsMaxBatchEvents*2+1, 1),
+			expected: []int{cloudWatchLogsMaxBatchEvents, cloudWatchLogsMaxBatchEvents, 1},
+		},
+		{
+			// 4 events of 300k (plus overhead) don't fit 1MB
+			desc:     "size limit",
+			events:   logEvents(4, 300*1024),
+			expected: []int{3, 1},
+		},
+		{
+			desc:     "exactly the size limit",
+			events:   logEvents(2, cloudWatchLogsMaxBatchBytes/2-cloudWatchLogsEventOverhead),
+			expected: []int{2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var chunks = chunkCloudWatchLogsEvents(tc.events)
+			if len(chunks) != len(tc.expected) {
+				t.Fatalf("expected %d chunks, got %d", len(tc.expected), len(chunks))
+			}
+
+			for i, chunk := range chunks {
+				if len(chunk) != tc.expected[i] {
+					t.Errorf("chunk %d: expected %d events, got %d", i, tc.expected[i], len(chunk))
+				}
+			}
+		})
+	}
+}
+
+func TestNewCloudWatchLogsInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  CloudWatchLogsConfig
+	}{
+		{desc: "no region", cfg: CloudWatchLogsConfig{LogGroup: "docker"}},
+		{desc: "no log group", cfg: CloudWatchLogsConfig{Region: "eu-west-1"}},
+		{desc: "malformed stream", cfg: CloudWatchLogsConfig{Region: "eu-west-1", LogGroup: "docker", LogStream: "{{.Host"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewCloudWatchLogs(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package aggregators
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetterConfig configures where the events an aggregator gave up
+// delivering end up.
+type DeadLetterConfig struct {
+	// Path is the file the events are appended to as newline
+	// delimited JSON, the format read by the file collector so
+	// that they can be reprocessed later on. Dead-lettering is
+	// disabled when empty.
+	Path string
+
+	// Counter, when set, counts the events dead-lettered.
+	Counter prometheus.Counter
+}
+
+// deadLetter appends the events that couldn't be delivered, even
+// after retrying, to a file instead of silently losing them. A nil
+// deadLetter discards them.
+type deadLetter struct {
+	logger  *log.Entry
+	file    *os.File
+	out     *lockedWriter
+	counter prometheus.Counter
+}
+
+func newDeadLetter(cfg DeadLetterConfig, aggregator string) (dl *deadLetter, err error) {
+	if cfg.Path == "" {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(cfg.Path), 0755)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create directory of dead letter file %s", cfg.Path)
+		return
+	}
+
+	file, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't open dead letter file %s", cfg.Path)
+		return
+	}
+
+	dl = &deadLetter{
+		logger: log.
+			WithField("aggregator", aggregator).
+			WithField("dead-letter", cfg.Path),
+		file:    file,
+		out:     &lockedWriter{w: file},
+		counter: cfg.Counter,
+	}
+	return
+}
+
+// add dead-letters the given events.
+func (d *deadLetter) add(evs ...events.Message) {
+	if d == nil {
+		return
+	}
+
+	for _, ev := range evs {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			d.logger.
+				WithError(err).
+				Error("Couldn't encode dead-lettered event")
+			continue
+		}
+
+		d.addEncoded(line)
+	}
+}
+
+// addEncoded dead-letters an event already encoded as JSON.
+func (d *deadLetter) addEncoded(line []byte) {
+	if d == nil {
+		return
+	}
+
+	_, err := d.out.Write(append(line, '\n'))
+	if err != nil {
+		d.logger.
+			WithError(err).
+			Error("Couldn't write dead-lettered event")
+		return
+	}
+
+	if d.counter != nil {
+		d.counter.Inc()
+	}
+}
+
+func (d *deadLetter) close() {
+	if d == nil {
+		return
+	}
+
+	err := d.file.Close()
+	if err != nil {
+		d.logger.
+			WithError(err).
+			Error("Couldn't close dead letter file")
+	}
+}
@@ -0,0 +1,116 @@
+package aggregators_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// readDeadLetters reads the events dead-lettered to `path` back with
+// the file collector.
+func readDeadLetters(t *testing.T, path string) (evs []events.Message) {
+	t.Helper()
+
+	file, err := collectors.NewFile(collectors.FileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inEvs, inErrs := file.Collect(context.Background())
+	for ev := range inEvs {
+		evs = append(evs, ev)
+	}
+
+	for err := range inErrs {
+		t.Errorf("unexpected error reading dead letters: %v", err)
+	}
+
+	return
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	var (
+		// nothing listens to the port, as if the backend was down
+		url     = fmt.Sprintf("http://127.0.0.1:%d", freePort(t))
+		path    = filepath.Join(t.TempDir(), "dead-letters", "webhook.json")
+		counter = prometheus.NewCounter(prometheus.CounterOpts{Name: "dead_lettered_total"})
+	)
+
+	webhook, err := aggregators.NewWebhook(aggregators.WebhookConfig{
+		URL:           url,
+		RetryAttempts: 2,
+		RetryBackoff:  time.Millisecond,
+		DeadLetter:    aggregators.DeadLetterConfig{Path: path, Counter: counter},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent = []events.Message{
+		{Type: "container", Action: "die", Actor: events.Actor{ID: "abc", Attributes: map[string]string{"exitCode": "1"}}},
+		{Type: "container", Action: "oom", Actor: events.Actor{ID: "def"}},
+	}
+
+	err = collectorstest.Run(context.Background(), webhook, sent...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.ToFloat64(counter); count != 2 {
+		t.Errorf("expected 2 events to be counted as dead-lettered, got %g", count)
+	}
+
+	var evs = readDeadLetters(t, path)
+	if len(evs) != len(sent) {
+		t.Fatalf("expected %d dead-lettered events, got %d", len(sent), len(evs))
+	}
+
+	for i, ev := range evs {
+		if ev.Action != sent[i].Action || ev.Actor.ID != sent[i].Actor.ID {
+			t.Errorf("expected %+v to be dead-lettered, got %+v", sent[i], ev)
+		}
+	}
+}
+
+func TestWebhookDeliveredNotDeadLettered(t *testing.T) {
+	url, _ := newWebhookEndpoint(t, 1)
+
+	var (
+		path    = filepath.Join(t.TempDir(), "webhook.json")
+		counter = prometheus.NewCounter(prometheus.CounterOpts{Name: "dead_lettered_total"})
+	)
+
+	webhook, err := aggregators.NewWebhook(aggregators.WebhookConfig{
+		URL:           url,
+		RetryAttempts: 2,
+		RetryBackoff:  time.Millisecond,
+		DeadLetter:    aggregators.DeadLetterConfig{Path: path, Counter: counter},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first attempt fails, the retry goes through
+	err = collectorstest.Run(context.Background(), webhook,
+		events.Message{Type: "container", Action: "die"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.ToFloat64(counter); count != 0 {
+		t.Errorf("expected nothing to be dead-lettered, got %g", count)
+	}
+
+	if evs := readDeadLetters(t, path); len(evs) != 0 {
+		t.Errorf("expected no dead-lettered events, got %+v", evs)
+	}
+}
@@ -0,0 +1,372 @@
+package aggregators
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cirocosta/devents/lib/transformers"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDispatcherBufferSize   = 100
+	defaultDispatcherDrainTimeout = 10 * time.Second
+)
+
+// The statuses an aggregator can be in: running (and healthy, as far
+// as it can tell), running but with its backend unreachable, or not
+// running at all (not started yet or returned).
+const (
+	aggregatorRunning   = "running"
+	aggregatorUnhealthy = "unhealthy"
+	aggregatorStopped   = "stopped"
+)
+
+var aggregatorStatuses = []string{
+	aggregatorRunning,
+	aggregatorUnhealthy,
+	aggregatorStopped,
+}
+
+var (
+	_ Aggregator = (*Dispatcher)(nil)
+	_ Reloader   = (*Dispatcher)(nil)
+)
+
+type DispatcherConfig struct {
+	// BufferSize is the capacity of the channels feeding each
+	// aggregator. Larger buffers absorb longer bursts of events
+	// before dropping any at the cost of memory. Defaults to 100
+	// when not set.
+	BufferSize int
+
+	// DrainTimeout is how long the aggregators are given to process
+	// the events still buffered for them once the dispatcher stops
+	// before being cancelled. Defaults to 10s.
+	DrainTimeout time.Duration
+
+	// Namespace and Subsystem prefix the name of the metrics
+	// exposed by the dispatcher.
+	Namespace string
+	Subsystem string
+
+	// Host, when set, is the value of the `host` constant label
+	// of the metrics exposed by the dispatcher.
+	Host string
+
+	// Aggregators maps a name (used for logging) to the
+	// aggregator that should receive a copy of every event.
+	Aggregators map[string]Aggregator
+
+	// Transformers maps the name of an aggregator to a transformer
+	// its events go through before reaching it (e.g., to sample
+	// them for some aggregators only), on top of those every
+	// event goes through.
+	Transformers map[string]transformers.Transformer
+}
+
+// Dispatcher reads from a single stream of events and errors and
+// fans each message out to every registered aggregator.
+//
+// Each aggregator gets its own buffered channel so that a slow
+// aggregator doesn't block the others: whenever its buffer is full
+// the message is dropped and a warning is logged.
+type Dispatcher struct {
+	logger       *log.Entry
+	bufferSize   int
+	drainTimeout time.Duration
+	targets      []dispatchTarget
+
+	droppedEvents     *prometheus.CounterVec
+	bufferedEvents    []prometheus.Collector
+	aggregatorsActive []prometheus.Collector
+}
+
+type dispatchTarget struct {
+	name        string
+	aggregator  Aggregator
+	transformer transformers.Transformer
+	evs         chan events.Message
+	errs        chan error
+
+	// running is set to 1 while the aggregator runs.
+	running *int32
+}
+
+// status tells the status the aggregator is in.
+func (t dispatchTarget) status() string {
+	if atomic.LoadInt32(t.running) != 1 {
+		return aggregatorStopped
+	}
+
+	if checker, ok := t.aggregator.(HealthChecker); ok && !checker.Healthy() {
+		return aggregatorUnhealthy
+	}
+
+	return aggregatorRunning
+}
+
+func NewDispatcher(cfg DispatcherConfig) (d Dispatcher, err error) {
+	if len(cfg.Aggregators) == 0 {
+		err = errors.New("At least one aggregator must be provided")
+		return
+	}
+
+	d.logger = log.WithField("component", "dispatcher")
+	d.bufferSize = cfg.BufferSize
+	if d.bufferSize <= 0 {
+		d.bufferSize = defaultDispatcherBufferSize
+	}
+
+	d.drainTimeout = cfg.DrainTimeout
+	if d.drainTimeout <= 0 {
+		d.drainTimeout = defaultDispatcherDrainTimeout
+	}
+
+	var subsystem = cfg.Subsystem
+	if subsystem == "" {
+		subsystem = defaultSubsystem
+	}
+
+	var constLabels = prometheus.Labels{}
+	if cfg.Host != "" {
+		constLabels["host"] = cfg.Host
+	}
+
+	d.droppedEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "dropped_events_total",
+		Help:        "Events dropped because an aggregator couldn't keep up",
+		Namespace:   cfg.Namespace,
+		Subsystem:   subsystem,
+		ConstLabels: constLabels,
+	}, []string{"aggregator"})
+
+	var names = make([]string, 0, len(cfg.Aggregators))
+	for name := range cfg.Aggregators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The channels are created upfront so that their depth can
+	// be reported before the dispatcher starts.
+	for _, name := range names {
+		var labels = prometheus.Labels{"aggregator": name}
+		for key, value := range constLabels {
+			labels[key] = value
+		}
+
+		var target = dispatchTarget{
+			name:        name,
+			aggregator:  cfg.Aggregators[name],
+			transformer: cfg.Transformers[name],
+			evs:         make(chan events.Message, d.bufferSize),
+			errs:        make(chan error, d.bufferSize),
+			running:     new(int32),
+		}
+
+		d.targets = append(d.targets, target)
+		d.bufferedEvents = append(d.bufferedEvents, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "buffered_events",
+			Help:        "Events waiting in the buffer of an aggregator",
+			Namespace:   cfg.Namespace,
+			Subsystem:   subsystem,
+			ConstLabels: labels,
+		}, func() float64 {
+			return float64(len(target.evs))
+		}))
+
+		for _, status := range aggregatorStatuses {
+			var (
+				status       = status
+				statusLabels = prometheus.Labels{"status": status}
+			)
+			for key, value := range labels {
+				statusLabels[key] = value
+			}
+
+			d.aggregatorsActive = append(d.aggregatorsActive, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name:        "aggregators_active",
+				Help:        "Status of the aggregators (1 for the status the aggregator is in, 0 otherwise)",
+				Namespace:   cfg.Namespace,
+				Subsystem:   subsystem,
+				ConstLabels: statusLabels,
+			}, func() float64 {
+				if target.status() == status {
+					return 1
+				}
+				return 0
+			}))
+		}
+	}
+
+	return
+}
+
+// Metrics returns the prometheus collectors that describe the
+// state of the dispatcher.
+func (d Dispatcher) Metrics() []prometheus.Collector {
+	var metrics = append([]prometheus.Collector{
+		d.droppedEvents,
+	}, d.bufferedEvents...)
+
+	return append(metrics, d.aggregatorsActive...)
+}
+
+// Reload reloads every aggregator that supports it, reporting the
+// ones that failed to. Aggregators failing to reload keep running
+// as they were.
+func (d Dispatcher) Reload() (err error) {
+	var problems ValidationErrors
+
+	for _, target := range d.targets {
+		reloader, ok := target.aggregator.(Reloader)
+		if !ok {
+			continue
+		}
+
+		if err := reloader.Reload(); err != nil {
+			problems = append(problems, errors.Wrapf(err,
+				"Couldn't reload aggregator %s", target.name))
+			continue
+		}
+
+		d.logger.
+			WithField("aggregator", target.name).
+			Info("aggregator reloaded")
+	}
+
+	return problems.Err()
+}
+
+// Run starts every aggregator and forwards to them the events and
+// errors received from `evs` and `errs` until `ctx` gets cancelled
+// or `evs` is closed, returning only after all the aggregators have
+// returned. A dispatcher can only be run once.
+//
+// Once the dispatcher stops, the aggregators are left to process
+// what's still buffered for them (seeing their channels closed
+// afterwards) for up to the drain timeout, after which their context
+// gets cancelled.
+func (d Dispatcher) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var (
+		wg      sync.WaitGroup
+		targets = d.targets
+	)
+
+	// The aggregators outlive `ctx` so that they can drain their
+	// buffers after it's cancelled.
+	aggCtx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		for _, target := range targets {
+			close(target.evs)
+			close(target.errs)
+		}
+		d.drain(&wg, cancel)
+	}()
+
+	for idx := range targets {
+		wg.Add(1)
+		go func(target dispatchTarget) {
+			defer wg.Done()
+
+			atomic.StoreInt32(target.running, 1)
+			defer atomic.StoreInt32(target.running, 0)
+
+			err := target.aggregator.Run(aggCtx, target.evs, target.errs)
+			if err != nil {
+				d.logger.
+					WithError(err).
+					WithField("aggregator", target.name).
+					Error("aggregator stopped")
+			}
+		}(targets[idx])
+	}
+
+	d.logger.Info("dispatching events")
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("context cancelled, stopping")
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			d.logger.WithError(err).Error("error received")
+			for _, target := range targets {
+				select {
+				case target.errs <- err:
+				default:
+					d.logger.
+						WithField("aggregator", target.name).
+						Warn("aggregator buffer full, dropping error")
+				}
+			}
+		case ev, ok := <-evs:
+			if !ok {
+				d.logger.Info("events channel closed, stopping")
+				return
+			}
+
+			d.logger.
+				WithField("type", ev.Type).
+				WithField("action", ev.Action).
+				WithField("id", ev.Actor.ID).
+				Debug("dispatching event")
+			for _, target := range targets {
+				var targetEv = ev
+				if target.transformer != nil {
+					var keep bool
+
+					targetEv, keep = target.transformer.Transform(ev)
+					if !keep {
+						continue
+					}
+				}
+
+				select {
+				case target.evs <- targetEv:
+				default:
+					d.droppedEvents.WithLabelValues(target.name).Inc()
+					d.logger.
+						WithField("aggregator", target.name).
+						Warn("aggregator buffer full, dropping event")
+				}
+			}
+		}
+	}
+}
+
+// drain waits for the aggregators to return, cancelling them if they
+// take longer than the drain timeout.
+func (d Dispatcher) drain(wg *sync.WaitGroup, cancel context.CancelFunc) {
+	var done = make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	d.logger.
+		WithField("timeout", d.drainTimeout).
+		Info("waiting for aggregators to drain")
+	select {
+	case <-done:
+	case <-time.After(d.drainTimeout):
+		d.logger.Warn("aggregators didn't drain in time, cancelling them")
+		cancel()
+		<-done
+	}
+
+	cancel()
+	d.logger.Info("aggregators stopped")
+}
@@ -0,0 +1,52 @@
+package aggregators_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// stuckAggregator never looks at its events, returning only once
+// cancelled.
+type stuckAggregator struct {
+	cancelled chan struct{}
+}
+
+func (a stuckAggregator) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) error {
+	<-ctx.Done()
+	close(a.cancelled)
+	return nil
+}
+
+func TestDispatcherDrainTimeout(t *testing.T) {
+	var agg = stuckAggregator{cancelled: make(chan struct{})}
+
+	dispatcher, err := aggregators.NewDispatcher(aggregators.DispatcherConfig{
+		DrainTimeout: 50 * time.Millisecond,
+		Aggregators:  map[string]aggregators.Aggregator{"stuck": agg},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var start = time.Now()
+	err = collectorstest.Run(context.Background(), dispatcher,
+		events.Message{Type: "container", Action: "start"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-agg.cancelled:
+	default:
+		t.Fatal("expected the aggregator to be cancelled")
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the aggregator to be given the drain timeout, returned after %s", elapsed)
+	}
+}
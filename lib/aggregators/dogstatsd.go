@@ -0,0 +1,131 @@
+package aggregators
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*DogStatsD)(nil)
+
+type DogStatsDConfig struct {
+	Host string
+	Port int
+
+	// Prefix is prepended to the metric name. Defaults to
+	// "devents", resulting in a `devents.events` counter.
+	Prefix string
+
+	// Tags are static `key:value` tags added to every metric.
+	Tags []string
+
+	// Attributes is the allowlist of actor attributes that get
+	// turned into tags. Attributes not listed are never sent so
+	// that tag cardinality stays under control.
+	Attributes []string
+}
+
+// DogStatsD emits a single `<prefix>.events` counter to a Datadog
+// agent, distinguishing events through tags (`type:container`,
+// `action:start`, ...) rather than through the metric name.
+type DogStatsD struct {
+	logger     *log.Entry
+	conn       net.Conn
+	name       string
+	tags       []string
+	attributes []string
+}
+
+func NewDogStatsD(cfg DogStatsDConfig) (agg DogStatsD, err error) {
+	var addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	agg.conn, err = net.Dial("udp", addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create dogstatsd connection to %s", addr)
+		return
+	}
+
+	var prefix = cfg.Prefix
+	if prefix == "" {
+		prefix = "devents"
+	}
+
+	agg.name = prefix + ".events"
+	agg.tags = cfg.Tags
+	agg.attributes = cfg.Attributes
+	agg.logger = log.WithField("aggregator", "dogstatsd")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (d DogStatsD) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer d.conn.Close()
+
+	d.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			d.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				d.logger.Info("events channel closed")
+				return
+			}
+
+			err := writeStatsDCounter(d.conn, d.name, d.eventTags(ev))
+			if err != nil {
+				d.logger.
+					WithError(err).
+					Error("Errored sending counter to dogstatsd")
+			}
+		}
+	}
+}
+
+// eventTags builds the tags describing an event: its type, action,
+// the allowed attributes it carries and the static tags.
+func (d DogStatsD) eventTags(ev events.Message) []string {
+	var tags = []string{
+		dogStatsDTag("type", ev.Type),
+		dogStatsDTag("action", normalizeAction(ev.Action)),
+	}
+
+	for _, key := range d.attributes {
+		value, present := ev.Actor.Attributes[key]
+		if !present {
+			continue
+		}
+
+		tags = append(tags, dogStatsDTag(key, value))
+	}
+
+	return append(tags, d.tags...)
+}
+
+// dogStatsDTag formats a `key:value` tag, replacing the characters
+// that would break the datagram (`|`, `,`, `#` and whitespace).
+func dogStatsDTag(key, value string) string {
+	var sanitize = func(r rune) rune {
+		switch r {
+		case '|', ',', '#', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}
+
+	return strings.Map(sanitize, key) + ":" + strings.Map(sanitize, value)
+}
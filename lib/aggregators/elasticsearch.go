@@ -0,0 +1,236 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultElasticsearchIndex = "docker-events-2006.01.02"
+
+var _ Aggregator = (*Elasticsearch)(nil)
+
+type ElasticsearchConfig struct {
+	// URL is the base address of the Elasticsearch cluster (e.g.,
+	// http://localhost:9200).
+	URL string
+
+	// Index is the name of the index documents are written to,
+	// formatted with the time of the event using Go's reference
+	// time layout. Defaults to `docker-events-2006.01.02`, which
+	// creates a daily index (`docker-events-2024.01.02`).
+	Index string
+
+	Username string
+	Password string
+
+	// BatchSize and FlushInterval control how many documents are
+	// sent in a single bulk request and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// RetryAttempts and RetryBackoff control how bulk requests that
+	// failed with transient errors (5xx, 429, network) are retried.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+
+	// DeadLetter configures where the events of the bulk requests
+	// that failed go.
+	DeadLetter DeadLetterConfig
+}
+
+// Elasticsearch indexes every event as a JSON document using the
+// `_bulk` API.
+type Elasticsearch struct {
+	logger     *log.Entry
+	client     *http.Client
+	bulkURL    string
+	index      string
+	username   string
+	password   string
+	batch      batchConfig
+	retry      retryConfig
+	deadLetter *deadLetter
+}
+
+// elasticsearchDocument is the document indexed for each event: the
+// message as sent by the daemon plus an `@timestamp` that Kibana
+// picks up as the time field.
+type elasticsearchDocument struct {
+	Timestamp time.Time `json:"@timestamp"`
+	events.Message
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+func NewElasticsearch(cfg ElasticsearchConfig) (agg Elasticsearch, err error) {
+	bulkURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse elasticsearch url %s", cfg.URL)
+		return
+	}
+
+	bulkURL.Path = strings.TrimSuffix(bulkURL.Path, "/") + "/_bulk"
+
+	agg.bulkURL = bulkURL.String()
+	agg.index = cfg.Index
+	if agg.index == "" {
+		agg.index = defaultElasticsearchIndex
+	}
+
+	agg.username = cfg.Username
+	agg.password = cfg.Password
+	agg.client = &http.Client{Timeout: 30 * time.Second}
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+	agg.retry = retryConfig{
+		Attempts: cfg.RetryAttempts,
+		Backoff:  cfg.RetryBackoff,
+	}.withDefaults()
+
+	agg.deadLetter, err = newDeadLetter(cfg.DeadLetter, "elasticsearch")
+	if err != nil {
+		return
+	}
+
+	agg.logger = log.WithField("aggregator", "elasticsearch")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (e Elasticsearch) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer e.deadLetter.close()
+
+	return runBatched(ctx, e.logger, evs, errs, e.batch, func(batch []events.Message) error {
+		err := e.write(ctx, batch)
+		if err != nil {
+			e.deadLetter.add(batch...)
+		}
+		return err
+	})
+}
+
+// write indexes a batch of events with a single bulk request,
+// retrying transient failures.
+func (e Elasticsearch) write(ctx context.Context, batch []events.Message) (err error) {
+	var (
+		body    bytes.Buffer
+		encoder = json.NewEncoder(&body)
+	)
+
+	for _, ev := range batch {
+		var timestamp = time.Unix(0, ev.TimeNano).UTC()
+		if ev.TimeNano == 0 {
+			timestamp = time.Unix(ev.Time, 0).UTC()
+		}
+
+		var action = map[string]map[string]string{
+			"index": {"_index": timestamp.Format(e.index)},
+		}
+
+		err = encoder.Encode(action)
+		if err == nil {
+			err = encoder.Encode(elasticsearchDocument{
+				Timestamp: timestamp,
+				Message:   ev,
+			})
+		}
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't encode event as elasticsearch document")
+			return
+		}
+	}
+
+	return retry(ctx, e.retry, func() error {
+		return e.post(ctx, body.Bytes())
+	})
+}
+
+func (e Elasticsearch) post(ctx context.Context, payload []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.bulkURL, bytes.NewReader(payload))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create elasticsearch bulk request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't send bulk request to elasticsearch")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"elasticsearch bulk request failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	var result elasticsearchBulkResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't decode elasticsearch bulk response")
+		return
+	}
+
+	if !result.Errors {
+		return
+	}
+
+	// Some documents were rejected. Those are not retried as the
+	// failures are usually mapping conflicts that would just fail
+	// again.
+	var failed = 0
+	for _, item := range result.Items {
+		for _, status := range item {
+			if status.Status/100 == 2 {
+				continue
+			}
+
+			failed++
+			e.logger.
+				WithField("status", status.Status).
+				WithField("error", string(status.Error)).
+				Warn("elasticsearch rejected document")
+		}
+	}
+
+	err = errors.Errorf(
+		"elasticsearch rejected %d of %d documents",
+		failed, len(result.Items))
+	return
+}
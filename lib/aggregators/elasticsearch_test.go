@@ -0,0 +1,189 @@
+package aggregators_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// newBulkEndpoint records the bodies of the bulk requests it receives,
+// answering them with the given statuses in order (200 once exhausted).
+func newBulkEndpoint(t *testing.T, statuses ...int) (url string, received func() [][]byte) {
+	t.Helper()
+
+	var (
+		mu     sync.Mutex
+		bodies [][]byte
+	)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected bulk request to %s (%s)",
+				r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		bodies = append(bodies, body)
+		if len(bodies) <= len(statuses) {
+			w.WriteHeader(statuses[len(bodies)-1])
+			return
+		}
+
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([][]byte(nil), bodies...)
+	}
+}
+
+func newElasticsearch(t *testing.T, cfg aggregators.ElasticsearchConfig) aggregators.Elasticsearch {
+	t.Helper()
+
+	cfg.RetryAttempts = 3
+	cfg.RetryBackoff = time.Millisecond
+
+	agg, err := aggregators.NewElasticsearch(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return agg
+}
+
+func TestElasticsearch(t *testing.T) {
+	url, received := newBulkEndpoint(t)
+	var agg = newElasticsearch(t, aggregators.ElasticsearchConfig{
+		URL:       url,
+		BatchSize: 2,
+	})
+
+	var timeNano = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano()
+	err := collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start", TimeNano: timeNano},
+		events.Message{Type: "container", Action: "die", Time: timeNano / int64(time.Second)},
+		events.Message{Type: "network", Action: "connect", TimeNano: timeNano + int64(24*time.Hour)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bodies = received()
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 bulk requests, got %d", len(bodies))
+	}
+
+	var expected = []struct {
+		index, action, timestamp string
+	}{
+		{"docker-events-2024.01.02", "start", "2024-01-02T03:04:05Z"},
+		{"docker-events-2024.01.02", "die", "2024-01-02T03:04:05Z"},
+		{"docker-events-2024.01.03", "connect", "2024-01-03T03:04:05Z"},
+	}
+
+	var scanner = bufio.NewScanner(bytes.NewReader(bytes.Join(bodies, nil)))
+	for i, doc := range expected {
+		var (
+			action   map[string]map[string]string
+			document map[string]interface{}
+		)
+
+		if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &action) != nil {
+			t.Fatalf("document %d: expected an action line", i)
+		}
+		if !scanner.Scan() || json.Unmarshal(scanner.Bytes(), &document) != nil {
+			t.Fatalf("document %d: expected a document line", i)
+		}
+
+		if index := action["index"]["_index"]; index != doc.index {
+			t.Errorf("document %d: expected index %s, got %s", i, doc.index, index)
+		}
+		if document["Action"] != doc.action {
+			t.Errorf("document %d: expected action %s, got %v", i, doc.action, document["Action"])
+		}
+		if document["@timestamp"] != doc.timestamp {
+			t.Errorf("document %d: expected @timestamp %s, got %v", i, doc.timestamp, document["@timestamp"])
+		}
+	}
+}
+
+func TestElasticsearchRetries(t *testing.T) {
+	var testCases = []struct {
+		desc         string
+		statuses     []int
+		requests     int
+		deadLettered bool
+	}{
+		{
+			desc:     "transient failures are retried",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			requests: 3,
+		},
+		{
+			desc:         "retries are bounded",
+			statuses:     []int{500, 500, 500},
+			requests:     3,
+			deadLettered: true,
+		},
+		{
+			desc:         "client errors aren't retried",
+			statuses:     []int{http.StatusBadRequest},
+			requests:     1,
+			deadLettered: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var deadLetterPath = filepath.Join(t.TempDir(), "dead-letter.json")
+
+			url, received := newBulkEndpoint(t, tc.statuses...)
+			var agg = newElasticsearch(t, aggregators.ElasticsearchConfig{
+				URL:        url,
+				Index:      "events",
+				DeadLetter: aggregators.DeadLetterConfig{Path: deadLetterPath},
+			})
+
+			err := collectorstest.Run(context.Background(), agg,
+				events.Message{Type: "container", Action: "start"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if requests := len(received()); requests != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, requests)
+			}
+
+			deadLettered, err := ioutil.ReadFile(deadLetterPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(deadLettered), `"start"`) != tc.deadLettered {
+				t.Errorf("expected dead-lettered=%v, got %q", tc.deadLettered, deadLettered)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package aggregators
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultEMFNamespace          = "devents"
+	defaultEMFMaxDimensionValues = 100
+
+	// emfOverflowValue replaces the values of a dimension once it
+	// reached the maximum number of distinct values.
+	emfOverflowValue = "other"
+)
+
+var _ Aggregator = (*EMF)(nil)
+
+type EMFConfig struct {
+	// Namespace is the CloudWatch namespace of the metrics.
+	Namespace string
+
+	// Dimensions are the actor attributes (e.g., `image`) that
+	// become dimensions besides `type` and `action`.
+	Dimensions []string
+
+	// MaxDimensionValues bounds the number of distinct values of
+	// each attribute dimension; values seen after the limit is hit
+	// are reported as `other`. Defaults to 100.
+	MaxDimensionValues int
+
+	// FlushInterval is how often the counts are emitted.
+	FlushInterval time.Duration
+
+	// Writer is where the EMF documents are written to. Defaults
+	// to os.Stdout, which is shipped to CloudWatch Logs by the
+	// awslogs driver (or Lambda/ECS) and extracted as metrics.
+	Writer io.Writer
+}
+
+// EMF counts events by type and action (and optionally some of their
+// attributes) and periodically writes the counts as CloudWatch
+// Embedded Metric Format documents.
+type EMF struct {
+	logger             *log.Entry
+	out                io.Writer
+	namespace          string
+	dimensions         []string
+	maxDimensionValues int
+	interval           time.Duration
+}
+
+func NewEMF(cfg EMFConfig) (agg EMF, err error) {
+	agg.namespace = cfg.Namespace
+	if agg.namespace == "" {
+		agg.namespace = defaultEMFNamespace
+	}
+
+	agg.maxDimensionValues = cfg.MaxDimensionValues
+	if agg.maxDimensionValues <= 0 {
+		agg.maxDimensionValues = defaultEMFMaxDimensionValues
+	}
+
+	agg.interval = cfg.FlushInterval
+	if agg.interval <= 0 {
+		agg.interval = time.Minute
+	}
+
+	var w = cfg.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	agg.out = &lockedWriter{w: w}
+	agg.dimensions = cfg.Dimensions
+	agg.logger = log.WithField("aggregator", "emf")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (e EMF) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var (
+		counts = map[string]int{}
+		seen   = map[string]map[string]bool{}
+		ticker = time.NewTicker(e.interval)
+	)
+	defer ticker.Stop()
+
+	var flush = func() {
+		for key, count := range counts {
+			err := e.write(strings.Split(key, "\x00"), count)
+			if err != nil {
+				e.logger.
+					WithError(err).
+					Error("Errored writing emf document")
+			}
+		}
+
+		counts = map[string]int{}
+	}
+	defer flush()
+
+	e.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flush()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			e.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				e.logger.Info("events channel closed")
+				return
+			}
+
+			var values = []string{ev.Type, normalizeAction(ev.Action)}
+			for _, dimension := range e.dimensions {
+				values = append(values,
+					e.boundedValue(seen, dimension, ev.Actor.Attributes[dimension]))
+			}
+
+			counts[strings.Join(values, "\x00")]++
+		}
+	}
+}
+
+// boundedValue returns the value to report for a dimension, keeping
+// track of the distinct values seen so far so that the cardinality
+// never exceeds maxDimensionValues.
+func (e EMF) boundedValue(seen map[string]map[string]bool, dimension, value string) string {
+	if value == "" {
+		return "none"
+	}
+
+	values, present := seen[dimension]
+	if !present {
+		values = map[string]bool{}
+		seen[dimension] = values
+	}
+
+	if values[value] {
+		return value
+	}
+
+	if len(values) >= e.maxDimensionValues {
+		return emfOverflowValue
+	}
+
+	values[value] = true
+	return value
+}
+
+// write emits a single EMF document with the count of events of a
+// combination of dimension values.
+func (e EMF) write(values []string, count int) (err error) {
+	var (
+		names = append([]string{"type", "action"}, e.dimensions...)
+		doc   = map[string]interface{}{}
+	)
+
+	for idx, name := range names {
+		doc[name] = values[idx]
+	}
+
+	// The dimension names are sorted to keep the output stable.
+	var dimensions = append([]string(nil), names...)
+	sort.Strings(dimensions[2:])
+
+	doc["Events"] = count
+	doc["_aws"] = map[string]interface{}{
+		"Timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []map[string]interface{}{{
+			"Namespace":  e.namespace,
+			"Dimensions": [][]string{dimensions},
+			"Metrics": []map[string]string{{
+				"Name": "Events",
+				"Unit": "Count",
+			}},
+		}},
+	}
+
+	line, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+
+	_, err = e.out.Write(append(line, '\n'))
+	return
+}
@@ -0,0 +1,45 @@
+package aggregators
+
+import (
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// exemplarTraceLabel is the label of the exemplars linking a counter
+// to the trace of the event that incremented it.
+const exemplarTraceLabel = "trace_id"
+
+// exemplarOf returns the exemplar of an event, out of the trace id
+// carried by its `attribute` attribute, or nil when exemplars are
+// disabled (`attribute` is empty) or the event carries no valid one.
+func exemplarOf(ev events.Message, attribute string) prometheus.Labels {
+	if attribute == "" {
+		return nil
+	}
+
+	traceID, present := ev.Actor.Attributes[attribute]
+	if !present || traceID == "" || !utf8.ValidString(traceID) {
+		return nil
+	}
+
+	// Exemplars whose labels are too long are rejected (by panicking)
+	// by the client, those are left out instead.
+	if utf8.RuneCountInString(exemplarTraceLabel)+utf8.RuneCountInString(traceID) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+
+	return prometheus.Labels{exemplarTraceLabel: traceID}
+}
+
+// addCounter adds `delta` to a counter, attaching `exemplar` to it
+// when there's one, falling back to a plain increment otherwise.
+func addCounter(counter prometheus.Counter, delta float64, exemplar prometheus.Labels) {
+	if adder, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		adder.AddWithExemplar(delta, exemplar)
+		return
+	}
+
+	counter.Add(delta)
+}
@@ -0,0 +1,88 @@
+package aggregators
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestExemplarOf(t *testing.T) {
+	var ev = events.Message{
+		Actor: events.Actor{
+			Attributes: map[string]string{"trace": "4bf92f3577b34da6"},
+		},
+	}
+
+	if exemplar := exemplarOf(ev, ""); exemplar != nil {
+		t.Errorf("expected no exemplar when disabled, got %v", exemplar)
+	}
+
+	if exemplar := exemplarOf(ev, "missing"); exemplar != nil {
+		t.Errorf("expected no exemplar without the attribute, got %v", exemplar)
+	}
+
+	exemplar := exemplarOf(ev, "trace")
+	if exemplar[exemplarTraceLabel] != "4bf92f3577b34da6" {
+		t.Errorf("expected the trace id as exemplar, got %v", exemplar)
+	}
+
+	ev.Actor.Attributes["trace"] = strings.Repeat("a", prometheus.ExemplarMaxRunes)
+	if exemplar := exemplarOf(ev, "trace"); exemplar != nil {
+		t.Errorf("expected no exemplar for a trace id too long, got %v", exemplar)
+	}
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		attribute string
+		exemplar  string
+	}{
+		{name: "disabled", attribute: "", exemplar: ""},
+		{name: "enabled", attribute: "trace", exemplar: "4bf92f3577b34da6"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewPrometheus(PrometheusConfig{
+				Port:              9090,
+				Path:              "/metrics",
+				ExemplarAttribute: tc.attribute,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p.handleEvent(events.Message{
+				Type:   events.ContainerEventType,
+				Action: "start",
+				Actor: events.Actor{
+					ID:         "c1",
+					Attributes: map[string]string{"trace": "4bf92f3577b34da6"},
+				},
+			})
+
+			var metric dto.Metric
+			err = p.metrics[""].events.WithLabelValues(events.ContainerEventType).Write(&metric)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value := metric.GetCounter().GetValue(); value != 1 {
+				t.Errorf("expected the event to be counted once, got %v", value)
+			}
+
+			var traceID string
+			for _, label := range metric.GetCounter().GetExemplar().GetLabel() {
+				if label.GetName() == exemplarTraceLabel {
+					traceID = label.GetValue()
+				}
+			}
+
+			if traceID != tc.exemplar {
+				t.Errorf("expected exemplar %q, got %q", tc.exemplar, traceID)
+			}
+		})
+	}
+}
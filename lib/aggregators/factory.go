@@ -9,7 +9,61 @@ func New(aggregatorType string, config interface{}) (agg Aggregator, err error)
 	case "fluentd":
 		agg, err = NewFluentd(config.(FluentdConfig))
 	case "stdout":
-		agg, err = NewStdout()
+		agg, err = NewStdout(config.(StdoutConfig))
+	case "statsd":
+		agg, err = NewStatsD(config.(StatsDConfig))
+	case "dogstatsd":
+		agg, err = NewDogStatsD(config.(DogStatsDConfig))
+	case "influxdb":
+		agg, err = NewInfluxDB(config.(InfluxDBConfig))
+	case "influxdb2":
+		agg, err = NewInfluxDB2(config.(InfluxDB2Config))
+	case "graphite":
+		agg, err = NewGraphite(config.(GraphiteConfig))
+	case "elasticsearch":
+		agg, err = NewElasticsearch(config.(ElasticsearchConfig))
+	case "kafka":
+		agg, err = NewKafka(config.(KafkaConfig))
+	case "nats":
+		agg, err = NewNATS(config.(NATSConfig))
+	case "webhook":
+		agg, err = NewWebhook(config.(WebhookConfig))
+	case "slack":
+		agg, err = NewSlack(config.(SlackConfig))
+	case "file":
+		agg, err = NewFile(config.(FileConfig))
+	case "syslog":
+		agg, err = NewSyslog(config.(SyslogConfig))
+	case "loki":
+		agg, err = NewLoki(config.(LokiConfig))
+	case "sqlite":
+		agg, err = NewSQLite(config.(SQLiteConfig))
+	case "postgres":
+		agg, err = NewPostgres(config.(PostgresConfig))
+	case "pubsub":
+		agg, err = NewPubSub(config.(PubSubConfig))
+	case "cloudwatchlogs":
+		agg, err = NewCloudWatchLogs(config.(CloudWatchLogsConfig))
+	case "emf":
+		agg, err = NewEMF(config.(EMFConfig))
+	case "otlpmetrics":
+		agg, err = NewOTLPMetrics(config.(OTLPMetricsConfig))
+	case "otlplogs":
+		agg, err = NewOTLPLogs(config.(OTLPLogsConfig))
+	case "sentry":
+		agg, err = NewSentry(config.(SentryConfig))
+	case "websocket":
+		agg, err = NewWebSocket(config.(WebSocketConfig))
+	case "sse":
+		agg, err = NewSSE(config.(SSEConfig))
+	case "grpc":
+		agg, err = NewGRPC(config.(GRPCConfig))
+	case "pushgateway":
+		agg, err = NewPushgateway(config.(PushgatewayConfig))
+	case "telegram":
+		agg, err = NewTelegram(config.(TelegramConfig))
+	case "mqtt":
+		agg, err = NewMQTT(config.(MQTTConfig))
 	default:
 		err = errors.Errorf(
 			"Unknown aggregator type %s", aggregatorType)
@@ -0,0 +1,91 @@
+package aggregators
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*File)(nil)
+
+type FileConfig struct {
+	Path string
+
+	// MaxSize (in bytes) and MaxAge trigger the rotation of the
+	// file. Zero disables the respective trigger.
+	MaxSize int64
+	MaxAge  time.Duration
+
+	// MaxBackups is the number of rotated files kept around. Zero
+	// keeps all of them.
+	MaxBackups int
+
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// File appends every event as a JSON line to a file, rotating it
+// based on its size and age.
+type File struct {
+	logger *log.Entry
+	file   *rotatingFile
+}
+
+func NewFile(cfg FileConfig) (agg File, err error) {
+	if cfg.Path == "" {
+		err = errors.New("A file path must be specified")
+		return
+	}
+
+	agg.file = &rotatingFile{
+		path:       cfg.Path,
+		maxSize:    cfg.MaxSize,
+		maxAge:     cfg.MaxAge,
+		maxBackups: cfg.MaxBackups,
+		compress:   cfg.Compress,
+	}
+
+	agg.logger = log.WithField("aggregator", "file")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (f File) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer f.file.Close()
+	defer f.file.Sync()
+
+	f.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			f.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				f.logger.Info("events channel closed")
+				return
+			}
+
+			line, err := json.Marshal(ev)
+			if err == nil {
+				_, err = f.file.Write(append(line, '\n'))
+			}
+			if err != nil {
+				f.logger.
+					WithError(err).
+					Error("Errored writing event to file")
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package aggregators_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// readEventFiles decodes the events of every file matching `pattern`,
+// gunzipping the compressed ones, returning them keyed by file.
+func readEventFiles(t *testing.T, pattern string) map[string][]events.Message {
+	t.Helper()
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files = map[string][]events.Message{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		var reader io.Reader = file
+		if strings.HasSuffix(path, ".gz") {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatalf("%s isn't gzipped: %v", path, err)
+			}
+			reader = gz
+		}
+
+		var scanner = bufio.NewScanner(reader)
+		for scanner.Scan() {
+			var ev events.Message
+			err := json.Unmarshal(scanner.Bytes(), &ev)
+			if err != nil {
+				t.Fatalf("%s has a malformed line %q: %v", path, scanner.Text(), err)
+			}
+
+			files[path] = append(files[path], ev)
+		}
+	}
+
+	return files
+}
+
+// containerEvents creates `n` container events with increasing ids.
+func containerEvents(n int) (evs []events.Message) {
+	for i := 0; i < n; i++ {
+		evs = append(evs, events.Message{
+			Type:   "container",
+			Action: "start",
+			Actor:  events.Actor{ID: strings.Repeat("a", i+1)},
+		})
+	}
+	return
+}
+
+// eventLine is the size of the JSON line of the first of
+// containerEvents.
+func eventLine(t *testing.T) int64 {
+	t.Helper()
+
+	line, err := json.Marshal(containerEvents(1)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return int64(len(line)) + 1
+}
+
+func TestFile(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "logs", "events.json")
+
+	agg, err := aggregators.NewFile(aggregators.FileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), agg, containerEvents(3)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files = readEventFiles(t, path+"*")
+	if len(files) != 1 || len(files[path]) != 3 {
+		t.Fatalf("expected 3 events in a single file, got %v", files)
+	}
+
+	for i, ev := range files[path] {
+		if ev.Actor.ID != strings.Repeat("a", i+1) {
+			t.Errorf("event %d: unexpected actor %s", i, ev.Actor.ID)
+		}
+	}
+}
+
+func TestFileRotatesBySize(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		compress bool
+		suffix   string
+	}{
+		{desc: "plain", suffix: ""},
+		{desc: "compressed", compress: true, suffix: ".gz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var path = filepath.Join(t.TempDir(), "events.json")
+
+			// the lines grow by a byte each, so the first two
+			// fit in a file but the third doesn't
+			agg, err := aggregators.NewFile(aggregators.FileConfig{
+				Path:     path,
+				MaxSize:  2*eventLine(t) + 1,
+				Compress: tc.compress,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), agg, containerEvents(6)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var files = readEventFiles(t, path+"*")
+
+			var backups []string
+			for file := range files {
+				if file == path {
+					continue
+				}
+
+				if !strings.HasSuffix(file, tc.suffix) || (tc.suffix == "" && strings.HasSuffix(file, ".gz")) {
+					t.Errorf("unexpected rotated file %s", file)
+				}
+				backups = append(backups, file)
+			}
+			sort.Strings(backups)
+
+			var total int
+			for _, file := range append(backups, path) {
+				total += len(files[file])
+				if len(files[file]) > 2 {
+					t.Errorf("%s holds %d events, beyond its max size", file, len(files[file]))
+				}
+			}
+
+			if len(backups) < 2 || total != 6 {
+				t.Errorf("expected 6 events spread over rotated files, got %d in %v", total, files)
+			}
+		})
+	}
+}
+
+func TestFileMaxBackups(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "events.json")
+
+	agg, err := aggregators.NewFile(aggregators.FileConfig{
+		Path:       path,
+		MaxSize:    1,
+		MaxBackups: 2,
+		Compress:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evs = containerEvents(5)
+	err = collectorstest.Run(context.Background(), agg, evs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files = readEventFiles(t, path+"*")
+	if len(files) != 3 {
+		t.Fatalf("expected the file and 2 backups, got %v", files)
+	}
+
+	// the newest backups, holding the 3rd and 4th events, are kept
+	var kept []string
+	for file, evs := range files {
+		if file != path {
+			kept = append(kept, evs[0].Actor.ID)
+		}
+	}
+	sort.Strings(kept)
+
+	if len(kept) != 2 || kept[0] != evs[2].Actor.ID || kept[1] != evs[3].Actor.ID {
+		t.Errorf("expected the newest backups to be kept, got %v", kept)
+	}
+}
+
+func TestFileRotatesByAge(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "events.json")
+
+	agg, err := aggregators.NewFile(aggregators.FileConfig{
+		Path:   path,
+		MaxAge: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mock = collectorstest.NewMock(2)
+		done = make(chan error, 1)
+		evs  = containerEvents(2)
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	mock.Push(evs[0])
+	time.Sleep(50 * time.Millisecond)
+	mock.Push(evs[1])
+	mock.Close()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var files = readEventFiles(t, path+"*")
+	if len(files) != 2 || len(files[path]) != 1 || files[path][0].Actor.ID != evs[1].Actor.ID {
+		t.Errorf("expected the first event to be rotated away, got %v", files)
+	}
+}
+
+func TestNewFileRequiresPath(t *testing.T) {
+	_, err := aggregators.NewFile(aggregators.FileConfig{})
+	if err == nil {
+		t.Fatal("expected an error without a path")
+	}
+}
@@ -0,0 +1,41 @@
+package aggregators
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// eventFilter selects events by type and action. Each entry is
+// either a type (`container`), a type and an action
+// (`container:die`) or an action of any type (`*:die`). Actions are
+// compared after being normalized. An empty filter matches every
+// event.
+type eventFilter []string
+
+// matches reports whether the event is selected by the filter.
+func (f eventFilter) matches(ev events.Message) bool {
+	if len(f) == 0 {
+		return true
+	}
+
+	var action = normalizeAction(ev.Action)
+	for _, entry := range f {
+		evType, evAction := entry, ""
+		if idx := strings.Index(entry, ":"); idx != -1 {
+			evType, evAction = entry[:idx], entry[idx+1:]
+		}
+
+		if evType != "*" && evType != ev.Type {
+			continue
+		}
+
+		if evAction != "" && evAction != "*" && evAction != action {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -1,6 +1,7 @@
 package aggregators
 
 import (
+	"context"
 	"strconv"
 
 	"github.com/docker/docker/api/types/events"
@@ -10,6 +11,8 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+var _ Aggregator = (*Fluentd)(nil)
+
 type FluentdConfig struct {
 	Host      string
 	Port      int
@@ -61,15 +64,34 @@ func ConvertEventToMap(ev events.Message) map[string]string {
 	return evMap
 }
 
-func (f Fluentd) Run(evs <-chan events.Message, errs <-chan error) {
+func (f Fluentd) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
 	var prefix = f.tagPrefix + ".container"
 
+	defer func() {
+		closeErr := f.fluent.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
 	f.logger.Info("listening to events")
 	for {
 		select {
-		case err := <-errs:
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
 			f.logger.WithError(err).Info("errored")
-		case ev := <-evs:
+		case ev, ok := <-evs:
+			if !ok {
+				f.logger.Info("events channel closed")
+				return
+			}
+
 			f.logger.Info("received evt")
 			err := f.fluent.Post(prefix, ConvertEventToMap(ev))
 			if err != nil {
@@ -80,6 +102,4 @@ func (f Fluentd) Run(evs <-chan events.Message, errs <-chan error) {
 			f.logger.Info("evt sent to fluentd")
 		}
 	}
-
-	return
 }
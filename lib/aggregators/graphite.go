@@ -0,0 +1,187 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultGraphiteDialTimeout = 5 * time.Second
+
+var (
+	_ Aggregator    = (*Graphite)(nil)
+	_ HealthChecker = (*Graphite)(nil)
+)
+
+type GraphiteConfig struct {
+	Host string
+	Port int
+
+	// Prefix is prepended to every metric name. Defaults to
+	// "devents", resulting in `devents.docker.<type>.<action>`.
+	Prefix string
+
+	// FlushInterval is how often the counters are sent to carbon.
+	FlushInterval time.Duration
+
+	// DialTimeout bounds the time spent (re)connecting to carbon.
+	DialTimeout time.Duration
+}
+
+// Graphite keeps a running count of the events received per type and
+// action and periodically sends them to a Carbon endpoint using the
+// plaintext protocol (`<name> <value> <timestamp>`).
+//
+// The counts are cumulative, so `nonNegativeDerivative()` should be
+// used to graph rates. When the connection drops the counts are kept
+// and a new connection is made on the next flush.
+type Graphite struct {
+	logger      *log.Entry
+	addr        string
+	prefix      string
+	interval    time.Duration
+	dialTimeout time.Duration
+
+	// down is set to 1 while the counts can't be sent to carbon.
+	down *int32
+}
+
+func NewGraphite(cfg GraphiteConfig) (agg Graphite, err error) {
+	agg.addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	agg.prefix = cfg.Prefix
+	if agg.prefix == "" {
+		agg.prefix = "devents"
+	}
+
+	agg.interval = cfg.FlushInterval
+	if agg.interval <= 0 {
+		agg.interval = defaultFlushInterval
+	}
+
+	agg.dialTimeout = cfg.DialTimeout
+	if agg.dialTimeout <= 0 {
+		agg.dialTimeout = defaultGraphiteDialTimeout
+	}
+
+	agg.down = new(int32)
+	agg.logger = log.WithField("aggregator", "graphite")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (g Graphite) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var (
+		conn   net.Conn
+		counts = map[string]uint64{}
+		ticker = time.NewTicker(g.interval)
+	)
+	defer ticker.Stop()
+
+	var flush = func() {
+		if len(counts) == 0 {
+			return
+		}
+
+		if conn == nil {
+			c, err := net.DialTimeout("tcp", g.addr, g.dialTimeout)
+			if err != nil {
+				g.logger.
+					WithError(err).
+					WithField("addr", g.addr).
+					Error("Couldn't connect to graphite")
+				atomic.StoreInt32(g.down, 1)
+				return
+			}
+
+			conn = c
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(g.dialTimeout))
+		_, err := conn.Write(g.encode(counts, time.Now()))
+		if err != nil {
+			g.logger.
+				WithError(err).
+				Error("Errored sending metrics to graphite, reconnecting on next flush")
+			conn.Close()
+			conn = nil
+			atomic.StoreInt32(g.down, 1)
+			return
+		}
+
+		atomic.StoreInt32(g.down, 0)
+	}
+
+	defer func() {
+		flush()
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	g.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flush()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			g.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				g.logger.Info("events channel closed")
+				return
+			}
+
+			counts[g.metricName(ev)]++
+		}
+	}
+}
+
+// Healthy reports whether the last attempt to send the counts to
+// carbon succeeded.
+func (g Graphite) Healthy() bool {
+	return atomic.LoadInt32(g.down) == 0
+}
+
+// metricName builds `<prefix>.docker.<type>.<action>` for an event.
+func (g Graphite) metricName(ev events.Message) string {
+	return g.prefix + ".docker." +
+		statsdSegment(ev.Type) + "." +
+		statsdSegment(normalizeAction(ev.Action))
+}
+
+// encode renders the counts as plaintext protocol lines, sorted by
+// name so that the output is stable.
+func (g Graphite) encode(counts map[string]uint64, now time.Time) []byte {
+	var (
+		buf   bytes.Buffer
+		names = make([]string, 0, len(counts))
+	)
+
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s %d %d\n", name, counts[name], now.Unix())
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,167 @@
+package aggregators_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// carbonLine is a plaintext protocol line received by a carbon
+// listener, along with the connection it came through.
+type carbonLine struct {
+	conn   net.Conn
+	fields []string
+}
+
+// newCarbonListener accepts connections, sending every line received
+// through the returned channel.
+func newCarbonListener(t *testing.T) (listener net.Listener, lines <-chan carbonLine) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var ch = make(chan carbonLine, 1024)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				var scanner = bufio.NewScanner(conn)
+				for scanner.Scan() {
+					ch <- carbonLine{conn: conn, fields: strings.Fields(scanner.Text())}
+				}
+			}()
+		}
+	}()
+
+	return listener, ch
+}
+
+// waitCarbonValue waits for a line reporting `value` for `name`.
+func waitCarbonValue(t *testing.T, lines <-chan carbonLine, name, value string) carbonLine {
+	t.Helper()
+
+	var timeout = time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-lines:
+			if len(line.fields) != 3 {
+				t.Fatalf("malformed line %q", line.fields)
+			}
+
+			if line.fields[0] == name && line.fields[1] == value {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s %s", name, value)
+		}
+	}
+}
+
+func newGraphite(t *testing.T, port int) aggregators.Graphite {
+	t.Helper()
+
+	agg, err := aggregators.NewGraphite(aggregators.GraphiteConfig{
+		Host:          "127.0.0.1",
+		Port:          port,
+		Prefix:        "test",
+		FlushInterval: 10 * time.Millisecond,
+		DialTimeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return agg
+}
+
+func TestGraphite(t *testing.T) {
+	listener, lines := newCarbonListener(t)
+	var agg = newGraphite(t, listener.Addr().(*net.TCPAddr).Port)
+
+	var before = time.Now().Unix()
+	err := collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "container", Action: "exec_start: sh -c ls"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lines are sorted by name within a flush
+	waitCarbonValue(t, lines, "test.docker.container.exec_start", "1")
+
+	var line = waitCarbonValue(t, lines, "test.docker.container.start", "2")
+	timestamp, err := strconv.ParseInt(line.fields[2], 10, 64)
+	if err != nil || timestamp < before {
+		t.Errorf("unexpected timestamp %s", line.fields[2])
+	}
+}
+
+func TestGraphiteReconnects(t *testing.T) {
+	listener, lines := newCarbonListener(t)
+	var (
+		agg  = newGraphite(t, listener.Addr().(*net.TCPAddr).Port)
+		mock = collectorstest.NewMock(10)
+		done = make(chan error, 1)
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	mock.Push(events.Message{Type: "container", Action: "start"})
+	var first = waitCarbonValue(t, lines, "test.docker.container.start", "1")
+
+	first.conn.Close()
+
+	mock.Push(events.Message{Type: "container", Action: "start"})
+	var second = waitCarbonValue(t, lines, "test.docker.container.start", "2")
+	if second.conn == first.conn {
+		t.Error("expected counts to be sent through a new connection")
+	}
+
+	mock.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGraphiteUnreachable(t *testing.T) {
+	listener, _ := newCarbonListener(t)
+	var port = listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var agg = newGraphite(t, port)
+	if !agg.Healthy() {
+		t.Fatal("expected graphite to start healthy")
+	}
+
+	err := collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if agg.Healthy() {
+		t.Error("expected graphite to be unhealthy after failing to connect")
+	}
+}
@@ -0,0 +1,225 @@
+package aggregators
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/cirocosta/devents/lib/api"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	_ Aggregator = (*GRPC)(nil)
+	_ Reloader   = (*GRPC)(nil)
+)
+
+type GRPCConfig struct {
+	// Addr is the address the server binds to (e.g., `:9106`).
+	Addr string
+
+	// TLSCertFile and TLSKeyFile, when both set, make the server
+	// accept TLS connections only.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// BufferSize is the number of events that can be queued for a
+	// client before it's considered too slow and disconnected.
+	BufferSize int
+}
+
+// GRPC runs a gRPC server implementing the `devents.Events` service
+// (see lib/api/devents.proto): clients call `Subscribe` with the
+// types and actions they're interested in and get the matching
+// events streamed back as protobuf messages.
+type GRPC struct {
+	logger      *log.Entry
+	addr        string
+	options     []grpc.ServerOption
+	keyPair     *keyPair
+	broadcaster *broadcaster
+}
+
+func NewGRPC(cfg GRPCConfig) (agg GRPC, err error) {
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		err = errors.New("Both a grpc tls cert and key must be specified")
+		return
+	}
+
+	if cfg.TLSCertFile != "" {
+		agg.keyPair, err = loadKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return
+		}
+
+		agg.options = append(agg.options,
+			grpc.Creds(credentials.NewTLS(agg.keyPair.tlsConfig())))
+	}
+
+	agg.addr = cfg.Addr
+	agg.broadcaster = newBroadcaster(cfg.BufferSize)
+	agg.logger = log.WithField("aggregator", "grpc")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+// Reload reloads the TLS certificate of the server, if any, from
+// its files.
+func (g GRPC) Reload() (err error) {
+	if g.keyPair == nil {
+		return
+	}
+
+	return g.keyPair.reload()
+}
+
+func (g GRPC) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	listener, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't listen on %s", g.addr)
+		return
+	}
+
+	var (
+		server    = grpc.NewServer(g.options...)
+		serveErrs = make(chan error, 1)
+	)
+
+	api.RegisterEventsServer(server, g)
+	go func() {
+		serveErrs <- server.Serve(listener)
+	}()
+
+	defer func() {
+		// Closing the feeds makes every Subscribe call return so
+		// that the graceful stop doesn't wait for the clients.
+		g.broadcaster.close()
+		stopGRPCServer(server, defaultPrometheusShutdownTimeout)
+	}()
+
+	g.logger.WithField("addr", g.addr).Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-serveErrs:
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			g.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				g.logger.Info("events channel closed")
+				return
+			}
+
+			if dropped := g.broadcaster.publish(ev); dropped > 0 {
+				g.logger.
+					WithField("clients", dropped).
+					Warn("disconnecting slow clients")
+			}
+		}
+	}
+}
+
+// Subscribe implements api.EventsServer, streaming the events
+// selected by the request until the client goes away or gets
+// dropped.
+func (g GRPC) Subscribe(req *api.SubscribeRequest, stream api.Events_SubscribeServer) (err error) {
+	var (
+		sub    = g.broadcaster.subscribe(subscribeFilter(req))
+		logger = g.logger
+	)
+	if client, ok := peer.FromContext(stream.Context()); ok {
+		logger = logger.WithField("client", client.Addr.String())
+	}
+	defer g.broadcaster.unsubscribe(sub)
+
+	logger.Info("client subscribed")
+	defer logger.Info("client unsubscribed")
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return
+		case ev, ok := <-sub.evs:
+			if !ok {
+				err = grpc.Errorf(codes.Unavailable,
+					"subscription terminated by the server")
+				return
+			}
+
+			err = stream.Send(protoEvent(ev))
+			if err != nil {
+				logger.WithError(err).Warn("Errored sending event")
+				return
+			}
+		}
+	}
+}
+
+// subscribeFilter translates the types and actions of a request
+// into an eventFilter selecting the events of any of the types with
+// any of the actions.
+func subscribeFilter(req *api.SubscribeRequest) (filter eventFilter) {
+	var types, actions = req.GetTypes(), req.GetActions()
+
+	switch {
+	case len(types) == 0 && len(actions) == 0:
+		return
+	case len(actions) == 0:
+		return eventFilter(types)
+	case len(types) == 0:
+		types = []string{"*"}
+	}
+
+	for _, evType := range types {
+		for _, action := range actions {
+			filter = append(filter, evType+":"+action)
+		}
+	}
+
+	return
+}
+
+// protoEvent converts an event to its protobuf representation.
+func protoEvent(ev events.Message) *api.Event {
+	return &api.Event{
+		Type:   ev.Type,
+		Action: ev.Action,
+		Actor: &api.Actor{
+			Id:         ev.Actor.ID,
+			Attributes: ev.Actor.Attributes,
+		},
+		TimeNano: ev.TimeNano,
+	}
+}
+
+// stopGRPCServer stops the server gracefully, closing the remaining
+// connections if that takes longer than `timeout`.
+func stopGRPCServer(server *grpc.Server, timeout time.Duration) {
+	var stopped = make(chan struct{})
+	go func() {
+		defer close(stopped)
+		server.GracefulStop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		server.Stop()
+		<-stopped
+	}
+}
@@ -0,0 +1,219 @@
+package aggregators
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/api"
+	"github.com/docker/docker/api/types/events"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+)
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and
+// its key to `dir`, returning their paths and a pool trusting it.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "devents"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	err = ioutil.WriteFile(certFile, certPEM, 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return
+}
+
+// subscribe calls Subscribe on the server at `addr`.
+func subscribe(t *testing.T, addr string, creds grpc.DialOption, req *api.SubscribeRequest) api.Events_SubscribeClient {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	conn, err := grpc.DialContext(ctx, addr, creds, grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	stream, err := api.NewEventsClient(conn).Subscribe(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stream
+}
+
+// expectEvents receives events from `stream`, failing unless their
+// actions are `actions`.
+func expectEvents(t *testing.T, stream api.Events_SubscribeClient, actions ...string) {
+	t.Helper()
+
+	for _, action := range actions {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ev.GetAction() != action {
+			t.Errorf("expected %s, got %s", action, ev.GetAction())
+		}
+	}
+}
+
+func TestGRPCSubscribe(t *testing.T) {
+	var addr = freeAddr(t)
+
+	agg, err := NewGRPC(GRPCConfig{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, stop := startStreaming(t, addr, agg.Run)
+
+	var (
+		insecure = grpc.WithInsecure()
+		all      = subscribe(t, addr, insecure, &api.SubscribeRequest{})
+		byType   = subscribe(t, addr, insecure, &api.SubscribeRequest{Types: []string{"network"}})
+		byAction = subscribe(t, addr, insecure, &api.SubscribeRequest{Actions: []string{"destroy"}})
+		both     = subscribe(t, addr, insecure, &api.SubscribeRequest{
+			Types:   []string{"container"},
+			Actions: []string{"start", "exec_start"},
+		})
+	)
+	waitSubscribers(t, agg.broadcaster, 4)
+
+	evs <- events.Message{
+		Type:     "container",
+		Action:   "start",
+		TimeNano: 1500000000000000001,
+		Actor:    events.Actor{ID: "abc", Attributes: map[string]string{"name": "web"}},
+	}
+	evs <- events.Message{Type: "network", Action: "connect"}
+	evs <- events.Message{Type: "container", Action: "exec_start: sh -c ls"}
+	evs <- events.Message{Type: "volume", Action: "destroy"}
+	evs <- events.Message{Type: "container", Action: "destroy"}
+
+	ev, err := all.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ev.GetType() != "container" || ev.GetAction() != "start" || ev.GetTimeNano() != 1500000000000000001 ||
+		ev.GetActor().GetId() != "abc" || ev.GetActor().GetAttributes()["name"] != "web" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	expectEvents(t, all, "connect", "exec_start: sh -c ls", "destroy", "destroy")
+	expectEvents(t, byType, "connect")
+	expectEvents(t, byAction, "destroy", "destroy")
+	expectEvents(t, both, "start", "exec_start: sh -c ls")
+
+	// stopping terminates the subscriptions
+	stop()
+
+	_, err = both.Recv()
+	if code := grpc.Code(err); code != codes.Unavailable {
+		t.Errorf("expected the subscription to be terminated, got %v", err)
+	}
+}
+
+func TestGRPCTLS(t *testing.T) {
+	var (
+		addr                    = freeAddr(t)
+		certFile, keyFile, pool = writeTestCert(t, t.TempDir())
+	)
+
+	agg, err := NewGRPC(GRPCConfig{
+		Addr:        addr,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, stop := startStreaming(t, addr, agg.Run)
+	defer stop()
+
+	var stream = subscribe(t, addr,
+		grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(pool, "")),
+		&api.SubscribeRequest{})
+	waitSubscribers(t, agg.broadcaster, 1)
+
+	evs <- events.Message{Type: "container", Action: "start"}
+	expectEvents(t, stream, "start")
+
+	if err := agg.Reload(); err != nil {
+		t.Errorf("expected the certificate to be reloaded, got %v", err)
+	}
+}
+
+func TestNewGRPCInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  GRPCConfig
+	}{
+		{desc: "cert without key", cfg: GRPCConfig{TLSCertFile: "cert.pem"}},
+		{desc: "key without cert", cfg: GRPCConfig{TLSKeyFile: "key.pem"}},
+		{desc: "missing files", cfg: GRPCConfig{TLSCertFile: "missing.pem", TLSKeyFile: "missing.pem"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewGRPC(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package aggregators
+
+import (
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+const (
+	// otherImageLabel is the value of the image labels of the
+	// images whose repository isn't allowed.
+	otherImageLabel = "other"
+
+	// missingImageLabel is the value of the image labels of the
+	// events not naming an image (e.g., those naming it by id).
+	missingImageLabel = "none"
+
+	// imageSizeAttribute is the attribute enriched image events
+	// carry the size (in bytes) of their image under.
+	imageSizeAttribute = "size"
+)
+
+// imageLabels are the labels of the image actions counter telling
+// the image acted upon, out of its name.
+var imageLabels = []string{"registry", "repo", "tag"}
+
+// imageAllowlist is the set of repositories whose images are told
+// apart in the image metrics, which bounds the cardinality of their
+// labels. A nil allowlist leaves the metrics without image labels.
+type imageAllowlist map[string]bool
+
+// newImageAllowlist creates the allowlist of the given repositories,
+// which are normalized (e.g., `nginx` stands for
+// `docker.io/library/nginx`).
+func newImageAllowlist(repos []string) (allowlist imageAllowlist, err error) {
+	if len(repos) == 0 {
+		return
+	}
+
+	allowlist = imageAllowlist{}
+	for _, repo := range repos {
+		var named reference.Named
+
+		named, err = reference.ParseNormalizedNamed(repo)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Malformed image repository %s", repo)
+			return
+		}
+
+		allowlist[named.Name()] = true
+	}
+
+	return
+}
+
+// labels returns the names of the image labels, if any.
+func (a imageAllowlist) labels() []string {
+	if a == nil {
+		return nil
+	}
+
+	return imageLabels
+}
+
+// values returns the values of the image labels for an image event:
+// the registry, repository and tag of the image named by its `name`
+// attribute, `other` for images outside the allowlist and `none` for
+// events that don't name an image.
+func (a imageAllowlist) values(ev events.Message) []string {
+	if a == nil {
+		return nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(ev.Actor.Attributes["name"])
+	if err != nil {
+		return []string{missingImageLabel, missingImageLabel, missingImageLabel}
+	}
+
+	if !a[named.Name()] {
+		return []string{otherImageLabel, otherImageLabel, otherImageLabel}
+	}
+
+	var tag = missingImageLabel
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	} else if _, digested := named.(reference.Digested); !digested {
+		tag = "latest"
+	}
+
+	return []string{reference.Domain(named), reference.Path(named), tag}
+}
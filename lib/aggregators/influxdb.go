@@ -0,0 +1,127 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*InfluxDB)(nil)
+
+type InfluxDBConfig struct {
+	// URL is the base address of the InfluxDB server (e.g.,
+	// http://localhost:8086).
+	URL string
+
+	Database        string
+	RetentionPolicy string
+	Username        string
+	Password        string
+
+	// BatchSize and FlushInterval control how many points are
+	// written at once and how long they may wait to be written.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// InfluxDB writes events as line protocol points to the `/write`
+// endpoint of an InfluxDB 1.x server.
+type InfluxDB struct {
+	logger   *log.Entry
+	client   *http.Client
+	writeURL string
+	username string
+	password string
+	batch    batchConfig
+}
+
+func NewInfluxDB(cfg InfluxDBConfig) (agg InfluxDB, err error) {
+	if cfg.Database == "" {
+		err = errors.New("An influxdb database must be specified")
+		return
+	}
+
+	writeURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse influxdb url %s", cfg.URL)
+		return
+	}
+
+	writeURL.Path = strings.TrimSuffix(writeURL.Path, "/") + "/write"
+
+	var query = url.Values{}
+	query.Set("db", cfg.Database)
+	query.Set("precision", "ns")
+	if cfg.RetentionPolicy != "" {
+		query.Set("rp", cfg.RetentionPolicy)
+	}
+	writeURL.RawQuery = query.Encode()
+
+	agg.writeURL = writeURL.String()
+	agg.username = cfg.Username
+	agg.password = cfg.Password
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "influxdb")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (i InfluxDB) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	return runBatched(ctx, i.logger, evs, errs, i.batch, func(batch []events.Message) error {
+		return i.write(ctx, batch)
+	})
+}
+
+// write sends a batch of events as line protocol points.
+func (i InfluxDB) write(ctx context.Context, batch []events.Message) (err error) {
+	var body bytes.Buffer
+	for _, ev := range batch {
+		encodeLineProtocol(&body, ev)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.writeURL, &body)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create influxdb write request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.username != "" {
+		req.SetBasicAuth(i.username, i.password)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't write points to influxdb")
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"influxdb write failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		return
+	}
+
+	return
+}
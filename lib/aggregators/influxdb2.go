@@ -0,0 +1,161 @@
+package aggregators
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*InfluxDB2)(nil)
+
+type InfluxDB2Config struct {
+	// URL is the base address of the InfluxDB server (e.g.,
+	// https://eu-central-1-1.aws.cloud2.influxdata.com).
+	URL string
+
+	Org    string
+	Bucket string
+	Token  string
+
+	// BatchSize and FlushInterval control how many points are
+	// written at once and how long they may wait to be written.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// RetryAttempts and RetryBackoff control how writes that
+	// failed with transient errors (5xx, network) are retried.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+}
+
+// InfluxDB2 writes events as gzip-compressed line protocol points to
+// the `/api/v2/write` endpoint of an InfluxDB 2.x server (or InfluxDB
+// Cloud), authenticating with an API token.
+type InfluxDB2 struct {
+	logger   *log.Entry
+	client   *http.Client
+	writeURL string
+	token    string
+	batch    batchConfig
+	retry    retryConfig
+}
+
+func NewInfluxDB2(cfg InfluxDB2Config) (agg InfluxDB2, err error) {
+	if cfg.Org == "" || cfg.Bucket == "" {
+		err = errors.New(
+			"Both an influxdb org and bucket must be specified")
+		return
+	}
+
+	writeURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse influxdb url %s", cfg.URL)
+		return
+	}
+
+	writeURL.Path = strings.TrimSuffix(writeURL.Path, "/") + "/api/v2/write"
+
+	var query = url.Values{}
+	query.Set("org", cfg.Org)
+	query.Set("bucket", cfg.Bucket)
+	query.Set("precision", "ns")
+	writeURL.RawQuery = query.Encode()
+
+	agg.writeURL = writeURL.String()
+	agg.token = cfg.Token
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+	agg.retry = retryConfig{
+		Attempts: cfg.RetryAttempts,
+		Backoff:  cfg.RetryBackoff,
+	}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "influxdb2")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (i InfluxDB2) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	return runBatched(ctx, i.logger, evs, errs, i.batch, func(batch []events.Message) error {
+		return i.write(ctx, batch)
+	})
+}
+
+// write sends a batch of events as line protocol points, retrying
+// transient failures.
+func (i InfluxDB2) write(ctx context.Context, batch []events.Message) (err error) {
+	var (
+		body bytes.Buffer
+		gz   = gzip.NewWriter(&body)
+		raw  bytes.Buffer
+	)
+
+	for _, ev := range batch {
+		encodeLineProtocol(&raw, ev)
+	}
+
+	_, err = raw.WriteTo(gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't compress influxdb points")
+		return
+	}
+
+	return retry(ctx, i.retry, func() error {
+		return i.post(ctx, body.Bytes())
+	})
+}
+
+func (i InfluxDB2) post(ctx context.Context, payload []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.writeURL, bytes.NewReader(payload))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create influxdb write request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't write points to influxdb")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"influxdb write failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
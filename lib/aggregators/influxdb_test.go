@@ -0,0 +1,147 @@
+package aggregators_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// recordedRequest is what an httptest server received.
+type recordedRequest struct {
+	method string
+	url    string
+	header http.Header
+	body   string
+}
+
+// newRecordingServer records every request it receives, answering
+// them with the given statuses in order (200 once exhausted).
+func newRecordingServer(t *testing.T, statuses ...int) (url string, received func() []recordedRequest) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []recordedRequest
+	)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, recordedRequest{
+			method: r.Method,
+			url:    r.URL.String(),
+			header: r.Header,
+			body:   string(body),
+		})
+		if len(requests) <= len(statuses) {
+			w.WriteHeader(statuses[len(requests)-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func TestInfluxDB(t *testing.T) {
+	url, received := newRecordingServer(t, http.StatusNoContent, http.StatusNoContent)
+
+	agg, err := aggregators.NewInfluxDB(aggregators.InfluxDBConfig{
+		URL:             url + "/influx/",
+		Database:        "docker",
+		RetentionPolicy: "weekly",
+		Username:        "user",
+		Password:        "secret",
+		BatchSize:       2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{
+			Type:     "container",
+			Action:   "start",
+			TimeNano: 1500000000000000001,
+			Actor: events.Actor{
+				ID: "abc",
+				Attributes: map[string]string{
+					"name":  "my web",
+					"image": `nginx:"latest"`,
+				},
+			},
+		},
+		events.Message{
+			Type:   "container",
+			Action: "exec_start: sh -c ls",
+			Time:   1500000000,
+			Actor:  events.Actor{ID: "abc"},
+		},
+		events.Message{
+			Type:     "network",
+			Action:   "connect",
+			TimeNano: 1500000000000000002,
+			Actor:    events.Actor{ID: "def"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(requests))
+	}
+
+	var expected = []string{
+		`docker_events,action=start,name=my\ web,type=container count=1i,id="abc",attrs.image="nginx:\"latest\"",attrs.name="my web" 1500000000000000001` + "\n" +
+			`docker_events,action=exec_start,type=container count=1i,id="abc" 1500000000000000000` + "\n",
+		`docker_events,action=connect,type=network count=1i,id="def" 1500000000000000002` + "\n",
+	}
+
+	for i, req := range requests {
+		if req.method != http.MethodPost {
+			t.Errorf("expected POST, got %s", req.method)
+		}
+
+		if !strings.HasPrefix(req.url, "/influx/write?") ||
+			!strings.Contains(req.url, "db=docker") ||
+			!strings.Contains(req.url, "rp=weekly") ||
+			!strings.Contains(req.url, "precision=ns") {
+			t.Errorf("unexpected write url %s", req.url)
+		}
+
+		user, password, ok := (&http.Request{Header: req.header}).BasicAuth()
+		if !ok || user != "user" || password != "secret" {
+			t.Errorf("expected basic auth user:secret, got %q:%q", user, password)
+		}
+
+		if req.body != expected[i] {
+			t.Errorf("batch %d: expected\n%s\ngot\n%s", i, expected[i], req.body)
+		}
+	}
+}
+
+func TestInfluxDBRequiresDatabase(t *testing.T) {
+	_, err := aggregators.NewInfluxDB(aggregators.InfluxDBConfig{
+		URL: "http://localhost:8086",
+	})
+	if err == nil {
+		t.Fatal("expected an error without a database")
+	}
+}
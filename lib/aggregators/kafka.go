@@ -0,0 +1,236 @@
+package aggregators
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*Kafka)(nil)
+
+var kafkaCompressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+}
+
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+
+	// Key selects what each message is keyed by, which determines
+	// the partition it lands on: `actor` (the id of the container,
+	// image, network, ... - the default), `type` or `none`. Keying
+	// by actor preserves the ordering of the events of a resource.
+	Key string
+
+	// Compression is the codec used for the produced batches: one
+	// of `none` (default), `gzip`, `snappy` or `lz4`.
+	Compression string
+
+	// FlushInterval and FlushMessages control how the producer
+	// batches messages before sending them to the brokers.
+	FlushInterval time.Duration
+	FlushMessages int
+
+	// TLS enables TLS when connecting to the brokers.
+	TLS bool
+
+	// SASLUser and SASLPassword enable SASL/PLAIN authentication.
+	SASLUser     string
+	SASLPassword string
+
+	// Format is how events are encoded in the messages: `json`
+	// (the default) or `cloudevents`, which produces them as
+	// structured CloudEvents whose source is Source.
+	Format string
+	Source string
+
+	// DeadLetter configures where the events of the messages that
+	// couldn't be produced go.
+	DeadLetter DeadLetterConfig
+}
+
+// Kafka produces every event as a JSON message to a topic using an
+// asynchronous, batching producer.
+type Kafka struct {
+	logger     *log.Entry
+	producer   sarama.AsyncProducer
+	topic      string
+	key        string
+	encoder    eventEncoder
+	deadLetter *deadLetter
+}
+
+func NewKafka(cfg KafkaConfig) (agg Kafka, err error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		err = errors.New(
+			"Both kafka brokers and topic must be specified")
+		return
+	}
+
+	switch cfg.Key {
+	case "":
+		cfg.Key = "actor"
+	case "actor", "type", "none":
+	default:
+		err = errors.Errorf(
+			"Unknown kafka key strategy %s", cfg.Key)
+		return
+	}
+
+	codec, present := kafkaCompressionCodecs[cfg.Compression]
+	if !present {
+		err = errors.Errorf(
+			"Unknown kafka compression codec %s", cfg.Compression)
+		return
+	}
+
+	var config = sarama.NewConfig()
+	config.ClientID = "devents"
+	config.Version = sarama.V0_10_0_0
+	config.Producer.Compression = codec
+	config.Producer.Flush.Frequency = cfg.FlushInterval
+	config.Producer.Flush.Messages = cfg.FlushMessages
+	config.Producer.Return.Successes = false
+	config.Producer.Return.Errors = true
+
+	if cfg.FlushInterval <= 0 {
+		config.Producer.Flush.Frequency = 500 * time.Millisecond
+	}
+
+	if cfg.TLS {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = &tls.Config{}
+	}
+
+	if cfg.SASLUser != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = cfg.SASLUser
+		config.Net.SASL.Password = cfg.SASLPassword
+	}
+
+	agg.producer, err = sarama.NewAsyncProducer(cfg.Brokers, config)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create kafka producer for brokers %v", cfg.Brokers)
+		return
+	}
+
+	agg.encoder, err = newEventEncoder(cfg.Format, cfg.Source)
+	if err != nil {
+		agg.producer.Close()
+		return
+	}
+
+	agg.deadLetter, err = newDeadLetter(cfg.DeadLetter, "kafka")
+	if err != nil {
+		agg.producer.Close()
+		return
+	}
+
+	agg.topic = cfg.Topic
+	agg.key = cfg.Key
+	agg.logger = log.WithField("aggregator", "kafka")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (k Kafka) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer k.deadLetter.close()
+	defer func() {
+		k.producer.AsyncClose()
+		for perr := range k.producer.Errors() {
+			k.logger.
+				WithError(perr.Err).
+				Error("Errored flushing pending kafka messages")
+			k.deadLetterMessage(perr.Msg)
+		}
+	}()
+
+	k.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case perr := <-k.producer.Errors():
+			k.logger.
+				WithError(perr.Err).
+				Error("Errored producing message to kafka")
+			k.deadLetterMessage(perr.Msg)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			k.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				k.logger.Info("events channel closed")
+				return
+			}
+
+			msg, merr := k.message(ev)
+			if merr != nil {
+				k.logger.
+					WithError(merr).
+					Error("Couldn't encode event")
+				continue
+			}
+
+			select {
+			case k.producer.Input() <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// message builds the kafka message carrying an event.
+func (k Kafka) message(ev events.Message) (msg *sarama.ProducerMessage, err error) {
+	value, err := k.encoder.encode(ev)
+	if err != nil {
+		return
+	}
+
+	msg = &sarama.ProducerMessage{
+		Topic:    k.topic,
+		Value:    sarama.ByteEncoder(value),
+		Metadata: ev,
+	}
+
+	if ev.TimeNano != 0 {
+		msg.Timestamp = time.Unix(0, ev.TimeNano)
+	}
+
+	switch k.key {
+	case "actor":
+		msg.Key = sarama.StringEncoder(ev.Actor.ID)
+	case "type":
+		msg.Key = sarama.StringEncoder(ev.Type)
+	}
+
+	return
+}
+
+// deadLetterMessage dead-letters the event carried by a message that
+// couldn't be produced.
+func (k Kafka) deadLetterMessage(msg *sarama.ProducerMessage) {
+	if msg == nil {
+		return
+	}
+
+	if ev, ok := msg.Metadata.(events.Message); ok {
+		k.deadLetter.add(ev)
+	}
+}
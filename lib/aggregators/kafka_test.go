@@ -0,0 +1,207 @@
+package aggregators
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// mockProducer is an AsyncProducer that keeps the messages it's given
+// instead of sending them to a broker.
+type mockProducer struct {
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func newMockProducer(size int) *mockProducer {
+	return &mockProducer{
+		input:  make(chan *sarama.ProducerMessage, size),
+		errors: make(chan *sarama.ProducerError, size),
+	}
+}
+
+func (m *mockProducer) AsyncClose()                               { close(m.errors) }
+func (m *mockProducer) Close() error                              { m.AsyncClose(); return nil }
+func (m *mockProducer) Input() chan<- *sarama.ProducerMessage     { return m.input }
+func (m *mockProducer) Successes() <-chan *sarama.ProducerMessage { return nil }
+func (m *mockProducer) Errors() <-chan *sarama.ProducerError      { return m.errors }
+
+// produced returns the messages the producer was given.
+func (m *mockProducer) produced() (msgs []*sarama.ProducerMessage) {
+	close(m.input)
+	for msg := range m.input {
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+func newTestKafka(t *testing.T, producer sarama.AsyncProducer, key, format string, deadLetterCfg DeadLetterConfig) Kafka {
+	t.Helper()
+
+	encoder, err := newEventEncoder(format, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetter, err := newDeadLetter(deadLetterCfg, "kafka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Kafka{
+		logger:     log.WithField("aggregator", "kafka"),
+		producer:   producer,
+		topic:      "docker-events",
+		key:        key,
+		encoder:    encoder,
+		deadLetter: deadLetter,
+	}
+}
+
+// runKafka feeds `evs` to `agg` until they're all consumed.
+func runKafka(t *testing.T, agg Kafka, evs ...events.Message) {
+	t.Helper()
+
+	var ch = make(chan events.Message, len(evs))
+	for _, ev := range evs {
+		ch <- ev
+	}
+	close(ch)
+
+	err := agg.Run(context.Background(), ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKafkaMessages(t *testing.T) {
+	var evs = []events.Message{
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}, TimeNano: 1500000000000000000},
+		{Type: "network", Action: "connect", Actor: events.Actor{ID: "def"}},
+	}
+
+	var testCases = []struct {
+		key      string
+		expected []string
+	}{
+		{key: "actor", expected: []string{"abc", "def"}},
+		{key: "type", expected: []string{"container", "network"}},
+		{key: "none", expected: []string{"", ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.key, func(t *testing.T) {
+			var producer = newMockProducer(len(evs))
+			runKafka(t, newTestKafka(t, producer, tc.key, "json", DeadLetterConfig{}), evs...)
+
+			var msgs = producer.produced()
+			if len(msgs) != len(evs) {
+				t.Fatalf("expected %d messages, got %d", len(evs), len(msgs))
+			}
+
+			for i, msg := range msgs {
+				if msg.Topic != "docker-events" {
+					t.Errorf("expected topic docker-events, got %s", msg.Topic)
+				}
+
+				var key string
+				if msg.Key != nil {
+					encoded, _ := msg.Key.Encode()
+					key = string(encoded)
+				}
+				if key != tc.expected[i] {
+					t.Errorf("message %d: expected key %q, got %q", i, tc.expected[i], key)
+				}
+
+				value, _ := msg.Value.Encode()
+
+				var ev events.Message
+				err := json.Unmarshal(value, &ev)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if ev.Type != evs[i].Type || ev.Action != evs[i].Action || ev.Actor.ID != evs[i].Actor.ID {
+					t.Errorf("message %d: expected payload %+v, got %+v", i, evs[i], ev)
+				}
+			}
+
+			if ts := msgs[0].Timestamp.UnixNano(); ts != evs[0].TimeNano {
+				t.Errorf("expected timestamp %d, got %d", evs[0].TimeNano, ts)
+			}
+		})
+	}
+}
+
+func TestKafkaCloudEvents(t *testing.T) {
+	var producer = newMockProducer(1)
+	runKafka(t, newTestKafka(t, producer, "actor", "cloudevents", DeadLetterConfig{}),
+		events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}},
+	)
+
+	value, _ := producer.produced()[0].Value.Encode()
+
+	var cloudEvent map[string]interface{}
+	err := json.Unmarshal(value, &cloudEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cloudEvent["specversion"] == nil || cloudEvent["source"] == nil {
+		t.Errorf("expected a cloudevent, got %s", value)
+	}
+}
+
+func TestKafkaDeadLettersErrors(t *testing.T) {
+	var (
+		path     = filepath.Join(t.TempDir(), "dead-letter.json")
+		producer = newMockProducer(1)
+		failed   = events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "abc"}}
+	)
+
+	producer.errors <- &sarama.ProducerError{
+		Msg: &sarama.ProducerMessage{Metadata: failed},
+		Err: errors.New("broker unavailable"),
+	}
+
+	runKafka(t, newTestKafka(t, producer, "actor", "json", DeadLetterConfig{Path: path}))
+
+	deadLettered, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(deadLettered), `"die"`) {
+		t.Errorf("expected the failed event to be dead-lettered, got %q", deadLettered)
+	}
+}
+
+func TestNewKafkaInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  KafkaConfig
+	}{
+		{desc: "no brokers", cfg: KafkaConfig{Topic: "events"}},
+		{desc: "no topic", cfg: KafkaConfig{Brokers: []string{"localhost:9092"}}},
+		{desc: "unknown key", cfg: KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events", Key: "name"}},
+		{desc: "unknown codec", cfg: KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events", Compression: "zstd"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewKafka(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
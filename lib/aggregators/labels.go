@@ -0,0 +1,227 @@
+package aggregators
+
+import (
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sanitizeLabel turns an attribute key (e.g., `com.docker.stack.namespace`)
+// into a valid prometheus label name (`com_docker_stack_namespace`) by
+// replacing every character not allowed in label names by `_`.
+func sanitizeLabel(key string) string {
+	var label = []byte(key)
+
+	for idx, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z',
+			c >= 'A' && c <= 'Z',
+			c == '_',
+			c >= '0' && c <= '9' && idx > 0:
+		default:
+			label[idx] = '_'
+		}
+	}
+
+	return string(label)
+}
+
+// missingDerivedLabel is the value of derived labels for the events
+// that don't carry the attribute they come from.
+const missingDerivedLabel = "none"
+
+// derivedLabels are shorthands for well-known attributes that can be
+// given in place of the attributes themselves, naming the label they
+// turn into. Unlike the labels of plain attributes, derived labels
+// are valued `none` for the events missing the attribute.
+var derivedLabels = map[string]string{
+	// Labels set by docker compose on the containers it creates.
+	"project": "com.docker.compose.project",
+	"service": "com.docker.compose.service",
+
+	// Labels set by swarm on the containers of its services
+	// (and by `docker stack deploy` on the services of a stack).
+	"swarm_service": "com.docker.swarm.service.name",
+	"stack":         "com.docker.stack.namespace",
+}
+
+// composeLabels are the derived labels telling the compose project
+// (and service) containers belong to.
+var composeLabels = []string{"project", "service"}
+
+// swarmLabels are the derived labels telling the swarm service (and
+// stack) containers belong to.
+var swarmLabels = []string{"swarm_service", "stack"}
+
+// networkContainerAttribute is the attribute of network `connect` and
+// `disconnect` events naming the container (by id) attached to or
+// detached from the network.
+const networkContainerAttribute = "container"
+
+// labelName returns the name of the label the attribute `key` (or
+// derived label) turns into.
+func labelName(key string) string {
+	if _, derived := derivedLabels[key]; derived {
+		return key
+	}
+
+	return sanitizeLabel(key)
+}
+
+// attributeLabels holds which actor attributes should be turned into
+// labels for each event type.
+type attributeLabels map[string][]string
+
+// names returns the label names of a metric for events of type
+// `evType`: the given fixed labels followed by the sanitized keys
+// of the attributes configured for that type.
+func (a attributeLabels) names(evType string, fixed ...string) []string {
+	var names = append([]string{}, fixed...)
+
+	for _, key := range a[evType] {
+		names = append(names, labelName(key))
+	}
+
+	return names
+}
+
+// actionLabels returns the label names of the actions counter of
+// events of type `evType`: its fixed labels followed by those of the
+// configured attributes.
+func (a attributeLabels) actionLabels(evType string) []string {
+	return a.names(evType, fixedLabels[evType]...)
+}
+
+// values returns the label values matching `names` for a given event:
+// the fixed values followed by the values of the configured attributes
+// (empty when the event doesn't carry them).
+func (a attributeLabels) values(ev events.Message, fixed ...string) []string {
+	var values = append([]string{}, fixed...)
+
+	for _, key := range a[ev.Type] {
+		attribute, derived := derivedLabels[key]
+		if !derived {
+			values = append(values, ev.Actor.Attributes[key])
+			continue
+		}
+
+		value, present := ev.Actor.Attributes[attribute]
+		if !present || value == "" {
+			value = missingDerivedLabel
+		}
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// except returns the attribute labels without those that would be
+// named as any of `names`, for metrics having fixed labels of those
+// names.
+func (a attributeLabels) except(names ...string) attributeLabels {
+	var excluded = map[string]bool{}
+	for _, name := range names {
+		excluded[name] = true
+	}
+
+	var labels = attributeLabels{}
+	for evType, keys := range a {
+		for _, key := range keys {
+			if !excluded[labelName(key)] {
+				labels[evType] = append(labels[evType], key)
+			}
+		}
+	}
+
+	return labels
+}
+
+// index returns the position, among the label values of a metric for
+// events of type `evType` with `fixed` fixed labels, of the value of
+// the attribute `key`, or -1 when it isn't a label.
+func (a attributeLabels) index(evType string, fixed int, key string) int {
+	for idx, labelKey := range a[evType] {
+		if labelKey == key {
+			return fixed + idx
+		}
+	}
+
+	return -1
+}
+
+// overflowLabel is the value of the capped labels of the series past
+// their limit of distinct values.
+const overflowLabel = "__overflow__"
+
+// labelCap caps the number of distinct values a label of a metric
+// takes (e.g., the names of containers), folding the values past the
+// limit into `__overflow__` so that the cardinality of the metric is
+// bounded. Values whose series all got swept (see retain) free their
+// slot for new ones. A nil labelCap leaves the values untouched.
+type labelCap struct {
+	logger *log.Entry
+	index  int
+	limit  int
+	seen   map[string]bool
+	warned bool
+}
+
+// newLabelCap caps the label at position `index` of the label values
+// of a metric to `limit` distinct values, returning nil when there's
+// no such label.
+func newLabelCap(logger *log.Entry, index, limit int) *labelCap {
+	if index < 0 || limit <= 0 {
+		return nil
+	}
+
+	return &labelCap{
+		logger: logger,
+		index:  index,
+		limit:  limit,
+		seen:   map[string]bool{},
+	}
+}
+
+// apply folds the value of the capped label into `__overflow__` if
+// the limit of distinct values was reached, warning the first time.
+func (c *labelCap) apply(values []string) []string {
+	if c == nil {
+		return values
+	}
+
+	var value = values[c.index]
+	if c.seen[value] {
+		return values
+	}
+
+	if len(c.seen) < c.limit {
+		c.seen[value] = true
+		return values
+	}
+
+	if !c.warned {
+		c.logger.
+			WithField("limit", c.limit).
+			Warn("too many distinct label values, folding the new ones into " + overflowLabel)
+		c.warned = true
+	}
+
+	values[c.index] = overflowLabel
+	return values
+}
+
+// retain frees the values of the capped label that aren't in `live`,
+// the values still carried by a series of the metric after stale
+// series got swept. A nil `live` (the series aren't tracked) frees
+// nothing.
+func (c *labelCap) retain(live map[string]bool) {
+	if c == nil || live == nil {
+		return
+	}
+
+	for value := range c.seen {
+		if !live[value] {
+			delete(c.seen, value)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package aggregators
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+const influxMeasurement = "docker_events"
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(
+		`,`, `\,`,
+		` `, `\ `,
+	)
+	influxKeyEscaper = strings.NewReplacer(
+		`,`, `\,`,
+		`=`, `\=`,
+		` `, `\ `,
+		"\n", `\n`,
+	)
+	influxStringEscaper = strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+	)
+)
+
+// encodeLineProtocol appends to `buf` the InfluxDB line protocol
+// representation of an event:
+//
+//	docker_events,action=start,name=web,type=container count=1i,id="...",attrs.image="nginx" 1500000000000000000
+//
+// Tags are limited to the type, action and name of the actor while the
+// rest of the attributes are stored as string fields.
+func encodeLineProtocol(buf *bytes.Buffer, ev events.Message) {
+	buf.WriteString(influxMeasurementEscaper.Replace(influxMeasurement))
+
+	writeTag := func(key, value string) {
+		if value == "" {
+			return
+		}
+
+		buf.WriteByte(',')
+		buf.WriteString(influxKeyEscaper.Replace(key))
+		buf.WriteByte('=')
+		buf.WriteString(influxKeyEscaper.Replace(value))
+	}
+
+	writeTag("action", normalizeAction(ev.Action))
+	writeTag("name", ev.Actor.Attributes["name"])
+	writeTag("type", ev.Type)
+
+	writeField := func(key, value string) {
+		buf.WriteByte(',')
+		buf.WriteString(influxKeyEscaper.Replace(key))
+		buf.WriteString(`="`)
+		buf.WriteString(influxStringEscaper.Replace(value))
+		buf.WriteByte('"')
+	}
+
+	buf.WriteString(" count=1i")
+	writeField("id", ev.Actor.ID)
+
+	var keys = make([]string, 0, len(ev.Actor.Attributes))
+	for key := range ev.Actor.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		writeField("attrs."+key, ev.Actor.Attributes[key])
+	}
+
+	var timestamp = ev.TimeNano
+	if timestamp == 0 && ev.Time != 0 {
+		timestamp = ev.Time * int64(time.Second)
+	}
+	if timestamp == 0 {
+		timestamp = time.Now().UnixNano()
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(timestamp, 10))
+	buf.WriteByte('\n')
+}
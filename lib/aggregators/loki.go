@@ -0,0 +1,195 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*Loki)(nil)
+
+type LokiConfig struct {
+	// URL is the base address of Loki (e.g., http://loki:3100).
+	URL string
+
+	// TenantID, when set, is sent as `X-Scope-OrgID`.
+	TenantID string
+
+	// Host is the value of the `host` stream label. Defaults to
+	// the hostname of the machine.
+	Host string
+
+	// BatchSize and FlushInterval control how many lines are
+	// pushed at once and how long they may wait to be pushed.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// RetryAttempts and RetryBackoff control how pushes that failed
+	// with transient errors (5xx, 429, network) are retried.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+}
+
+// Loki pushes every event as a JSON log line to Loki, in streams
+// labeled with `job="devents"`, the host and the type and action of
+// the events.
+type Loki struct {
+	logger   *log.Entry
+	client   *http.Client
+	pushURL  string
+	tenantID string
+	host     string
+	batch    batchConfig
+	retry    retryConfig
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func NewLoki(cfg LokiConfig) (agg Loki, err error) {
+	pushURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse loki url %s", cfg.URL)
+		return
+	}
+
+	pushURL.Path = strings.TrimSuffix(pushURL.Path, "/") + "/loki/api/v1/push"
+
+	agg.host = cfg.Host
+	if agg.host == "" {
+		agg.host, _ = os.Hostname()
+	}
+
+	agg.pushURL = pushURL.String()
+	agg.tenantID = cfg.TenantID
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+	agg.retry = retryConfig{
+		Attempts: cfg.RetryAttempts,
+		Backoff:  cfg.RetryBackoff,
+	}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "loki")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (l Loki) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	return runBatched(ctx, l.logger, evs, errs, l.batch, func(batch []events.Message) error {
+		return l.push(ctx, batch)
+	})
+}
+
+// push sends a batch of events grouped in streams, retrying transient
+// failures.
+func (l Loki) push(ctx context.Context, batch []events.Message) (err error) {
+	var (
+		req     lokiPushRequest
+		streams = map[string]*lokiStream{}
+	)
+
+	for _, ev := range batch {
+		var (
+			action = normalizeAction(ev.Action)
+			key    = ev.Type + "\x00" + action
+		)
+
+		stream, present := streams[key]
+		if !present {
+			stream = &lokiStream{
+				Stream: map[string]string{
+					"job":    "devents",
+					"host":   l.host,
+					"type":   ev.Type,
+					"action": action,
+				},
+			}
+			streams[key] = stream
+			req.Streams = append(req.Streams, stream)
+		}
+
+		line, err := json.Marshal(ev)
+		if err != nil {
+			return errors.Wrapf(err,
+				"Couldn't encode event")
+		}
+
+		var ts = ev.TimeNano
+		if ts == 0 {
+			ts = time.Unix(ev.Time, 0).UnixNano()
+		}
+
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(ts, 10), string(line),
+		})
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode loki push request")
+		return
+	}
+
+	return retry(ctx, l.retry, func() error {
+		return l.post(ctx, body)
+	})
+}
+
+func (l Loki) post(ctx context.Context, body []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.pushURL, bytes.NewReader(body))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create loki push request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if l.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't push lines to loki")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"loki push failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,174 @@
+package aggregators_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+func newLoki(t *testing.T, cfg aggregators.LokiConfig) aggregators.Loki {
+	t.Helper()
+
+	cfg.RetryAttempts = 3
+	cfg.RetryBackoff = time.Millisecond
+
+	agg, err := aggregators.NewLoki(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return agg
+}
+
+func TestLoki(t *testing.T) {
+	url, received := newRecordingServer(t)
+	var agg = newLoki(t, aggregators.LokiConfig{
+		URL:      url + "/",
+		TenantID: "team-a",
+		Host:     "node-1",
+	})
+
+	var evs = []events.Message{
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}, TimeNano: 1500000000000000001},
+		{Type: "network", Action: "connect", Actor: events.Actor{ID: "def"}, Time: 1500000000},
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "ghi"}, TimeNano: 1500000000000000002},
+		{Type: "container", Action: "exec_start: sh -c ls", Actor: events.Actor{ID: "abc"}, TimeNano: 1500000000000000003},
+	}
+
+	err := collectorstest.Run(context.Background(), agg, evs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 1 {
+		t.Fatalf("expected a single push, got %d", len(requests))
+	}
+
+	var req = requests[0]
+	if req.url != "/loki/api/v1/push" {
+		t.Errorf("unexpected push url %s", req.url)
+	}
+	if tenant := req.header.Get("X-Scope-OrgID"); tenant != "team-a" {
+		t.Errorf("expected tenant team-a, got %q", tenant)
+	}
+
+	var push lokiPush
+	err = json.Unmarshal([]byte(req.body), &push)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = []struct {
+		typ, action string
+		events      []events.Message
+	}{
+		{"container", "start", []events.Message{evs[0], evs[2]}},
+		{"network", "connect", []events.Message{evs[1]}},
+		{"container", "exec_start", []events.Message{evs[3]}},
+	}
+
+	if len(push.Streams) != len(expected) {
+		t.Fatalf("expected %d streams, got %d", len(expected), len(push.Streams))
+	}
+
+	for i, stream := range push.Streams {
+		var labels = map[string]string{
+			"job":    "devents",
+			"host":   "node-1",
+			"type":   expected[i].typ,
+			"action": expected[i].action,
+		}
+		for key, value := range labels {
+			if stream.Stream[key] != value {
+				t.Errorf("stream %d: expected label %s=%s, got %q", i, key, value, stream.Stream[key])
+			}
+		}
+
+		if len(stream.Values) != len(expected[i].events) {
+			t.Fatalf("stream %d: expected %d lines, got %d", i, len(expected[i].events), len(stream.Values))
+		}
+
+		for j, value := range stream.Values {
+			var ev = expected[i].events[j]
+
+			var ts = ev.TimeNano
+			if ts == 0 {
+				ts = ev.Time * int64(time.Second)
+			}
+			if value[0] != strconv.FormatInt(ts, 10) {
+				t.Errorf("stream %d: expected timestamp %d, got %s", i, ts, value[0])
+			}
+
+			var line events.Message
+			err := json.Unmarshal([]byte(value[1]), &line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line.Actor.ID != ev.Actor.ID || line.Action != ev.Action {
+				t.Errorf("stream %d: expected line %+v, got %+v", i, ev, line)
+			}
+		}
+	}
+}
+
+func TestLokiRetries(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		statuses []int
+		requests int
+	}{
+		{
+			desc:     "rate limits and server errors are retried",
+			statuses: []int{http.StatusTooManyRequests, http.StatusBadGateway},
+			requests: 3,
+		},
+		{
+			desc:     "retries are bounded",
+			statuses: []int{500, 500, 500, 500},
+			requests: 3,
+		},
+		{
+			desc:     "client errors aren't retried",
+			statuses: []int{http.StatusBadRequest},
+			requests: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			url, received := newRecordingServer(t, tc.statuses...)
+			var agg = newLoki(t, aggregators.LokiConfig{URL: url})
+
+			err := collectorstest.Run(context.Background(), agg,
+				events.Message{Type: "container", Action: "start"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var requests = received()
+			if len(requests) != tc.requests {
+				t.Fatalf("expected %d requests, got %d", tc.requests, len(requests))
+			}
+
+			if requests[0].header.Get("X-Scope-OrgID") != "" {
+				t.Error("expected no tenant header without a tenant")
+			}
+		})
+	}
+}
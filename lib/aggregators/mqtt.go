@@ -0,0 +1,222 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/docker/docker/api/types/events"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMQTTTopic    = "docker/events/{{.Type}}/{{.Action}}"
+	defaultMQTTClientID = "devents"
+)
+
+var (
+	_ Aggregator    = (*MQTT)(nil)
+	_ HealthChecker = (*MQTT)(nil)
+)
+
+type MQTTConfig struct {
+	// Broker is the URL of the MQTT broker (e.g.,
+	// tcp://localhost:1883 or ssl://broker:8883).
+	Broker string
+
+	// ClientID identifies the connection to the broker. Defaults
+	// to "devents".
+	ClientID string
+
+	// Username and Password authenticate the connection.
+	Username string
+	Password string
+
+	// Topic is a text/template rendered for each event to pick the
+	// topic it's published to. It has access to `.Type`, `.Action`,
+	// `.ID` and `.Name`, all made safe to be used as topic levels.
+	// Defaults to `docker/events/{{.Type}}/{{.Action}}`.
+	Topic string
+
+	// QoS is the quality of service level (0, 1 or 2) the events
+	// are published with.
+	QoS int
+
+	// Retain makes the broker keep the last event of each topic
+	// for the clients subscribing later on.
+	Retain bool
+}
+
+// MQTT publishes every event as JSON to a topic derived from the
+// event. The client reconnects to the broker automatically whenever
+// the connection is lost.
+type MQTT struct {
+	logger *log.Entry
+	client mqtt.Client
+	topic  *template.Template
+	qos    byte
+	retain bool
+}
+
+// mqttTopicData is what the topic template gets rendered with.
+type mqttTopicData struct {
+	Type   string
+	Action string
+	ID     string
+	Name   string
+}
+
+func NewMQTT(cfg MQTTConfig) (agg MQTT, err error) {
+	agg.logger = log.WithField("aggregator", "mqtt")
+
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		err = errors.Errorf(
+			"Invalid mqtt qos %d, expected 0, 1 or 2", cfg.QoS)
+		return
+	}
+
+	var topic = cfg.Topic
+	if topic == "" {
+		topic = defaultMQTTTopic
+	}
+
+	agg.topic, err = template.New("topic").Parse(topic)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse mqtt topic template %s", topic)
+		return
+	}
+
+	var clientID = cfg.ClientID
+	if clientID == "" {
+		clientID = defaultMQTTClientID
+	}
+
+	var options = mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			agg.logger.
+				WithError(err).
+				Warn("disconnected from mqtt broker")
+		}).
+		SetOnConnectHandler(func(mqtt.Client) {
+			agg.logger.Info("connected to mqtt broker")
+		})
+
+	agg.client = mqtt.NewClient(options)
+
+	var token = agg.client.Connect()
+	if !token.WaitTimeout(defaultWriteTimeout) {
+		err = errors.Errorf(
+			"Timed out connecting to mqtt broker %s", cfg.Broker)
+		return
+	}
+
+	if err = token.Error(); err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't connect to mqtt broker %s", cfg.Broker)
+		return
+	}
+
+	agg.qos = byte(cfg.QoS)
+	agg.retain = cfg.Retain
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (m MQTT) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	// Give in-flight messages up to a second (in milliseconds) to
+	// be delivered before disconnecting.
+	defer m.client.Disconnect(1000)
+
+	m.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			m.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				m.logger.Info("events channel closed")
+				return
+			}
+
+			err := m.publish(ev)
+			if err != nil {
+				m.logger.
+					WithError(err).
+					Error("Errored publishing event to mqtt")
+			}
+		}
+	}
+}
+
+// Healthy reports whether the client is connected to the broker.
+func (m MQTT) Healthy() bool {
+	return m.client.IsConnected()
+}
+
+func (m MQTT) publish(ev events.Message) (err error) {
+	var topic bytes.Buffer
+
+	err = m.topic.Execute(&topic, mqttTopicData{
+		Type:   mqttTopicLevel(ev.Type),
+		Action: mqttTopicLevel(normalizeAction(ev.Action)),
+		ID:     mqttTopicLevel(ev.Actor.ID),
+		Name:   mqttTopicLevel(ev.Actor.Attributes["name"]),
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't render mqtt topic")
+		return
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode event")
+		return
+	}
+
+	var token = m.client.Publish(topic.String(), m.qos, m.retain, payload)
+	if !token.WaitTimeout(defaultWriteTimeout) {
+		err = errors.Errorf(
+			"Timed out publishing to mqtt topic %s", topic.String())
+		return
+	}
+
+	return token.Error()
+}
+
+// mqttTopicLevel makes a string safe to be used as a single topic
+// level, replacing the separator (`/`), the wildcards (`+`, `#`) and
+// whitespace by `_`. Empty strings become `_` so that topics never
+// end up with empty levels.
+func mqttTopicLevel(s string) string {
+	if s == "" {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '+', '#', ' ', '\t', '\n', '\r', 0:
+			return '_'
+		}
+		return r
+	}, s)
+}
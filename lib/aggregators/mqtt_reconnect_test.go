@@ -0,0 +1,56 @@
+//go:build !race
+
+// The vendored paho client races with itself while reconnecting, which
+// the race detector would flag regardless of what devents does.
+
+package aggregators_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestMQTTReconnects(t *testing.T) {
+	var broker = newMQTTBroker(t)
+
+	agg, err := aggregators.NewMQTT(aggregators.MQTTConfig{Broker: broker.url, QoS: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-broker.connects
+
+	if !agg.Healthy() {
+		t.Error("expected mqtt to be healthy once connected")
+	}
+
+	var (
+		mock = collectorstest.NewMock(1)
+		done = make(chan error, 1)
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	broker.drop()
+
+	select {
+	case <-broker.connects:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the client to reconnect")
+	}
+
+	mock.Push(events.Message{Type: "container", Action: "start"})
+	broker.expectPublished(t, "docker/events/container/start")
+
+	mock.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
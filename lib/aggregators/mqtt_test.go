@@ -0,0 +1,244 @@
+package aggregators_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// mqttBroker accepts MQTT connections, acknowledging whatever gets
+// published at any QoS and sending it through `published`.
+type mqttBroker struct {
+	url       string
+	connects  chan *packets.ConnectPacket
+	published chan *packets.PublishPacket
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newMQTTBroker(t *testing.T) *mqttBroker {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var b = &mqttBroker{
+		url:       "tcp://" + listener.Addr().String(),
+		connects:  make(chan *packets.ConnectPacket, 8),
+		published: make(chan *packets.PublishPacket, 64),
+	}
+	t.Cleanup(b.drop)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+// drop closes every connection the broker accepted.
+func (b *mqttBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *mqttBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		var reply packets.ControlPacket
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.connects <- p
+			reply = packets.NewControlPacket(packets.Connack)
+		case *packets.PublishPacket:
+			b.published <- p
+			switch p.Qos {
+			case 1:
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				reply = ack
+			case 2:
+				rec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				rec.MessageID = p.MessageID
+				reply = rec
+			}
+		case *packets.PubrelPacket:
+			comp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			comp.MessageID = p.MessageID
+			reply = comp
+		case *packets.PingreqPacket:
+			reply = packets.NewControlPacket(packets.Pingresp)
+		case *packets.DisconnectPacket:
+			return
+		}
+
+		if reply != nil {
+			if err := reply.Write(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// expectPublished waits for a message to be published to `topic`,
+// returning it.
+func (b *mqttBroker) expectPublished(t *testing.T, topic string) *packets.PublishPacket {
+	t.Helper()
+
+	select {
+	case p := <-b.published:
+		if p.TopicName != topic {
+			t.Errorf("expected topic %s, got %s", topic, p.TopicName)
+		}
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", topic)
+	}
+
+	return nil
+}
+
+func TestMQTT(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		topic    string
+		qos      int
+		expected []string
+	}{
+		{
+			desc: "default topic",
+			expected: []string{
+				"docker/events/container/start",
+				"docker/events/container/exec_start",
+				"docker/events/network/_",
+			},
+		},
+		{
+			desc:  "templated topic",
+			topic: "hosts/a/{{.Type}}/{{.Name}}",
+			qos:   1,
+			expected: []string{
+				"hosts/a/container/my_web",
+				"hosts/a/container/_",
+				"hosts/a/network/_",
+			},
+		},
+		{
+			desc: "exactly once",
+			qos:  2,
+			expected: []string{
+				"docker/events/container/start",
+				"docker/events/container/exec_start",
+				"docker/events/network/_",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var broker = newMQTTBroker(t)
+
+			agg, err := aggregators.NewMQTT(aggregators.MQTTConfig{
+				Broker:   broker.url,
+				ClientID: "host-a",
+				Username: "user",
+				Password: "pass",
+				Topic:    tc.topic,
+				QoS:      tc.qos,
+				Retain:   true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var connect = <-broker.connects
+			if connect.ClientIdentifier != "host-a" || connect.Username != "user" || string(connect.Password) != "pass" {
+				t.Errorf("unexpected connect %s", connect)
+			}
+
+			var evs = []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{
+					ID: "abc", Attributes: map[string]string{"name": "my/web"},
+				}},
+				{Type: "container", Action: "exec_start: sh -c ls"},
+				{Type: "network", Action: ""},
+			}
+
+			err = collectorstest.Run(context.Background(), agg, evs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, topic := range tc.expected {
+				var p = broker.expectPublished(t, topic)
+				if int(p.Qos) != tc.qos || !p.Retain {
+					t.Errorf("message %d: expected qos %d and retain, got qos %d, retain %t", i, tc.qos, p.Qos, p.Retain)
+				}
+
+				var ev events.Message
+				err := json.Unmarshal(p.Payload, &ev)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if ev.Type != evs[i].Type || ev.Action != evs[i].Action {
+					t.Errorf("message %d: expected payload %+v, got %+v", i, evs[i], ev)
+				}
+			}
+		})
+	}
+}
+
+func TestNewMQTTInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.MQTTConfig
+	}{
+		{desc: "invalid qos", cfg: aggregators.MQTTConfig{Broker: "tcp://127.0.0.1:1883", QoS: 3}},
+		{desc: "malformed topic", cfg: aggregators.MQTTConfig{Broker: "tcp://127.0.0.1:1883", Topic: "docker/{{.Type"}},
+		{desc: "unreachable broker", cfg: aggregators.MQTTConfig{Broker: "tcp://127.0.0.1:1"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewMQTT(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
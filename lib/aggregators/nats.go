@@ -0,0 +1,188 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/nats-io/go-nats"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultNATSSubject = "docker.events.{{.Type}}.{{.Action}}"
+
+var (
+	_ Aggregator    = (*NATS)(nil)
+	_ HealthChecker = (*NATS)(nil)
+)
+
+type NATSConfig struct {
+	// Servers are the URLs of the NATS servers of the cluster
+	// (e.g., nats://localhost:4222).
+	Servers []string
+
+	// Subject is a text/template rendered for each event to pick
+	// the subject it's published to. It has access to `.Type`,
+	// `.Action`, `.ID` and `.Name`, all made safe to be used as
+	// subject tokens. Defaults to `docker.events.{{.Type}}.{{.Action}}`.
+	Subject string
+
+	// Username and Password, or Token, authenticate the connection.
+	Username string
+	Password string
+	Token    string
+}
+
+// NATS publishes every event as JSON to a subject derived from the
+// event. Reconnections are handled by the NATS client, which buffers
+// the messages published while disconnected.
+type NATS struct {
+	logger  *log.Entry
+	conn    *nats.Conn
+	subject *template.Template
+}
+
+// natsSubjectData is what the subject template gets rendered with.
+type natsSubjectData struct {
+	Type   string
+	Action string
+	ID     string
+	Name   string
+}
+
+func NewNATS(cfg NATSConfig) (agg NATS, err error) {
+	agg.logger = log.WithField("aggregator", "nats")
+
+	var subject = cfg.Subject
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+
+	agg.subject, err = template.New("subject").Parse(subject)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse nats subject template %s", subject)
+		return
+	}
+
+	var options = []nats.Option{
+		nats.Name("devents"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectHandler(func(*nats.Conn) {
+			agg.logger.Warn("disconnected from nats")
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			agg.logger.
+				WithField("server", conn.ConnectedUrl()).
+				Info("reconnected to nats")
+		}),
+	}
+
+	if cfg.Username != "" {
+		options = append(options, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+
+	if cfg.Token != "" {
+		options = append(options, nats.Token(cfg.Token))
+	}
+
+	var servers = strings.Join(cfg.Servers, ",")
+	if servers == "" {
+		servers = nats.DefaultURL
+	}
+
+	agg.conn, err = nats.Connect(servers, options...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't connect to nats servers %s", servers)
+		return
+	}
+
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (n NATS) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer n.conn.Close()
+	defer n.conn.Flush()
+
+	n.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			n.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				n.logger.Info("events channel closed")
+				return
+			}
+
+			err := n.publish(ev)
+			if err != nil {
+				n.logger.
+					WithError(err).
+					Error("Errored publishing event to nats")
+			}
+		}
+	}
+}
+
+// Healthy reports whether the client is connected to a server.
+func (n NATS) Healthy() bool {
+	return n.conn.IsConnected()
+}
+
+func (n NATS) publish(ev events.Message) (err error) {
+	var subject bytes.Buffer
+
+	err = n.subject.Execute(&subject, natsSubjectData{
+		Type:   natsToken(ev.Type),
+		Action: natsToken(normalizeAction(ev.Action)),
+		ID:     natsToken(ev.Actor.ID),
+		Name:   natsToken(ev.Actor.Attributes["name"]),
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't render nats subject")
+		return
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode event")
+		return
+	}
+
+	return n.conn.Publish(subject.String(), payload)
+}
+
+// natsToken makes a string safe to be used as a single subject
+// token, replacing the separator (`.`), the wildcards (`*`, `>`) and
+// whitespace by `_`. Empty strings become `_` so that subjects never
+// end up with empty tokens.
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\n', '\r':
+			return '_'
+		}
+		return r
+	}, s)
+}
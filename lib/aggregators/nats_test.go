@@ -0,0 +1,172 @@
+package aggregators_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// natsMessage is a message published to a natsServer.
+type natsMessage struct {
+	subject string
+	payload []byte
+}
+
+// newNATSServer starts a server speaking just enough of the NATS
+// client protocol (INFO, CONNECT, PING/PONG and PUB) for a client to
+// connect and publish, sending what's published through the returned
+// channel.
+func newNATSServer(t *testing.T) (url string, published <-chan natsMessage) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var ch = make(chan natsMessage, 64)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveNATS(conn, ch)
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), ch
+}
+
+func serveNATS(conn net.Conn, published chan<- natsMessage) {
+	defer conn.Close()
+
+	io.WriteString(conn, `INFO {"server_id":"test","version":"1.0.0","max_payload":1048576}`+"\r\n")
+
+	var reader = bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		var fields = strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+
+			var payload = make([]byte, size+2)
+			_, err := io.ReadFull(reader, payload)
+			if err != nil {
+				return
+			}
+
+			published <- natsMessage{subject: fields[1], payload: payload[:size]}
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		subject  string
+		expected []string
+	}{
+		{
+			desc: "default subject",
+			expected: []string{
+				"docker.events.container.start",
+				"docker.events.container.exec_start",
+				"docker.events.network._",
+			},
+		},
+		{
+			desc:    "templated subject",
+			subject: "docker.{{.Type}}.{{.Name}}",
+			expected: []string{
+				"docker.container.my_web",
+				"docker.container._",
+				"docker.network._",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			url, published := newNATSServer(t)
+
+			agg, err := aggregators.NewNATS(aggregators.NATSConfig{
+				Servers: []string{url},
+				Subject: tc.subject,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !agg.Healthy() {
+				t.Error("expected nats to be healthy once connected")
+			}
+
+			var evs = []events.Message{
+				{Type: "container", Action: "start", Actor: events.Actor{
+					ID: "abc", Attributes: map[string]string{"name": "my.web"},
+				}},
+				{Type: "container", Action: "exec_start: sh -c ls"},
+				{Type: "network", Action: ""},
+			}
+
+			err = collectorstest.Run(context.Background(), agg, evs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, subject := range tc.expected {
+				select {
+				case msg := <-published:
+					if msg.subject != subject {
+						t.Errorf("message %d: expected subject %s, got %s", i, subject, msg.subject)
+					}
+
+					var ev events.Message
+					err := json.Unmarshal(msg.payload, &ev)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if ev.Type != evs[i].Type || ev.Action != evs[i].Action {
+						t.Errorf("message %d: expected payload %+v, got %+v", i, evs[i], ev)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for %s", subject)
+				}
+			}
+		})
+	}
+}
+
+func TestNATSInvalidSubject(t *testing.T) {
+	_, err := aggregators.NewNATS(aggregators.NATSConfig{
+		Subject: "docker.{{.Type",
+	})
+	if err == nil {
+		t.Fatal("expected an error for a malformed subject template")
+	}
+}
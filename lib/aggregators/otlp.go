@@ -0,0 +1,100 @@
+package aggregators
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// otlpScope is the instrumentation scope of the metrics and logs
+// exported by devents.
+const otlpScope = "github.com/cirocosta/devents"
+
+// otlpErrorHandler makes the OpenTelemetry SDK report the errors that
+// happen in the background (e.g., failed exports) through logrus
+// instead of the standard logger.
+var otlpErrorHandler sync.Once
+
+// otlpConfig holds what the OTLP metrics and logs aggregators share:
+// where to export to, the headers sent with every export and the
+// resource describing devents.
+type otlpConfig struct {
+	endpoint string
+	headers  map[string]string
+	resource *resource.Resource
+}
+
+// newOTLPConfig parses the configuration of an OTLP aggregator.
+// `headers` are `Name=value` pairs and `resourceAttributes` are
+// `key=value` pairs added to those describing devents itself
+// (`service.name` and `host.name`).
+func newOTLPConfig(endpoint string, headers, resourceAttributes []string) (cfg otlpConfig, err error) {
+	if endpoint == "" {
+		err = errors.New("An OTLP endpoint must be specified")
+		return
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		err = errors.Errorf(
+			"Malformed OTLP endpoint %s, expected an URL", endpoint)
+		return
+	}
+
+	cfg.headers = map[string]string{}
+	for _, header := range headers {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) != 2 {
+			err = errors.Errorf(
+				"Malformed OTLP header %s, expected Name=value", header)
+			return
+		}
+
+		cfg.headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	var attributes = []attribute.KeyValue{
+		attribute.String("service.name", "devents"),
+	}
+
+	if host, _ := os.Hostname(); host != "" {
+		attributes = append(attributes, attribute.String("host.name", host))
+	}
+
+	for _, attr := range resourceAttributes {
+		parts := strings.SplitN(attr, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			err = errors.Errorf(
+				"Malformed OTLP resource attribute %s, expected key=value", attr)
+			return
+		}
+
+		attributes = append(attributes, attribute.String(parts[0], parts[1]))
+	}
+
+	otlpErrorHandler.Do(func() {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			log.WithField("aggregator", "otlp").
+				WithError(err).
+				Error("Errored exporting to OTLP")
+		}))
+	})
+
+	cfg.endpoint = strings.TrimSuffix(endpoint, "/")
+	cfg.resource = resource.NewSchemaless(attributes...)
+	return
+}
+
+// url is the address of the OTLP/HTTP receiver of the signal at
+// `path` (e.g., `/v1/metrics`).
+func (o otlpConfig) url(path string) string {
+	return o.endpoint + path
+}
@@ -0,0 +1,166 @@
+package aggregators
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// otlpSeverities maps syslog severities (see syslogSeverity) to the
+// OTLP severity numbers and texts.
+var otlpSeverities = map[int]struct {
+	Number otellog.Severity
+	Text   string
+}{
+	syslogSeverityCritical: {otellog.SeverityFatal, "FATAL"},
+	syslogSeverityError:    {otellog.SeverityError, "ERROR"},
+	syslogSeverityWarning:  {otellog.SeverityWarn, "WARN"},
+	syslogSeverityNotice:   {otellog.SeverityInfo2, "INFO2"},
+	syslogSeverityInfo:     {otellog.SeverityInfo, "INFO"},
+}
+
+var _ Aggregator = (*OTLPLogs)(nil)
+
+type OTLPLogsConfig struct {
+	// Endpoint, Headers and ResourceAttributes are the same as in
+	// OTLPMetricsConfig.
+	Endpoint           string
+	Headers            []string
+	ResourceAttributes []string
+
+	// BatchSize and FlushInterval control how many log records are
+	// exported at once and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// OTLPLogs emits every event as a log record of the OpenTelemetry
+// SDK, timestamped with the time of the event and carrying its type,
+// action and actor as attributes, which are exported in batches to
+// an OpenTelemetry collector.
+type OTLPLogs struct {
+	logger   *log.Entry
+	exporter sdklog.Exporter
+	resource *resource.Resource
+	batch    batchConfig
+}
+
+func NewOTLPLogs(cfg OTLPLogsConfig) (agg OTLPLogs, err error) {
+	otlp, err := newOTLPConfig(cfg.Endpoint, cfg.Headers, cfg.ResourceAttributes)
+	if err != nil {
+		return
+	}
+
+	agg.exporter, err = otlploghttp.New(context.Background(),
+		otlploghttp.WithEndpointURL(otlp.url("/v1/logs")),
+		otlploghttp.WithHeaders(otlp.headers),
+		otlploghttp.WithRetry(otlploghttp.RetryConfig{
+			Enabled:         true,
+			InitialInterval: defaultRetryBackoff,
+			MaxInterval:     30 * time.Second,
+			MaxElapsedTime:  time.Minute,
+		}))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create OTLP logs exporter")
+		return
+	}
+
+	agg.resource = otlp.resource
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "otlplogs")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (o OTLPLogs) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var provider = sdklog.NewLoggerProvider(
+		sdklog.WithResource(o.resource),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(o.exporter,
+			sdklog.WithExportMaxBatchSize(o.batch.Size),
+			sdklog.WithExportInterval(o.batch.Interval))),
+	)
+
+	// Shutting down exports the records still queued.
+	defer func() {
+		err := provider.Shutdown(context.Background())
+		if err != nil {
+			o.logger.
+				WithError(err).
+				Error("Errored exporting log records")
+		}
+	}()
+
+	var logger = provider.Logger(otlpScope)
+
+	o.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			o.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				o.logger.Info("events channel closed")
+				return
+			}
+
+			logger.Emit(context.Background(), o.record(ev))
+		}
+	}
+}
+
+// record converts an event into a log record. Events without a time
+// are left untimestamped, only carrying the time they were observed.
+func (o OTLPLogs) record(ev events.Message) (record otellog.Record) {
+	var (
+		action   = normalizeAction(ev.Action)
+		severity = otlpSeverities[syslogSeverity(ev)]
+		name     = ev.Actor.Attributes["name"]
+	)
+
+	switch {
+	case ev.TimeNano != 0:
+		record.SetTimestamp(time.Unix(0, ev.TimeNano))
+	case ev.Time != 0:
+		record.SetTimestamp(time.Unix(ev.Time, 0))
+	}
+
+	if name == "" {
+		name = ev.Actor.ID
+	}
+
+	record.SetSeverity(severity.Number)
+	record.SetSeverityText(severity.Text)
+	record.SetBody(attribute.StringValue(ev.Type + " " + action + " " + name))
+	record.AddAttributes(
+		attribute.String("docker.event.type", ev.Type),
+		attribute.String("docker.event.action", action),
+		attribute.String("docker.actor.id", ev.Actor.ID),
+	)
+
+	for key, value := range ev.Actor.Attributes {
+		record.AddAttributes(attribute.String("docker.actor.attributes."+key, value))
+	}
+
+	return
+}
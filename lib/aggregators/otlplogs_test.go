@@ -0,0 +1,178 @@
+package aggregators_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	logspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logpb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// logRecords decodes the log records of the exports in `requests`.
+func logRecords(t *testing.T, requests []recordedRequest) (records []*logpb.LogRecord) {
+	t.Helper()
+
+	for _, req := range requests {
+		if req.url != "/v1/logs" {
+			t.Errorf("unexpected export to %s", req.url)
+		}
+
+		var export logspb.ExportLogsServiceRequest
+		err := proto.Unmarshal([]byte(req.body), &export)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, resourceLogs := range export.ResourceLogs {
+			var resource = otlpAttributes(resourceLogs.Resource.Attributes)
+			if resource["service.name"] != "devents" || resource["team"] != "infra" {
+				t.Errorf("unexpected resource attributes %v", resource)
+			}
+
+			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				records = append(records, scopeLogs.LogRecords...)
+			}
+		}
+	}
+
+	return
+}
+
+func TestOTLPLogs(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	agg, err := aggregators.NewOTLPLogs(aggregators.OTLPLogsConfig{
+		Endpoint:           url,
+		Headers:            []string{"X-Tenant=team-a"},
+		ResourceAttributes: []string{"team=infra"},
+		BatchSize:          2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before = uint64(time.Now().UnixNano())
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{
+			Type:     "container",
+			Action:   "die",
+			TimeNano: 1500000000000000001,
+			Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+				"name":     "web",
+				"exitCode": "1",
+			}},
+		},
+		events.Message{Type: "container", Action: "exec_start: sh -c ls", Time: 1500000000, Actor: events.Actor{ID: "abc"}},
+		events.Message{Type: "container", Action: "oom", Actor: events.Actor{ID: "abc"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(requests))
+	}
+	if tenant := requests[0].header.Get("X-Tenant"); tenant != "team-a" {
+		t.Errorf("expected the configured header, got %q", tenant)
+	}
+
+	var records = logRecords(t, requests)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 log records, got %d", len(records))
+	}
+
+	var expected = []struct {
+		time       uint64
+		severity   logpb.SeverityNumber
+		text       string
+		body       string
+		attributes map[string]string
+	}{
+		{
+			time: 1500000000000000001, severity: logpb.SeverityNumber_SEVERITY_NUMBER_ERROR, text: "ERROR",
+			body: "container die web",
+			attributes: map[string]string{
+				"docker.event.type":                "container",
+				"docker.event.action":              "die",
+				"docker.actor.id":                  "abc",
+				"docker.actor.attributes.name":     "web",
+				"docker.actor.attributes.exitCode": "1",
+			},
+		},
+		{
+			time: 1500000000000000000, severity: logpb.SeverityNumber_SEVERITY_NUMBER_INFO, text: "INFO",
+			body: "container exec_start abc",
+			attributes: map[string]string{
+				"docker.event.type":   "container",
+				"docker.event.action": "exec_start",
+				"docker.actor.id":     "abc",
+			},
+		},
+		{
+			time: 0, severity: logpb.SeverityNumber_SEVERITY_NUMBER_FATAL, text: "FATAL",
+			body: "container oom abc",
+			attributes: map[string]string{
+				"docker.event.action": "oom",
+			},
+		},
+	}
+
+	for i, record := range records {
+		var want = expected[i]
+
+		if record.TimeUnixNano != want.time {
+			t.Errorf("record %d: expected time %d, got %d", i, want.time, record.TimeUnixNano)
+		}
+
+		if record.ObservedTimeUnixNano < before {
+			t.Errorf("record %d: unexpected observed time %d", i, record.ObservedTimeUnixNano)
+		}
+
+		if record.SeverityNumber != want.severity || record.SeverityText != want.text {
+			t.Errorf("record %d: expected severity %d %s, got %d %s",
+				i, want.severity, want.text, record.SeverityNumber, record.SeverityText)
+		}
+
+		if body := record.Body.GetStringValue(); body != want.body {
+			t.Errorf("record %d: expected body %q, got %q", i, want.body, body)
+		}
+
+		var attributes = otlpAttributes(record.Attributes)
+		for key, value := range want.attributes {
+			if attributes[key] != value {
+				t.Errorf("record %d: expected attribute %s=%s, got %q", i, key, value, attributes[key])
+			}
+		}
+	}
+}
+
+func TestOTLPLogsRetries(t *testing.T) {
+	url, received := newRecordingServer(t, http.StatusServiceUnavailable)
+
+	agg, err := aggregators.NewOTLPLogs(aggregators.OTLPLogsConfig{
+		Endpoint:           url,
+		ResourceAttributes: []string{"team=infra"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 2 || len(logRecords(t, requests[1:])) != 1 {
+		t.Errorf("expected the export to be retried once, got %d requests", len(requests))
+	}
+}
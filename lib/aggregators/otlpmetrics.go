@@ -0,0 +1,133 @@
+package aggregators
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultOTLPExportInterval = time.Minute
+
+var _ Aggregator = (*OTLPMetrics)(nil)
+
+type OTLPMetricsConfig struct {
+	// Endpoint is the base address of the OTLP/HTTP receiver of a
+	// collector (e.g., http://otel-collector:4318).
+	Endpoint string
+
+	// Headers are `Name=value` headers sent with every export
+	// (e.g., for authentication).
+	Headers []string
+
+	// ResourceAttributes are `key=value` pairs describing the
+	// resource (e.g., `deployment.environment=prod`).
+	ResourceAttributes []string
+
+	// ExportInterval is how often the counters are exported.
+	ExportInterval time.Duration
+}
+
+// OTLPMetrics counts events by type and action in a `docker.events`
+// counter of the OpenTelemetry SDK, mirroring the `events_total`
+// counter exposed for prometheus, which is periodically exported as
+// a cumulative sum to an OpenTelemetry collector.
+type OTLPMetrics struct {
+	logger   *log.Entry
+	exporter sdkmetric.Exporter
+	resource *resource.Resource
+	interval time.Duration
+}
+
+func NewOTLPMetrics(cfg OTLPMetricsConfig) (agg OTLPMetrics, err error) {
+	otlp, err := newOTLPConfig(cfg.Endpoint, cfg.Headers, cfg.ResourceAttributes)
+	if err != nil {
+		return
+	}
+
+	agg.exporter, err = otlpmetrichttp.New(context.Background(),
+		otlpmetrichttp.WithEndpointURL(otlp.url("/v1/metrics")),
+		otlpmetrichttp.WithHeaders(otlp.headers),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{
+			Enabled:         true,
+			InitialInterval: defaultRetryBackoff,
+			MaxInterval:     30 * time.Second,
+			MaxElapsedTime:  time.Minute,
+		}))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create OTLP metrics exporter")
+		return
+	}
+
+	agg.resource = otlp.resource
+	agg.interval = cfg.ExportInterval
+	if agg.interval <= 0 {
+		agg.interval = defaultOTLPExportInterval
+	}
+
+	agg.logger = log.WithField("aggregator", "otlpmetrics")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (o OTLPMetrics) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var provider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(o.resource),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(o.exporter,
+			sdkmetric.WithInterval(o.interval))),
+	)
+
+	// Shutting down exports whatever was counted since the last
+	// export.
+	defer func() {
+		err := provider.Shutdown(context.Background())
+		if err != nil {
+			o.logger.
+				WithError(err).
+				Error("Errored exporting metrics")
+		}
+	}()
+
+	counter, err := provider.Meter(otlpScope).Int64Counter("docker.events",
+		metric.WithDescription("Number of docker events received"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create docker.events counter")
+		return
+	}
+
+	o.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			o.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				o.logger.Info("events channel closed")
+				return
+			}
+
+			counter.Add(context.Background(), 1, metric.WithAttributes(
+				attribute.String("type", ev.Type),
+				attribute.String("action", normalizeAction(ev.Action)),
+			))
+		}
+	}
+}
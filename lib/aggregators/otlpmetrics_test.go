@@ -0,0 +1,210 @@
+package aggregators_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	metricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpAttributes converts OTLP attributes into a map of their string
+// values.
+func otlpAttributes(kvs []*commonpb.KeyValue) map[string]string {
+	var m = map[string]string{}
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.GetStringValue()
+	}
+	return m
+}
+
+func decodeOTLPMetrics(t *testing.T, body string) *metricspb.ExportMetricsServiceRequest {
+	t.Helper()
+
+	var export metricspb.ExportMetricsServiceRequest
+	err := proto.Unmarshal([]byte(body), &export)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &export
+}
+
+// otlpCounts decodes an export into the counts keyed by `type/action`,
+// failing unless it's the single docker.events sum it's expected to
+// be. Exports taken before anything got counted carry no metrics.
+func otlpCounts(t *testing.T, export *metricspb.ExportMetricsServiceRequest) map[string]int64 {
+	t.Helper()
+
+	var metrics []*metricpb.Metric
+	for _, resourceMetrics := range export.ResourceMetrics {
+		for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+			metrics = append(metrics, scopeMetrics.Metrics...)
+		}
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("expected a single metric, got %v", metrics)
+	}
+
+	var sum = metrics[0].GetSum()
+	if metrics[0].Name != "docker.events" || sum == nil || !sum.IsMonotonic ||
+		sum.AggregationTemporality != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("expected a cumulative monotonic docker.events sum, got %v", metrics[0])
+	}
+
+	var counts = map[string]int64{}
+	for _, point := range sum.GetDataPoints() {
+		var attributes = otlpAttributes(point.Attributes)
+		counts[attributes["type"]+"/"+attributes["action"]] = point.GetAsInt()
+
+		if point.StartTimeUnixNano == 0 || point.StartTimeUnixNano > point.TimeUnixNano {
+			t.Errorf("unexpected data point window %d-%d", point.StartTimeUnixNano, point.TimeUnixNano)
+		}
+	}
+
+	return counts
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	agg, err := aggregators.NewOTLPMetrics(aggregators.OTLPMetricsConfig{
+		Endpoint:           url + "/",
+		Headers:            []string{"Authorization = Bearer token"},
+		ResourceAttributes: []string{"deployment.environment=prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "container", Action: "exec_start: sh -c ls"},
+		events.Message{Type: "network", Action: "connect"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 1 {
+		t.Fatalf("expected the counts to be exported once on exit, got %d exports", len(requests))
+	}
+
+	var req = requests[0]
+	if req.url != "/v1/metrics" || req.header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected export to %s (%s)", req.url, req.header.Get("Content-Type"))
+	}
+	if auth := req.header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("expected the configured header, got %q", auth)
+	}
+
+	var export = decodeOTLPMetrics(t, req.body)
+
+	var resource = otlpAttributes(export.ResourceMetrics[0].Resource.Attributes)
+	if resource["service.name"] != "devents" || resource["deployment.environment"] != "prod" {
+		t.Errorf("unexpected resource attributes %v", resource)
+	}
+
+	var counts = otlpCounts(t, export)
+	var expected = map[string]int64{
+		"container/start":      2,
+		"container/exec_start": 1,
+		"network/connect":      1,
+	}
+
+	if len(counts) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, counts)
+	}
+	for key, value := range expected {
+		if counts[key] != value {
+			t.Errorf("expected %s=%d, got %d", key, value, counts[key])
+		}
+	}
+}
+
+func TestOTLPMetricsCumulative(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	agg, err := aggregators.NewOTLPMetrics(aggregators.OTLPMetricsConfig{
+		Endpoint:       url,
+		ExportInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mock = collectorstest.NewMock(2)
+		done = make(chan error, 1)
+		ev   = events.Message{Type: "container", Action: "start"}
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	// waitCount waits for an export counting `count` starts.
+	var waitCount = func(count int64) {
+		t.Helper()
+
+		var deadline = time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			var requests = received()
+			if len(requests) > 0 {
+				last := decodeOTLPMetrics(t, requests[len(requests)-1].body)
+				if otlpCounts(t, last)["container/start"] == count {
+					return
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("timed out waiting for an export counting %d", count)
+	}
+
+	mock.Push(ev)
+	waitCount(1)
+
+	mock.Push(ev)
+	waitCount(2)
+
+	mock.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewOTLPMetricsInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.OTLPMetricsConfig
+	}{
+		{desc: "no endpoint", cfg: aggregators.OTLPMetricsConfig{}},
+		{desc: "malformed endpoint", cfg: aggregators.OTLPMetricsConfig{Endpoint: "otel-collector"}},
+		{desc: "malformed header", cfg: aggregators.OTLPMetricsConfig{Endpoint: "http://collector:4318", Headers: []string{"Authorization"}}},
+		{desc: "malformed attribute", cfg: aggregators.OTLPMetricsConfig{Endpoint: "http://collector:4318", ResourceAttributes: []string{"=prod"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewOTLPMetrics(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package aggregators
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultPostgresTable = "docker_events"
+
+var _ Aggregator = (*Postgres)(nil)
+
+type PostgresConfig struct {
+	// DSN is the connection string of the database (e.g.,
+	// postgres://devents@db/devents?sslmode=disable).
+	DSN string
+
+	// Table is the table events are written to, created if it
+	// doesn't exist. Defaults to `docker_events`.
+	Table string
+
+	// BatchSize and FlushInterval control how many events are
+	// copied at once and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// MaxConns caps the number of connections of the pool.
+	MaxConns int
+}
+
+// Postgres writes events into a PostgreSQL table, copying them in
+// batches with `COPY FROM STDIN`. The attributes of the actor are
+// stored as JSONB.
+type Postgres struct {
+	logger *log.Entry
+	db     *sql.DB
+	table  string
+	batch  batchConfig
+	retry  retryConfig
+}
+
+func NewPostgres(cfg PostgresConfig) (agg Postgres, err error) {
+	if cfg.DSN == "" {
+		err = errors.New("A postgres DSN must be specified")
+		return
+	}
+
+	agg.table = cfg.Table
+	if agg.table == "" {
+		agg.table = defaultPostgresTable
+	}
+
+	agg.db, err = sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't open postgres database")
+		return
+	}
+
+	if cfg.MaxConns > 0 {
+		agg.db.SetMaxOpenConns(cfg.MaxConns)
+	}
+
+	_, err = agg.db.Exec(`CREATE TABLE IF NOT EXISTS ` + pq.QuoteIdentifier(agg.table) + ` (
+		id         BIGSERIAL   PRIMARY KEY,
+		time       TIMESTAMPTZ NOT NULL,
+		type       TEXT        NOT NULL,
+		action     TEXT        NOT NULL,
+		actor_id   TEXT        NOT NULL,
+		actor_name TEXT        NOT NULL,
+		attributes JSONB       NOT NULL
+	)`)
+	if err != nil {
+		agg.db.Close()
+		err = errors.Wrapf(err,
+			"Couldn't create postgres table %s", agg.table)
+		return
+	}
+
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+	agg.retry = retryConfig{}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "postgres")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (p Postgres) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer p.db.Close()
+
+	return runBatched(ctx, p.logger, evs, errs, p.batch, func(batch []events.Message) error {
+		return p.write(ctx, batch)
+	})
+}
+
+// write copies a batch of events into the table. Batches failing
+// because of connection issues are retried, the pool taking care of
+// establishing new connections.
+func (p Postgres) write(ctx context.Context, batch []events.Message) (err error) {
+	var rows = make([]eventRow, 0, len(batch))
+
+	for _, ev := range batch {
+		row, err := newEventRow(ev)
+		if err != nil {
+			return errors.Wrapf(err,
+				"Couldn't encode event attributes")
+		}
+
+		rows = append(rows, row)
+	}
+
+	return retry(ctx, p.retry, func() error {
+		err := p.copy(rows)
+		if err == nil {
+			return nil
+		}
+
+		switch errors.Cause(err).(type) {
+		case net.Error:
+			return transientError{err}
+		}
+
+		if errors.Cause(err) == driver.ErrBadConn {
+			return transientError{err}
+		}
+
+		return err
+	})
+}
+
+func (p Postgres) copy(rows []eventRow) (err error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't start postgres transaction")
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.Prepare(pq.CopyIn(p.table,
+		"time", "type", "action", "actor_id", "actor_name", "attributes"))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't prepare postgres copy")
+		return
+	}
+
+	for _, row := range rows {
+		_, err = stmt.Exec(row.Time, row.Type, row.Action,
+			row.ActorID, row.ActorName, string(row.Attributes))
+		if err != nil {
+			stmt.Close()
+			err = errors.Wrapf(err,
+				"Couldn't copy event into postgres")
+			return
+		}
+	}
+
+	_, err = stmt.Exec()
+	if err == nil {
+		err = stmt.Close()
+	}
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't flush postgres copy")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't commit postgres transaction")
+		return
+	}
+
+	return
+}
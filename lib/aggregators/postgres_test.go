@@ -0,0 +1,220 @@
+package aggregators
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// copyDriver is a database/sql driver that understands just enough of
+// `COPY ... FROM STDIN` (as prepared by lib/pq) to record the rows
+// copied by each committed transaction.
+type copyDriver struct {
+	mu        sync.Mutex
+	queries   []string
+	committed [][][]driver.Value
+
+	// failures is the number of copies that fail with a network
+	// error before they start succeeding.
+	failures int
+}
+
+func (d *copyDriver) Open(name string) (driver.Conn, error) {
+	return &copyConn{driver: d}, nil
+}
+
+// batches returns the rows of each committed transaction.
+func (d *copyDriver) batches() [][][]driver.Value {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([][][]driver.Value(nil), d.committed...)
+}
+
+type copyConn struct {
+	driver *copyDriver
+	rows   [][]driver.Value
+}
+
+func (c *copyConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.queries = append(c.driver.queries, query)
+	return &copyStmt{conn: c}, nil
+}
+
+func (c *copyConn) Close() error              { return nil }
+func (c *copyConn) Begin() (driver.Tx, error) { c.rows = nil; return c, nil }
+func (c *copyConn) Rollback() error           { c.rows = nil; return nil }
+
+func (c *copyConn) Commit() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	c.driver.committed = append(c.driver.committed, c.rows)
+	c.rows = nil
+	return nil
+}
+
+type copyStmt struct {
+	conn *copyConn
+}
+
+func (s *copyStmt) Close() error  { return nil }
+func (s *copyStmt) NumInput() int { return -1 }
+
+// Exec buffers a row or, when called without arguments, flushes the
+// buffered rows.
+func (s *copyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if len(args) > 0 {
+		s.conn.rows = append(s.conn.rows, args)
+		return driver.RowsAffected(1), nil
+	}
+
+	var d = s.conn.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.failures > 0 {
+		d.failures--
+		return nil, &net.OpError{Op: "write", Net: "tcp", Err: net.UnknownNetworkError("connection reset")}
+	}
+
+	return driver.RowsAffected(len(s.conn.rows)), nil
+}
+
+func (s *copyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+var copyDrivers int32
+
+func newTestPostgres(t *testing.T, d *copyDriver, cfg PostgresConfig) Postgres {
+	t.Helper()
+
+	var name = "copy-" + strconv.Itoa(int(atomic.AddInt32(&copyDrivers, 1)))
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Postgres{
+		logger: log.WithField("aggregator", "postgres"),
+		db:     db,
+		table:  cfg.Table,
+		batch: batchConfig{
+			Size:     cfg.BatchSize,
+			Interval: cfg.FlushInterval,
+		}.withDefaults(),
+		retry: retryConfig{Attempts: 3, Backoff: time.Millisecond},
+	}
+}
+
+// runPostgres feeds `evs` to `agg` until they're all consumed.
+func runPostgres(t *testing.T, agg Postgres, evs ...events.Message) {
+	t.Helper()
+
+	var ch = make(chan events.Message, len(evs))
+	for _, ev := range evs {
+		ch <- ev
+	}
+	close(ch)
+
+	err := agg.Run(context.Background(), ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresBatches(t *testing.T) {
+	var (
+		d   = &copyDriver{}
+		agg = newTestPostgres(t, d, PostgresConfig{Table: "my events", BatchSize: 2})
+	)
+
+	runPostgres(t, agg,
+		events.Message{
+			Type:     "container",
+			Action:   "start",
+			TimeNano: 1500000000000000001,
+			Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+				"name":  "web",
+				"image": "nginx",
+			}},
+		},
+		events.Message{Type: "network", Action: "connect", Time: 1500000001, Actor: events.Actor{ID: "def"}},
+		events.Message{Type: "volume", Action: "create", Actor: events.Actor{ID: "ghi"}},
+	)
+
+	var batches = d.batches()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1 rows, got %v", batches)
+	}
+
+	if d.queries[0] != `COPY "my events" ("time", "type", "action", "actor_id", "actor_name", "attributes") FROM STDIN` {
+		t.Errorf("unexpected copy statement %s", d.queries[0])
+	}
+
+	var row = batches[0][0]
+	if !row[0].(time.Time).Equal(time.Unix(0, 1500000000000000001)) ||
+		row[1] != "container" || row[2] != "start" || row[3] != "abc" || row[4] != "web" {
+		t.Errorf("unexpected row %v", row)
+	}
+
+	var attributes map[string]string
+	err := json.Unmarshal([]byte(row[5].(string)), &attributes)
+	if err != nil || attributes["image"] != "nginx" {
+		t.Errorf("expected the attributes as JSON, got %v", row[5])
+	}
+
+	if attrs := batches[0][1][5]; attrs != "{}" {
+		t.Errorf("expected empty attributes to be stored as {}, got %v", attrs)
+	}
+}
+
+func TestPostgresRetriesConnectionErrors(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		failures int
+		batches  int
+	}{
+		{desc: "reconnects", failures: 2, batches: 1},
+		{desc: "gives up", failures: 3, batches: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var (
+				d   = &copyDriver{failures: tc.failures}
+				agg = newTestPostgres(t, d, PostgresConfig{Table: "docker_events"})
+			)
+
+			runPostgres(t, agg, events.Message{Type: "container", Action: "start"})
+
+			if batches := d.batches(); len(batches) != tc.batches {
+				t.Errorf("expected %d committed batches, got %d", tc.batches, len(batches))
+			}
+		})
+	}
+}
+
+func TestNewPostgresRequiresDSN(t *testing.T) {
+	_, err := NewPostgres(PostgresConfig{})
+	if err == nil {
+		t.Fatal("expected an error without a DSN")
+	}
+}
@@ -1,152 +1,1529 @@
 package aggregators
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	defaultSubsystem                 = "devents"
+	defaultHealthPath                = "/healthz"
+	defaultReadyPath                 = "/ready"
+	defaultPrometheusShutdownTimeout = 5 * time.Second
+
+	// restartCountAttribute is the attribute carrying the restart
+	// count of containers, set by enriching their events.
+	restartCountAttribute = "restartCount"
+
+	// containerNameAttribute is the attribute naming the container
+	// of container events.
+	containerNameAttribute = "name"
+
+	// defaultNameLimit is how many container names each container
+	// metric tells apart when labelled by name.
+	defaultNameLimit = 100
+
+	// runningSeedPollInterval is how often the connection to the
+	// daemon is checked while waiting to seed the running
+	// containers.
+	runningSeedPollInterval = 100 * time.Millisecond
+)
+
+// Swarm event types that the vendored docker API doesn't define yet.
+const (
+	serviceEventType = "service"
+	nodeEventType    = "node"
+	secretEventType  = "secret"
+	configEventType  = "config"
+)
+
+// fixedLabels are the labels the actions counter of each event type
+// always has, before those coming from the actor attributes.
+var fixedLabels = map[string][]string{
+	events.ContainerEventType: {"action"},
+	events.ImageEventType:     {"action"},
+	events.NetworkEventType:   {"action", "name", "type"},
+	events.PluginEventType:    {"action", "name"},
+	events.VolumeEventType:    {"action", "driver"},
+	serviceEventType:          {"action", "name"},
+	nodeEventType:             {"action", "node_id"},
+	secretEventType:           {"action", "name"},
+	configEventType:           {"action", "name"},
+	events.DaemonEventType:    {"action"},
+}
+
+// defaultProcessingBuckets cover from sub-millisecond up to tens of
+// milliseconds, which is what handling a single event should take.
+var defaultProcessingBuckets = []float64{
+	.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05,
+}
+
+// lagBuckets cover from a few milliseconds, how long events should
+// take to get from the daemon to devents, up to minutes, for when
+// devents falls far behind.
+var lagBuckets = []float64{
+	.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300,
+}
+
+// defaultLifetimeBuckets cover from containers crashing right away
+// up to long-running services living for weeks.
+var defaultLifetimeBuckets = []float64{
+	1, 5, 15, 60, 300, 900, 3600, 3 * 3600, 12 * 3600, 86400, 7 * 86400, 30 * 86400,
+}
+
+// maxTrackedCreations bounds how many containers have their creation
+// time kept around, as those whose destruction devents doesn't get
+// to see (e.g., while it's not running) would otherwise leak.
+const maxTrackedCreations = 10000
+
+var (
+	_ Aggregator = (*Prometheus)(nil)
+	_ Reloader   = (*Prometheus)(nil)
+)
+
 type PrometheusConfig struct {
-	Path   string
-	Port   int
+	Path string
+	Port int
+
+	// Labels are the container attributes added as labels to
+	// the container actions counter. Equivalent to setting
+	// TypeLabels["container"].
 	Labels []string
+
+	// TypeLabels maps an event type (container, image, network,
+	// ...) to the actor attributes that should be added as labels
+	// to the actions counter of that type.
+	TypeLabels map[string][]string
+
+	// ImageRepos are the repositories (e.g., `nginx` or
+	// `ghcr.io/acme/app`) whose images are told apart by the
+	// `registry`, `repo` and `tag` labels of the image actions
+	// counter, the images of the others being labelled `other`.
+	// The counter has no such labels when empty.
+	ImageRepos []string
+
+	// ComposeLabels adds the `project` and `service` labels, out of
+	// the labels docker compose sets on the containers it creates,
+	// to the container metrics. Containers that aren't part of a
+	// compose project get `none`.
+	ComposeLabels bool
+
+	// SwarmLabels adds the `swarm_service` and `stack` labels, out
+	// of the labels swarm sets on the containers of its services,
+	// to the container metrics. Containers that aren't part of a
+	// service (or stack) get `none`.
+	SwarmLabels bool
+
+	// NameLabel adds the `name` label, the name of the containers,
+	// to the container metrics. As names tend to be unique (e.g.,
+	// generated ones), each metric tells at most NameLimit names
+	// apart (100 by default), labelling the others `__overflow__`.
+	NameLabel bool
+	NameLimit int
+
+	// NetworkContainerLabel adds the `container` label, the id of
+	// the container connected to (or disconnected from) a network,
+	// to the network actions counter. The other network actions
+	// get an empty one.
+	NetworkContainerLabel bool
+
+	// VolumeMounts counts the mounts and unmounts of volumes
+	// apart, by volume and by the container (id) mounting them,
+	// to correlate volumes with their consumers.
+	VolumeMounts bool
+
+	// Registry is where the metrics get registered and gathered
+	// from. A fresh registry is created when none is provided.
+	Registry *prometheus.Registry
+
+	// Namespace and Subsystem prefix the name of every metric.
+	// Subsystem defaults to "devents" while Namespace is empty
+	// by default.
+	Namespace string
+	Subsystem string
+
+	// SeriesTTL, when set, deletes the series of the counters
+	// labelled after things that come and go (e.g., the actions of
+	// containers, labelled by their attributes) once they haven't
+	// been updated for that long, which keeps the cardinality of
+	// ephemeral workloads bounded.
+	SeriesTTL time.Duration
+
+	// ExemplarAttribute, when set, is the actor attribute holding
+	// the id of the trace an event belongs to (e.g., a container
+	// label enriched into its events), which the counters the event
+	// increments get as an exemplar. Exemplars are exposed in the
+	// OpenMetrics format only, which is served once enabled.
+	ExemplarAttribute string
+
+	// ProcessingBuckets are the buckets (in seconds) of the event
+	// processing duration histogram, in increasing order. Defaults
+	// to buckets covering from 100µs up to 50ms, which are also
+	// used when those given are invalid.
+	ProcessingBuckets []float64
+
+	// LifetimeBuckets are the buckets (in seconds) of the container
+	// lifetime histogram, in increasing order. Defaults to buckets
+	// covering from a second up to a month, which are also used
+	// when those given are invalid.
+	LifetimeBuckets []float64
+
+	// ShutdownTimeout bounds how long in-flight scrapes are waited
+	// for when the aggregator stops. Defaults to 5s.
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile make the metrics endpoint be
+	// served over HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// RawActions disables the normalization of container actions
+	// that embed the command being executed (`exec_create: ...`,
+	// `exec_start: ...`), which otherwise get folded down to their
+	// base name to keep the cardinality of the `action` label low.
+	RawActions bool
+
+	// HealthPath is where a liveness endpoint is served. It
+	// reports 200 for as long as the event loop is running,
+	// regardless of the state of the docker daemon. Defaults
+	// to "/healthz".
+	HealthPath string
+
+	// ReadyPath is where a readiness endpoint is served. It
+	// reports 200 only while DockerConnected returns true and
+	// 503 otherwise. Defaults to "/ready".
+	ReadyPath string
+
+	// DockerConnected reports whether there's an open
+	// subscription to the docker daemon. When nil the
+	// readiness endpoint always reports ready.
+	DockerConnected func() bool
+
+	// RunningContainers, when set, lists the containers already
+	// running (as the `start` events they were started with) so
+	// that the running containers gauge accounts for those
+	// started before devents. It's called once DockerConnected
+	// reports the events stream open.
+	RunningContainers func(ctx context.Context) ([]events.Message, error)
+
+	// BasicAuthUser and BasicAuthPass, when set, protect the
+	// metrics endpoint with HTTP basic authentication.
+	BasicAuthUser string
+	BasicAuthPass string
+
+	// Logger is where the aggregator logs to. Defaults to the
+	// standard logger.
+	Logger *log.Logger
+
+	// Host is the value of the `host` constant label of every
+	// metric (usually the name of the machine devents runs on),
+	// which tells apart the metrics of each host once gathered
+	// in a central place. No such label is added when empty.
+	Host string
+
+	// HostAttribute is the actor attribute naming the daemon an
+	// event came from (set when collecting events from several
+	// daemons). The metrics of such events get its value as their
+	// `host` label in place of Host, with every daemon getting
+	// its own series.
+	HostAttribute string
 }
 
 type Prometheus struct {
-	labels []string
-	port   int
-	path   string
-	logger *log.Entry
+	labels    attributeLabels
+	port      int
+	path      string
+	logger    *log.Entry
+	registry  *prometheus.Registry
+	namespace string
+	subsystem string
+
+	// runningLabels are the attribute labels of the running
+	// containers gauge, which has a fixed `image` label.
+	runningLabels attributeLabels
+
+	// images tells the images apart in the image actions counter.
+	images imageAllowlist
+
+	// nameLimit caps the distinct names of containers in each
+	// container metric when they're labelled by name.
+	nameLimit int
+
+	volumeMounts bool
 
-	containerActions *prometheus.CounterVec
-	imageActions     *prometheus.CounterVec
-	networkActions   *prometheus.CounterVec
-	pluginActions    *prometheus.CounterVec
-	volumeActions    *prometheus.CounterVec
+	shutdownTimeout time.Duration
+	tlsConfig       *tls.Config
+	keyPair         *keyPair
+	basicAuthUser   string
+	basicAuthPass   string
+	healthPath      string
+	rawActions      bool
+	readyPath       string
+	dockerConnected func() bool
 
-	// not on stable yet
-	// serviceActions   *prometheus.CounterVec
-	// nodeActions      *prometheus.CounterVec
+	runningContainers func(ctx context.Context) ([]events.Message, error)
+
+	// alive is set to 1 while the event loop is running.
+	alive *int32
+
+	processingBuckets []float64
+	lifetimeBuckets   []float64
+	seriesTTL         time.Duration
+	exemplarAttribute string
+	host              string
+	hostAttribute     string
+
+	// metrics maps the name of each host to its metrics, created
+	// once the first event of the host comes.
+	metrics map[string]*prometheusMetrics
+}
+
+// prometheusMetrics are the metrics of the events of a single host,
+// all of which carry its name as their `host` constant label.
+type prometheusMetrics struct {
+	events            *prometheus.CounterVec
+	unhandled         *prometheus.CounterVec
+	errors            *prometheus.CounterVec
+	processing        *prometheus.HistogramVec
+	lag               prometheus.Histogram
+	lastEvent         prometheus.Gauge
+	containerActions  *prometheus.CounterVec
+	containersRunning *prometheus.GaugeVec
+	containerExits    *prometheus.CounterVec
+	containerHealth   *prometheus.GaugeVec
+	healthTransitions *prometheus.CounterVec
+	containerOOMs     *prometheus.CounterVec
+	containerRestarts *prometheus.CounterVec
+	containerLifetime prometheus.Histogram
+	containerKills    *prometheus.CounterVec
+	imageActions      *prometheus.CounterVec
+	imageSize         *prometheus.GaugeVec
+	networkActions    *prometheus.CounterVec
+	pluginActions     *prometheus.CounterVec
+	volumeActions     *prometheus.CounterVec
+	volumeMounts      *prometheus.CounterVec
+	serviceActions    *prometheus.CounterVec
+	nodeActions       *prometheus.CounterVec
+	secretActions     *prometheus.CounterVec
+	configActions     *prometheus.CounterVec
+	daemonActions     *prometheus.CounterVec
+
+	// running maps the ids of the containers known to be running
+	// to the label values (image, ...) they were started with, so
+	// that the running gauge is decremented for the same series it
+	// was incremented.
+	running map[string][]string
+
+	// actionNames and runningNames cap the distinct names of the
+	// container actions counter and the running containers gauge.
+	actionNames  *labelCap
+	runningNames *labelCap
+
+	// stale tracks the updates of the series of the counters that
+	// get swept once idle for the series TTL.
+	stale *staleSeries
+
+	// restarts maps the ids of the containers to the last restart
+	// count they were seen with, so that the restarts counter only
+	// grows by the restarts that happened since.
+	restarts map[string]int
+
+	// created maps the ids of the containers whose creation was
+	// seen to when they were created, so that their lifetime can
+	// be observed once they're destroyed.
+	created map[string]time.Time
+}
+
+// Validate checks the configuration, reporting every problem found:
+// the port must be a valid TCP port, the path must be absolute and
+// the attribute labels must not collide with each other (or with the
+// fixed labels) once sanitized.
+func (cfg PrometheusConfig) Validate() (err error) {
+	var problems ValidationErrors
+
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		problems = append(problems, errors.Errorf(
+			"metrics port %d must be between 1 and 65535", cfg.Port))
+	}
+
+	if !strings.HasPrefix(cfg.Path, "/") {
+		problems = append(problems, errors.Errorf(
+			"metrics path %q must start with /", cfg.Path))
+	}
+
+	if _, err := newImageAllowlist(cfg.ImageRepos); err != nil {
+		problems = append(problems, err)
+	}
+
+	var labels = cfg.attributeLabels()
+
+	var evTypes = make([]string, 0, len(labels))
+	for evType := range labels {
+		evTypes = append(evTypes, evType)
+	}
+	sort.Strings(evTypes)
+
+	for _, evType := range evTypes {
+		var seen = map[string]string{}
+		for _, name := range fixedLabels[evType] {
+			seen[name] = "the fixed label " + name
+		}
+
+		if evType == events.ImageEventType && len(cfg.ImageRepos) > 0 {
+			for _, name := range imageLabels {
+				seen[name] = "the image label " + name
+			}
+		}
+
+		if cfg.Host != "" || cfg.HostAttribute != "" {
+			seen["host"] = "the host label"
+		}
+
+		for _, key := range labels[evType] {
+			var name = labelName(key)
+			if previous, present := seen[name]; present {
+				problems = append(problems, errors.Errorf(
+					"%s label %s collides with %s once sanitized to %s",
+					evType, key, previous, name))
+				continue
+			}
+
+			seen[name] = key
+		}
+	}
+
+	return problems.Err()
+}
+
+// attributeLabels gathers the attributes turned into labels for each
+// event type.
+func (cfg PrometheusConfig) attributeLabels() attributeLabels {
+	var labels = attributeLabels{}
+	for evType, keys := range cfg.TypeLabels {
+		labels[evType] = append(labels[evType], keys...)
+	}
+
+	labels[events.ContainerEventType] = append(
+		labels[events.ContainerEventType], cfg.Labels...)
+	if cfg.ComposeLabels {
+		labels[events.ContainerEventType] = append(
+			labels[events.ContainerEventType], composeLabels...)
+	}
+
+	if cfg.SwarmLabels {
+		labels[events.ContainerEventType] = append(
+			labels[events.ContainerEventType], swarmLabels...)
+	}
+
+	if cfg.NameLabel {
+		labels[events.ContainerEventType] = append(
+			labels[events.ContainerEventType], containerNameAttribute)
+	}
+
+	if cfg.NetworkContainerLabel {
+		labels[events.NetworkEventType] = append(
+			labels[events.NetworkEventType], networkContainerAttribute)
+	}
+
+	return labels
 }
 
 func NewPrometheus(cfg PrometheusConfig) (agg Prometheus, err error) {
-	agg.logger = log.WithField("aggregator", "prometheus")
+	var logger = cfg.Logger
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+
+	agg.logger = logger.WithField("aggregator", "prometheus")
 	agg.port = cfg.Port
 	agg.path = cfg.Path
-	agg.labels = cfg.Labels
-
-	var containerActionLabels = []string{"action"}
-	for _, label := range agg.labels {
-		containerActionLabels = append(
-			containerActionLabels,
-			strings.Replace(label, ".", "_", -1))
-	}
-
-	agg.containerActions = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name:      "container_action",
-		Help:      "Docker container actions performed",
-		Subsystem: "devents",
-	}, containerActionLabels)
-
-	agg.imageActions = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name:      "image_action",
-		Help:      "Docker image actions performed",
-		Subsystem: "devents",
-	}, []string{"action"})
-
-	agg.networkActions = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name:      "network_action",
-		Help:      "Docker network actions performed",
-		Subsystem: "devents",
-	}, []string{"action", "name", "type"})
-
-	agg.pluginActions = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name:      "plugin_action",
-		Help:      "Docker plugin actions performed",
-		Subsystem: "devents",
-	}, []string{"action", "name"})
-
-	agg.volumeActions = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name:      "volume_action",
-		Help:      "Docker volume actions performed",
-		Subsystem: "devents",
-	}, []string{"action", "driver"})
-
-	prometheus.MustRegister(agg.containerActions)
-	prometheus.MustRegister(agg.imageActions)
-	prometheus.MustRegister(agg.networkActions)
-	prometheus.MustRegister(agg.pluginActions)
-	prometheus.MustRegister(agg.volumeActions)
+	agg.labels = cfg.attributeLabels()
+	agg.runningLabels = agg.labels.except("image")
+	agg.volumeMounts = cfg.VolumeMounts
+	if cfg.NameLabel {
+		agg.nameLimit = cfg.NameLimit
+		if agg.nameLimit <= 0 {
+			agg.nameLimit = defaultNameLimit
+		}
+	}
+
+	agg.images, err = newImageAllowlist(cfg.ImageRepos)
+	if err != nil {
+		return
+	}
+
+	agg.registry = cfg.Registry
+	if agg.registry == nil {
+		agg.registry = prometheus.NewRegistry()
+	}
+
+	agg.namespace = cfg.Namespace
+	agg.subsystem = cfg.Subsystem
+	if agg.subsystem == "" {
+		agg.subsystem = defaultSubsystem
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		agg.keyPair, err = loadKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return
+		}
+
+		agg.tlsConfig = agg.keyPair.tlsConfig()
+	}
+
+	agg.rawActions = cfg.RawActions
+	agg.alive = new(int32)
+	agg.healthPath = cfg.HealthPath
+	if agg.healthPath == "" {
+		agg.healthPath = defaultHealthPath
+	}
+
+	agg.readyPath = cfg.ReadyPath
+	if agg.readyPath == "" {
+		agg.readyPath = defaultReadyPath
+	}
+
+	agg.dockerConnected = cfg.DockerConnected
+	if agg.dockerConnected == nil {
+		agg.dockerConnected = func() bool { return true }
+	}
+
+	agg.runningContainers = cfg.RunningContainers
+
+	if agg.healthPath == agg.path ||
+		agg.readyPath == agg.path ||
+		agg.readyPath == agg.healthPath {
+		err = errors.Errorf(
+			"Metrics (%s), health (%s) and ready (%s) paths must differ",
+			agg.path, agg.healthPath, agg.readyPath)
+		return
+	}
+
+	agg.basicAuthUser = cfg.BasicAuthUser
+	agg.basicAuthPass = cfg.BasicAuthPass
+
+	agg.shutdownTimeout = cfg.ShutdownTimeout
+	if agg.shutdownTimeout <= 0 {
+		agg.shutdownTimeout = defaultPrometheusShutdownTimeout
+	}
+
+	if cfg.SeriesTTL < 0 {
+		err = errors.Errorf(
+			"Series TTL must not be negative, got %s", cfg.SeriesTTL)
+		return
+	}
+
+	agg.seriesTTL = cfg.SeriesTTL
+	agg.exemplarAttribute = cfg.ExemplarAttribute
+	agg.host = cfg.Host
+	agg.hostAttribute = cfg.HostAttribute
+	agg.metrics = map[string]*prometheusMetrics{}
+
+	agg.processingBuckets = agg.bucketsOr("processing",
+		cfg.ProcessingBuckets, defaultProcessingBuckets)
+	agg.lifetimeBuckets = agg.bucketsOr("lifetime",
+		cfg.LifetimeBuckets, defaultLifetimeBuckets)
+
+	_, err = agg.metricsOf(agg.host)
+	if err != nil {
+		return
+	}
 
 	agg.logger.Info("aggregator initialized")
 	return
 }
 
-func (p Prometheus) Run(evs <-chan events.Message, errs <-chan error) {
-	var handlerErrChan = make(chan error)
+// metricsOf returns the metrics of the host `host`, creating (and
+// registering) them if they don't exist yet.
+func (p Prometheus) metricsOf(host string) (m *prometheusMetrics, err error) {
+	m, present := p.metrics[host]
+	if present {
+		return
+	}
+
+	var constLabels prometheus.Labels
+	if p.host != "" || p.hostAttribute != "" {
+		constLabels = prometheus.Labels{"host": host}
+	}
 
-	go func() {
-		http.Handle(p.path, promhttp.Handler())
-		err := http.ListenAndServe(fmt.Sprintf(":%d", p.port), nil)
+	m = &prometheusMetrics{
+		running:  map[string][]string{},
+		restarts: map[string]int{},
+		created:  map[string]time.Time{},
+		stale:    newStaleSeries(p.seriesTTL),
+	}
+
+	if p.nameLimit > 0 {
+		var container = events.ContainerEventType
+
+		m.actionNames = newLabelCap(
+			p.logger.WithField("metric", "container_action"),
+			p.labels.index(container, len(fixedLabels[container]), containerNameAttribute),
+			p.nameLimit)
+		m.runningNames = newLabelCap(
+			p.logger.WithField("metric", "containers_running"),
+			p.runningLabels.index(container, 1, containerNameAttribute),
+			p.nameLimit)
+	}
+
+	m.events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "events_total",
+		Help:        "Docker events received, regardless of their type",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"type"})
+
+	m.unhandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "unhandled_events_total",
+		Help:        "Docker events of types without metrics of their own",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"type"})
+
+	m.errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "errors_total",
+		Help:        "Errors seen by the aggregator, split by where they came from",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"source"})
+
+	m.processing = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "event_processing_duration_seconds",
+		Help:        "Time spent handling a single docker event",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+		Buckets:     p.processingBuckets,
+	}, []string{"type"})
+
+	m.lag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        "event_lag_seconds",
+		Help:        "Time between docker emitting an event and devents handling it",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+		Buckets:     lagBuckets,
+	})
+
+	m.lastEvent = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "last_event_timestamp_seconds",
+		Help:        "Unix time of the last docker event received",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	})
+
+	m.containerActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_action",
+		Help:        "Docker container actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(events.ContainerEventType))
+
+	m.containersRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "containers_running",
+		Help:        "Docker containers currently running",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.runningLabels.names(events.ContainerEventType, "image"))
+
+	m.containerExits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_exits_total",
+		Help:        "Docker containers that exited, by exit code",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"exit_code"})
+
+	m.containerHealth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "container_health_status",
+		Help:        "Whether docker containers are healthy (1) or unhealthy (0), unset while their health is starting",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"name"})
+
+	m.healthTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_health_transitions_total",
+		Help:        "Docker container health status changes, by the status transitioned to",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"status"})
+
+	m.containerOOMs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_oom_total",
+		Help:        "Docker containers that ran out of memory",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"name", "image"})
+
+	m.containerRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_restarts_total",
+		Help:        "Docker containers restarted by their restart policy",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"name", "image"})
+
+	m.containerLifetime = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        "container_lifetime_seconds",
+		Help:        "Time between docker containers being created and destroyed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+		Buckets:     p.lifetimeBuckets,
+	})
+
+	m.containerKills = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "container_kills_total",
+		Help:        "Docker containers killed, by the signal sent",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, []string{"signal"})
+
+	m.imageActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "image_action",
+		Help:        "Docker image actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.names(events.ImageEventType,
+		append(fixedLabels[events.ImageEventType], p.images.labels()...)...))
+
+	if p.images != nil {
+		m.imageSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "image_size_bytes",
+			Help:        "Size of the docker images of the allowed repositories, as last reported by their events",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystem,
+			ConstLabels: constLabels,
+		}, imageLabels)
+	}
+
+	m.networkActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "network_action",
+		Help:        "Docker network actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(events.NetworkEventType))
+
+	m.pluginActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "plugin_action",
+		Help:        "Docker plugin actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(events.PluginEventType))
+
+	m.volumeActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "volume_action",
+		Help:        "Docker volume actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(events.VolumeEventType))
+
+	if p.volumeMounts {
+		m.volumeMounts = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "volume_mounts_total",
+			Help:        "Docker volumes mounted and unmounted by containers",
+			Namespace:   p.namespace,
+			Subsystem:   p.subsystem,
+			ConstLabels: constLabels,
+		}, []string{"action", "driver", "volume", "container"})
+	}
+
+	m.serviceActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "service_action",
+		Help:        "Docker swarm service actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(serviceEventType))
+
+	m.nodeActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "node_action",
+		Help:        "Docker swarm node actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(nodeEventType))
+
+	m.secretActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "secret_action",
+		Help:        "Docker swarm secret actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(secretEventType))
+
+	m.configActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "config_action",
+		Help:        "Docker swarm config actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(configEventType))
+
+	m.daemonActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "daemon_action",
+		Help:        "Docker daemon actions performed",
+		Namespace:   p.namespace,
+		Subsystem:   p.subsystem,
+		ConstLabels: constLabels,
+	}, p.labels.actionLabels(events.DaemonEventType))
+
+	for _, collector := range []prometheus.Collector{
+		m.events,
+		m.unhandled,
+		m.errors,
+		m.processing,
+		m.lag,
+		m.lastEvent,
+		m.containerActions,
+		m.containersRunning,
+		m.containerExits,
+		m.containerHealth,
+		m.healthTransitions,
+		m.containerOOMs,
+		m.containerRestarts,
+		m.containerLifetime,
+		m.containerKills,
+		m.imageActions,
+		m.networkActions,
+		m.pluginActions,
+		m.volumeActions,
+		m.serviceActions,
+		m.nodeActions,
+		m.secretActions,
+		m.configActions,
+		m.daemonActions,
+	} {
+		err = p.registry.Register(collector)
 		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't register prometheus collector")
+			return
+		}
+	}
+
+	if m.volumeMounts != nil {
+		err = p.registry.Register(m.volumeMounts)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't register prometheus collector")
+			return
+		}
+	}
+
+	if m.imageSize != nil {
+		err = p.registry.Register(m.imageSize)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't register prometheus collector")
+			return
+		}
+	}
+
+	p.metrics[host] = m
+	return
+}
+
+// sweepStale deletes the series of every host that weren't updated
+// for longer than the series TTL as of `now`, freeing the names whose
+// container actions series were all deleted from their cap.
+func (p Prometheus) sweepStale(now time.Time) {
+	var deleted = 0
+	for _, m := range p.metrics {
+		deleted += m.stale.sweep(now)
+
+		if m.actionNames != nil {
+			m.actionNames.retain(m.stale.values(m.containerActions, m.actionNames.index))
+		}
+	}
+
+	if deleted > 0 {
+		p.logger.
+			WithField("series", deleted).
+			Debug("deleted stale series")
+	}
+}
+
+// bucketsOr returns the buckets of the histogram `name`, falling back
+// to `defaults` when none are given or, with a warning, when those
+// given are invalid.
+func (p Prometheus) bucketsOr(name string, buckets, defaults []float64) []float64 {
+	if len(buckets) == 0 {
+		return defaults
+	}
+
+	if err := validateBuckets(name, buckets); err != nil {
+		p.logger.
+			WithError(err).
+			WithField("buckets", defaults).
+			Warn("invalid histogram buckets, falling back to the default ones")
+		return defaults
+	}
+
+	return buckets
+}
+
+// validateBuckets checks that the buckets of the histogram `name`, if
+// given, are positive and strictly increasing.
+func validateBuckets(name string, buckets []float64) (err error) {
+	for idx, bucket := range buckets {
+		if bucket <= 0 {
+			err = errors.Errorf(
+				"%s bucket %g must be positive", name, bucket)
+			return
+		}
+
+		if idx > 0 && bucket <= buckets[idx-1] {
+			err = errors.Errorf(
+				"%s buckets must be in increasing order, got %g after %g",
+				name, bucket, buckets[idx-1])
+			return
+		}
+	}
+
+	return
+}
+
+// emittedAt returns when docker emitted the event, as precisely as
+// it's known, if at all.
+func emittedAt(ev events.Message) (emitted time.Time, ok bool) {
+	switch {
+	case ev.TimeNano != 0:
+		return time.Unix(0, ev.TimeNano), true
+	case ev.Time != 0:
+		return time.Unix(ev.Time, 0), true
+	}
+
+	return
+}
+
+// countError counts an error that came from `source`.
+func (p Prometheus) countError(source string) {
+	p.metrics[p.host].errors.WithLabelValues(source).Inc()
+}
+
+// hostOf returns the name of the host an event came from.
+func (p Prometheus) hostOf(ev events.Message) string {
+	if p.hostAttribute != "" {
+		if host, present := ev.Actor.Attributes[p.hostAttribute]; present {
+			return host
+		}
+	}
+
+	return p.host
+}
+
+// Run serves the metrics endpoint while updating the metrics with
+// the events received.
+//
+// The listener is bound before Run starts consuming events and is
+// guaranteed to be released by the time Run returns, so a subsequent
+// call can reuse the same port.
+func (p Prometheus) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var (
+		handlerErrChan = make(chan error, 1)
+		serveDone      = make(chan struct{})
+		mux            = http.NewServeMux()
+		server         = &http.Server{
+			Addr:      fmt.Sprintf(":%d", p.port),
+			Handler:   mux,
+			TLSConfig: p.tlsConfig,
+		}
+	)
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't listen on %s for metrics", server.Addr)
+		return
+	}
+
+	// Exemplars are only exposed in the OpenMetrics format.
+	var metricsHandler = promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: p.exemplarAttribute != "",
+	})
+	if p.basicAuthUser != "" || p.basicAuthPass != "" {
+		metricsHandler = basicAuth(metricsHandler, p.basicAuthUser, p.basicAuthPass)
+	}
+
+	mux.Handle(p.path, metricsHandler)
+	mux.HandleFunc(p.healthPath, p.serveHealth)
+	mux.HandleFunc(p.readyPath, p.serveReady)
+	go func() {
+		defer close(serveDone)
+
+		var err error
+		if p.tlsConfig != nil {
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if err != nil && err != http.ErrServerClosed {
 			handlerErrChan <- err
 		}
 	}()
 
+	defer func() {
+		p.logger.Info("shutting down metrics HTTP server")
+
+		shutdownCtx, cancel := context.WithTimeout(
+			context.Background(), p.shutdownTimeout)
+		defer cancel()
+
+		shutdownErr := server.Shutdown(shutdownCtx)
+		if shutdownErr != nil {
+			shutdownErr = server.Close()
+		}
+		<-serveDone
+
+		if err == nil {
+			err = shutdownErr
+		}
+	}()
+
+	atomic.StoreInt32(p.alive, 1)
+	defer atomic.StoreInt32(p.alive, 0)
+
+	var seed = p.seedRunning(ctx)
+
+	var sweep <-chan time.Time
+	if p.seriesTTL > 0 {
+		var ticker = time.NewTicker(p.seriesTTL / 2)
+		defer ticker.Stop()
+
+		sweep = ticker.C
+	}
+
 	p.logger.Info("listening to events")
 	for {
 		select {
+		case <-ctx.Done():
+			return
+		case now := <-sweep:
+			p.sweepStale(now)
+		case running, ok := <-seed.running:
+			if ok {
+				p.applySeed(running, seed.stopped)
+			}
+			seed.running, seed.stopped = nil, nil
 		case err := <-handlerErrChan:
+			p.countError("http_handler")
 			p.logger.
 				WithError(err).
 				Error("metrics HTTP handler failed")
-		case err := <-errs:
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			p.countError("events_stream")
 			p.logger.
 				WithError(err).
 				Error("events retrieval failed")
-		case ev := <-evs:
-			switch ev.Type {
-			case events.ContainerEventType:
-				labelValues := []string{
-					ev.Action,
-				}
-
-				attrs := ev.Actor.Attributes
-				for _, label := range p.labels {
-					v, _ := attrs[label]
-					labelValues = append(labelValues, v)
-				}
-				p.containerActions.
-					WithLabelValues(labelValues...).
-					Inc()
-			case events.ImageEventType:
-				p.imageActions.WithLabelValues(ev.Action).Inc()
-			case events.NetworkEventType:
-				netName, _ := ev.Actor.Attributes["name"]
-				netType, _ := ev.Actor.Attributes["type"]
-
-				p.networkActions.
-					WithLabelValues(ev.Action, netName, netType).
-					Inc()
-			case events.PluginEventType:
-				pluginName, _ := ev.Actor.Attributes["name"]
-
-				p.pluginActions.
-					WithLabelValues(ev.Action, pluginName).
-					Inc()
-			case events.VolumeEventType:
-				volDriver, _ := ev.Actor.Attributes["driver"]
-				p.volumeActions.
-					WithLabelValues(ev.Action, volDriver).
-					Inc()
+		case ev, ok := <-evs:
+			if !ok {
+				p.logger.Info("events channel closed")
+				return
+			}
+
+			seed.observe(ev)
+			p.handleEvent(ev)
+		}
+	}
+}
+
+// Reload reloads the TLS certificate of the metrics endpoint, if
+// any, from its files.
+func (p Prometheus) Reload() (err error) {
+	if p.keyPair == nil {
+		return
+	}
+
+	return p.keyPair.reload()
+}
+
+// serveHealth reports whether the event loop is still running.
+func (p Prometheus) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(p.alive) != 1 {
+		http.Error(w, "event loop not running",
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// serveReady reports whether events are currently flowing from the
+// docker daemon.
+func (p Prometheus) serveReady(w http.ResponseWriter, r *http.Request) {
+	var (
+		status = http.StatusOK
+		state  = struct {
+			Ready  bool   `json:"ready"`
+			Docker string `json:"docker"`
+		}{
+			Ready:  true,
+			Docker: "connected",
+		}
+	)
+
+	if !p.dockerConnected() {
+		status = http.StatusServiceUnavailable
+		state.Ready = false
+		state.Docker = "disconnected"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(state)
+}
+
+// basicAuth wraps a handler so that it's only served to requests
+// carrying the given basic authentication credentials.
+func basicAuth(handler http.Handler, user, pass string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqUser, reqPass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(reqUser), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(reqPass), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="devents"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized),
+				http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (p Prometheus) handleEvent(ev events.Message) {
+	m, err := p.metricsOf(p.hostOf(ev))
+	if err != nil {
+		p.logger.
+			WithError(err).
+			Error("couldn't create the metrics of the host")
+		return
+	}
+
+	var start = time.Now()
+	defer func() {
+		m.processing.
+			WithLabelValues(ev.Type).
+			Observe(time.Since(start).Seconds())
+	}()
+
+	var exemplar = exemplarOf(ev, p.exemplarAttribute)
+
+	addCounter(m.events.WithLabelValues(ev.Type), 1, exemplar)
+	p.observeLag(m, ev, start)
+	if emitted, ok := emittedAt(ev); ok {
+		m.lastEvent.Set(float64(emitted.UnixNano()) / 1e9)
+	} else {
+		m.lastEvent.Set(float64(start.UnixNano()) / 1e9)
+	}
+
+	switch ev.Type {
+	case events.ContainerEventType:
+		p.handleContainerEvent(m, ev, exemplar)
+	case events.ImageEventType:
+		m.stale.inc(m.imageActions, exemplar, p.labels.values(ev,
+			append([]string{ev.Action}, p.images.values(ev)...)...)...)
+		p.observeImageSize(m, ev)
+	case events.NetworkEventType:
+		netName, _ := ev.Actor.Attributes["name"]
+		netType, _ := ev.Actor.Attributes["type"]
+
+		m.stale.inc(m.networkActions, exemplar,
+			p.labels.values(ev, ev.Action, netName, netType)...)
+	case events.PluginEventType:
+		pluginName, _ := ev.Actor.Attributes["name"]
+
+		m.stale.inc(m.pluginActions, exemplar,
+			p.labels.values(ev, ev.Action, pluginName)...)
+	case events.VolumeEventType:
+		volDriver, _ := ev.Actor.Attributes["driver"]
+		m.stale.inc(m.volumeActions, exemplar,
+			p.labels.values(ev, ev.Action, volDriver)...)
+
+		if m.volumeMounts != nil && (ev.Action == "mount" || ev.Action == "unmount") {
+			m.stale.inc(m.volumeMounts, exemplar,
+				ev.Action, volDriver, ev.Actor.ID, ev.Actor.Attributes["container"])
+		}
+	case serviceEventType:
+		serviceName, _ := ev.Actor.Attributes["name"]
+		m.stale.inc(m.serviceActions, exemplar,
+			p.labels.values(ev, ev.Action, serviceName)...)
+	case nodeEventType:
+		m.stale.inc(m.nodeActions, exemplar,
+			p.labels.values(ev, ev.Action, ev.Actor.ID)...)
+	case secretEventType:
+		secretName, _ := ev.Actor.Attributes["name"]
+		m.stale.inc(m.secretActions, exemplar,
+			p.labels.values(ev, ev.Action, secretName)...)
+	case configEventType:
+		configName, _ := ev.Actor.Attributes["name"]
+		m.stale.inc(m.configActions, exemplar,
+			p.labels.values(ev, ev.Action, configName)...)
+	case events.DaemonEventType:
+		m.stale.inc(m.daemonActions, exemplar,
+			p.labels.values(ev, ev.Action)...)
+	default:
+		m.unhandled.WithLabelValues(ev.Type).Inc()
+	}
+}
+
+// observeLag records how long after docker emitted the event it's
+// being handled at `now`. Events emitted in the future, according to
+// the local clock, are taken as handled right away as the clocks of
+// the daemon and devents (if on different hosts) may be skewed.
+func (p Prometheus) observeLag(m *prometheusMetrics, ev events.Message, now time.Time) {
+	emitted, ok := emittedAt(ev)
+	if !ok {
+		return
+	}
+
+	var lag = now.Sub(emitted)
+	if lag < 0 {
+		p.logger.
+			WithField("lag", lag).
+			Debug("event emitted in the future, clocks may be skewed")
+		lag = 0
+	}
+
+	m.lag.Observe(lag.Seconds())
+}
+
+// observeImageSize sets the size of the image of an image event, as
+// reported by its `size` attribute (see the `size` enrichment field).
+// Events without it, or whose image isn't allowed, are skipped rather
+// than reported as empty images.
+func (p Prometheus) observeImageSize(m *prometheusMetrics, ev events.Message) {
+	if m.imageSize == nil {
+		return
+	}
+
+	raw, present := ev.Actor.Attributes[imageSizeAttribute]
+	if !present {
+		return
+	}
+
+	size, err := strconv.ParseFloat(raw, 64)
+	if err != nil || size < 0 {
+		p.logger.
+			WithField("size", raw).
+			Debug("malformed image size")
+		return
+	}
+
+	var values = p.images.values(ev)
+	if values[0] == otherImageLabel || values[0] == missingImageLabel {
+		return
+	}
+
+	m.imageSize.WithLabelValues(values...).Set(size)
+}
+
+func (p Prometheus) handleContainerEvent(m *prometheusMetrics, ev events.Message, exemplar prometheus.Labels) {
+	var action = ev.Action
+	if !p.rawActions {
+		action = normalizeAction(action)
+	}
+
+	attrs := ev.Actor.Attributes
+	m.stale.inc(m.containerActions, exemplar,
+		m.actionNames.apply(p.labels.values(ev, action))...)
+
+	switch ev.Action {
+	case "die":
+		m.containerExits.
+			WithLabelValues(exitCode(attrs)).
+			Inc()
+	case "kill":
+		signal, present := attrs["signal"]
+		if !present || signal == "" {
+			signal = "unknown"
+		}
+
+		m.containerKills.WithLabelValues(signal).Inc()
+	case "oom":
+		m.stale.inc(m.containerOOMs, exemplar,
+			attrs["name"], attrs["image"])
+	case "destroy":
+		m.containerHealth.DeleteLabelValues(attrs["name"])
+	}
+
+	if status, ok := parseHealthStatus(ev.Action); ok {
+		m.trackHealth(attrs["name"], status)
+	}
+
+	m.trackRestarts(ev, exemplar)
+	m.trackLifetime(ev)
+	p.trackRunning(m, ev)
+}
+
+// trackLifetime observes the lifetime of destroyed containers out of
+// the time they were created at. Containers whose creation wasn't
+// seen (e.g., those created before devents started) are skipped.
+func (m *prometheusMetrics) trackLifetime(ev events.Message) {
+	emitted, ok := emittedAt(ev)
+	if !ok {
+		return
+	}
+
+	switch ev.Action {
+	case "create":
+		if _, present := m.created[ev.Actor.ID]; !present && len(m.created) >= maxTrackedCreations {
+			m.forgetOldestCreation()
+		}
+
+		m.created[ev.Actor.ID] = emitted
+	case "destroy":
+		created, present := m.created[ev.Actor.ID]
+		if !present {
+			return
+		}
+
+		delete(m.created, ev.Actor.ID)
+
+		var lifetime = emitted.Sub(created)
+		if lifetime < 0 {
+			lifetime = 0
+		}
+
+		m.containerLifetime.Observe(lifetime.Seconds())
+	}
+}
+
+// forgetOldestCreation makes room for a container creation by
+// forgetting the container created the longest ago, the most likely
+// to have been destroyed without devents noticing.
+func (m *prometheusMetrics) forgetOldestCreation() {
+	var (
+		oldestID string
+		oldest   time.Time
+	)
+
+	for id, created := range m.created {
+		if oldestID == "" || created.Before(oldest) {
+			oldestID, oldest = id, created
+		}
+	}
+
+	delete(m.created, oldestID)
+}
+
+// trackRestarts counts the restarts of a container out of the restart
+// count its events carry once enriched (see `--dockerenrich
+// restarts`). Events without it are skipped.
+func (m *prometheusMetrics) trackRestarts(ev events.Message, exemplar prometheus.Labels) {
+	if ev.Action == "destroy" {
+		delete(m.restarts, ev.Actor.ID)
+		return
+	}
+
+	value, present := ev.Actor.Attributes[restartCountAttribute]
+	if !present {
+		return
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return
+	}
+
+	last := m.restarts[ev.Actor.ID]
+	m.restarts[ev.Actor.ID] = count
+
+	if count > last {
+		m.stale.add(m.containerRestarts, float64(count-last), exemplar,
+			ev.Actor.Attributes["name"], ev.Actor.Attributes["image"])
+	}
+}
+
+// trackHealth records `status` as the current health status of the
+// container named `name`: 1 when healthy, 0 when unhealthy. While
+// it's starting (or in any other state) the container is neither, so
+// that its series is removed until the first check settles it.
+func (m *prometheusMetrics) trackHealth(name, status string) {
+	m.healthTransitions.WithLabelValues(status).Inc()
+
+	switch status {
+	case "healthy":
+		m.containerHealth.WithLabelValues(name).Set(1)
+	case "unhealthy":
+		m.containerHealth.WithLabelValues(name).Set(0)
+	default:
+		m.containerHealth.DeleteLabelValues(name)
+	}
+}
+
+// exitCode retrieves the exit code of a container from the attributes
+// of its `die` event, falling back to "unknown" when it's missing or
+// isn't a number.
+func exitCode(attrs map[string]string) string {
+	code, present := attrs["exitCode"]
+	if !present {
+		return "unknown"
+	}
+
+	if _, err := strconv.Atoi(code); err != nil {
+		return "unknown"
+	}
+
+	return code
+}
+
+// trackRunning keeps the running containers gauge up to date.
+//
+// Containers that stop without having been seen starting (e.g.,
+// started before devents) are ignored so that the gauge never goes
+// below the number of containers actually running.
+func (p Prometheus) trackRunning(m *prometheusMetrics, ev events.Message) {
+	switch ev.Action {
+	case "start":
+		if _, present := m.running[ev.Actor.ID]; present {
+			return
+		}
+
+		image, _ := ev.Actor.Attributes["image"]
+		values := m.runningNames.apply(p.runningLabels.values(ev, image))
+		m.running[ev.Actor.ID] = values
+		m.containersRunning.WithLabelValues(values...).Inc()
+	case "die", "stop", "destroy":
+		values, present := m.running[ev.Actor.ID]
+		if !present {
+			return
+		}
+
+		delete(m.running, ev.Actor.ID)
+		m.containersRunning.WithLabelValues(values...).Dec()
+	}
+}
+
+// runningSeed is the listing of the containers running when the
+// aggregator started, as it's being taken.
+type runningSeed struct {
+	// running delivers the listing, or gets closed if it can't
+	// be taken. It's nil once done with, as is stopped.
+	running <-chan []events.Message
+
+	// stopped are the containers seen stopping while the listing
+	// was being taken, which it may still have running.
+	stopped map[string]bool
+}
+
+// seedRunning lists, in the background, the containers running once
+// the events stream is open. Listing them only then means that those
+// stopping afterwards are seen stopping, while the ones starting in
+// between are tracked only once as tracking is idempotent.
+func (p Prometheus) seedRunning(ctx context.Context) (seed *runningSeed) {
+	seed = &runningSeed{}
+	if p.runningContainers == nil {
+		return
+	}
+
+	var running = make(chan []events.Message, 1)
+
+	seed.running = running
+	seed.stopped = map[string]bool{}
+
+	go func() {
+		defer close(running)
+
+		var ticker = time.NewTicker(runningSeedPollInterval)
+		defer ticker.Stop()
+
+		for !p.dockerConnected() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 			}
+		}
 
+		evs, err := p.runningContainers(ctx)
+		if err != nil {
+			p.logger.
+				WithError(err).
+				Error("couldn't seed running containers")
+			return
 		}
+
+		running <- evs
+	}()
+
+	return
+}
+
+// observe notes the containers stopping while the listing is taken.
+func (s *runningSeed) observe(ev events.Message) {
+	if s.stopped == nil || ev.Type != events.ContainerEventType {
+		return
 	}
+
+	switch ev.Action {
+	case "die", "stop", "destroy":
+		s.stopped[ev.Actor.ID] = true
+	}
+}
+
+// applySeed tracks the containers listed as running, except those
+// that stopped since.
+func (p Prometheus) applySeed(running []events.Message, stopped map[string]bool) {
+	var seeded = 0
+
+	for _, ev := range running {
+		if stopped[ev.Actor.ID] {
+			continue
+		}
+
+		m, err := p.metricsOf(p.hostOf(ev))
+		if err != nil {
+			p.logger.
+				WithError(err).
+				Error("couldn't create the metrics of the host")
+			continue
+		}
+
+		p.trackRunning(m, ev)
+		seeded++
+	}
+
+	p.logger.
+		WithField("containers", seeded).
+		Info("seeded running containers")
 }
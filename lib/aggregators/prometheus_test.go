@@ -0,0 +1,897 @@
+package aggregators
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// newTestPrometheus creates a Prometheus aggregator out of `cfg`,
+// filling in the settings every one of them needs.
+func newTestPrometheus(t *testing.T, cfg PrometheusConfig) *Prometheus {
+	t.Helper()
+
+	cfg.Port = 9090
+	cfg.Path = "/metrics"
+	if cfg.Registry == nil {
+		cfg.Registry = prometheus.NewRegistry()
+	}
+
+	p, err := NewPrometheus(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &p
+}
+
+// gather returns the metric family `name` registered by `p`, or nil
+// if it has no series.
+func (p *Prometheus) gather(t *testing.T, name string) *dto.MetricFamily {
+	t.Helper()
+
+	families, err := p.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+	}
+
+	return nil
+}
+
+// upperBounds returns the buckets of the first histogram of `family`.
+func upperBounds(t *testing.T, family *dto.MetricFamily) (bounds []float64) {
+	t.Helper()
+
+	if family == nil || len(family.GetMetric()) == 0 {
+		t.Fatal("expected the histogram to have been observed")
+	}
+
+	for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+		bounds = append(bounds, bucket.GetUpperBound())
+	}
+
+	return
+}
+
+// observeLifetime has a container created and destroyed a minute
+// later go through `p`.
+func observeLifetime(p *Prometheus) {
+	var created = time.Now()
+
+	for _, ev := range []events.Message{
+		{Action: "create", TimeNano: created.UnixNano()},
+		{Action: "destroy", TimeNano: created.Add(time.Minute).UnixNano()},
+	} {
+		ev.Type = events.ContainerEventType
+		ev.Actor = events.Actor{ID: "c1", Attributes: map[string]string{"name": "web"}}
+		p.handleEvent(ev)
+	}
+}
+
+func TestPrometheusBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		processing []float64
+		lifetime   []float64
+		expected   [2][]float64
+	}{
+		{
+			name:     "defaults",
+			expected: [2][]float64{defaultProcessingBuckets, defaultLifetimeBuckets},
+		},
+		{
+			name:       "custom",
+			processing: []float64{0.001, 0.01, 0.1},
+			lifetime:   []float64{60, 3600},
+			expected:   [2][]float64{{0.001, 0.01, 0.1}, {60, 3600}},
+		},
+		{
+			name:       "invalid",
+			processing: []float64{0.1, 0.01},
+			lifetime:   []float64{-1, 60},
+			expected:   [2][]float64{defaultProcessingBuckets, defaultLifetimeBuckets},
+		},
+		{
+			name:       "empty",
+			processing: []float64{},
+			lifetime:   []float64{60, 60},
+			expected:   [2][]float64{defaultProcessingBuckets, defaultLifetimeBuckets},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg = PrometheusConfig{
+				Port:              9090,
+				Path:              "/metrics",
+				ProcessingBuckets: tc.processing,
+				LifetimeBuckets:   tc.lifetime,
+			}
+
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("expected the buckets not to fail validation, got %v", err)
+			}
+
+			var p = newTestPrometheus(t, cfg)
+			observeLifetime(p)
+
+			var processing = upperBounds(t,
+				p.gather(t, "devents_event_processing_duration_seconds"))
+			if !reflect.DeepEqual(processing, tc.expected[0]) {
+				t.Errorf("expected processing buckets %v, got %v", tc.expected[0], processing)
+			}
+
+			var lifetime = upperBounds(t,
+				p.gather(t, "devents_container_lifetime_seconds"))
+			if !reflect.DeepEqual(lifetime, tc.expected[1]) {
+				t.Errorf("expected lifetime buckets %v, got %v", tc.expected[1], lifetime)
+			}
+		})
+	}
+}
+
+// containerEvent is an event of the container named `name`.
+func containerEvent(action, name string) events.Message {
+	return events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         name + "-id",
+			Attributes: map[string]string{"name": name, "image": "nginx"},
+		},
+	}
+}
+
+func TestPrometheusLag(t *testing.T) {
+	var (
+		p   = newTestPrometheus(t, PrometheusConfig{})
+		now = time.Now().Truncate(time.Second)
+	)
+
+	for _, ev := range []events.Message{
+		{TimeNano: now.Add(-time.Minute).UnixNano()},
+		{Time: now.Add(-time.Hour).Unix()},
+		{TimeNano: now.Add(time.Hour).UnixNano()},
+		{},
+	} {
+		p.observeLag(p.metrics[""], ev, now)
+	}
+
+	var metric dto.Metric
+	if err := p.metrics[""].lag.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+
+	// the event without a time isn't observed while the one from the
+	// future is taken as handled right away
+	if count := metric.GetHistogram().GetSampleCount(); count != 3 {
+		t.Errorf("expected 3 events to be observed, got %d", count)
+	}
+
+	if sum := metric.GetHistogram().GetSampleSum(); sum != 3660 {
+		t.Errorf("expected lags of a minute and an hour, got %gs", sum)
+	}
+}
+
+func TestPrometheusLastEvent(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		ev       events.Message
+		expected float64
+	}{
+		{
+			desc:     "nanoseconds",
+			ev:       events.Message{Time: 1500000060, TimeNano: 1500000060500000000},
+			expected: 1500000060.5,
+		},
+		{
+			desc:     "seconds only",
+			ev:       events.Message{Time: 1500000060},
+			expected: 1500000060,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var p = newTestPrometheus(t, PrometheusConfig{})
+
+			tc.ev.Type = events.NetworkEventType
+			p.handleEvent(tc.ev)
+
+			if value := testutil.ToFloat64(p.metrics[""].lastEvent); value != tc.expected {
+				t.Errorf("expected the last event at %f, got %f", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestPrometheusHealth(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{})
+		m = p.metrics[""]
+	)
+
+	for _, tc := range []struct {
+		action string
+		series int
+		value  float64
+	}{
+		{action: "health_status: starting", series: 0},
+		{action: "health_status: healthy", series: 1, value: 1},
+		{action: "health_status: unhealthy", series: 1, value: 0},
+		{action: "health_status: healthy", series: 1, value: 1},
+		{action: "destroy", series: 0},
+	} {
+		p.handleEvent(containerEvent(tc.action, "web"))
+
+		if series := testutil.CollectAndCount(m.containerHealth); series != tc.series {
+			t.Fatalf("after %s: expected %d health series, got %d", tc.action, tc.series, series)
+		}
+
+		if tc.series == 0 {
+			continue
+		}
+
+		if value := testutil.ToFloat64(m.containerHealth.WithLabelValues("web")); value != tc.value {
+			t.Errorf("after %s: expected health %g, got %g", tc.action, tc.value, value)
+		}
+	}
+
+	for status, expected := range map[string]float64{"starting": 1, "healthy": 2, "unhealthy": 1} {
+		if count := testutil.ToFloat64(m.healthTransitions.WithLabelValues(status)); count != expected {
+			t.Errorf("expected %g transitions to %s, got %g", expected, status, count)
+		}
+	}
+}
+
+func TestPrometheusDoubleRegistration(t *testing.T) {
+	var (
+		registry = prometheus.NewRegistry()
+		cfg      = PrometheusConfig{Port: 9090, Path: "/metrics", Registry: registry}
+	)
+
+	if _, err := NewPrometheus(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewPrometheus(cfg); err == nil {
+		t.Errorf("expected registering the metrics twice to fail")
+	}
+}
+
+func TestPrometheusOOM(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(containerEvent("oom", "web"))
+	p.handleEvent(containerEvent("oom", "web"))
+	p.handleEvent(containerEvent("die", "web"))
+
+	if count := testutil.ToFloat64(m.containerOOMs.WithLabelValues("web", "nginx")); count != 2 {
+		t.Errorf("expected 2 OOM kills of web, got %g", count)
+	}
+
+	if series := testutil.CollectAndCount(m.containerOOMs); series != 1 {
+		t.Errorf("expected a single OOM series, got %d", series)
+	}
+}
+
+func TestPrometheusSeedRunning(t *testing.T) {
+	var (
+		connected int32
+		listed    = make(chan struct{})
+		release   = make(chan struct{})
+	)
+
+	var p = newTestPrometheus(t, PrometheusConfig{
+		DockerConnected: func() bool { return atomic.LoadInt32(&connected) == 1 },
+		RunningContainers: func(ctx context.Context) ([]events.Message, error) {
+			close(listed)
+			<-release
+
+			return []events.Message{
+				containerEvent("start", "web"),
+				containerEvent("start", "db"),
+				containerEvent("start", "cache"),
+			}, nil
+		},
+	})
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	var seed = p.seedRunning(ctx)
+
+	// nothing gets listed before the events stream is open
+	select {
+	case <-listed:
+		t.Fatal("expected the containers to be listed only once connected")
+	case <-time.After(2 * runningSeedPollInterval):
+	}
+
+	atomic.StoreInt32(&connected, 1)
+	<-listed
+
+	// db stops while the listing is taken, and a container starts
+	for _, ev := range []events.Message{
+		containerEvent("die", "db"),
+		containerEvent("start", "api"),
+	} {
+		seed.observe(ev)
+		p.handleEvent(ev)
+	}
+	close(release)
+
+	p.applySeed(<-seed.running, seed.stopped)
+
+	var m = p.metrics[""]
+	if running := testutil.ToFloat64(m.containersRunning.WithLabelValues("nginx")); running != 3 {
+		t.Errorf("expected web, cache and api to be running, got %g", running)
+	}
+
+	// containers seeded as running are seen stopping
+	p.handleEvent(containerEvent("die", "web"))
+	if running := testutil.ToFloat64(m.containersRunning.WithLabelValues("nginx")); running != 2 {
+		t.Errorf("expected cache and api to be running, got %g", running)
+	}
+}
+
+func TestPrometheusRestarts(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{})
+		m = p.metrics[""]
+	)
+
+	// withRestarts is the die event of web carrying `count` as its
+	// restart count, if any.
+	var withRestarts = func(count string) events.Message {
+		var ev = containerEvent("die", "web")
+		if count != "" {
+			ev.Actor.Attributes[restartCountAttribute] = count
+		}
+		return ev
+	}
+
+	// events without the attribute don't create the series
+	p.handleEvent(withRestarts(""))
+	if series := testutil.CollectAndCount(m.containerRestarts); series != 0 {
+		t.Fatalf("expected no restarts series without a restart count, got %d", series)
+	}
+
+	for _, tc := range []struct {
+		count    string
+		expected float64
+	}{
+		{count: "1", expected: 1},
+		{count: "2", expected: 2},
+		{count: "2", expected: 2},
+		{count: "5", expected: 5},
+		{count: "", expected: 5},
+		{count: "abc", expected: 5},
+	} {
+		p.handleEvent(withRestarts(tc.count))
+
+		if count := testutil.ToFloat64(m.containerRestarts.WithLabelValues("web", "nginx")); count != tc.expected {
+			t.Errorf("after a restart count of %q: expected %g restarts, got %g", tc.count, tc.expected, count)
+		}
+	}
+
+	// a new container under the same name starts counting from
+	// scratch, adding up to the same series
+	p.handleEvent(containerEvent("destroy", "web"))
+	p.handleEvent(withRestarts("1"))
+
+	if count := testutil.ToFloat64(m.containerRestarts.WithLabelValues("web", "nginx")); count != 6 {
+		t.Errorf("expected the restarts of the new container to be added, got %g", count)
+	}
+}
+
+// networkEvent is a `network` event of action `action` on the bridge
+// network, naming `container` if any.
+func networkEvent(action, container string) events.Message {
+	var ev = events.Message{
+		Type:   events.NetworkEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         "bridge-id",
+			Attributes: map[string]string{"name": "bridge", "type": "bridge"},
+		},
+	}
+
+	if container != "" {
+		ev.Actor.Attributes[networkContainerAttribute] = container
+	}
+
+	return ev
+}
+
+func TestPrometheusNetworkContainerLabel(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{NetworkContainerLabel: true})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(networkEvent("create", ""))
+	p.handleEvent(networkEvent("connect", "abc"))
+	p.handleEvent(networkEvent("connect", "def"))
+	p.handleEvent(networkEvent("disconnect", "abc"))
+
+	for _, tc := range []struct {
+		action, container string
+	}{
+		{action: "create", container: ""},
+		{action: "connect", container: "abc"},
+		{action: "connect", container: "def"},
+		{action: "disconnect", container: "abc"},
+	} {
+		var counter = m.networkActions.WithLabelValues(tc.action, "bridge", "bridge", tc.container)
+		if count := testutil.ToFloat64(counter); count != 1 {
+			t.Errorf("expected a single %s of %q, got %g", tc.action, tc.container, count)
+		}
+	}
+
+	if series := testutil.CollectAndCount(m.networkActions); series != 4 {
+		t.Errorf("expected a series per action and container, got %d", series)
+	}
+}
+
+func TestPrometheusNetworkContainerLabelDisabled(t *testing.T) {
+	var p = newTestPrometheus(t, PrometheusConfig{})
+
+	p.handleEvent(networkEvent("connect", "abc"))
+	p.handleEvent(networkEvent("connect", "def"))
+
+	var family = p.gather(t, "devents_network_action")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatalf("expected the connects to share a series, got %v", family)
+	}
+
+	for _, label := range family.GetMetric()[0].GetLabel() {
+		if label.GetName() == networkContainerAttribute {
+			t.Errorf("expected no %s label unless enabled", networkContainerAttribute)
+		}
+	}
+
+	if count := family.GetMetric()[0].GetCounter().GetValue(); count != 2 {
+		t.Errorf("expected 2 connects, got %g", count)
+	}
+}
+
+// volumeEvent is a `volume` event of action `action` on the local
+// volume `data`, naming `container` if any.
+func volumeEvent(action, container string) events.Message {
+	var ev = events.Message{
+		Type:   events.VolumeEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         "data",
+			Attributes: map[string]string{"driver": "local"},
+		},
+	}
+
+	if container != "" {
+		ev.Actor.Attributes["container"] = container
+	}
+
+	return ev
+}
+
+func TestPrometheusVolumeMounts(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{VolumeMounts: true})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(volumeEvent("create", ""))
+	p.handleEvent(volumeEvent("mount", "abc"))
+	p.handleEvent(volumeEvent("mount", "abc"))
+	p.handleEvent(volumeEvent("mount", "def"))
+	p.handleEvent(volumeEvent("unmount", "abc"))
+	p.handleEvent(volumeEvent("destroy", ""))
+
+	for _, tc := range []struct {
+		action, container string
+		expected          float64
+	}{
+		{action: "mount", container: "abc", expected: 2},
+		{action: "mount", container: "def", expected: 1},
+		{action: "unmount", container: "abc", expected: 1},
+	} {
+		var counter = m.volumeMounts.WithLabelValues(tc.action, "local", "data", tc.container)
+		if count := testutil.ToFloat64(counter); count != tc.expected {
+			t.Errorf("expected %g %s of data by %s, got %g", tc.expected, tc.action, tc.container, count)
+		}
+	}
+
+	// other actions are only counted by the volume actions counter
+	if series := testutil.CollectAndCount(m.volumeMounts); series != 3 {
+		t.Errorf("expected only mounts and unmounts to be counted, got %d series", series)
+	}
+
+	for action, expected := range map[string]float64{"create": 1, "mount": 3, "unmount": 1, "destroy": 1} {
+		if count := testutil.ToFloat64(m.volumeActions.WithLabelValues(action, "local")); count != expected {
+			t.Errorf("expected %g volume %s actions, got %g", expected, action, count)
+		}
+	}
+}
+
+func TestPrometheusVolumeMountsDisabled(t *testing.T) {
+	var p = newTestPrometheus(t, PrometheusConfig{})
+
+	p.handleEvent(volumeEvent("mount", "abc"))
+
+	if p.metrics[""].volumeMounts != nil || p.gather(t, "devents_volume_mounts_total") != nil {
+		t.Errorf("expected no volume mounts counter unless enabled")
+	}
+}
+
+func TestPrometheusSeriesTTL(t *testing.T) {
+	const ttl = time.Hour
+
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{SeriesTTL: ttl})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(containerEvent("oom", "idle"))
+	time.Sleep(10 * time.Millisecond)
+
+	var swept = time.Now()
+	p.handleEvent(containerEvent("oom", "active"))
+
+	// idle was last updated over a TTL before the sweep, active just
+	// under it
+	p.sweepStale(swept.Add(ttl - time.Millisecond))
+
+	if series := testutil.CollectAndCount(m.containerOOMs); series != 1 {
+		t.Fatalf("expected only the active series to be kept, got %d series", series)
+	}
+	if count := testutil.ToFloat64(m.containerOOMs.WithLabelValues("active", "nginx")); count != 1 {
+		t.Errorf("expected the active series to be kept as is, got %g", count)
+	}
+
+	// a deleted series starts over once updated again
+	p.handleEvent(containerEvent("oom", "idle"))
+	if count := testutil.ToFloat64(m.containerOOMs.WithLabelValues("idle", "nginx")); count != 1 {
+		t.Errorf("expected the idle series to start over, got %g", count)
+	}
+}
+
+func TestPrometheusSeriesTTLDisabled(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(containerEvent("oom", "web"))
+	p.sweepStale(time.Now().Add(24 * time.Hour))
+
+	if series := testutil.CollectAndCount(m.containerOOMs); series != 1 {
+		t.Errorf("expected series to be kept without a TTL, got %d series", series)
+	}
+}
+
+func TestNewPrometheusNegativeSeriesTTL(t *testing.T) {
+	_, err := NewPrometheus(PrometheusConfig{
+		Port:      9090,
+		Path:      "/metrics",
+		Registry:  prometheus.NewRegistry(),
+		SeriesTTL: -time.Minute,
+	})
+	if err == nil {
+		t.Fatal("expected a negative series TTL to fail")
+	}
+}
+
+func TestPrometheusNameLimit(t *testing.T) {
+	var (
+		logger, hook = test.NewNullLogger()
+		p            = newTestPrometheus(t, PrometheusConfig{
+			NameLabel: true,
+			NameLimit: 2,
+			Logger:    logger,
+		})
+		m = p.metrics[""]
+	)
+
+	for _, name := range []string{"web", "db", "web", "api", "cache"} {
+		p.handleEvent(containerEvent("start", name))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		expected float64
+	}{
+		{name: "web", expected: 2},
+		{name: "db", expected: 1},
+		{name: overflowLabel, expected: 2},
+	} {
+		if count := testutil.ToFloat64(m.containerActions.WithLabelValues("start", tc.name)); count != tc.expected {
+			t.Errorf("expected %g starts of %s, got %g", tc.expected, tc.name, count)
+		}
+	}
+
+	if series := testutil.CollectAndCount(m.containerActions); series != 3 {
+		t.Errorf("expected the names past the limit to share a series, got %d series", series)
+	}
+
+	if running := testutil.ToFloat64(m.containersRunning.WithLabelValues("nginx", overflowLabel)); running != 2 {
+		t.Errorf("expected api and cache to be running as %s, got %g", overflowLabel, running)
+	}
+
+	// names already seen keep their own series
+	p.handleEvent(containerEvent("die", "db"))
+	if count := testutil.ToFloat64(m.containerActions.WithLabelValues("die", "db")); count != 1 {
+		t.Errorf("expected db to keep being told apart, got %g", count)
+	}
+
+	var warnings = 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel && entry.Data["metric"] == "container_action" {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("expected a single warning once over the limit, got %d", warnings)
+	}
+}
+
+func TestPrometheusNameLimitSeriesTTL(t *testing.T) {
+	const ttl = time.Hour
+
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{
+			NameLabel: true,
+			NameLimit: 2,
+			SeriesTTL: ttl,
+		})
+		m = p.metrics[""]
+	)
+
+	p.handleEvent(containerEvent("start", "web"))
+	p.handleEvent(containerEvent("start", "db"))
+	time.Sleep(10 * time.Millisecond)
+
+	var swept = time.Now()
+	p.handleEvent(containerEvent("die", "db"))
+
+	// every series of web gets swept, freeing its name, while db
+	// still has one
+	p.sweepStale(swept.Add(ttl - time.Millisecond))
+
+	p.handleEvent(containerEvent("start", "api"))
+	p.handleEvent(containerEvent("start", "cache"))
+
+	for _, tc := range []struct {
+		action   string
+		name     string
+		expected float64
+	}{
+		{action: "start", name: "api", expected: 1},
+		{action: "die", name: "db", expected: 1},
+		{action: "start", name: overflowLabel, expected: 1},
+	} {
+		if count := testutil.ToFloat64(m.containerActions.WithLabelValues(tc.action, tc.name)); count != tc.expected {
+			t.Errorf("expected %g %s of %s, got %g", tc.expected, tc.action, tc.name, count)
+		}
+	}
+}
+
+func TestPrometheusNameLabelDisabled(t *testing.T) {
+	var p = newTestPrometheus(t, PrometheusConfig{NameLimit: 1})
+
+	p.handleEvent(containerEvent("start", "web"))
+	p.handleEvent(containerEvent("start", "db"))
+
+	var family = p.gather(t, "devents_container_action")
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatalf("expected the starts to share a series, got %v", family)
+	}
+
+	for _, label := range family.GetMetric()[0].GetLabel() {
+		if label.GetName() == containerNameAttribute {
+			t.Errorf("expected no %s label unless enabled", containerNameAttribute)
+		}
+	}
+}
+
+// imageEvent is an `image` event of action `action` on the image
+// `name`, reporting `size` if any.
+func imageEvent(action, name, size string) events.Message {
+	var ev = events.Message{
+		Type:   events.ImageEventType,
+		Action: action,
+		Actor: events.Actor{
+			ID:         "sha256:" + name,
+			Attributes: map[string]string{"name": name},
+		},
+	}
+
+	if size != "" {
+		ev.Actor.Attributes[imageSizeAttribute] = size
+	}
+
+	return ev
+}
+
+func TestPrometheusImageSize(t *testing.T) {
+	var (
+		p = newTestPrometheus(t, PrometheusConfig{ImageRepos: []string{"nginx", "quay.io/prometheus/node-exporter"}})
+		m = p.metrics[""]
+	)
+
+	// events without the size (or with a malformed one) don't create
+	// the series
+	p.handleEvent(imageEvent("tag", "nginx:1.25", ""))
+	p.handleEvent(imageEvent("pull", "nginx:1.25", "abc"))
+	p.handleEvent(imageEvent("pull", "nginx:1.25", "-1"))
+	if series := testutil.CollectAndCount(m.imageSize); series != 0 {
+		t.Fatalf("expected no image size without a valid size, got %d series", series)
+	}
+
+	p.handleEvent(imageEvent("pull", "nginx:1.25", "187654321"))
+	p.handleEvent(imageEvent("pull", "quay.io/prometheus/node-exporter", "23000000"))
+	p.handleEvent(imageEvent("pull", "redis:7", "117000000"))
+	p.handleEvent(imageEvent("pull", "nginx:1.25", "187000000"))
+	p.handleEvent(imageEvent("untag", "nginx:1.25", ""))
+
+	for _, tc := range []struct {
+		registry, repo, tag string
+		expected            float64
+	}{
+		{registry: "docker.io", repo: "library/nginx", tag: "1.25", expected: 187000000},
+		{registry: "quay.io", repo: "prometheus/node-exporter", tag: "latest", expected: 23000000},
+	} {
+		var gauge = m.imageSize.WithLabelValues(tc.registry, tc.repo, tc.tag)
+		if size := testutil.ToFloat64(gauge); size != tc.expected {
+			t.Errorf("expected %s to weigh %g, got %g", tc.repo, tc.expected, size)
+		}
+	}
+
+	// images not in the allowlist are skipped
+	if series := testutil.CollectAndCount(m.imageSize); series != 2 {
+		t.Errorf("expected only the allowed images to be reported, got %d series", series)
+	}
+}
+
+func TestPrometheusImageSizeWithoutAllowlist(t *testing.T) {
+	var p = newTestPrometheus(t, PrometheusConfig{})
+
+	p.handleEvent(imageEvent("pull", "nginx:1.25", "187654321"))
+
+	if p.metrics[""].imageSize != nil || p.gather(t, "devents_image_size_bytes") != nil {
+		t.Errorf("expected no image size without an image allowlist")
+	}
+}
+
+func TestPrometheusUnhandledEvents(t *testing.T) {
+	var p = newTestPrometheus(t, PrometheusConfig{})
+
+	for _, ev := range []events.Message{
+		{Type: "sandbox", Action: "create"},
+		{Type: "sandbox", Action: "destroy"},
+		{Type: "", Action: "whatever"},
+		containerEvent("start", "web"),
+		networkEvent("connect", ""),
+	} {
+		p.handleEvent(ev)
+	}
+
+	var (
+		family = p.gather(t, "devents_unhandled_events_total")
+		counts = map[string]float64{}
+	)
+
+	if family == nil {
+		t.Fatal("expected the unhandled events to be counted in the registry")
+	}
+
+	for _, metric := range family.GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "type" {
+				counts[label.GetValue()] = metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	var expected = map[string]float64{"sandbox": 2, "": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected only the types without metrics to be counted as %v, got %v", expected, counts)
+	}
+
+	// unhandled events still count towards the events received
+	var received = p.metrics[""].events
+	if count := testutil.ToFloat64(received.WithLabelValues("sandbox")); count != 2 {
+		t.Errorf("expected the sandbox events to be counted as received, got %g", count)
+	}
+}
+
+// lifecycleEvent is the event of action `action` of the container
+// `id`, emitted at `at`.
+func lifecycleEvent(action, id string, at time.Time) events.Message {
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		TimeNano: at.UnixNano(),
+		Actor:    events.Actor{ID: id, Attributes: map[string]string{"name": id}},
+	}
+}
+
+func TestPrometheusLifetime(t *testing.T) {
+	var (
+		p       = newTestPrometheus(t, PrometheusConfig{})
+		m       = p.metrics[""]
+		created = time.Unix(1500000000, 0)
+	)
+
+	for _, ev := range []events.Message{
+		lifecycleEvent("create", "short", created),
+		lifecycleEvent("create", "long", created),
+		lifecycleEvent("start", "short", created.Add(time.Second)),
+		lifecycleEvent("die", "short", created.Add(time.Minute)),
+		lifecycleEvent("destroy", "short", created.Add(90*time.Second)),
+		// created before devents started
+		lifecycleEvent("destroy", "unknown", created.Add(time.Hour)),
+		// already destroyed
+		lifecycleEvent("destroy", "short", created.Add(time.Hour)),
+		lifecycleEvent("destroy", "long", created.Add(30*time.Minute)),
+	} {
+		p.handleEvent(ev)
+	}
+
+	var family = p.gather(t, "devents_container_lifetime_seconds")
+	if family == nil {
+		t.Fatal("expected the lifetimes to have been observed")
+	}
+
+	var histogram = family.GetMetric()[0].GetHistogram()
+	if histogram.GetSampleCount() != 2 || histogram.GetSampleSum() != 90+1800 {
+		t.Errorf("expected lifetimes of 90s and 1800s, got %d summing %gs",
+			histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+
+	if len(m.created) != 0 {
+		t.Errorf("expected destroyed containers to be forgotten, got %v", m.created)
+	}
+}
+
+func TestPrometheusLifetimeBounded(t *testing.T) {
+	var (
+		p       = newTestPrometheus(t, PrometheusConfig{})
+		m       = p.metrics[""]
+		created = time.Unix(1500000000, 0)
+	)
+
+	m.created["oldest"] = created
+	for i := 1; i < maxTrackedCreations; i++ {
+		m.created[fmt.Sprintf("c%d", i)] = created.Add(time.Duration(i) * time.Second)
+	}
+
+	p.handleEvent(lifecycleEvent("create", "new", created.Add(time.Hour)))
+
+	if len(m.created) != maxTrackedCreations {
+		t.Errorf("expected at most %d creations to be kept, got %d", maxTrackedCreations, len(m.created))
+	}
+	if _, present := m.created["oldest"]; present {
+		t.Errorf("expected the oldest creation to be forgotten")
+	}
+	if _, present := m.created["new"]; !present {
+		t.Errorf("expected the new creation to be kept")
+	}
+}
@@ -0,0 +1,194 @@
+package aggregators
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*PubSub)(nil)
+
+type PubSubConfig struct {
+	Project string
+	Topic   string
+
+	// CredentialsFile is a service account key file. When empty,
+	// the application default credentials are used
+	// (GOOGLE_APPLICATION_CREDENTIALS or, on GCE/GKE, the metadata
+	// server). When PUBSUB_EMULATOR_HOST is set messages go to the
+	// emulator, without authentication.
+	CredentialsFile string
+
+	// OrderingKey selects the ordering key of the messages:
+	// `none` (the default), `actor` or `type`. Ordered delivery
+	// must be enabled on the subscriptions for it to take effect.
+	OrderingKey string
+
+	// BatchSize and FlushInterval control how many messages are
+	// published at once and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// Format is how events are encoded in the data of the
+	// messages: `json` (the default) or `cloudevents`, which
+	// publishes them as structured CloudEvents whose source is
+	// Source.
+	Format string
+	Source string
+}
+
+// PubSub publishes every event as a JSON message to a Google Cloud
+// Pub/Sub topic, with the type and action of the event as attributes
+// so that subscriptions can filter on them. Messages are batched by
+// the publisher of the client library.
+type PubSub struct {
+	logger      *log.Entry
+	client      *pubsub.Client
+	topic       *pubsub.Topic
+	orderingKey string
+	encoder     eventEncoder
+}
+
+func NewPubSub(cfg PubSubConfig) (agg PubSub, err error) {
+	if cfg.Project == "" || cfg.Topic == "" {
+		err = errors.New(
+			"Both a pubsub project and topic must be specified")
+		return
+	}
+
+	switch cfg.OrderingKey {
+	case "":
+		cfg.OrderingKey = "none"
+	case "none", "actor", "type":
+	default:
+		err = errors.Errorf(
+			"Unknown pubsub ordering key %s", cfg.OrderingKey)
+		return
+	}
+
+	agg.encoder, err = newEventEncoder(cfg.Format, cfg.Source)
+	if err != nil {
+		return
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithAuthCredentialsFile(option.ServiceAccount, cfg.CredentialsFile))
+	}
+
+	agg.client, err = pubsub.NewClient(context.Background(), cfg.Project, opts...)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create pubsub client for project %s", cfg.Project)
+		return
+	}
+
+	var batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+
+	agg.topic = agg.client.Topic(cfg.Topic)
+	agg.topic.PublishSettings.CountThreshold = batch.Size
+	agg.topic.PublishSettings.DelayThreshold = batch.Interval
+	agg.topic.EnableMessageOrdering = cfg.OrderingKey != "none"
+
+	agg.orderingKey = cfg.OrderingKey
+	agg.logger = log.WithField("aggregator", "pubsub")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (p PubSub) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var pending sync.WaitGroup
+
+	defer p.client.Close()
+	defer pending.Wait()
+	defer p.topic.Stop()
+
+	p.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			p.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				p.logger.Info("events channel closed")
+				return
+			}
+
+			msg, merr := p.message(ev)
+			if merr != nil {
+				p.logger.
+					WithError(merr).
+					Error("Couldn't encode event")
+				continue
+			}
+
+			var result = p.topic.Publish(ctx, msg)
+
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				p.checkPublished(result, msg.OrderingKey)
+			}()
+		}
+	}
+}
+
+// message builds the pubsub message carrying an event.
+func (p PubSub) message(ev events.Message) (msg *pubsub.Message, err error) {
+	data, err := p.encoder.encode(ev)
+	if err != nil {
+		return
+	}
+
+	msg = &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"type":   ev.Type,
+			"action": normalizeAction(ev.Action),
+		},
+	}
+
+	switch p.orderingKey {
+	case "actor":
+		msg.OrderingKey = ev.Actor.ID
+	case "type":
+		msg.OrderingKey = ev.Type
+	}
+
+	return
+}
+
+// checkPublished waits for a message to be published, logging the
+// failures. A failure pauses the publishing of the messages sharing
+// its ordering key, so they get resumed.
+func (p PubSub) checkPublished(result *pubsub.PublishResult, orderingKey string) {
+	_, err := result.Get(context.Background())
+	if err == nil {
+		return
+	}
+
+	p.logger.
+		WithError(err).
+		Error("Errored publishing message to pubsub")
+
+	if orderingKey != "" {
+		p.topic.ResumePublish(orderingKey)
+	}
+}
@@ -0,0 +1,139 @@
+package aggregators_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// newPubSubEmulator starts an in-process Pub/Sub emulator holding the
+// topic `projects/<project>/topics/<topic>`, pointing the client
+// library at it.
+func newPubSubEmulator(t *testing.T, project, topic string) *pstest.Server {
+	t.Helper()
+
+	var server = pstest.NewServer()
+	t.Cleanup(func() { server.Close() })
+	t.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	_, err := server.GServer.CreateTopic(context.Background(), &pubsubpb.Topic{
+		Name: "projects/" + project + "/topics/" + topic,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func TestPubSub(t *testing.T) {
+	var evs = []events.Message{
+		{Type: "container", Action: "exec_start: sh -c ls", Actor: events.Actor{ID: "abc"}},
+		{Type: "network", Action: "connect", Actor: events.Actor{ID: "def"}},
+	}
+
+	var testCases = []struct {
+		orderingKey string
+		expected    map[string]string
+	}{
+		{orderingKey: "", expected: map[string]string{"abc": "", "def": ""}},
+		{orderingKey: "actor", expected: map[string]string{"abc": "abc", "def": "def"}},
+		{orderingKey: "type", expected: map[string]string{"abc": "container", "def": "network"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run("ordering key "+tc.orderingKey, func(t *testing.T) {
+			var server = newPubSubEmulator(t, "my-project", "docker-events")
+
+			agg, err := aggregators.NewPubSub(aggregators.PubSubConfig{
+				Project:     "my-project",
+				Topic:       "docker-events",
+				OrderingKey: tc.orderingKey,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), agg, evs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var messages = server.Messages()
+			if len(messages) != len(evs) {
+				t.Fatalf("expected %d messages, got %d", len(evs), len(messages))
+			}
+
+			var actions = map[string]string{"container": "exec_start", "network": "connect"}
+			for _, msg := range messages {
+				var ev events.Message
+				err := json.Unmarshal(msg.Data, &ev)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if msg.Attributes["type"] != ev.Type || msg.Attributes["action"] != actions[ev.Type] {
+					t.Errorf("%s: unexpected attributes %v", ev.Actor.ID, msg.Attributes)
+				}
+
+				if msg.OrderingKey != tc.expected[ev.Actor.ID] {
+					t.Errorf("%s: expected ordering key %q, got %q",
+						ev.Actor.ID, tc.expected[ev.Actor.ID], msg.OrderingKey)
+				}
+			}
+		})
+	}
+}
+
+func TestPubSubMissingTopic(t *testing.T) {
+	var server = newPubSubEmulator(t, "my-project", "docker-events")
+
+	agg, err := aggregators.NewPubSub(aggregators.PubSubConfig{
+		Project: "my-project",
+		Topic:   "other-events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failing to publish is logged, not fatal
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "start"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := server.Messages(); len(messages) != 0 {
+		t.Errorf("expected nothing to be published, got %d messages", len(messages))
+	}
+}
+
+func TestNewPubSubInvalid(t *testing.T) {
+	t.Setenv("PUBSUB_EMULATOR_HOST", "")
+
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.PubSubConfig
+	}{
+		{desc: "no project", cfg: aggregators.PubSubConfig{Topic: "events"}},
+		{desc: "no topic", cfg: aggregators.PubSubConfig{Project: "project"}},
+		{desc: "unknown ordering key", cfg: aggregators.PubSubConfig{Project: "project", Topic: "events", OrderingKey: "name"}},
+		{desc: "missing credentials", cfg: aggregators.PubSubConfig{Project: "project", Topic: "events", CredentialsFile: "/nonexistent/key.json"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewPubSub(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package aggregators
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPushgatewayJob      = "devents"
+	defaultPushgatewayInterval = 15 * time.Second
+)
+
+var _ Aggregator = (*Pushgateway)(nil)
+
+type PushgatewayConfig struct {
+	// URL is the address of the Pushgateway (e.g.,
+	// http://pushgateway:9091).
+	URL string
+
+	// Job is the job the metrics are pushed under. Defaults to
+	// "devents".
+	Job string
+
+	// Grouping are `key=value` labels identifying the group the
+	// metrics are pushed to along with the job (e.g.,
+	// `instance=host-1`).
+	Grouping []string
+
+	// Interval is how often the metrics are pushed.
+	Interval time.Duration
+
+	// Metrics configures the metrics pushed. The HTTP related
+	// fields are ignored as nothing gets served.
+	Metrics PrometheusConfig
+}
+
+// Pushgateway keeps the same metrics as the prometheus aggregator but,
+// instead of serving them to be scraped, periodically pushes them to
+// a Prometheus Pushgateway, which suits hosts that are too short-lived
+// (or too hidden) to be scraped.
+//
+// Pushes replace the whole group while the metrics are never reset,
+// so counters keep growing across pushes as they would if scraped.
+type Pushgateway struct {
+	logger   *log.Entry
+	url      string
+	job      string
+	grouping map[string]string
+	interval time.Duration
+	metrics  Prometheus
+}
+
+func NewPushgateway(cfg PushgatewayConfig) (agg Pushgateway, err error) {
+	if cfg.URL == "" {
+		err = errors.New("A pushgateway url must be specified")
+		return
+	}
+
+	agg.job = cfg.Job
+	if agg.job == "" {
+		agg.job = defaultPushgatewayJob
+	}
+
+	agg.grouping = map[string]string{}
+	for _, label := range cfg.Grouping {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			err = errors.Errorf(
+				"Malformed pushgateway grouping label %s, expected key=value", label)
+			return
+		}
+
+		agg.grouping[parts[0]] = parts[1]
+	}
+
+	agg.interval = cfg.Interval
+	if agg.interval <= 0 {
+		agg.interval = defaultPushgatewayInterval
+	}
+
+	// Sharing the registry with the prometheus aggregator would
+	// make the metrics be registered twice.
+	cfg.Metrics.Registry = nil
+	agg.metrics, err = NewPrometheus(cfg.Metrics)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create pushgateway metrics")
+		return
+	}
+
+	agg.url = cfg.URL
+	agg.logger = log.WithField("aggregator", "pushgateway")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (p Pushgateway) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var ticker = time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// A last push makes the final values available even when
+	// devents goes away right after the events happened.
+	defer p.push()
+
+	var seed = p.metrics.seedRunning(ctx)
+
+	p.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case running, ok := <-seed.running:
+			if ok {
+				p.metrics.applySeed(running, seed.stopped)
+			}
+			seed.running, seed.stopped = nil, nil
+		case now := <-ticker.C:
+			p.metrics.sweepStale(now)
+			p.push()
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			p.metrics.countError("events_stream")
+			p.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				p.logger.Info("events channel closed")
+				return
+			}
+
+			seed.observe(ev)
+			p.metrics.handleEvent(ev)
+		}
+	}
+}
+
+// push replaces the metrics of the group with the current values.
+func (p Pushgateway) push() {
+	var pusher = push.New(p.url, p.job).Gatherer(p.metrics.registry)
+	for name, value := range p.grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	err := pusher.Push()
+	if err != nil {
+		p.metrics.countError("push")
+		p.logger.
+			WithError(err).
+			Error("Errored pushing metrics")
+	}
+}
@@ -0,0 +1,126 @@
+package aggregators_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// pushedEvents decodes a push, returning the value of the
+// events_total counter for containers.
+func pushedEvents(t *testing.T, req recordedRequest) float64 {
+	t.Helper()
+
+	if req.method != http.MethodPut || req.url != "/metrics/job/devents/instance/host-1" {
+		t.Fatalf("unexpected push %s %s", req.method, req.url)
+	}
+
+	var decoder = expfmt.NewDecoder(strings.NewReader(req.body), expfmt.ResponseFormat(req.header))
+	for {
+		var family dto.MetricFamily
+		if err := decoder.Decode(&family); err != nil {
+			break
+		}
+
+		if family.GetName() != "devents_events_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "type" && label.GetValue() == "container" {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestPushgateway(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	agg, err := aggregators.NewPushgateway(aggregators.PushgatewayConfig{
+		URL:      url,
+		Grouping: []string{"instance=host-1"},
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mock = collectorstest.NewMock(2)
+		done = make(chan error, 1)
+		ev   = events.Message{Type: "container", Action: "start"}
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	// waitPushed waits for a push counting `count` events.
+	var waitPushed = func(count float64) {
+		t.Helper()
+
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+			var requests = received()
+			if len(requests) > 0 && pushedEvents(t, requests[len(requests)-1]) == count {
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("timed out waiting for a push counting %v events", count)
+	}
+
+	mock.Push(ev)
+	waitPushed(1)
+
+	// counters keep growing across pushes
+	mock.Push(ev)
+	waitPushed(2)
+
+	mock.Push(ev)
+	mock.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// exiting pushes the final values
+	var requests = received()
+	if count := pushedEvents(t, requests[len(requests)-1]); count != 3 {
+		t.Errorf("expected a last push counting 3 events, got %v", count)
+	}
+}
+
+func TestNewPushgatewayInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.PushgatewayConfig
+	}{
+		{desc: "no url", cfg: aggregators.PushgatewayConfig{}},
+		{desc: "malformed grouping", cfg: aggregators.PushgatewayConfig{URL: "http://pushgateway:9091", Grouping: []string{"host-1"}}},
+		{desc: "empty grouping key", cfg: aggregators.PushgatewayConfig{URL: "http://pushgateway:9091", Grouping: []string{"=host-1"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewPushgateway(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package aggregators
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 500 * time.Millisecond
+)
+
+// retryConfig controls how many times a failed delivery is attempted
+// and how long to wait before the first retry. The wait doubles after
+// every attempt.
+type retryConfig struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+// withDefaults fills the unset fields of the configuration.
+func (r retryConfig) withDefaults() retryConfig {
+	if r.Attempts <= 0 {
+		r.Attempts = defaultRetryAttempts
+	}
+
+	if r.Backoff <= 0 {
+		r.Backoff = defaultRetryBackoff
+	}
+
+	return r
+}
+
+// transientError marks a failure as worth retrying (e.g., network
+// errors or 5xx responses).
+type transientError struct {
+	error
+}
+
+// retry calls `fn` until it succeeds, fails with a non-transient error,
+// the attempts are exhausted or `ctx` gets cancelled while waiting to
+// retry, returning the last error.
+func retry(ctx context.Context, cfg retryConfig, fn func() error) (err error) {
+	var backoff = cfg.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return
+		}
+
+		transient, ok := err.(transientError)
+		if !ok {
+			return
+		}
+
+		err = transient.error
+		if attempt >= cfg.Attempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
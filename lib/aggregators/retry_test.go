@@ -0,0 +1,80 @@
+package aggregators
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var failure = errors.New("unavailable")
+
+	for _, tc := range []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{name: "success", errs: []error{nil}, attempts: 1},
+		{name: "transient", errs: []error{transientError{failure}, nil}, attempts: 2},
+		{name: "permanent", errs: []error{failure}, attempts: 1, err: failure},
+		{
+			name:     "exhausted",
+			errs:     []error{transientError{failure}, transientError{failure}, transientError{failure}},
+			attempts: 3,
+			err:      failure,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int
+
+			err := retry(context.Background(), retryConfig{
+				Attempts: 3,
+				Backoff:  time.Millisecond,
+			}, func() error {
+				attempts++
+				return tc.errs[attempts-1]
+			})
+
+			if err != tc.err {
+				t.Errorf("expected error %v, got %v", tc.err, err)
+			}
+
+			if attempts != tc.attempts {
+				t.Errorf("expected %d attempts, got %d", tc.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	var (
+		failure     = errors.New("unavailable")
+		ctx, cancel = context.WithCancel(context.Background())
+		attempts    int
+	)
+
+	var done = make(chan error)
+	go func() {
+		done <- retry(ctx, retryConfig{Attempts: 3, Backoff: time.Hour}, func() error {
+			attempts++
+			return transientError{failure}
+		})
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != failure {
+			t.Errorf("expected the last error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected retry to give up once cancelled")
+	}
+
+	if attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", attempts)
+	}
+}
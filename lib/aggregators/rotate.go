@@ -0,0 +1,237 @@
+package aggregators
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const rotatedFileTimeFormat = "20060102T150405.000000000"
+
+// rotatingFile is an io.WriteCloser that appends to a file, moving it
+// aside (`<path>.<timestamp>`, optionally gzipped) once it grows past
+// maxSize bytes or gets older than maxAge. Only the newest maxBackups
+// rotated files are kept. Zero values disable the respective limit.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Write appends `p` to the file, rotating it beforehand if it's due.
+// Each call is expected to carry a whole record so that records are
+// never split across files.
+func (r *rotatingFile) Write(p []byte) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		err = r.open()
+		if err != nil {
+			return
+		}
+	}
+
+	if r.due(int64(len(p))) {
+		err = r.rotate()
+		if err != nil {
+			return
+		}
+	}
+
+	n, err = r.file.Write(p)
+	r.size += int64(n)
+	return
+}
+
+// Sync flushes the file to stable storage.
+func (r *rotatingFile) Sync() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	return r.file.Sync()
+}
+
+func (r *rotatingFile) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	err = r.file.Close()
+	r.file = nil
+	return
+}
+
+// due tells whether writing `n` more bytes requires rotating first.
+func (r *rotatingFile) due(n int64) bool {
+	if r.size == 0 {
+		return false
+	}
+
+	if r.maxSize > 0 && r.size+n > r.maxSize {
+		return true
+	}
+
+	return r.maxAge > 0 && time.Since(r.openedAt) > r.maxAge
+}
+
+// open opens (or creates) the file for appending, picking up the size
+// and age of what's already there.
+func (r *rotatingFile) open() (err error) {
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create directory of %s", r.path)
+		return
+	}
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't open file %s", r.path)
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		err = errors.Wrapf(err,
+			"Couldn't stat file %s", r.path)
+		return
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	if r.size > 0 {
+		r.openedAt = info.ModTime()
+	}
+
+	return
+}
+
+// rotate closes the current file, moves it aside and opens a new one.
+func (r *rotatingFile) rotate() (err error) {
+	err = r.file.Sync()
+	if err == nil {
+		err = r.file.Close()
+	}
+	r.file = nil
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't close file %s", r.path)
+		return
+	}
+
+	var backup = r.path + "." + time.Now().UTC().Format(rotatedFileTimeFormat)
+	err = os.Rename(r.path, backup)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't rename %s to %s", r.path, backup)
+		return
+	}
+
+	err = r.open()
+	if err != nil {
+		return
+	}
+
+	if r.compress {
+		err = gzipFile(backup)
+		if err != nil {
+			return
+		}
+	}
+
+	return r.prune()
+}
+
+// prune removes the oldest rotated files beyond maxBackups.
+func (r *rotatingFile) prune() (err error) {
+	if r.maxBackups <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+
+	// The timestamp suffix sorts chronologically whether or not the
+	// file has been compressed.
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], ".gz") < strings.TrimSuffix(backups[j], ".gz")
+	})
+
+	for len(backups) > r.maxBackups {
+		err = os.Remove(backups[0])
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't remove old file %s", backups[0])
+			return
+		}
+
+		backups = backups[1:]
+	}
+
+	return
+}
+
+// gzipFile compresses `path` into `path.gz`, removing the original.
+func gzipFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't open %s for compression", path)
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create %s.gz", path)
+		return
+	}
+
+	var gz = gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		err = errors.Wrapf(err,
+			"Couldn't compress %s", path)
+		return
+	}
+
+	return os.Remove(path)
+}
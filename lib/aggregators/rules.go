@@ -0,0 +1,88 @@
+package aggregators
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+// eventMatcher selects events through an eventFilter entry (`Event`)
+// and conditions on the attributes of their actor.
+type eventMatcher struct {
+	Event      string
+	Conditions []attributeCondition
+}
+
+// attributeCondition holds when the attribute equals the value (or
+// differs from it when negated).
+type attributeCondition struct {
+	Attribute string
+	Value     string
+	Negate    bool
+}
+
+// parseEventMatcher parses comma separated `key=value` pairs, where
+// `event` sets the eventFilter entry, the keys in `options` set the
+// corresponding strings and any other key is a condition on the
+// actor attribute with that name (`key!=value` negates it), e.g.
+//
+//	event=container:die,exitCode!=0
+func parseEventMatcher(s string, options map[string]*string) (m eventMatcher, err error) {
+	for _, pair := range strings.Split(s, ",") {
+		var (
+			idx    = strings.Index(pair, "=")
+			negate = false
+		)
+
+		if idx <= 0 {
+			err = errors.Errorf(
+				"Malformed rule %s, expected key=value pairs", s)
+			return
+		}
+
+		key, value := strings.TrimSpace(pair[:idx]), pair[idx+1:]
+		if strings.HasSuffix(key, "!") {
+			key, negate = strings.TrimSuffix(key, "!"), true
+		}
+
+		if option, present := options[key]; present && !negate {
+			*option = value
+			continue
+		}
+
+		if key == "event" && !negate {
+			m.Event = value
+			continue
+		}
+
+		m.Conditions = append(m.Conditions, attributeCondition{
+			Attribute: key,
+			Value:     value,
+			Negate:    negate,
+		})
+	}
+
+	if m.Event == "" {
+		err = errors.Errorf(
+			"Rule %s must specify an event", s)
+		return
+	}
+
+	return
+}
+
+// matches reports whether the event is selected by the matcher.
+func (m eventMatcher) matches(ev events.Message) bool {
+	if !(eventFilter{m.Event}).matches(ev) {
+		return false
+	}
+
+	for _, cond := range m.Conditions {
+		if (ev.Actor.Attributes[cond.Attribute] == cond.Value) == cond.Negate {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,390 @@
+package aggregators_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// freePort returns a port nothing listens to.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// counterValue returns the value of the counter `name` whose labels
+// include `labels` out of what `registry` gathers.
+func counterValue(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			if hasLabels(metric, labels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+// hasLabels reports whether `metric` has every label of `labels`.
+func hasLabels(metric *dto.Metric, labels map[string]string) bool {
+	var matched int
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			matched++
+		}
+	}
+
+	return matched == len(labels)
+}
+
+func TestPrometheusRun(t *testing.T) {
+	var registry = prometheus.NewRegistry()
+
+	agg, err := aggregators.NewPrometheus(aggregators.PrometheusConfig{
+		Port:     freePort(t),
+		Path:     "/metrics",
+		Registry: registry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mock      = collectorstest.NewMock(10)
+		evs, errs = mock.Collect(context.Background())
+	)
+
+	var done = make(chan error)
+	go func() {
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	mock.Push(
+		events.Message{Type: events.ContainerEventType, Action: "start"},
+		events.Message{Type: events.ContainerEventType, Action: "die"},
+		events.Message{Type: events.NetworkEventType, Action: "connect"},
+	)
+	mock.Fail(errors.New("stream reset"))
+
+	// Closing the mock right away could have Run return before
+	// getting to the error, which is waited for first.
+	var errored = map[string]string{"source": "events_stream"}
+	for deadline := time.Now().Add(5 * time.Second); counterValue(t, registry, "devents_errors_total", errored) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the error to be counted")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mock.Close()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		value  float64
+	}{
+		{"devents_events_total", map[string]string{"type": "container"}, 2},
+		{"devents_events_total", map[string]string{"type": "network"}, 1},
+		{"devents_errors_total", map[string]string{"source": "events_stream"}, 1},
+	} {
+		if value := counterValue(t, registry, tc.name, tc.labels); value != tc.value {
+			t.Errorf("expected %s%v to be %g, got %g", tc.name, tc.labels, tc.value, value)
+		}
+	}
+}
+
+func TestAggregators(t *testing.T) {
+	metrics, err := aggregators.NewPrometheus(aggregators.PrometheusConfig{
+		Port:     freePort(t),
+		Path:     "/metrics",
+		Registry: prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	stdout, err := aggregators.NewStdout(aggregators.StdoutConfig{Writer: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every backend is driven the same way, through the interface.
+	for _, agg := range []aggregators.Aggregator{metrics, stdout} {
+		err := collectorstest.Run(context.Background(), agg,
+			events.Message{Type: events.ContainerEventType, Action: "start"})
+		if err != nil {
+			t.Errorf("%T: %v", agg, err)
+		}
+	}
+
+	if !bytes.Contains(out.Bytes(), []byte(`"Action":"start"`)) {
+		t.Errorf("expected the event to be written to stdout, got %q", out.String())
+	}
+}
+
+// newPrometheus creates a Prometheus aggregator listening to a free
+// port, returned along with it.
+func newPrometheus(t *testing.T) (agg aggregators.Prometheus, port int) {
+	t.Helper()
+
+	port = freePort(t)
+
+	agg, err := aggregators.NewPrometheus(aggregators.PrometheusConfig{
+		Port:     port,
+		Path:     "/metrics",
+		Registry: prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+// waitListening waits for something to accept connections on `port`.
+func waitListening(t *testing.T, port int) {
+	t.Helper()
+
+	var addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be listened to: %v", addr, err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitReturned waits for Run to return through `done`.
+func waitReturned(t *testing.T, done <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return")
+	}
+}
+
+func TestPrometheusRunCancelled(t *testing.T) {
+	var (
+		agg, port   = newPrometheus(t)
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error)
+	)
+
+	go func() {
+		done <- agg.Run(ctx, make(chan events.Message), make(chan error))
+	}()
+
+	waitListening(t, port)
+	cancel()
+	waitReturned(t, done)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("expected the port to be released: %v", err)
+	}
+	listener.Close()
+}
+
+func TestPrometheusRunClosedChannels(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		closeErrs bool
+	}{
+		{name: "events and errors", closeErrs: true},
+		{name: "events only", closeErrs: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				agg, _ = newPrometheus(t)
+				evs    = make(chan events.Message)
+				errs   = make(chan error)
+				done   = make(chan error)
+			)
+
+			if tc.closeErrs {
+				close(errs)
+			}
+
+			go func() {
+				done <- agg.Run(context.Background(), evs, errs)
+			}()
+
+			close(evs)
+			waitReturned(t, done)
+		})
+	}
+}
+
+func TestStdoutRunClosedChannels(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		closeErrs bool
+	}{
+		{name: "events and errors", closeErrs: true},
+		{name: "events only", closeErrs: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			agg, err := aggregators.NewStdout(aggregators.StdoutConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				evs  = make(chan events.Message)
+				errs = make(chan error)
+				done = make(chan error)
+			)
+
+			if tc.closeErrs {
+				close(errs)
+			}
+
+			go func() {
+				done <- agg.Run(context.Background(), evs, errs)
+			}()
+
+			close(evs)
+			waitReturned(t, done)
+		})
+	}
+}
+
+func TestPrometheusRunPortTaken(t *testing.T) {
+	var agg, port = newPrometheus(t)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	err = agg.Run(context.Background(), make(chan events.Message), make(chan error))
+	if err == nil {
+		t.Fatal("expected Run to fail right away when the port is taken")
+	}
+}
+
+func TestPrometheusRestart(t *testing.T) {
+	var agg, port = newPrometheus(t)
+
+	for i := 0; i < 2; i++ {
+		var (
+			ctx, cancel = context.WithCancel(context.Background())
+			done        = make(chan error)
+		)
+
+		go func() {
+			done <- agg.Run(ctx, make(chan events.Message), make(chan error))
+		}()
+
+		waitListening(t, port)
+
+		resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/metrics")
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("run %d: expected the metrics to be served, got %d", i, resp.StatusCode)
+		}
+
+		cancel()
+		waitReturned(t, done)
+	}
+}
+
+func TestPrometheusErrorsScraped(t *testing.T) {
+	var (
+		agg, port   = newPrometheus(t)
+		mock        = collectorstest.NewMock(10)
+		evs, errs   = mock.Collect(context.Background())
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error)
+	)
+	defer cancel()
+
+	go func() {
+		done <- agg.Run(ctx, evs, errs)
+	}()
+
+	mock.Fail(errors.New("stream reset"))
+	mock.Fail(errors.New("stream reset"))
+
+	waitListening(t, port)
+
+	const expected = `devents_errors_total{source="events_stream"} 2`
+
+	var body []byte
+	for deadline := time.Now().Add(5 * time.Second); !bytes.Contains(body, []byte(expected)); {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be scraped, got:\n%s", expected, body)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := http.Get("http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cancel()
+	waitReturned(t, done)
+}
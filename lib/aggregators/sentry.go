@@ -0,0 +1,349 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultSentryDedupWindow = time.Minute
+
+// defaultSentryRules capture the events that look like failures.
+var defaultSentryRules = []SentryRule{
+	{
+		eventMatcher: eventMatcher{
+			Event:      "container:die",
+			Conditions: []attributeCondition{{Attribute: "exitCode", Value: "0", Negate: true}},
+		},
+		Level: "error",
+	},
+	{eventMatcher: eventMatcher{Event: "container:oom"}, Level: "fatal"},
+	{eventMatcher: eventMatcher{Event: "container:health_status: unhealthy"}, Level: "warning"},
+}
+
+var _ Aggregator = (*Sentry)(nil)
+
+// SentryRule selects the events captured and their level.
+type SentryRule struct {
+	eventMatcher
+
+	// Level is the sentry level of the captured event (`fatal`,
+	// `error`, `warning`, `info` or `debug`).
+	Level string
+}
+
+// ParseSentryRule parses a rule in the form accepted by
+// parseEventMatcher, where `level` sets the level, e.g.
+//
+//	event=container:die,exitCode!=0,level=error
+func ParseSentryRule(s string) (rule SentryRule, err error) {
+	rule.eventMatcher, err = parseEventMatcher(s, map[string]*string{
+		"level": &rule.Level,
+	})
+	if err != nil {
+		return
+	}
+
+	switch rule.Level {
+	case "":
+		rule.Level = "error"
+	case "fatal", "error", "warning", "info", "debug":
+	default:
+		err = errors.Errorf(
+			"Unknown sentry level %s in rule %s", rule.Level, s)
+	}
+
+	return
+}
+
+type SentryConfig struct {
+	// DSN is the client key of the sentry project
+	// (`https://<key>@<host>/<project>`).
+	DSN string
+
+	// Environment is attached to every captured event.
+	Environment string
+
+	// Rules select the events captured. The first matching rule
+	// decides the level. Defaults to non-zero container exits,
+	// OOMs and containers turning unhealthy.
+	Rules []SentryRule
+
+	// DedupWindow is the period during which identical failures
+	// (same type, action, container and exit code) are captured
+	// only once. Defaults to 1m.
+	DedupWindow time.Duration
+
+	// Release identifies the version of devents reporting.
+	Release string
+}
+
+// Sentry captures failure-like events as Sentry events, tagged with
+// the image, container and host involved.
+type Sentry struct {
+	logger      *log.Entry
+	client      *http.Client
+	storeURL    string
+	auth        string
+	environment string
+	release     string
+	host        string
+	rules       []SentryRule
+	dedupWindow time.Duration
+	retry       retryConfig
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	Message     string            `json:"message"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra"`
+	Fingerprint []string          `json:"fingerprint"`
+}
+
+func NewSentry(cfg SentryConfig) (agg Sentry, err error) {
+	dsn, err := url.Parse(cfg.DSN)
+	if err != nil || dsn.User == nil || dsn.Host == "" {
+		err = errors.Errorf(
+			"Malformed sentry DSN, expected https://<key>@<host>/<project>")
+		return
+	}
+
+	var (
+		key       = dsn.User.Username()
+		secret, _ = dsn.User.Password()
+		idx       = strings.LastIndex(dsn.Path, "/")
+		project   = dsn.Path[idx+1:]
+	)
+
+	if project == "" {
+		err = errors.Errorf(
+			"Sentry DSN is missing the project id")
+		return
+	}
+
+	agg.storeURL = dsn.Scheme + "://" + dsn.Host + dsn.Path[:idx] + "/api/" + project + "/store/"
+	agg.auth = "Sentry sentry_version=7, sentry_client=devents/" + cfg.Release + ", sentry_key=" + key
+	if secret != "" {
+		agg.auth += ", sentry_secret=" + secret
+	}
+
+	agg.rules = cfg.Rules
+	if len(agg.rules) == 0 {
+		agg.rules = defaultSentryRules
+	}
+
+	agg.dedupWindow = cfg.DedupWindow
+	if agg.dedupWindow <= 0 {
+		agg.dedupWindow = defaultSentryDedupWindow
+	}
+
+	agg.host, _ = os.Hostname()
+	agg.environment = cfg.Environment
+	agg.release = cfg.Release
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.retry = retryConfig{}.withDefaults()
+	agg.logger = log.WithField("aggregator", "sentry")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s Sentry) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var lastCaptured = map[string]time.Time{}
+
+	s.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			s.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			rule, matched := s.match(ev)
+			if !matched {
+				continue
+			}
+
+			var (
+				fingerprint = s.fingerprint(ev)
+				key         = strings.Join(fingerprint, "\x00")
+				now         = time.Now()
+			)
+
+			if last, seen := lastCaptured[key]; seen && now.Sub(last) < s.dedupWindow {
+				continue
+			}
+
+			lastCaptured[key] = now
+			for key, last := range lastCaptured {
+				if now.Sub(last) >= s.dedupWindow {
+					delete(lastCaptured, key)
+				}
+			}
+
+			err := s.capture(ctx, rule, ev, fingerprint)
+			if err != nil {
+				s.logger.
+					WithError(err).
+					Error("Errored capturing event in sentry")
+			}
+		}
+	}
+}
+
+// match returns the first rule that selects the event.
+func (s Sentry) match(ev events.Message) (rule SentryRule, matched bool) {
+	for _, rule = range s.rules {
+		if rule.matches(ev) {
+			matched = true
+			return
+		}
+	}
+
+	return
+}
+
+// fingerprint groups identical failures together, both in sentry and
+// for deduplication.
+func (s Sentry) fingerprint(ev events.Message) []string {
+	var name = ev.Actor.Attributes["name"]
+	if name == "" {
+		name = ev.Actor.ID
+	}
+
+	return []string{
+		ev.Type,
+		normalizeAction(ev.Action),
+		name,
+		ev.Actor.Attributes["exitCode"],
+	}
+}
+
+func (s Sentry) capture(ctx context.Context, rule SentryRule, ev events.Message, fingerprint []string) (err error) {
+	var id = make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return
+	}
+
+	var (
+		action = normalizeAction(ev.Action)
+		name   = fingerprint[2]
+		ts     = time.Unix(0, ev.TimeNano)
+	)
+
+	if ev.TimeNano == 0 {
+		ts = time.Unix(ev.Time, 0)
+	}
+
+	var tags = map[string]string{
+		"type":   ev.Type,
+		"action": action,
+		"host":   s.host,
+	}
+
+	if image := ev.Actor.Attributes["image"]; image != "" {
+		tags["image"] = image
+	}
+
+	if ev.Type == "container" {
+		tags["container"] = name
+	}
+
+	if exitCode := ev.Actor.Attributes["exitCode"]; exitCode != "" {
+		tags["exit_code"] = exitCode
+	}
+
+	var extra = map[string]string{"id": ev.Actor.ID}
+	for key, value := range ev.Actor.Attributes {
+		extra[key] = value
+	}
+
+	body, err := json.Marshal(sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   ts.UTC().Format("2006-01-02T15:04:05"),
+		Level:       rule.Level,
+		Logger:      "devents",
+		Platform:    "other",
+		Message:     ev.Type + " " + name + ": " + action,
+		ServerName:  s.host,
+		Environment: s.environment,
+		Release:     s.release,
+		Tags:        tags,
+		Extra:       extra,
+		Fingerprint: fingerprint,
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode sentry event")
+		return
+	}
+
+	return retry(ctx, s.retry, func() error {
+		return s.post(ctx, body)
+	})
+}
+
+func (s Sentry) post(ctx context.Context, body []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.storeURL, bytes.NewReader(body))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create sentry request")
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't send event to sentry")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"sentry request failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
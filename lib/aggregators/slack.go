@@ -0,0 +1,255 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSlackTemplate = "*{{.Type}} {{.Action}}*" +
+		" `{{or .Actor.Attributes.name .Actor.ID}}`" +
+		"{{with .Actor.Attributes.image}} ({{.}}){{end}}" +
+		"{{with .Actor.Attributes.exitCode}} exited with {{.}}{{end}}"
+	defaultSlackInterval = time.Second
+)
+
+// defaultSlackRules notify about the events that usually need the
+// attention of whoever is on call.
+var defaultSlackRules = []SlackRule{
+	{
+		eventMatcher: eventMatcher{
+			Event:      "container:die",
+			Conditions: []attributeCondition{{Attribute: "exitCode", Value: "0", Negate: true}},
+		},
+		Color: "danger",
+	},
+	{eventMatcher: eventMatcher{Event: "container:oom"}, Color: "danger"},
+	{eventMatcher: eventMatcher{Event: "container:health_status: unhealthy"}, Color: "warning"},
+}
+
+var _ Aggregator = (*Slack)(nil)
+
+// SlackRule selects the events that get notified and how.
+type SlackRule struct {
+	eventMatcher
+
+	// Channel overrides the channel of the incoming webhook.
+	Channel string
+
+	// Color of the message attachment (`good`, `warning`, `danger`
+	// or a hex code).
+	Color string
+}
+
+// ParseSlackRule parses a rule in the form accepted by
+// parseEventMatcher, where `channel` and `color` set the
+// corresponding fields, e.g.
+//
+//	event=container:die,exitCode!=0,channel=#oncall,color=danger
+func ParseSlackRule(s string) (rule SlackRule, err error) {
+	rule.eventMatcher, err = parseEventMatcher(s, map[string]*string{
+		"channel": &rule.Channel,
+		"color":   &rule.Color,
+	})
+	return
+}
+
+type SlackConfig struct {
+	// WebhookURL is the address of a Slack incoming webhook.
+	WebhookURL string
+
+	// Rules select the events that are notified. The first rule
+	// matching an event decides the channel and color of the
+	// message. Defaults to non-zero container exits, OOMs and
+	// containers turning unhealthy.
+	Rules []SlackRule
+
+	// Template is a text/template rendered with the event to
+	// produce the text of the message.
+	Template string
+
+	// Interval is the minimum time between two messages, keeping
+	// devents under Slack's rate limits. Defaults to 1s.
+	Interval time.Duration
+}
+
+// Slack posts human readable notifications about selected events to
+// a Slack incoming webhook.
+type Slack struct {
+	logger   *log.Entry
+	client   *http.Client
+	url      string
+	rules    []SlackRule
+	template *template.Template
+	interval time.Duration
+	retry    retryConfig
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Fallback string   `json:"fallback"`
+	Color    string   `json:"color,omitempty"`
+	Text     string   `json:"text"`
+	Markdown []string `json:"mrkdwn_in"`
+	Ts       int64    `json:"ts"`
+}
+
+func NewSlack(cfg SlackConfig) (agg Slack, err error) {
+	if cfg.WebhookURL == "" {
+		err = errors.New("A slack webhook url must be specified")
+		return
+	}
+
+	var text = cfg.Template
+	if text == "" {
+		text = defaultSlackTemplate
+	}
+
+	agg.template, err = template.New("slack").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse slack template %s", text)
+		return
+	}
+
+	agg.rules = cfg.Rules
+	if len(agg.rules) == 0 {
+		agg.rules = defaultSlackRules
+	}
+
+	agg.interval = cfg.Interval
+	if agg.interval <= 0 {
+		agg.interval = defaultSlackInterval
+	}
+
+	agg.url = cfg.WebhookURL
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.retry = retryConfig{}.withDefaults()
+	agg.logger = log.WithField("aggregator", "slack")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s Slack) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var lastSent time.Time
+
+	s.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			s.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			rule, matched := s.match(ev)
+			if !matched {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(lastSent.Add(s.interval))):
+			}
+
+			lastSent = time.Now()
+			err := s.notify(ctx, rule, ev)
+			if err != nil {
+				s.logger.
+					WithError(err).
+					Error("Errored sending slack notification")
+			}
+		}
+	}
+}
+
+// match returns the first rule that selects the event.
+func (s Slack) match(ev events.Message) (rule SlackRule, matched bool) {
+	for _, rule = range s.rules {
+		if rule.matches(ev) {
+			matched = true
+			return
+		}
+	}
+
+	return
+}
+
+func (s Slack) notify(ctx context.Context, rule SlackRule, ev events.Message) (err error) {
+	var text bytes.Buffer
+
+	err = s.template.Execute(&text, ev)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't render slack template")
+		return
+	}
+
+	body, err := json.Marshal(slackMessage{
+		Channel: rule.Channel,
+		Attachments: []slackAttachment{{
+			Fallback: text.String(),
+			Color:    rule.Color,
+			Text:     text.String(),
+			Markdown: []string{"text"},
+			Ts:       ev.Time,
+		}},
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode slack message")
+		return
+	}
+
+	return retry(ctx, s.retry, func() error {
+		return s.post(body)
+	})
+}
+
+func (s Slack) post(body []byte) (err error) {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't post message to slack")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"slack request failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,44 @@
+package aggregators
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// eventRow is the flattened representation of an event stored by
+// the SQL aggregators.
+type eventRow struct {
+	Time       time.Time
+	Type       string
+	Action     string
+	ActorID    string
+	ActorName  string
+	Attributes []byte
+}
+
+// newEventRow flattens an event, encoding the attributes of its actor
+// as a JSON object.
+func newEventRow(ev events.Message) (row eventRow, err error) {
+	row.Time = time.Unix(0, ev.TimeNano).UTC()
+	if ev.TimeNano == 0 {
+		row.Time = time.Unix(ev.Time, 0).UTC()
+	}
+
+	var attributes = ev.Actor.Attributes
+	if attributes == nil {
+		attributes = map[string]string{}
+	}
+
+	row.Attributes, err = json.Marshal(attributes)
+	if err != nil {
+		return
+	}
+
+	row.Type = ev.Type
+	row.Action = ev.Action
+	row.ActorID = ev.Actor.ID
+	row.ActorName = ev.Actor.Attributes["name"]
+	return
+}
@@ -0,0 +1,199 @@
+//go:build sqlite
+// +build sqlite
+
+package aggregators
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSQLitePruneInterval = time.Hour
+
+	sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	time_nano  INTEGER NOT NULL,
+	type       TEXT    NOT NULL,
+	action     TEXT    NOT NULL,
+	actor_id   TEXT    NOT NULL,
+	actor_name TEXT    NOT NULL,
+	attributes TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time_nano ON events (time_nano);
+CREATE INDEX IF NOT EXISTS events_type_action ON events (type, action);
+CREATE INDEX IF NOT EXISTS events_actor_id ON events (actor_id);
+`
+)
+
+var _ Aggregator = (*SQLite)(nil)
+
+// SQLite stores events in a local SQLite database, inserting them in
+// batched transactions and periodically deleting those older than the
+// retention period.
+type SQLite struct {
+	logger        *log.Entry
+	db            *sql.DB
+	retention     time.Duration
+	pruneInterval time.Duration
+	batch         batchConfig
+}
+
+func NewSQLite(cfg SQLiteConfig) (agg SQLite, err error) {
+	if cfg.Path == "" {
+		err = errors.New("A sqlite database path must be specified")
+		return
+	}
+
+	agg.db, err = sql.Open("sqlite3", "file:"+cfg.Path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't open sqlite database %s", cfg.Path)
+		return
+	}
+
+	// SQLite allows a single writer at a time.
+	agg.db.SetMaxOpenConns(1)
+
+	_, err = agg.db.Exec(sqliteSchema)
+	if err != nil {
+		agg.db.Close()
+		err = errors.Wrapf(err,
+			"Couldn't create sqlite schema in %s", cfg.Path)
+		return
+	}
+
+	agg.retention = cfg.Retention
+	agg.pruneInterval = cfg.PruneInterval
+	if agg.pruneInterval <= 0 {
+		agg.pruneInterval = defaultSQLitePruneInterval
+	}
+
+	agg.batch = batchConfig{
+		Size:     cfg.BatchSize,
+		Interval: cfg.FlushInterval,
+	}.withDefaults()
+
+	agg.logger = log.WithField("aggregator", "sqlite")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s SQLite) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer s.db.Close()
+
+	if s.retention > 0 {
+		var done = make(chan struct{})
+		defer func() { <-done }()
+
+		go func() {
+			defer close(done)
+			s.pruneLoop(ctx)
+		}()
+	}
+
+	return runBatched(ctx, s.logger, evs, errs, s.batch, s.insert)
+}
+
+// insert stores a batch of events in a single transaction.
+func (s SQLite) insert(batch []events.Message) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't start sqlite transaction")
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.Prepare(`INSERT INTO events
+		(time_nano, type, action, actor_id, actor_name, attributes)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't prepare sqlite insert")
+		return
+	}
+	defer stmt.Close()
+
+	for _, ev := range batch {
+		var row eventRow
+
+		row, err = newEventRow(ev)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't encode event attributes")
+			return
+		}
+
+		_, err = stmt.Exec(row.Time.UnixNano(), row.Type, row.Action,
+			row.ActorID, row.ActorName, string(row.Attributes))
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't insert event into sqlite")
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't commit sqlite transaction")
+		return
+	}
+
+	return
+}
+
+// pruneLoop deletes the events older than the retention period every
+// pruneInterval until `ctx` is cancelled.
+func (s SQLite) pruneLoop(ctx context.Context) {
+	var ticker = time.NewTicker(s.pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.prune(time.Now().Add(-s.retention))
+		if err != nil {
+			s.logger.
+				WithError(err).
+				Error("Errored pruning old events")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes the events that happened before `cutoff`.
+func (s SQLite) prune(cutoff time.Time) (err error) {
+	res, err := s.db.Exec(
+		"DELETE FROM events WHERE time_nano < ?", cutoff.UnixNano())
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't delete events older than %s", cutoff)
+		return
+	}
+
+	deleted, _ := res.RowsAffected()
+	if deleted > 0 {
+		s.logger.
+			WithField("deleted", deleted).
+			Info("pruned old events")
+	}
+
+	return
+}
@@ -0,0 +1,21 @@
+package aggregators
+
+import (
+	"time"
+)
+
+type SQLiteConfig struct {
+	// Path is the location of the database file, created if it
+	// doesn't exist.
+	Path string
+
+	// Retention is how long events are kept. Older events are
+	// deleted every PruneInterval. Zero keeps events forever.
+	Retention     time.Duration
+	PruneInterval time.Duration
+
+	// BatchSize and FlushInterval control how many events are
+	// inserted per transaction and how long they may wait.
+	BatchSize     int
+	FlushInterval time.Duration
+}
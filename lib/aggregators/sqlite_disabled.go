@@ -0,0 +1,27 @@
+//go:build !sqlite
+// +build !sqlite
+
+package aggregators
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+var _ Aggregator = (*SQLite)(nil)
+
+// SQLite is only available when devents is built with the `sqlite`
+// tag as the driver requires cgo.
+type SQLite struct{}
+
+func NewSQLite(cfg SQLiteConfig) (agg SQLite, err error) {
+	err = errors.New(
+		"devents was built without sqlite support - rebuild it with `-tags sqlite`")
+	return
+}
+
+func (s SQLite) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	return
+}
@@ -0,0 +1,16 @@
+//go:build !sqlite
+// +build !sqlite
+
+package aggregators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSQLiteDisabled(t *testing.T) {
+	_, err := NewSQLite(SQLiteConfig{Path: "events.db"})
+	if err == nil || !strings.Contains(err.Error(), "-tags sqlite") {
+		t.Fatalf("expected an error pointing at the sqlite build tag, got %v", err)
+	}
+}
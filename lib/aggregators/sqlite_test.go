@@ -0,0 +1,182 @@
+//go:build sqlite
+// +build sqlite
+
+package aggregators
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func newTestSQLite(t *testing.T, cfg SQLiteConfig) (agg SQLite, path string) {
+	t.Helper()
+
+	cfg.Path = filepath.Join(t.TempDir(), "events.db")
+
+	agg, err := NewSQLite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return agg, cfg.Path
+}
+
+// runSQLite feeds `evs` to `agg` until they're all consumed.
+func runSQLite(t *testing.T, ctx context.Context, agg SQLite, evs ...events.Message) {
+	t.Helper()
+
+	var ch = make(chan events.Message, len(evs))
+	for _, ev := range evs {
+		ch <- ev
+	}
+	close(ch)
+
+	err := agg.Run(ctx, ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storedActors returns the actor ids stored in the database at `path`
+// ordered by time.
+func storedActors(t *testing.T, path string) (ids []string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT actor_id FROM events ORDER BY time_nano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	return
+}
+
+func TestSQLiteInsert(t *testing.T) {
+	agg, path := newTestSQLite(t, SQLiteConfig{BatchSize: 2})
+
+	var ev = events.Message{
+		Type:     "container",
+		Action:   "start",
+		TimeNano: 1500000000000000001,
+		Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+			"name":  "web",
+			"image": "nginx",
+		}},
+	}
+
+	runSQLite(t, context.Background(), agg, ev,
+		events.Message{Type: "network", Action: "connect", Time: 1500000001, Actor: events.Actor{ID: "def"}},
+		events.Message{Type: "volume", Action: "create", Time: 1500000002, Actor: events.Actor{ID: "ghi"}},
+	)
+
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var (
+		timeNano                   int64
+		typ, action, id, name, raw string
+	)
+
+	err = db.QueryRow(`SELECT time_nano, type, action, actor_id, actor_name, attributes
+		FROM events WHERE actor_id = 'abc'`).Scan(&timeNano, &typ, &action, &id, &name, &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timeNano != ev.TimeNano || typ != "container" || action != "start" || name != "web" {
+		t.Errorf("unexpected row %d %s %s %s %s", timeNano, typ, action, id, name)
+	}
+
+	var attributes map[string]string
+	err = json.Unmarshal([]byte(raw), &attributes)
+	if err != nil || attributes["image"] != "nginx" {
+		t.Errorf("expected the attributes as JSON, got %q", raw)
+	}
+
+	if ids := storedActors(t, path); len(ids) != 3 {
+		t.Errorf("expected the 3 events to be stored, got %v", ids)
+	}
+}
+
+func TestSQLitePrune(t *testing.T) {
+	agg, path := newTestSQLite(t, SQLiteConfig{
+		Retention:     24 * time.Hour,
+		PruneInterval: 10 * time.Millisecond,
+		FlushInterval: 10 * time.Millisecond,
+	})
+
+	var now = time.Now()
+	var evs = []events.Message{
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "old"}, TimeNano: now.Add(-48 * time.Hour).UnixNano()},
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "older"}, Time: now.Add(-72 * time.Hour).Unix()},
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "recent"}, TimeNano: now.Add(-time.Hour).UnixNano()},
+		{Type: "container", Action: "start", Actor: events.Actor{ID: "new"}, TimeNano: now.UnixNano()},
+	}
+
+	// the events are inserted past the first pruning, so they're only
+	// removed by a later one
+	var (
+		ch          = make(chan events.Message, len(evs))
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan error, 1)
+	)
+	defer cancel()
+
+	go func() { done <- agg.Run(ctx, ch, nil) }()
+	for _, ev := range evs {
+		ch <- ev
+	}
+
+	var deadline = time.Now().Add(5 * time.Second)
+	for {
+		var ids = storedActors(t, path)
+		if len(ids) == 2 && ids[0] == "recent" && ids[1] == "new" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected only the recent events to be kept, got %v", ids)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteNoRetention(t *testing.T) {
+	agg, path := newTestSQLite(t, SQLiteConfig{})
+
+	runSQLite(t, context.Background(), agg, events.Message{
+		Type: "container", Action: "start", Actor: events.Actor{ID: "ancient"}, Time: 1,
+	})
+
+	if ids := storedActors(t, path); len(ids) != 1 {
+		t.Errorf("expected events to be kept forever without a retention, got %v", ids)
+	}
+}
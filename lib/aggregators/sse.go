@@ -0,0 +1,241 @@
+package aggregators
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSSEBufferSize = 1000
+	sseKeepAliveInterval = 15 * time.Second
+)
+
+var _ Aggregator = (*SSE)(nil)
+
+type SSEConfig struct {
+	// Addr is the address the server binds to (e.g., `:9105`).
+	Addr string
+
+	// Path is where the stream is served. Defaults to `/events`.
+	Path string
+
+	// BufferSize is the number of recent events kept to be replayed
+	// to clients resuming with `Last-Event-ID`. Defaults to 1000.
+	BufferSize int
+}
+
+// SSE serves the events as a `text/event-stream` that browsers can
+// consume with `EventSource`. Every event gets a monotonic id and the
+// most recent ones are kept in memory so that reconnecting clients
+// (which send the last id they saw in `Last-Event-ID`) resume where
+// they left off.
+//
+// Clients never hold back the pipeline: they read from the buffer at
+// their own pace and skip whatever got evicted in the meantime.
+type SSE struct {
+	logger *log.Entry
+	addr   string
+	path   string
+	ring   *sseRing
+	done   chan struct{}
+}
+
+type sseEntry struct {
+	id   uint64
+	data []byte
+}
+
+// sseRing is a fixed size buffer of the most recent entries. Readers
+// wait for new entries on the `changed` channel, which gets closed
+// (and replaced) on every append.
+type sseRing struct {
+	mu      sync.Mutex
+	entries []sseEntry
+	size    int
+	lastID  uint64
+	changed chan struct{}
+}
+
+func newSSERing(size int) *sseRing {
+	return &sseRing{
+		size:    size,
+		entries: make([]sseEntry, 0, size),
+		changed: make(chan struct{}),
+	}
+}
+
+// append stores the data under the next id.
+func (r *sseRing) append(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	if len(r.entries) == r.size {
+		copy(r.entries, r.entries[1:])
+		r.entries = r.entries[:r.size-1]
+	}
+	r.entries = append(r.entries, sseEntry{id: r.lastID, data: data})
+
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// since returns the entries stored after `id` along with a channel
+// that gets closed once there's something newer.
+func (r *sseRing) since(id uint64) (entries []sseEntry, changed <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for idx, entry := range r.entries {
+		if entry.id > id {
+			entries = append(entries, r.entries[idx:]...)
+			break
+		}
+	}
+
+	changed = r.changed
+	return
+}
+
+// last returns the id of the most recent entry.
+func (r *sseRing) last() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastID
+}
+
+func NewSSE(cfg SSEConfig) (agg SSE, err error) {
+	agg.path = cfg.Path
+	if agg.path == "" {
+		agg.path = "/events"
+	}
+
+	var size = cfg.BufferSize
+	if size <= 0 {
+		size = defaultSSEBufferSize
+	}
+
+	agg.addr = cfg.Addr
+	agg.ring = newSSERing(size)
+	agg.done = make(chan struct{})
+	agg.logger = log.WithField("aggregator", "sse")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s SSE) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var mux = http.NewServeMux()
+	mux.HandleFunc(s.path, s.serveStream)
+
+	serveErrs, shutdown, err := serveHTTP(s.addr, mux)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		// Streams only end when clients go away, so they're told
+		// to finish before shutting the server down.
+		close(s.done)
+
+		shutdownErr := shutdown(defaultPrometheusShutdownTimeout)
+		if err == nil {
+			err = shutdownErr
+		}
+	}()
+
+	s.logger.WithField("addr", s.addr).Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-serveErrs:
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			s.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			data, err := json.Marshal(ev)
+			if err != nil {
+				s.logger.WithError(err).Error("Couldn't encode event")
+				continue
+			}
+
+			s.ring.append(data)
+		}
+	}
+}
+
+// serveStream streams the events to a client, starting after the
+// `Last-Event-ID` it sent (if any) or with the events that come next.
+func (s SSE) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastID = s.ring.last()
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, "malformed Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+
+		lastID = id
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var keepAlive = time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		entries, changed := s.ring.since(lastID)
+		for _, entry := range entries {
+			_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.id, entry.data)
+			if err != nil {
+				return
+			}
+
+			lastID = entry.id
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package aggregators
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// sseClient reads the events of a `text/event-stream` response.
+type sseClient struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+func dialSSE(t *testing.T, url, lastEventID string) *sseClient {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d (%s)", resp.StatusCode, ct)
+	}
+
+	return &sseClient{resp: resp, reader: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next event, returning its id and the action of the
+// docker event it carries.
+func (c *sseClient) next(t *testing.T) (id, action string) {
+	t.Helper()
+
+	var (
+		read = make(chan error, 1)
+		data string
+	)
+
+	go func() {
+		for {
+			line, err := c.reader.ReadString('\n')
+			if err != nil {
+				read <- err
+				return
+			}
+
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && data != "":
+				read <- nil
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	var ev events.Message
+	err := json.Unmarshal([]byte(data), &ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id, ev.Action
+}
+
+// expect reads events, failing unless they're `expected`, given as
+// `id:action` pairs.
+func (c *sseClient) expect(t *testing.T, expected ...string) {
+	t.Helper()
+
+	for _, want := range expected {
+		id, action := c.next(t)
+		if got := id + ":" + action; got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestSSE(t *testing.T) {
+	var addr = freeAddr(t)
+
+	agg, err := NewSSE(SSEConfig{Addr: addr, Path: "/stream", BufferSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, stop := startStreaming(t, addr, agg.Run)
+	defer stop()
+
+	var push = func(actions ...string) {
+		for _, action := range actions {
+			evs <- events.Message{Type: "container", Action: action}
+		}
+	}
+
+	// events from before connecting aren't sent to new clients
+	push("create")
+
+	var client = dialSSE(t, "http://"+addr+"/stream", "")
+	push("start", "pause")
+	client.expect(t, "2:start", "3:pause")
+	client.resp.Body.Close()
+
+	// resuming replays what happened since the last id seen
+	push("unpause")
+	client = dialSSE(t, "http://"+addr+"/stream", "3")
+	client.expect(t, "4:unpause")
+
+	push("stop")
+	client.expect(t, "5:stop")
+	client.resp.Body.Close()
+
+	// only the last 3 events are kept, so resuming from an evicted
+	// one skips to the oldest still around
+	push("die", "destroy")
+	client = dialSSE(t, "http://"+addr+"/stream", "1")
+	client.expect(t, "5:stop", "6:die", "7:destroy")
+}
+
+func TestSSEMalformedLastEventID(t *testing.T) {
+	var addr = freeAddr(t)
+
+	agg, err := NewSSE(SSEConfig{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, stop := startStreaming(t, addr, agg.Run)
+	defer stop()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "abc")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
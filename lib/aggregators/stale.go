@@ -0,0 +1,97 @@
+package aggregators
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesKey identifies a series of a counter by its label values,
+// joined by a separator that can't appear in them.
+type seriesKey struct {
+	vec    *prometheus.CounterVec
+	values string
+}
+
+// seriesSeparator joins the label values of a series key.
+const seriesSeparator = "\xff"
+
+// staleSeries keeps track of when each series of the counters whose
+// labels churn along with the containers (actions, OOMs, restarts,
+// ...) was last incremented, so that the series that stopped being
+// updated (e.g., those of containers long gone) can be deleted.
+type staleSeries struct {
+	ttl     time.Duration
+	touched map[seriesKey]time.Time
+}
+
+// newStaleSeries keeps track of the series of counters when `ttl` is
+// set, returning nil (which tracks nothing) otherwise.
+func newStaleSeries(ttl time.Duration) *staleSeries {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &staleSeries{
+		ttl:     ttl,
+		touched: map[seriesKey]time.Time{},
+	}
+}
+
+// add adds `delta` to the series of `vec` with the given label values,
+// with `exemplar` if any, noting it's been updated.
+func (s *staleSeries) add(vec *prometheus.CounterVec, delta float64, exemplar prometheus.Labels, values ...string) {
+	addCounter(vec.WithLabelValues(values...), delta, exemplar)
+
+	if s == nil {
+		return
+	}
+
+	s.touched[seriesKey{vec, strings.Join(values, seriesSeparator)}] = time.Now()
+}
+
+// inc increments the series of `vec` with the given label values,
+// with `exemplar` if any, noting it's been updated.
+func (s *staleSeries) inc(vec *prometheus.CounterVec, exemplar prometheus.Labels, values ...string) {
+	s.add(vec, 1, exemplar, values...)
+}
+
+// sweep deletes the series that weren't updated for longer than the
+// TTL as of `now`, returning how many were.
+func (s *staleSeries) sweep(now time.Time) (deleted int) {
+	if s == nil {
+		return
+	}
+
+	for key, touched := range s.touched {
+		if now.Sub(touched) < s.ttl {
+			continue
+		}
+
+		key.vec.DeleteLabelValues(strings.Split(key.values, seriesSeparator)...)
+		delete(s.touched, key)
+		deleted++
+	}
+
+	return
+}
+
+// values returns the distinct values of the label at position `index`
+// of the tracked series of `vec`, or nil when nothing is tracked.
+func (s *staleSeries) values(vec *prometheus.CounterVec, index int) (values map[string]bool) {
+	if s == nil {
+		return
+	}
+
+	values = map[string]bool{}
+	for key := range s.touched {
+		if key.vec != vec {
+			continue
+		}
+
+		values[strings.Split(key.values, seriesSeparator)[index]] = true
+	}
+
+	return
+}
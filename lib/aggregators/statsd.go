@@ -0,0 +1,123 @@
+package aggregators
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*StatsD)(nil)
+
+type StatsDConfig struct {
+	Host string
+	Port int
+
+	// Prefix is prepended to every metric name. Defaults to
+	// "devents".
+	Prefix string
+
+	// Tags are static `key:value` tags appended to every metric
+	// using the DogStatsD `|#tag1,tag2` extension. Plain StatsD
+	// servers don't understand tags, so leave it empty for those.
+	Tags []string
+}
+
+// StatsD emits a counter over UDP for every event received, named
+// after the type and action of the event (`devents.container.start`).
+type StatsD struct {
+	logger *log.Entry
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+func NewStatsD(cfg StatsDConfig) (agg StatsD, err error) {
+	var addr = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+
+	agg.conn, err = net.Dial("udp", addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create statsd connection to %s", addr)
+		return
+	}
+
+	agg.prefix = cfg.Prefix
+	if agg.prefix == "" {
+		agg.prefix = "devents"
+	}
+
+	agg.tags = cfg.Tags
+	agg.logger = log.WithField("aggregator", "statsd")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s StatsD) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer s.conn.Close()
+
+	s.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			s.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			name := strings.Join([]string{
+				s.prefix,
+				statsdSegment(ev.Type),
+				statsdSegment(normalizeAction(ev.Action)),
+			}, ".")
+
+			err := writeStatsDCounter(s.conn, name, s.tags)
+			if err != nil {
+				s.logger.
+					WithError(err).
+					Error("Errored sending counter to statsd")
+			}
+		}
+	}
+}
+
+// writeStatsDCounter writes a single `name:1|c` increment to `conn`,
+// appending the tags (if any) in the DogStatsD format.
+func writeStatsDCounter(conn net.Conn, name string, tags []string) (err error) {
+	var line = name + ":1|c"
+
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	_, err = conn.Write([]byte(line))
+	return
+}
+
+// statsdSegment makes a string safe to be used as part of a statsd
+// metric name (or tag), replacing the characters that have special
+// meaning in the protocol (`:`, `|`, `,`, `@`, `#`), dots and
+// whitespace by `_`.
+func statsdSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '@', '#', '.', ' ', '\t', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,96 @@
+package aggregators_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// readDatagrams reads `n` datagrams out of `conn`.
+func readDatagrams(t *testing.T, conn net.PacketConn, n int) (datagrams []string) {
+	t.Helper()
+
+	var buf = make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for len(datagrams) < n {
+		read, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected %d datagrams, got %q: %v", n, datagrams, err)
+		}
+
+		datagrams = append(datagrams, string(buf[:read]))
+	}
+
+	return
+}
+
+func TestStatsD(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		cfg      aggregators.StatsDConfig
+		expected []string
+	}{
+		{
+			desc: "default prefix",
+			expected: []string{
+				"devents.container.start:1|c",
+				"devents.container.exec_start:1|c",
+				"devents.network.connect:1|c",
+			},
+		},
+		{
+			desc: "prefix and tags",
+			cfg: aggregators.StatsDConfig{
+				Prefix: "docker",
+				Tags:   []string{"env:prod", "dc:eu"},
+			},
+			expected: []string{
+				"docker.container.start:1|c|#env:prod,dc:eu",
+				"docker.container.exec_start:1|c|#env:prod,dc:eu",
+				"docker.network.connect:1|c|#env:prod,dc:eu",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			var cfg = tc.cfg
+			cfg.Host = "127.0.0.1"
+			cfg.Port = listener.LocalAddr().(*net.UDPAddr).Port
+
+			agg, err := aggregators.NewStatsD(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), agg,
+				events.Message{Type: "container", Action: "start"},
+				events.Message{Type: "container", Action: "exec_start: sh -c ls"},
+				events.Message{Type: "network", Action: "connect"},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var datagrams = readDatagrams(t, listener, len(tc.expected))
+			for i, expected := range tc.expected {
+				if datagrams[i] != expected {
+					t.Errorf("datagram %d: expected %q, got %q",
+						i, expected, datagrams[i])
+				}
+			}
+		})
+	}
+}
@@ -1,30 +1,142 @@
 package aggregators
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
 	"github.com/docker/docker/api/types/events"
 
 	log "github.com/sirupsen/logrus"
 )
 
+var _ Aggregator = (*Stdout)(nil)
+
+type StdoutConfig struct {
+	// Pretty indents the JSON objects written.
+	Pretty bool
+
+	// Dump writes the events exactly as received, one per line,
+	// so that they can be read back by the file collector. It
+	// takes precedence over Pretty.
+	Dump bool
+
+	// Writer is where events are written to. Defaults to
+	// os.Stdout.
+	Writer io.Writer
+}
+
+// Stdout writes every event as a JSON object to stdout, one per
+// line (unless pretty printing), so that it can be picked up by
+// whatever collects the logs of the container devents runs in.
 type Stdout struct {
 	logger *log.Entry
+	pretty bool
+	dump   bool
+	out    *lockedWriter
+}
+
+// stdoutEvent is the object written for each event: the message as
+// sent by the daemon plus its time in ISO-8601.
+type stdoutEvent struct {
+	Timestamp string `json:"timestamp"`
+	events.Message
 }
 
-func NewStdout() (agg Stdout, err error) {
+// lockedWriter serializes writes so that the objects written by
+// concurrent users never interleave.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Write(p)
+}
+
+func NewStdout(cfg StdoutConfig) (agg Stdout, err error) {
+	var w = cfg.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	agg.out = &lockedWriter{w: w}
+	agg.pretty = cfg.Pretty
+	agg.dump = cfg.Dump
 	agg.logger = log.WithField("aggregator", "stdout")
 	agg.logger.Info("aggregator initialized")
 	return
 }
 
-func (s Stdout) Run(evs <-chan events.Message, errs <-chan error) {
+func (s Stdout) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
 	s.logger.Info("listening to events")
 
 	for {
 		select {
-		case err := <-errs:
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
 			s.logger.WithError(err).Info("errored")
-		case ev := <-evs:
-			s.logger.WithField("event", ev).Info("event received")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			err := s.write(ev)
+			if err != nil {
+				s.logger.
+					WithError(err).
+					Error("Errored writing event")
+			}
+		}
+	}
+}
+
+// write encodes the event and writes it, newline included, with a
+// single call.
+func (s Stdout) write(ev events.Message) (err error) {
+	if s.dump {
+		line, err := json.Marshal(ev)
+		if err != nil {
+			return err
 		}
+
+		_, err = s.out.Write(append(line, '\n'))
+		return err
+	}
+
+	var ts = time.Unix(0, ev.TimeNano)
+	if ev.TimeNano == 0 {
+		ts = time.Unix(ev.Time, 0)
 	}
+
+	var obj = stdoutEvent{
+		Timestamp: ts.UTC().Format(time.RFC3339Nano),
+		Message:   ev,
+	}
+
+	var line []byte
+	if s.pretty {
+		line, err = json.MarshalIndent(obj, "", "  ")
+	} else {
+		line, err = json.Marshal(obj)
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = s.out.Write(append(line, '\n'))
+	return
 }
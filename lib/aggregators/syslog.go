@@ -0,0 +1,299 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogEnterpriseID identifies the structured data element
+	// carrying the event. 32473 is the IANA number reserved for
+	// documentation and examples.
+	syslogEnterpriseID = "docker@32473"
+
+	syslogSeverityCritical = 2
+	syslogSeverityError    = 3
+	syslogSeverityWarning  = 4
+	syslogSeverityNotice   = 5
+	syslogSeverityInfo     = 6
+
+	defaultSyslogDialTimeout = 5 * time.Second
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var (
+	_ Aggregator    = (*Syslog)(nil)
+	_ HealthChecker = (*Syslog)(nil)
+)
+
+type SyslogConfig struct {
+	// Network is either `udp` or `tcp`.
+	Network string
+	Address string
+
+	// Facility is the name of the syslog facility (`daemon`,
+	// `local0`, ...). Defaults to `daemon`.
+	Facility string
+
+	// AppName is the APP-NAME of the messages. Defaults to
+	// `devents`.
+	AppName string
+}
+
+// Syslog forwards every event to a syslog server as an RFC 5424
+// message carrying the event in its structured data. The severity
+// is derived from the event (see syslogSeverity).
+//
+// Over TCP, messages are framed with octet counting (RFC 6587) and
+// the connection is re-established when it drops.
+type Syslog struct {
+	logger   *log.Entry
+	network  string
+	address  string
+	facility int
+	appName  string
+	hostname string
+
+	// down is set to 1 while events can't be sent to the server.
+	down *int32
+}
+
+func NewSyslog(cfg SyslogConfig) (agg Syslog, err error) {
+	switch cfg.Network {
+	case "":
+		cfg.Network = "udp"
+	case "udp", "tcp":
+	default:
+		err = errors.Errorf(
+			"Unsupported syslog network %s", cfg.Network)
+		return
+	}
+
+	if cfg.Facility == "" {
+		cfg.Facility = "daemon"
+	}
+
+	facility, present := syslogFacilities[cfg.Facility]
+	if !present {
+		err = errors.Errorf(
+			"Unknown syslog facility %s", cfg.Facility)
+		return
+	}
+
+	agg.appName = cfg.AppName
+	if agg.appName == "" {
+		agg.appName = "devents"
+	}
+
+	agg.hostname, _ = os.Hostname()
+
+	agg.network = cfg.Network
+	agg.address = cfg.Address
+	agg.facility = facility
+	agg.down = new(int32)
+	agg.logger = log.WithField("aggregator", "syslog")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (s Syslog) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	var send = func(msg []byte) (err error) {
+		if conn == nil {
+			conn, err = net.DialTimeout(s.network, s.address, defaultSyslogDialTimeout)
+			if err != nil {
+				conn = nil
+				err = errors.Wrapf(err,
+					"Couldn't connect to syslog server %s", s.address)
+				return
+			}
+		}
+
+		if s.network == "tcp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		_, err = conn.Write(msg)
+		if err != nil {
+			conn.Close()
+			conn = nil
+		}
+
+		return
+	}
+
+	s.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			s.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				s.logger.Info("events channel closed")
+				return
+			}
+
+			var msg = s.format(ev)
+
+			// A failed write over a dropped TCP connection is
+			// retried once on a new connection.
+			err := send(msg)
+			if err != nil && s.network == "tcp" {
+				err = send(msg)
+			}
+			if err != nil {
+				atomic.StoreInt32(s.down, 1)
+				s.logger.
+					WithError(err).
+					Error("Errored sending event to syslog")
+				continue
+			}
+
+			atomic.StoreInt32(s.down, 0)
+		}
+	}
+}
+
+// Healthy reports whether the last event was sent to the server.
+func (s Syslog) Healthy() bool {
+	return atomic.LoadInt32(s.down) == 0
+}
+
+// format renders an event as an RFC 5424 message.
+func (s Syslog) format(ev events.Message) []byte {
+	var (
+		buf    bytes.Buffer
+		action = normalizeAction(ev.Action)
+		ts     = time.Unix(0, ev.TimeNano)
+	)
+
+	if ev.TimeNano == 0 {
+		ts = time.Unix(ev.Time, 0)
+	}
+
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s - %s ",
+		s.facility*8+syslogSeverity(ev),
+		ts.UTC().Format(time.RFC3339Nano),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.appName, 48),
+		syslogHeaderField(ev.Type, 32))
+
+	buf.WriteString("[" + syslogEnterpriseID)
+	writeSyslogParam(&buf, "type", ev.Type)
+	writeSyslogParam(&buf, "action", action)
+	writeSyslogParam(&buf, "id", ev.Actor.ID)
+
+	var keys = make([]string, 0, len(ev.Actor.Attributes))
+	for key := range ev.Actor.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		writeSyslogParam(&buf, key, ev.Actor.Attributes[key])
+	}
+	buf.WriteString("]")
+
+	var name = ev.Actor.Attributes["name"]
+	if name == "" {
+		name = ev.Actor.ID
+	}
+
+	fmt.Fprintf(&buf, " %s %s %s", ev.Type, action, name)
+	return buf.Bytes()
+}
+
+// syslogSeverity maps an event to a severity: OOMs are critical,
+// non-zero exits errors, kills and unhealthy containers warnings,
+// destructive actions notices and everything else informational.
+func syslogSeverity(ev events.Message) int {
+	var action = normalizeAction(ev.Action)
+
+	switch {
+	case action == "oom":
+		return syslogSeverityCritical
+	case action == "die" && ev.Actor.Attributes["exitCode"] != "0":
+		return syslogSeverityError
+	case action == "kill":
+		return syslogSeverityWarning
+	case action == "health_status: unhealthy":
+		return syslogSeverityWarning
+	case action == "destroy", action == "delete", action == "remove":
+		return syslogSeverityNotice
+	}
+
+	return syslogSeverityInfo
+}
+
+// syslogHeaderField makes a value fit a header field: printable
+// ASCII without spaces, at most `max` characters, `-` when empty.
+func syslogHeaderField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// writeSyslogParam writes a ` name="value"` structured data param,
+// sanitizing the name and escaping `"`, `\` and `]` in the value.
+func writeSyslogParam(buf *bytes.Buffer, name, value string) {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r <= ' ' || r > '~', r == '=', r == ']', r == '"':
+			return '_'
+		}
+		return r
+	}, name)
+
+	if len(name) > 32 {
+		name = name[:32]
+	}
+
+	var escaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+	buf.WriteString(" " + name + `="` + escaper.Replace(value) + `"`)
+}
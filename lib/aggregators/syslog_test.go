@@ -0,0 +1,323 @@
+package aggregators_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// syslogMessage is an RFC 5424 message received by a syslog listener.
+type syslogMessage struct {
+	conn      net.Conn
+	priority  int
+	timestamp time.Time
+	appName   string
+	msgID     string
+	sdID      string
+	params    map[string]string
+	msg       string
+}
+
+var (
+	syslogHeaderRe = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) - (\S+) \[(\S+)((?: [^=]+="(?:[^"\\\]]|\\.)*")*)\] (.*)$`)
+	syslogParamRe  = regexp.MustCompile(` ([^=]+)="((?:[^"\\\]]|\\.)*)"`)
+	syslogUnescape = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\]`, `]`)
+)
+
+func parseSyslog(t *testing.T, conn net.Conn, raw string) syslogMessage {
+	t.Helper()
+
+	var match = syslogHeaderRe.FindStringSubmatch(raw)
+	if match == nil {
+		t.Fatalf("malformed syslog message %q", raw)
+	}
+
+	priority, _ := strconv.Atoi(match[1])
+	timestamp, err := time.Parse(time.RFC3339Nano, match[2])
+	if err != nil {
+		t.Fatalf("malformed timestamp in %q: %v", raw, err)
+	}
+
+	var params = map[string]string{}
+	for _, param := range syslogParamRe.FindAllStringSubmatch(match[7], -1) {
+		params[param[1]] = syslogUnescape.Replace(param[2])
+	}
+
+	return syslogMessage{
+		conn:      conn,
+		priority:  priority,
+		timestamp: timestamp,
+		appName:   match[4],
+		msgID:     match[5],
+		sdID:      match[6],
+		params:    params,
+		msg:       match[8],
+	}
+}
+
+// newSyslogListener listens for syslog messages over `network`,
+// decoding the octet counted framing of TCP.
+func newSyslogListener(t *testing.T, network string) (addr string, msgs <-chan syslogMessage) {
+	t.Helper()
+
+	var ch = make(chan syslogMessage, 64)
+
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		go func() {
+			var buf = make([]byte, 8192)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+
+				ch <- parseSyslog(t, nil, string(buf[:n]))
+			}
+		}()
+
+		return conn.LocalAddr().String(), ch
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				var reader = bufio.NewReader(conn)
+				for {
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+
+					size, err := strconv.Atoi(strings.TrimSpace(length))
+					if err != nil {
+						t.Errorf("malformed frame length %q", length)
+						return
+					}
+
+					var msg = make([]byte, size)
+					_, err = io.ReadFull(reader, msg)
+					if err != nil {
+						return
+					}
+
+					ch <- parseSyslog(t, conn, string(msg))
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), ch
+}
+
+func waitSyslog(t *testing.T, msgs <-chan syslogMessage) syslogMessage {
+	t.Helper()
+
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for syslog message")
+	}
+
+	return syslogMessage{}
+}
+
+func TestSyslog(t *testing.T) {
+	var evs = []events.Message{
+		{
+			Type:     "container",
+			Action:   "die",
+			TimeNano: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC).UnixNano(),
+			Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+				"name":     "web",
+				"exitCode": "137",
+				"label":    `quoted "]\ value`,
+			}},
+		},
+		{
+			Type:   "container",
+			Action: "die",
+			Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+				"exitCode": "0",
+			}},
+		},
+		{Type: "container", Action: "oom", Actor: events.Actor{ID: "abc"}},
+		{Type: "container", Action: "health_status: unhealthy", Actor: events.Actor{ID: "abc"}},
+		{Type: "image", Action: "delete", Actor: events.Actor{ID: "sha256:def"}},
+		{Type: "container", Action: "exec_start: sh -c ls", Actor: events.Actor{ID: "abc"}},
+	}
+
+	// local3 is facility 19
+	var expectedPriorities = []int{19*8 + 3, 19*8 + 6, 19*8 + 2, 19*8 + 4, 19*8 + 5, 19*8 + 6}
+
+	for _, network := range []string{"udp", "tcp"} {
+		t.Run(network, func(t *testing.T) {
+			addr, msgs := newSyslogListener(t, network)
+
+			agg, err := aggregators.NewSyslog(aggregators.SyslogConfig{
+				Network:  network,
+				Address:  addr,
+				Facility: "local3",
+				AppName:  "my app",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), agg, evs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, priority := range expectedPriorities {
+				var msg = waitSyslog(t, msgs)
+				if msg.priority != priority {
+					t.Errorf("message %d: expected priority %d, got %d", i, priority, msg.priority)
+				}
+			}
+
+			if !agg.Healthy() {
+				t.Error("expected syslog to be healthy")
+			}
+		})
+	}
+
+	t.Run("structured data", func(t *testing.T) {
+		addr, msgs := newSyslogListener(t, "udp")
+
+		agg, err := aggregators.NewSyslog(aggregators.SyslogConfig{Address: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = collectorstest.Run(context.Background(), agg, evs[0], evs[5])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msg = waitSyslog(t, msgs)
+		if msg.appName != "devents" || msg.msgID != "container" || msg.sdID != "docker@32473" {
+			t.Errorf("unexpected header %+v", msg)
+		}
+
+		if !msg.timestamp.Equal(time.Unix(0, evs[0].TimeNano)) {
+			t.Errorf("expected timestamp %v, got %v", time.Unix(0, evs[0].TimeNano), msg.timestamp)
+		}
+
+		var expected = map[string]string{
+			"type":     "container",
+			"action":   "die",
+			"id":       "abc",
+			"name":     "web",
+			"exitCode": "137",
+			"label":    `quoted "]\ value`,
+		}
+		for key, value := range expected {
+			if msg.params[key] != value {
+				t.Errorf("expected param %s=%q, got %q", key, value, msg.params[key])
+			}
+		}
+
+		if msg.msg != "container die web" {
+			t.Errorf("unexpected message %q", msg.msg)
+		}
+
+		msg = waitSyslog(t, msgs)
+		if msg.params["action"] != "exec_start" || msg.msg != "container exec_start abc" {
+			t.Errorf("expected the exec action to be normalized, got %+v", msg)
+		}
+	})
+}
+
+func TestSyslogReconnects(t *testing.T) {
+	addr, msgs := newSyslogListener(t, "tcp")
+
+	agg, err := aggregators.NewSyslog(aggregators.SyslogConfig{
+		Network: "tcp",
+		Address: addr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mock = collectorstest.NewMock(1)
+		done = make(chan error, 1)
+		ev   = events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}}
+	)
+
+	go func() {
+		evs, errs := mock.Collect(context.Background())
+		done <- agg.Run(context.Background(), evs, errs)
+	}()
+
+	mock.Push(ev)
+	var first = waitSyslog(t, msgs)
+	first.conn.Close()
+
+	// the writes right after the drop may still succeed locally, so
+	// keep sending until one makes it through a new connection
+	var deadline = time.After(5 * time.Second)
+	for reconnected := false; !reconnected; {
+		mock.Push(ev)
+
+		select {
+		case msg := <-msgs:
+			reconnected = msg.conn != first.conn
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for syslog to reconnect")
+		}
+	}
+
+	mock.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSyslogInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.SyslogConfig
+	}{
+		{desc: "unknown network", cfg: aggregators.SyslogConfig{Network: "unix"}},
+		{desc: "unknown facility", cfg: aggregators.SyslogConfig{Facility: "local9"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewSyslog(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTelegramAPIURL   = "https://api.telegram.org"
+	defaultTelegramTemplate = "{{.Type}} {{.Action}}: {{or .Actor.Attributes.name .Actor.ID}}" +
+		"{{with .Actor.Attributes.image}} ({{.}}){{end}}" +
+		"{{with .Actor.Attributes.exitCode}} exited with {{.}}{{end}}"
+	defaultTelegramInterval = time.Second
+)
+
+// defaultTelegramRules notify about the same events as
+// defaultSlackRules.
+var defaultTelegramRules = []TelegramRule{
+	{eventMatcher: eventMatcher{
+		Event:      "container:die",
+		Conditions: []attributeCondition{{Attribute: "exitCode", Value: "0", Negate: true}},
+	}},
+	{eventMatcher: eventMatcher{Event: "container:oom"}},
+	{eventMatcher: eventMatcher{Event: "container:health_status: unhealthy"}},
+}
+
+var _ Aggregator = (*Telegram)(nil)
+
+// TelegramRule selects the events that get notified and where.
+type TelegramRule struct {
+	eventMatcher
+
+	// ChatID overrides the chat the message is sent to.
+	ChatID string
+}
+
+// ParseTelegramRule parses a rule in the form accepted by
+// parseEventMatcher, where `chat` sets the chat the matching events
+// are sent to, e.g.
+//
+//	event=container:oom,chat=-1001234567890
+func ParseTelegramRule(s string) (rule TelegramRule, err error) {
+	rule.eventMatcher, err = parseEventMatcher(s, map[string]*string{
+		"chat": &rule.ChatID,
+	})
+	return
+}
+
+type TelegramConfig struct {
+	// Token is the token of the bot sending the messages.
+	Token string
+
+	// ChatID is the chat messages are sent to when the rule that
+	// selected the event doesn't name one.
+	ChatID string
+
+	// Rules select the events that are notified. The first rule
+	// matching an event decides the chat of the message. Defaults
+	// to non-zero container exits, OOMs and containers turning
+	// unhealthy.
+	Rules []TelegramRule
+
+	// Template is a text/template rendered with the event to
+	// produce the text of the message.
+	Template string
+
+	// Interval is the minimum time between two messages, keeping
+	// devents under Telegram's rate limits. Defaults to 1s.
+	Interval time.Duration
+
+	// APIURL is the base address of the Bot API. Defaults to
+	// https://api.telegram.org.
+	APIURL string
+}
+
+// Telegram sends human readable notifications about selected events
+// to Telegram chats through the Bot API.
+type Telegram struct {
+	logger   *log.Entry
+	client   *http.Client
+	url      string
+	chatID   string
+	rules    []TelegramRule
+	template *template.Template
+	interval time.Duration
+	retry    retryConfig
+}
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func NewTelegram(cfg TelegramConfig) (agg Telegram, err error) {
+	if cfg.Token == "" {
+		err = errors.New("A telegram bot token must be specified")
+		return
+	}
+
+	agg.rules = cfg.Rules
+	if len(agg.rules) == 0 {
+		agg.rules = defaultTelegramRules
+	}
+
+	for _, rule := range agg.rules {
+		if rule.ChatID == "" && cfg.ChatID == "" {
+			err = errors.Errorf(
+				"No telegram chat specified for the events matching %s",
+				rule.Event)
+			return
+		}
+	}
+
+	var text = cfg.Template
+	if text == "" {
+		text = defaultTelegramTemplate
+	}
+
+	agg.template, err = template.New("telegram").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't parse telegram template %s", text)
+		return
+	}
+
+	agg.interval = cfg.Interval
+	if agg.interval <= 0 {
+		agg.interval = defaultTelegramInterval
+	}
+
+	var apiURL = cfg.APIURL
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+
+	agg.url = strings.TrimSuffix(apiURL, "/") + "/bot" + cfg.Token + "/sendMessage"
+	agg.chatID = cfg.ChatID
+	agg.client = &http.Client{Timeout: 10 * time.Second}
+	agg.retry = retryConfig{}.withDefaults()
+	agg.logger = log.WithField("aggregator", "telegram")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (t Telegram) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var lastSent time.Time
+
+	t.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			t.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				t.logger.Info("events channel closed")
+				return
+			}
+
+			rule, matched := t.match(ev)
+			if !matched {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(lastSent.Add(t.interval))):
+			}
+
+			lastSent = time.Now()
+			err := t.notify(ctx, rule, ev)
+			if err != nil {
+				t.logger.
+					WithError(err).
+					Error("Errored sending telegram notification")
+			}
+		}
+	}
+}
+
+// match returns the first rule that selects the event.
+func (t Telegram) match(ev events.Message) (rule TelegramRule, matched bool) {
+	for _, rule = range t.rules {
+		if rule.matches(ev) {
+			matched = true
+			return
+		}
+	}
+
+	return
+}
+
+func (t Telegram) notify(ctx context.Context, rule TelegramRule, ev events.Message) (err error) {
+	var text bytes.Buffer
+
+	err = t.template.Execute(&text, ev)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't render telegram template")
+		return
+	}
+
+	var chatID = rule.ChatID
+	if chatID == "" {
+		chatID = t.chatID
+	}
+
+	body, err := json.Marshal(telegramMessage{
+		ChatID:                chatID,
+		Text:                  text.String(),
+		DisableWebPagePreview: true,
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode telegram message")
+		return
+	}
+
+	return retry(ctx, t.retry, func() error {
+		return t.post(body)
+	})
+}
+
+func (t Telegram) post(body []byte) (err error) {
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The url carries the bot token, which must not end up
+		// in the logs.
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+
+		err = transientError{errors.Wrapf(err,
+			"Couldn't send message to telegram")}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var reply telegramResponse
+
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		if json.Unmarshal(msg, &reply) == nil && reply.Description != "" {
+			msg = []byte(reply.Description)
+		}
+
+		err = errors.Errorf(
+			"telegram request failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
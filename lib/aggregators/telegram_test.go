@@ -0,0 +1,191 @@
+package aggregators_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// telegramMessages decodes the sendMessage calls in `requests`.
+func telegramMessages(t *testing.T, requests []recordedRequest) (messages []telegramMessage) {
+	t.Helper()
+
+	for _, req := range requests {
+		if req.method != http.MethodPost || req.url != "/bottoken/sendMessage" {
+			t.Errorf("unexpected request %s %s", req.method, req.url)
+		}
+		if ct := req.header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected a json body, got %s", ct)
+		}
+
+		var msg telegramMessage
+		err := json.Unmarshal([]byte(req.body), &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return
+}
+
+func TestTelegram(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	oomRule, err := aggregators.ParseTelegramRule("event=container:oom,chat=-100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dieRule, err := aggregators.ParseTelegramRule("event=container:die,exitCode!=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agg, err := aggregators.NewTelegram(aggregators.TelegramConfig{
+		Token:    "token",
+		ChatID:   "42",
+		Rules:    []aggregators.TelegramRule{oomRule, dieRule},
+		Interval: 50 * time.Millisecond,
+		APIURL:   url + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var start = time.Now()
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "oom", Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+			"name":  "web",
+			"image": "nginx",
+		}}},
+		events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "abc", Attributes: map[string]string{
+			"exitCode": "0",
+		}}},
+		events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}},
+		events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "def", Attributes: map[string]string{
+			"exitCode": "137",
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages = telegramMessages(t, received())
+	var expected = []telegramMessage{
+		{ChatID: "-100", Text: "container oom: web (nginx)", DisableWebPagePreview: true},
+		{ChatID: "42", Text: "container die: def exited with 137", DisableWebPagePreview: true},
+	}
+
+	if len(messages) != len(expected) {
+		t.Fatalf("expected %d messages, got %+v", len(expected), messages)
+	}
+	for i, msg := range messages {
+		if msg != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], msg)
+		}
+	}
+
+	// messages are spaced by the interval
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the messages to be rate limited, took %s", elapsed)
+	}
+}
+
+func TestTelegramTemplate(t *testing.T) {
+	url, received := newRecordingServer(t)
+
+	agg, err := aggregators.NewTelegram(aggregators.TelegramConfig{
+		Token:    "token",
+		ChatID:   "42",
+		Template: "{{.Actor.Attributes.name}} ran out of memory",
+		Interval: time.Millisecond,
+		APIURL:   url,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), agg,
+		events.Message{Type: "container", Action: "oom", Actor: events.Actor{Attributes: map[string]string{"name": "web"}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages = telegramMessages(t, received())
+	if len(messages) != 1 || messages[0].Text != "web ran out of memory" {
+		t.Errorf("expected the template to be rendered, got %+v", messages)
+	}
+}
+
+func TestTelegramRetries(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		status   int
+		requests int
+	}{
+		{desc: "server error", status: http.StatusServiceUnavailable, requests: 2},
+		{desc: "rejected message", status: http.StatusBadRequest, requests: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			url, received := newRecordingServer(t, tc.status)
+
+			agg, err := aggregators.NewTelegram(aggregators.TelegramConfig{
+				Token:    "token",
+				ChatID:   "42",
+				Interval: time.Millisecond,
+				APIURL:   url,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), agg,
+				events.Message{Type: "container", Action: "oom", Actor: events.Actor{ID: "abc"}},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if requests := received(); len(requests) != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, len(requests))
+			}
+		})
+	}
+}
+
+func TestNewTelegramInvalid(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  aggregators.TelegramConfig
+	}{
+		{desc: "no token", cfg: aggregators.TelegramConfig{ChatID: "42"}},
+		{desc: "no chat", cfg: aggregators.TelegramConfig{Token: "token"}},
+		{desc: "malformed template", cfg: aggregators.TelegramConfig{Token: "token", ChatID: "42", Template: "{{.Type"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := aggregators.NewTelegram(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
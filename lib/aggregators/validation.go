@@ -0,0 +1,29 @@
+package aggregators
+
+import (
+	"strings"
+)
+
+// ValidationErrors gathers every problem found while validating a
+// configuration so that they can all be reported at once instead of
+// one per attempt.
+type ValidationErrors []error
+
+func (v ValidationErrors) Error() string {
+	var messages = make([]string, 0, len(v))
+	for _, err := range v {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Err returns nil when no problem was found and the errors
+// otherwise.
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+
+	return v
+}
@@ -0,0 +1,219 @@
+package aggregators
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWebhookTimeout  = 10 * time.Second
+	webhookSignatureHeader = "X-Devents-Signature"
+)
+
+var _ Aggregator = (*Webhook)(nil)
+
+type WebhookConfig struct {
+	URL string
+
+	// Headers are extra `Name: value` headers sent with every
+	// request (e.g., `Authorization: Bearer ...`).
+	Headers []string
+
+	// Timeout bounds each request. Defaults to 10s.
+	Timeout time.Duration
+
+	// RetryAttempts and RetryBackoff control how requests that
+	// failed with transient errors (5xx, 429, network) are retried.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+
+	// Events restricts the events that trigger a request (see
+	// eventFilter). Every event is sent when empty.
+	Events []string
+
+	// Secret, when set, is used to sign the body with HMAC-SHA256.
+	// The signature is sent in the `X-Devents-Signature` header as
+	// `sha256=<hex digest>`.
+	Secret string
+
+	// Format is how events are encoded in the body of the
+	// requests: `json` (the default) or `cloudevents`, which sends
+	// them as structured CloudEvents whose source is Source.
+	Format string
+	Source string
+
+	// DeadLetter configures where the events that couldn't be
+	// delivered go.
+	DeadLetter DeadLetterConfig
+}
+
+// Webhook POSTs every (selected) event as JSON to an URL.
+type Webhook struct {
+	logger     *log.Entry
+	client     *http.Client
+	url        string
+	headers    http.Header
+	filter     eventFilter
+	secret     []byte
+	retry      retryConfig
+	encoder    eventEncoder
+	deadLetter *deadLetter
+}
+
+func NewWebhook(cfg WebhookConfig) (agg Webhook, err error) {
+	if cfg.URL == "" {
+		err = errors.New("A webhook url must be specified")
+		return
+	}
+
+	agg.headers = http.Header{}
+	for _, header := range cfg.Headers {
+		idx := strings.Index(header, ":")
+		if idx == -1 {
+			err = errors.Errorf(
+				"Malformed webhook header %s - expected `Name: value`", header)
+			return
+		}
+
+		agg.headers.Add(
+			strings.TrimSpace(header[:idx]),
+			strings.TrimSpace(header[idx+1:]))
+	}
+
+	var timeout = cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	agg.url = cfg.URL
+	agg.client = &http.Client{Timeout: timeout}
+	agg.filter = eventFilter(cfg.Events)
+	agg.secret = []byte(cfg.Secret)
+	agg.retry = retryConfig{
+		Attempts: cfg.RetryAttempts,
+		Backoff:  cfg.RetryBackoff,
+	}.withDefaults()
+
+	agg.encoder, err = newEventEncoder(cfg.Format, cfg.Source)
+	if err != nil {
+		return
+	}
+
+	agg.deadLetter, err = newDeadLetter(cfg.DeadLetter, "webhook")
+	if err != nil {
+		return
+	}
+
+	agg.logger = log.WithField("aggregator", "webhook")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (w Webhook) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	defer w.deadLetter.close()
+
+	w.logger.Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			w.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				w.logger.Info("events channel closed")
+				return
+			}
+
+			if !w.filter.matches(ev) {
+				continue
+			}
+
+			err := w.send(ctx, ev)
+			if err != nil {
+				w.logger.
+					WithError(err).
+					Error("Errored sending event to webhook")
+				w.deadLetter.add(ev)
+			}
+		}
+	}
+}
+
+// send POSTs an event, retrying transient failures.
+func (w Webhook) send(ctx context.Context, ev events.Message) (err error) {
+	body, err := w.encoder.encode(ev)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't encode event")
+		return
+	}
+
+	return retry(ctx, w.retry, func() error {
+		return w.post(ctx, body)
+	})
+}
+
+func (w Webhook) post(ctx context.Context, body []byte) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't create webhook request")
+		return
+	}
+
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+
+	req.Header.Set("Content-Type", w.encoder.contentType())
+	if len(w.secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signHMAC(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		err = transientError{errors.Wrapf(err,
+			"Couldn't send webhook request to %s", w.url)}
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = errors.Errorf(
+			"webhook request failed with status %d: %s",
+			resp.StatusCode, bytes.TrimSpace(msg))
+		if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+			err = transientError{err}
+		}
+		return
+	}
+
+	return
+}
+
+// signHMAC computes the hex encoded HMAC-SHA256 of `body`.
+func signHMAC(secret, body []byte) string {
+	var mac = hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,190 @@
+package aggregators_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// webhookRequest is what a webhook endpoint received.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newWebhookEndpoint records the requests it receives, answering the
+// first `failures` of them with a 503.
+func newWebhookEndpoint(t *testing.T, failures int) (url string, received func() []webhookRequest) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []webhookRequest
+	)
+
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, webhookRequest{header: r.Header, body: body})
+		if len(requests) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL, func() []webhookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]webhookRequest(nil), requests...)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	url, received := newWebhookEndpoint(t, 0)
+
+	webhook, err := aggregators.NewWebhook(aggregators.WebhookConfig{
+		URL:     url,
+		Headers: []string{"Authorization: Bearer abc"},
+		Events:  []string{"container:die"},
+		Secret:  "s3cr3t",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), webhook,
+		events.Message{Type: events.ContainerEventType, Action: "start"},
+		events.Message{Type: events.ContainerEventType, Action: "die", Actor: events.Actor{ID: "c1"}},
+		events.Message{Type: events.NetworkEventType, Action: "die"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requests = received()
+	if len(requests) != 1 {
+		t.Fatalf("expected only the container:die event to be sent, got %d requests", len(requests))
+	}
+
+	var request = requests[0]
+
+	if auth := request.header.Get("Authorization"); auth != "Bearer abc" {
+		t.Errorf("expected the extra header to be sent, got %q", auth)
+	}
+
+	var mac = hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(request.body)
+
+	var signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := request.header.Get("X-Devents-Signature"); got != signature {
+		t.Errorf("expected signature %s, got %s", signature, got)
+	}
+
+	var ev events.Message
+	if err := json.Unmarshal(request.body, &ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if ev.Action != "die" || ev.Actor.ID != "c1" {
+		t.Errorf("expected the die event of c1, got %+v", ev)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int
+		attempts int
+		requests int
+	}{
+		{name: "recovers", failures: 2, attempts: 3, requests: 3},
+		{name: "gives up", failures: 5, attempts: 2, requests: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			url, received := newWebhookEndpoint(t, tc.failures)
+
+			webhook, err := aggregators.NewWebhook(aggregators.WebhookConfig{
+				URL:           url,
+				RetryAttempts: tc.attempts,
+				RetryBackoff:  time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = collectorstest.Run(context.Background(), webhook,
+				events.Message{Type: events.ContainerEventType, Action: "die"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if requests := len(received()); requests != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, requests)
+			}
+		})
+	}
+}
+
+func TestWebhookCancel(t *testing.T) {
+	var received = make(chan struct{}, 1)
+
+	// the endpoint never answers, holding requests until they're
+	// abandoned
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		received <- struct{}{}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	webhook, err := aggregators.NewWebhook(aggregators.WebhookConfig{
+		URL:     server.URL,
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		evs         = make(chan events.Message, 1)
+		done        = make(chan error, 1)
+	)
+	defer cancel()
+
+	go func() {
+		done <- webhook.Run(ctx, evs, nil)
+	}()
+
+	evs <- events.Message{Type: events.ContainerEventType, Action: "die"}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the event to be sent")
+	}
+
+	// cancelling abandons the request in flight instead of waiting
+	// for the timeout
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the webhook to return once cancelled")
+	}
+}
@@ -0,0 +1,163 @@
+package aggregators
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"golang.org/x/net/websocket"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Aggregator = (*WebSocket)(nil)
+
+type WebSocketConfig struct {
+	// Addr is the address the server binds to (e.g., `:9104`).
+	Addr string
+
+	// Path is where clients connect to. Defaults to `/events`.
+	Path string
+
+	// Token, when set, must be given by clients either as a bearer
+	// token or through the `token` query parameter.
+	Token string
+
+	// Events restricts the events broadcast (see eventFilter).
+	Events []string
+
+	// BufferSize is the number of events that can be queued for a
+	// client before it's considered too slow and disconnected.
+	BufferSize int
+}
+
+// WebSocket runs a WebSocket server that broadcasts every event as
+// JSON to all the connected clients. Clients that can't keep up are
+// disconnected so that they never hold back the pipeline.
+type WebSocket struct {
+	logger      *log.Entry
+	addr        string
+	path        string
+	token       string
+	filter      eventFilter
+	broadcaster *broadcaster
+}
+
+func NewWebSocket(cfg WebSocketConfig) (agg WebSocket, err error) {
+	agg.path = cfg.Path
+	if agg.path == "" {
+		agg.path = "/events"
+	}
+
+	agg.addr = cfg.Addr
+	agg.token = cfg.Token
+	agg.filter = eventFilter(cfg.Events)
+	agg.broadcaster = newBroadcaster(cfg.BufferSize)
+	agg.logger = log.WithField("aggregator", "websocket")
+	agg.logger.Info("aggregator initialized")
+	return
+}
+
+func (w WebSocket) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) (err error) {
+	var (
+		mux     = http.NewServeMux()
+		handler = http.Handler(websocket.Server{Handler: w.serveClient})
+	)
+
+	if w.token != "" {
+		handler = tokenAuth(handler, w.token)
+	}
+
+	mux.Handle(w.path, handler)
+
+	serveErrs, shutdown, err := serveHTTP(w.addr, mux)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		// Hijacked connections aren't tracked by the server, so
+		// the clients are disconnected by closing their feeds.
+		w.broadcaster.close()
+
+		shutdownErr := shutdown(defaultPrometheusShutdownTimeout)
+		if err == nil {
+			err = shutdownErr
+		}
+	}()
+
+	w.logger.WithField("addr", w.addr).Info("listening to events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-serveErrs:
+			return
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			w.logger.WithError(err).Info("errored")
+		case ev, ok := <-evs:
+			if !ok {
+				w.logger.Info("events channel closed")
+				return
+			}
+
+			if !w.filter.matches(ev) {
+				continue
+			}
+
+			if dropped := w.broadcaster.publish(ev); dropped > 0 {
+				w.logger.
+					WithField("clients", dropped).
+					Warn("disconnecting slow clients")
+			}
+		}
+	}
+}
+
+// serveClient streams the events to a connected client until it
+// disconnects or gets dropped.
+func (w WebSocket) serveClient(conn *websocket.Conn) {
+	var (
+		sub    = w.broadcaster.subscribe(nil)
+		logger = w.logger.WithField("client", conn.Request().RemoteAddr)
+	)
+	defer w.broadcaster.unsubscribe(sub)
+	defer conn.Close()
+
+	logger.Info("client connected")
+	defer logger.Info("client disconnected")
+
+	// Clients aren't expected to send anything: reading only serves
+	// to notice when they go away.
+	var gone = make(chan struct{})
+	go func() {
+		defer close(gone)
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case ev, ok := <-sub.evs:
+			if !ok {
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
+			err := websocket.JSON.Send(conn, ev)
+			if err != nil {
+				logger.WithError(err).Warn("Errored sending event")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package aggregators
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"golang.org/x/net/websocket"
+)
+
+// freeAddr returns a local address nothing listens to.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+// waitSubscribers waits for `b` to have `n` subscribers.
+func waitSubscribers(t *testing.T, b *broadcaster, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); b.len() != n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, b.len())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startStreaming runs `run` in the background with an events channel
+// the test pushes to, waiting for the server at `addr` to be up. The
+// returned function closes the channel and waits for `run` to return.
+func startStreaming(t *testing.T, addr string, run func(context.Context, <-chan events.Message, <-chan error) error) (evs chan<- events.Message, stop func()) {
+	t.Helper()
+
+	var (
+		ch   = make(chan events.Message)
+		done = make(chan error, 1)
+	)
+
+	go func() { done <- run(context.Background(), ch, nil) }()
+
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be listened to: %v", addr, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return ch, func() {
+		t.Helper()
+
+		close(ch)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected Run to return")
+		}
+	}
+}
+
+func dialWebSocket(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocket(t *testing.T) {
+	var addr = freeAddr(t)
+
+	agg, err := NewWebSocket(WebSocketConfig{
+		Addr:   addr,
+		Token:  "secret",
+		Events: []string{"container:start", "*:destroy"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, stop := startStreaming(t, addr, agg.Run)
+
+	var clients = []*websocket.Conn{
+		dialWebSocket(t, "ws://"+addr+"/events?token=secret"),
+		dialWebSocket(t, "ws://"+addr+"/events?token=secret"),
+	}
+	waitSubscribers(t, agg.broadcaster, len(clients))
+
+	evs <- events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "abc"}}
+	evs <- events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "abc"}}
+	evs <- events.Message{Type: "volume", Action: "destroy", Actor: events.Actor{ID: "def"}}
+
+	for i, client := range clients {
+		for _, expected := range []string{"start", "destroy"} {
+			var ev events.Message
+			err := websocket.JSON.Receive(client, &ev)
+			if err != nil {
+				t.Fatalf("client %d: %v", i, err)
+			}
+
+			if ev.Action != expected {
+				t.Errorf("client %d: expected %s, got %s", i, expected, ev.Action)
+			}
+		}
+	}
+
+	// closing a client unsubscribes it
+	clients[0].Close()
+	waitSubscribers(t, agg.broadcaster, 1)
+
+	// stopping disconnects the remaining clients
+	stop()
+
+	var ev events.Message
+	if err := websocket.JSON.Receive(clients[1], &ev); err == nil {
+		t.Errorf("expected the client to be disconnected, got %+v", ev)
+	}
+}
+
+func TestWebSocketToken(t *testing.T) {
+	var addr = freeAddr(t)
+
+	agg, err := NewWebSocket(WebSocketConfig{Addr: addr, Path: "/feed", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, stop := startStreaming(t, addr, agg.Run)
+	defer stop()
+
+	var testCases = []struct {
+		desc   string
+		header string
+		query  string
+		status int
+	}{
+		{desc: "no token", status: http.StatusUnauthorized},
+		{desc: "wrong token", query: "?token=nope", status: http.StatusUnauthorized},
+		{desc: "bearer token", header: "Bearer secret", status: http.StatusBadRequest},
+		{desc: "query token", query: "?token=secret", status: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/feed"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			// authorized requests reach the websocket handler,
+			// which rejects them for not being a handshake
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBroadcasterDropsSlowSubscribers(t *testing.T) {
+	var (
+		b    = newBroadcaster(1)
+		slow = b.subscribe(nil)
+		fast = b.subscribe(eventFilter{"container"})
+		ev   = events.Message{Type: "container", Action: "start"}
+	)
+
+	if dropped := b.publish(ev); dropped != 0 {
+		t.Fatalf("expected no subscriber to be dropped, got %d", dropped)
+	}
+	<-fast.evs
+
+	// the slow subscriber still holds the first event
+	if dropped := b.publish(ev); dropped != 1 {
+		t.Fatalf("expected the slow subscriber to be dropped, got %d", dropped)
+	}
+
+	if _, ok := <-slow.evs; !ok {
+		t.Fatal("expected the event queued before being dropped")
+	}
+	if _, ok := <-slow.evs; ok {
+		t.Fatal("expected the channel of the slow subscriber to be closed")
+	}
+
+	if _, ok := <-fast.evs; !ok || b.len() != 1 {
+		t.Fatal("expected the subscriber keeping up to be kept")
+	}
+
+	// events filtered out don't count against the buffer
+	b.publish(events.Message{Type: "network", Action: "connect"})
+	b.publish(events.Message{Type: "network", Action: "connect"})
+	if b.len() != 1 {
+		t.Fatal("expected filtered out events to be skipped")
+	}
+
+	b.close()
+	if _, ok := <-fast.evs; ok {
+		t.Fatal("expected closing to close the channels")
+	}
+
+	if _, ok := <-b.subscribe(nil).evs; ok {
+		t.Fatal("expected subscribing after close to get a closed channel")
+	}
+}
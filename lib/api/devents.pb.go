@@ -0,0 +1,255 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: devents.proto
+
+/*
+Package api is a generated protocol buffer package.
+
+It is generated from these files:
+
+	devents.proto
+
+It has these top-level messages:
+
+	SubscribeRequest
+	Actor
+	Event
+*/
+package api
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SubscribeRequest struct {
+	Types   []string `protobuf:"bytes,1,rep,name=types" json:"types,omitempty"`
+	Actions []string `protobuf:"bytes,2,rep,name=actions" json:"actions,omitempty"`
+}
+
+func (m *SubscribeRequest) Reset()                    { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()               {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *SubscribeRequest) GetTypes() []string {
+	if m != nil {
+		return m.Types
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetActions() []string {
+	if m != nil {
+		return m.Actions
+	}
+	return nil
+}
+
+type Actor struct {
+	Id         string            `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Attributes map[string]string `protobuf:"bytes,2,rep,name=attributes" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Actor) Reset()                    { *m = Actor{} }
+func (m *Actor) String() string            { return proto.CompactTextString(m) }
+func (*Actor) ProtoMessage()               {}
+func (*Actor) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Actor) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Actor) GetAttributes() map[string]string {
+	if m != nil {
+		return m.Attributes
+	}
+	return nil
+}
+
+type Event struct {
+	Type     string `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	Action   string `protobuf:"bytes,2,opt,name=action" json:"action,omitempty"`
+	Actor    *Actor `protobuf:"bytes,3,opt,name=actor" json:"actor,omitempty"`
+	TimeNano int64  `protobuf:"varint,4,opt,name=time_nano,json=timeNano" json:"time_nano,omitempty"`
+}
+
+func (m *Event) Reset()                    { *m = Event{} }
+func (m *Event) String() string            { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()               {}
+func (*Event) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Event) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Event) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *Event) GetActor() *Actor {
+	if m != nil {
+		return m.Actor
+	}
+	return nil
+}
+
+func (m *Event) GetTimeNano() int64 {
+	if m != nil {
+		return m.TimeNano
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*SubscribeRequest)(nil), "devents.SubscribeRequest")
+	proto.RegisterType((*Actor)(nil), "devents.Actor")
+	proto.RegisterType((*Event)(nil), "devents.Event")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Events service
+
+type EventsClient interface {
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Events_SubscribeClient, error)
+}
+
+type eventsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewEventsClient(cc *grpc.ClientConn) EventsClient {
+	return &eventsClient{cc}
+}
+
+func (c *eventsClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Events_SubscribeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Events_serviceDesc.Streams[0], c.cc, "/devents.Events/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &eventsSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Events_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type eventsSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *eventsSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Events service
+
+type EventsServer interface {
+	Subscribe(*SubscribeRequest, Events_SubscribeServer) error
+}
+
+func RegisterEventsServer(s *grpc.Server, srv EventsServer) {
+	s.RegisterService(&_Events_serviceDesc, srv)
+}
+
+func _Events_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EventsServer).Subscribe(m, &eventsSubscribeServer{stream})
+}
+
+type Events_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type eventsSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *eventsSubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Events_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "devents.Events",
+	HandlerType: (*EventsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Events_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "devents.proto",
+}
+
+func init() { proto.RegisterFile("devents.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 291 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0x41, 0x4b, 0xfb, 0x40,
+	0x10, 0xc5, 0xd9, 0xa4, 0x69, 0xff, 0x99, 0xf2, 0xaf, 0x65, 0x10, 0x59, 0x2b, 0x48, 0x28, 0x1e,
+	0x72, 0x2a, 0x52, 0x2f, 0x45, 0x50, 0x68, 0xa0, 0x57, 0x0f, 0xeb, 0xcd, 0x8b, 0x6c, 0x92, 0x3d,
+	0x2c, 0xea, 0x6e, 0xcc, 0x6e, 0x02, 0xf9, 0x22, 0x7e, 0x5e, 0xd9, 0x4d, 0x1a, 0xb5, 0xb7, 0x79,
+	0x33, 0xf9, 0xe5, 0xbd, 0x99, 0x85, 0xff, 0xa5, 0x68, 0x85, 0xb2, 0x66, 0x53, 0xd5, 0xda, 0x6a,
+	0x9c, 0x0d, 0x72, 0x9d, 0xc1, 0xf2, 0xb9, 0xc9, 0x4d, 0x51, 0xcb, 0x5c, 0x30, 0xf1, 0xd9, 0x08,
+	0x63, 0xf1, 0x1c, 0x22, 0xdb, 0x55, 0xc2, 0x50, 0x92, 0x84, 0x69, 0xcc, 0x7a, 0x81, 0x14, 0x66,
+	0xbc, 0xb0, 0x52, 0x2b, 0x43, 0x03, 0xdf, 0x3f, 0xca, 0xf5, 0x17, 0x81, 0x68, 0x5f, 0x58, 0x5d,
+	0xe3, 0x02, 0x02, 0x59, 0x52, 0x92, 0x90, 0x34, 0x66, 0x81, 0x2c, 0xf1, 0x11, 0x80, 0x5b, 0x5b,
+	0xcb, 0xbc, 0xb1, 0xa2, 0xc7, 0xe6, 0xdb, 0xeb, 0xcd, 0x31, 0x8a, 0x67, 0x36, 0xfb, 0xf1, 0x83,
+	0x83, 0xb2, 0x75, 0xc7, 0x7e, 0x11, 0xab, 0x07, 0x38, 0x3b, 0x19, 0xe3, 0x12, 0xc2, 0x37, 0xd1,
+	0x0d, 0x1e, 0xae, 0x74, 0x71, 0x5b, 0xfe, 0xde, 0x08, 0x1a, 0xf8, 0x5e, 0x2f, 0xee, 0x83, 0x1d,
+	0x59, 0xb7, 0x10, 0x1d, 0x9c, 0x15, 0x22, 0x4c, 0xdc, 0x12, 0x03, 0xe5, 0x6b, 0xbc, 0x80, 0x69,
+	0xbf, 0xc0, 0xc0, 0x0d, 0x0a, 0x6f, 0x20, 0xe2, 0x2e, 0x18, 0x0d, 0x13, 0x92, 0xce, 0xb7, 0x8b,
+	0xbf, 0x71, 0x59, 0x3f, 0xc4, 0x2b, 0x88, 0xad, 0xfc, 0x10, 0xaf, 0x8a, 0x2b, 0x4d, 0x27, 0x09,
+	0x49, 0x43, 0xf6, 0xcf, 0x35, 0x9e, 0xb8, 0xd2, 0xdb, 0x0c, 0xa6, 0xde, 0xd7, 0xe0, 0x0e, 0xe2,
+	0xf1, 0xbc, 0x78, 0x39, 0xfe, 0xea, 0xf4, 0xe4, 0xab, 0x1f, 0x17, 0x0f, 0xde, 0x92, 0x2c, 0x7a,
+	0x09, 0x79, 0x25, 0xf3, 0xa9, 0x7f, 0xaf, 0xbb, 0xef, 0x01, 0x00, 0x76, 0x81, 0xc7, 0x21, 0xc0,
+	0x01, 0x00, 0x00,
+}
@@ -1,9 +1,11 @@
 package collectors
 
 import (
+	"context"
+
 	"github.com/docker/docker/api/types/events"
 )
 
 type Collector interface {
-	Collect() (<-chan events.Message, <-chan error)
+	Collect(ctx context.Context) (<-chan events.Message, <-chan error)
 }
@@ -0,0 +1,70 @@
+// Package collectorstest provides a collector that emits whatever
+// it's told to, allowing aggregators (and anything else consuming
+// a collector) to be exercised without a docker daemon.
+package collectorstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/docker/docker/api/types/events"
+)
+
+var _ collectors.Collector = (*Mock)(nil)
+
+// Mock is a collector whose events and errors are pushed by hand.
+type Mock struct {
+	evs       chan events.Message
+	errs      chan error
+	closeOnce sync.Once
+}
+
+// NewMock creates a mock able to hold `bufferSize` events (and as
+// many errors) before pushing blocks.
+func NewMock(bufferSize int) *Mock {
+	return &Mock{
+		evs:  make(chan events.Message, bufferSize),
+		errs: make(chan error, bufferSize),
+	}
+}
+
+// Collect returns the channels the events and errors are pushed to.
+func (m *Mock) Collect(ctx context.Context) (<-chan events.Message, <-chan error) {
+	return m.evs, m.errs
+}
+
+// Push emits the given events.
+func (m *Mock) Push(evs ...events.Message) {
+	for _, ev := range evs {
+		m.evs <- ev
+	}
+}
+
+// Fail emits the given error.
+func (m *Mock) Fail(err error) {
+	m.errs <- err
+}
+
+// Close closes both channels, signaling that no more events will
+// come.
+func (m *Mock) Close() {
+	m.closeOnce.Do(func() {
+		close(m.evs)
+		close(m.errs)
+	})
+}
+
+// Run feeds `evs` to the aggregator and waits for it to process them,
+// returning what its Run returned. As aggregators return once their
+// events channel is closed, every side effect of the events has taken
+// place by the time Run returns.
+func Run(ctx context.Context, agg aggregators.Aggregator, evs ...events.Message) error {
+	var mock = NewMock(len(evs))
+
+	mock.Push(evs...)
+	mock.Close()
+
+	return agg.Run(ctx, mock.evs, mock.errs)
+}
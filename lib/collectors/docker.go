@@ -2,31 +2,429 @@ package collectors
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/docker/docker/api"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/sockets"
+	"github.com/docker/go-connections/tlsconfig"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	defaultSubsystem  = "devents"
 )
 
-type DockerConfig struct{}
+// eventFilters are the filters understood by the events endpoint of
+// the docker API.
+var eventFilters = map[string]bool{
+	"config":    true,
+	"container": true,
+	"daemon":    true,
+	"event":     true,
+	"image":     true,
+	"label":     true,
+	"network":   true,
+	"node":      true,
+	"plugin":    true,
+	"scope":     true,
+	"secret":    true,
+	"service":   true,
+	"type":      true,
+	"volume":    true,
+}
+
+type DockerConfig struct {
+	// Host is the address of the daemon (e.g.,
+	// unix:///var/run/docker.sock or tcp://host:2376). When empty,
+	// it's taken from `DOCKER_HOST` or the current docker CLI
+	// context, falling back to the local socket.
+	Host string
+
+	// TLSCACert, TLSCert and TLSKey are the files holding the
+	// certificate authority the daemon's certificate is verified
+	// against and the certificate (and key) devents presents to
+	// the daemon. Setting any of them makes the connection use
+	// TLS.
+	TLSCACert string
+	TLSCert   string
+	TLSKey    string
+
+	// TLSVerify enables TLS and verifies the certificate of the
+	// daemon. Without it the certificate isn't verified.
+	TLSVerify bool
+
+	// MinBackoff is the time to wait before the first attempt
+	// to reconnect to the daemon after the stream dies.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the exponentially increasing time waited
+	// between consecutive reconnection attempts.
+	MaxBackoff time.Duration
+
+	// Name identifies the daemon, as a `host` label, in the
+	// metrics of the collector.
+	Name string
+
+	// Namespace and Subsystem prefix the name of the metrics
+	// exposed by the collector.
+	Namespace string
+	Subsystem string
+
+	// Filters are `key=value` filters (as in `docker events
+	// --filter`) applied by the daemon so that only the events
+	// matching them are sent (e.g., `type=container`, `event=die`
+	// or `label=com.example=foo`). Filters with different keys
+	// must all match while filters sharing a key match if any of
+	// them does.
+	Filters []string
+
+	// Since makes the first subscription ask for the events that
+	// happened since then, replaying them before the live ones.
+	Since time.Time
+
+	// Until makes the daemon stop sending events once it's
+	// reached, after which the events channel is closed.
+	Until time.Time
+
+	// Enrich configures the metadata of containers, retrieved by
+	// inspecting them, that's merged into their events.
+	Enrich EnrichConfig
+}
 
 type Docker struct {
-	docker *client.Client
+	docker     *client.Client
+	logger     *log.Entry
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	reconnects prometheus.Counter
+	connection prometheus.Collector
+	filters    filters.Args
+	since      time.Time
+	until      time.Time
+	enricher   *enricher
+
+	// connected is set to 1 while there's an open subscription
+	// to the daemon's events stream, confirmed by the daemon.
+	connected *int32
 }
 
 func NewDocker(cfg DockerConfig) (collector Docker, err error) {
-	cli, err := client.NewEnvClient()
+	collector.logger = log.WithField("collector", "docker")
+
+	cfg, source, err := resolveDockerEndpoint(cfg, os.Getenv)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't resolve docker daemon")
+		return
+	}
+
+	collector.logger.
+		WithField("host", cfg.Host).
+		WithField("source", source).
+		Info("connecting to docker daemon")
+
+	cli, err := newDockerClient(cfg)
 	if err != nil {
 		err = errors.Wrapf(err,
 			"Couldn't instantiate docker client")
 		return
 	}
 
+	collector.filters = filters.NewArgs()
+	for _, filter := range cfg.Filters {
+		collector.filters, err = filters.ParseFlag(filter, collector.filters)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Malformed docker filter %s", filter)
+			return
+		}
+	}
+
+	err = collector.filters.Validate(eventFilters)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid docker filter")
+		return
+	}
+
+	if !cfg.Until.IsZero() && cfg.Until.Before(cfg.Since) {
+		err = errors.Errorf(
+			"until (%s) must not be before since (%s)",
+			cfg.Until, cfg.Since)
+		return
+	}
+
+	collector.enricher, err = newEnricher(cli, cfg.Enrich, collector.logger)
+	if err != nil {
+		return
+	}
+
+	collector.since = cfg.Since
+	collector.until = cfg.Until
+	collector.minBackoff = cfg.MinBackoff
+	if collector.minBackoff <= 0 {
+		collector.minBackoff = defaultMinBackoff
+	}
+
+	collector.maxBackoff = cfg.MaxBackoff
+	if collector.maxBackoff <= 0 {
+		collector.maxBackoff = defaultMaxBackoff
+	}
+
+	if collector.maxBackoff < collector.minBackoff {
+		err = errors.Errorf(
+			"max backoff (%s) must not be smaller than min backoff (%s)",
+			collector.maxBackoff, collector.minBackoff)
+		return
+	}
+
+	var subsystem = cfg.Subsystem
+	if subsystem == "" {
+		subsystem = defaultSubsystem
+	}
+
+	var constLabels prometheus.Labels
+	if cfg.Name != "" {
+		constLabels = prometheus.Labels{"host": cfg.Name}
+	}
+
+	collector.reconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "docker_reconnects_total",
+		Help:        "Number of times the docker events stream was re-established",
+		Namespace:   cfg.Namespace,
+		Subsystem:   subsystem,
+		ConstLabels: constLabels,
+	})
+
+	collector.connected = new(int32)
+	collector.connection = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "docker_connected",
+		Help:        "Whether the docker events stream is currently open (1) or not (0)",
+		Namespace:   cfg.Namespace,
+		Subsystem:   subsystem,
+		ConstLabels: constLabels,
+	}, func() float64 {
+		return float64(atomic.LoadInt32(collector.connected))
+	})
+
 	collector.docker = cli
 	return
 }
 
-func (d Docker) Collect() (<-chan events.Message, <-chan error) {
-	return d.docker.Events(context.Background(), types.EventsOptions{})
+// newDockerClient creates a client of the daemon at `cfg.Host`,
+// configuring its transport to use TLS when requested.
+func newDockerClient(cfg DockerConfig) (cli *client.Client, err error) {
+	var host = cfg.Host
+
+	proto, addr, _, err := client.ParseHost(host)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Malformed docker host %s", host)
+		return
+	}
+
+	var transport = new(http.Transport)
+	err = sockets.ConfigureTransport(transport, proto, addr)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't configure transport to %s", host)
+		return
+	}
+
+	if cfg.TLSVerify || cfg.TLSCACert != "" || cfg.TLSCert != "" || cfg.TLSKey != "" {
+		transport.TLSClientConfig, err = tlsconfig.Client(tlsconfig.Options{
+			CAFile:             cfg.TLSCACert,
+			CertFile:           cfg.TLSCert,
+			KeyFile:            cfg.TLSKey,
+			InsecureSkipVerify: !cfg.TLSVerify,
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't load docker TLS configuration")
+			return
+		}
+	}
+
+	cli, err = client.NewClient(host, api.DefaultVersion,
+		&http.Client{Transport: transport}, nil)
+	return
+}
+
+// Metrics returns the prometheus collectors that describe the
+// state of the docker collector.
+func (d Docker) Metrics() []prometheus.Collector {
+	return []prometheus.Collector{
+		d.reconnects,
+		d.connection,
+	}
+}
+
+// Connected reports whether the collector currently holds an open
+// subscription to the docker events stream.
+func (d Docker) Connected() bool {
+	return atomic.LoadInt32(d.connected) == 1
+}
+
+// Collect subscribes to the docker events stream.
+//
+// Whenever the stream terminates the subscription is re-established
+// with an exponential backoff, asking the daemon for the events that
+// happened since the last one received so that nothing is lost in
+// the gap. Stream errors are forwarded to the errors channel but are
+// not fatal. Both channels are closed once `ctx` gets cancelled or,
+// when an until time is set, once the daemon has sent every event
+// up to it.
+func (d Docker) Collect(ctx context.Context) (<-chan events.Message, <-chan error) {
+	var (
+		evs  = make(chan events.Message)
+		errs = make(chan error, 1)
+	)
+
+	go func() {
+		defer close(evs)
+		defer close(errs)
+
+		var (
+			backoff = d.minBackoff
+			since   = ""
+		)
+
+		if !d.since.IsZero() {
+			since = formatSince(d.since)
+		}
+
+		for {
+			var (
+				streamCtx, cancel = context.WithCancel(ctx)
+				subscribedAt      = time.Now()
+			)
+
+			dockerEvs, dockerErrs := d.docker.Events(streamCtx, d.eventsOptions(since))
+
+			// When replaying, `since` keeps pointing right after
+			// the last event received so that a reconnection
+			// resumes the replay instead of skipping what's left.
+			if d.since.IsZero() {
+				since = formatSince(subscribedAt)
+			}
+			// The stream is only known to be open once the daemon
+			// sends something down it: a daemon answering pings
+			// may still fail the subscription.
+			err := d.forward(ctx, dockerEvs, dockerErrs, evs, func(ev events.Message) {
+				atomic.StoreInt32(d.connected, 1)
+				switch {
+				case ev.TimeNano != 0:
+					since = formatSince(time.Unix(0, ev.TimeNano+1))
+				case ev.Time != 0:
+					// Only known to the second: resuming at
+					// it replays the rest of that second
+					// rather than losing it.
+					since = formatSince(time.Unix(ev.Time, 0))
+				}
+				backoff = d.minBackoff
+			})
+			atomic.StoreInt32(d.connected, 0)
+			cancel()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err == io.EOF && !d.until.IsZero() {
+				d.logger.
+					WithField("until", d.until).
+					Info("reached the end of the events requested")
+				return
+			}
+
+			d.logger.
+				WithError(err).
+				WithField("backoff", backoff).
+				Warn("events stream terminated, reconnecting")
+
+			select {
+			case errs <- err:
+			default:
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > d.maxBackoff {
+				backoff = d.maxBackoff
+			}
+
+			d.reconnects.Inc()
+		}
+	}()
+
+	return evs, errs
+}
+
+// eventsOptions builds the options of a subscription to the events
+// that happened since `since`.
+func (d Docker) eventsOptions(since string) types.EventsOptions {
+	var options = types.EventsOptions{
+		Since:   since,
+		Filters: d.filters,
+	}
+
+	if !d.until.IsZero() {
+		options.Until = formatSince(d.until)
+	}
+
+	return options
+}
+
+// forward pipes the events from a single docker subscription into
+// `out` until the subscription terminates, returning the reason.
+func (d Docker) forward(ctx context.Context,
+	in <-chan events.Message, inErrs <-chan error,
+	out chan<- events.Message, onEvent func(events.Message)) (err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case err = <-inErrs:
+			if err == nil {
+				err = errors.New("events stream closed")
+			}
+			return
+		case ev := <-in:
+			onEvent(ev)
+			ev = d.enricher.enrich(ctx, ev)
+
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+	}
+}
+
+// formatSince formats a point in time in the `seconds.nanoseconds`
+// form understood by the docker events API.
+func formatSince(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
 }
@@ -0,0 +1,645 @@
+package collectors
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestDocker creates a docker collector of the daemon served by
+// `handler`.
+func newTestDocker(t *testing.T, handler http.Handler) Docker {
+	t.Helper()
+
+	return newTestDockerConfig(t, handler, DockerConfig{})
+}
+
+// newTestDockerConfig is newTestDocker with the rest of the
+// configuration taken from `cfg`.
+func newTestDockerConfig(t *testing.T, handler http.Handler, cfg DockerConfig) Docker {
+	t.Helper()
+
+	var server = httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.Host = "tcp://" + strings.TrimPrefix(server.URL, "http://")
+	cfg.MinBackoff = 10 * time.Millisecond
+	cfg.MaxBackoff = 10 * time.Millisecond
+
+	d, err := NewDocker(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+// eventsRequests sends the queries of the subscriptions to the
+// events endpoint through the returned channel, answering them with
+// `evs` before closing the stream.
+func eventsRequests(evs ...events.Message) (handler http.Handler, queries <-chan url.Values) {
+	var ch = make(chan url.Values, 16)
+
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/events") {
+			return
+		}
+
+		select {
+		case ch <- r.URL.Query():
+		default:
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		for _, ev := range evs {
+			json.NewEncoder(w).Encode(ev)
+		}
+	})
+
+	return handler, ch
+}
+
+// nextQuery waits for a subscription, returning its query.
+func nextQuery(t *testing.T, queries <-chan url.Values) url.Values {
+	t.Helper()
+
+	select {
+	case query := <-queries:
+		return query
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a subscription to the events")
+	}
+
+	return nil
+}
+
+// assertConnected checks both Connected and the gauge exposing it.
+func assertConnected(t *testing.T, d Docker, connected bool) {
+	t.Helper()
+
+	var expected float64
+	if connected {
+		expected = 1
+	}
+
+	if d.Connected() != connected {
+		t.Errorf("expected connected to be %t", connected)
+	}
+
+	if value := testutil.ToFloat64(d.connection); value != expected {
+		t.Errorf("expected docker_connected to be %g, got %g", expected, value)
+	}
+}
+
+func TestDockerFailingConnection(t *testing.T) {
+	var d = newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	_, errs := d.Collect(ctx)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the subscription to fail")
+		}
+
+		assertConnected(t, d, false)
+	}
+}
+
+func TestDockerFailingSubscription(t *testing.T) {
+	var subscribed = make(chan chan struct{})
+
+	// The daemon answers pings and accepts each subscription but,
+	// once released by the test, closes it without sending a thing.
+	var d = newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/events") {
+			w.Write([]byte("OK"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.(http.Flusher).Flush()
+
+		var release = make(chan struct{})
+		select {
+		case subscribed <- release:
+			<-release
+		case <-r.Context().Done():
+		}
+	}))
+
+	if _, err := d.docker.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	_, errs := d.Collect(ctx)
+
+	for i := 0; i < 3; i++ {
+		var release = <-subscribed
+		time.Sleep(50 * time.Millisecond)
+		assertConnected(t, d, false)
+
+		close(release)
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the subscription to fail")
+		}
+
+		assertConnected(t, d, false)
+	}
+}
+
+func TestDockerConnectedFlips(t *testing.T) {
+	var (
+		opened   = make(chan chan struct{})
+		requests = 0
+	)
+
+	var d = newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/events") {
+			return
+		}
+
+		// Each subscription waits to be released by the test
+		// before being answered (the first one right away) and
+		// sends a single event before being closed once the test
+		// releases it again.
+		var release = make(chan struct{})
+
+		requests++
+		if requests > 1 {
+			opened <- release
+			<-release
+			release = make(chan struct{})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events.Message{
+			Type:     events.ContainerEventType,
+			Action:   "start",
+			TimeNano: time.Now().UnixNano(),
+		})
+		w.(http.Flusher).Flush()
+
+		select {
+		case opened <- release:
+			<-release
+		case <-r.Context().Done():
+		}
+	}))
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	evs, errs := d.Collect(ctx)
+
+	<-evs
+	assertConnected(t, d, true)
+	if count := testutil.ToFloat64(d.reconnects); count != 0 {
+		t.Errorf("expected no reconnection yet, got %g", count)
+	}
+
+	// The stream terminates, the reconnection is held back by the
+	// daemon until released.
+	close(<-opened)
+	<-errs
+	var pending = <-opened
+	assertConnected(t, d, false)
+
+	close(pending)
+	<-evs
+	assertConnected(t, d, true)
+	if count := testutil.ToFloat64(d.reconnects); count != 1 {
+		t.Errorf("expected a single reconnection, got %g", count)
+	}
+}
+
+func TestDockerFilters(t *testing.T) {
+	handler, queries := eventsRequests()
+
+	var d = newTestDockerConfig(t, handler, DockerConfig{
+		Filters: []string{
+			"type=container",
+			"event=start",
+			"event=die",
+			"label=com.example.monitor=true",
+		},
+	})
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Collect(ctx)
+
+	args, err := filters.FromParam(nextQuery(t, queries).Get("filters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die"},
+		"label": {"com.example.monitor=true"},
+	}
+
+	if args.Len() != len(expected) {
+		t.Errorf("expected %d filters, got %d", len(expected), args.Len())
+	}
+	for key, values := range expected {
+		for _, value := range values {
+			if !args.ExactMatch(key, value) {
+				t.Errorf("expected the filter %s=%s to be sent, got %v", key, value, args.Get(key))
+			}
+		}
+	}
+}
+
+func TestNewDockerInvalidFilters(t *testing.T) {
+	var testCases = []struct {
+		desc   string
+		filter string
+	}{
+		{desc: "malformed", filter: "container"},
+		{desc: "unknown key", filter: "colour=blue"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := NewDocker(DockerConfig{
+				Host:    "tcp://127.0.0.1:2375",
+				Filters: []string{tc.filter},
+			})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDockerReplay(t *testing.T) {
+	var (
+		since    = time.Unix(1500000000, 0)
+		until    = time.Unix(1500003600, 0)
+		recorded = []events.Message{
+			{Type: "container", Action: "create", TimeNano: since.Add(time.Minute).UnixNano()},
+			{Type: "container", Action: "start", TimeNano: since.Add(2 * time.Minute).UnixNano()},
+			{Type: "container", Action: "die", TimeNano: since.Add(30 * time.Minute).UnixNano()},
+		}
+	)
+
+	handler, queries := eventsRequests(recorded...)
+
+	var d = newTestDockerConfig(t, handler, DockerConfig{Since: since, Until: until})
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	evs, _ := d.Collect(ctx)
+
+	var query = nextQuery(t, queries)
+	if query.Get("since") != "1500000000.000000000" || query.Get("until") != "1500003600.000000000" {
+		t.Errorf("expected the range to be requested, got since=%s until=%s",
+			query.Get("since"), query.Get("until"))
+	}
+
+	for _, expected := range recorded {
+		select {
+		case ev := <-evs:
+			if ev.Action != expected.Action || ev.TimeNano != expected.TimeNano {
+				t.Errorf("expected %s at %d, got %s at %d",
+					expected.Action, expected.TimeNano, ev.Action, ev.TimeNano)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", expected.Action)
+		}
+	}
+
+	// reaching the end of the range closes the events channel
+	// instead of reconnecting
+	select {
+	case ev, ok := <-evs:
+		if ok {
+			t.Fatalf("expected the events channel to be closed, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the replay to end")
+	}
+}
+
+func TestDockerResume(t *testing.T) {
+	var testCases = []struct {
+		desc     string
+		ev       events.Message
+		expected string
+	}{
+		{
+			desc:     "nanoseconds",
+			ev:       events.Message{Type: "container", Action: "start", Time: 1500000060, TimeNano: 1500000060000000005},
+			expected: "1500000060.000000006",
+		},
+		{
+			desc:     "seconds only",
+			ev:       events.Message{Type: "container", Action: "start", Time: 1500000060},
+			expected: "1500000060.000000000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			handler, queries := eventsRequests(tc.ev)
+
+			var d = newTestDockerConfig(t, handler, DockerConfig{Since: time.Unix(1500000000, 0)})
+
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+
+			evs, _ := d.Collect(ctx)
+			go func() {
+				for range evs {
+				}
+			}()
+
+			if since := nextQuery(t, queries).Get("since"); since != "1500000000.000000000" {
+				t.Errorf("expected the first subscription since 1500000000.000000000, got %s", since)
+			}
+
+			// the stream closes after the event, resuming after it
+			if since := nextQuery(t, queries).Get("since"); since != tc.expected {
+				t.Errorf("expected to resume since %s, got %s", tc.expected, since)
+			}
+		})
+	}
+}
+
+func TestNewDockerUntilBeforeSince(t *testing.T) {
+	_, err := NewDocker(DockerConfig{
+		Host:  "tcp://127.0.0.1:2375",
+		Since: time.Unix(1500003600, 0),
+		Until: time.Unix(1500000000, 0),
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, good
+// for both servers and clients, and its key to `dir` under `name`,
+// returning their paths and the parsed pair.
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string, pair tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var template = &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM  = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	)
+
+	certFile = filepath.Join(dir, name+"-cert.pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+
+	err = ioutil.WriteFile(certFile, certPEM, 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, keyPEM, 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return
+}
+
+func TestDockerTLS(t *testing.T) {
+	var (
+		dir                          = t.TempDir()
+		serverCert, _, serverPair    = writeTestCert(t, dir, "daemon")
+		clientCert, clientKey, _     = writeTestCert(t, dir, "devents")
+		strangerCert, strangerKey, _ = writeTestCert(t, dir, "stranger")
+		handler, _                   = eventsRequests(events.Message{Type: "container", Action: "start"})
+	)
+
+	clientCertPEM, err := ioutil.ReadFile(clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clientCAs = x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCertPEM)
+
+	// the daemon only talks to clients presenting the certificate
+	// of devents
+	var server = httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	var host = "tcp://" + strings.TrimPrefix(server.URL, "https://")
+
+	var testCases = []struct {
+		desc    string
+		cfg     DockerConfig
+		connect bool
+	}{
+		{
+			desc:    "verified",
+			cfg:     DockerConfig{TLSVerify: true, TLSCACert: serverCert, TLSCert: clientCert, TLSKey: clientKey},
+			connect: true,
+		},
+		{
+			desc:    "unverified",
+			cfg:     DockerConfig{TLSCert: clientCert, TLSKey: clientKey},
+			connect: true,
+		},
+		{
+			desc: "untrusted daemon",
+			cfg:  DockerConfig{TLSVerify: true, TLSCACert: strangerCert, TLSCert: clientCert, TLSKey: clientKey},
+		},
+		{
+			desc: "untrusted client",
+			cfg:  DockerConfig{TLSVerify: true, TLSCACert: serverCert, TLSCert: strangerCert, TLSKey: strangerKey},
+		},
+		{
+			desc: "no client certificate",
+			cfg:  DockerConfig{TLSVerify: true, TLSCACert: serverCert},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.cfg.Host = host
+
+			d, err := NewDocker(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+
+			evs, errs := d.Collect(ctx)
+
+			select {
+			case ev := <-evs:
+				if !tc.connect {
+					t.Fatalf("expected the connection to be refused, got %+v", ev)
+				}
+			case err := <-errs:
+				if tc.connect {
+					t.Fatalf("expected to connect, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the subscription")
+			}
+		})
+	}
+}
+
+func TestNewDockerInvalidTLS(t *testing.T) {
+	var testCases = []struct {
+		desc string
+		cfg  DockerConfig
+	}{
+		{desc: "missing ca", cfg: DockerConfig{TLSVerify: true, TLSCACert: "missing.pem"}},
+		{desc: "missing key pair", cfg: DockerConfig{TLSCert: "missing.pem", TLSKey: "missing.pem"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tc.cfg.Host = "tcp://127.0.0.1:2376"
+
+			_, err := NewDocker(tc.cfg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestDockerRunning(t *testing.T) {
+	var (
+		listed  = make(chan url.Values, 1)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, "/containers/json") {
+				return
+			}
+
+			listed <- r.URL.Query()
+			json.NewEncoder(w).Encode([]types.Container{
+				{ID: "abc", Names: []string{"/web"}, Image: "nginx", Labels: map[string]string{"com.example.monitor": "true"}},
+				{ID: "def", Names: []string{"/db"}, Image: "postgres"},
+			})
+		})
+	)
+
+	var d = newTestDockerConfig(t, handler, DockerConfig{Filters: []string{"label=com.example.monitor=true"}})
+
+	evs, err := d.Running(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := filters.FromParam((<-listed).Get("filters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !args.ExactMatch("label", "com.example.monitor=true") {
+		t.Errorf("expected the label filters to restrict the listing, got %v", args.Get("label"))
+	}
+
+	if len(evs) != 2 {
+		t.Fatalf("expected 2 running containers, got %d", len(evs))
+	}
+
+	var ev = evs[0]
+	if ev.Type != "container" || ev.Action != "start" || ev.Actor.ID != "abc" || ev.TimeNano == 0 {
+		t.Errorf("expected the start event of abc, got %+v", ev)
+	}
+
+	var expected = map[string]string{"name": "web", "image": "nginx", "com.example.monitor": "true"}
+	if !reflect.DeepEqual(ev.Actor.Attributes, expected) {
+		t.Errorf("expected attributes %v, got %v", expected, ev.Actor.Attributes)
+	}
+}
+
+func TestDockerRunningFilteredOut(t *testing.T) {
+	var d = newTestDockerConfig(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected no listing when container starts are filtered out, got %s", r.URL.Path)
+	}), DockerConfig{Filters: []string{"type=network"}})
+
+	evs, err := d.Running(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(evs) != 0 {
+		t.Errorf("expected no running containers, got %+v", evs)
+	}
+}
@@ -0,0 +1,185 @@
+package collectors
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+)
+
+// dockerContextMeta is the part of the metadata of a docker CLI
+// context (`~/.docker/contexts/meta/<hash>/meta.json`) describing
+// how to reach the daemon.
+type dockerContextMeta struct {
+	Endpoints struct {
+		Docker struct {
+			Host          string
+			SkipTLSVerify bool
+		} `json:"docker"`
+	}
+}
+
+// resolveDockerEndpoint fills the address (and TLS settings) of the
+// daemon when the configuration doesn't name one, picking, in order,
+// the one in `DOCKER_HOST` (along with `DOCKER_CERT_PATH` and
+// `DOCKER_TLS_VERIFY`), the one of the current docker CLI context or
+// the local socket. It returns where the address came from.
+func resolveDockerEndpoint(cfg DockerConfig, getenv func(string) string) (resolved DockerConfig, source string, err error) {
+	resolved = cfg
+	if cfg.Host != "" {
+		source = "config"
+		return
+	}
+
+	var configDir = getenv("DOCKER_CONFIG")
+	if configDir == "" && getenv("HOME") != "" {
+		configDir = filepath.Join(getenv("HOME"), ".docker")
+	}
+
+	if host := getenv("DOCKER_HOST"); host != "" {
+		resolved.Host = host
+
+		var certPath = getenv("DOCKER_CERT_PATH")
+		if certPath == "" && getenv("DOCKER_TLS_VERIFY") != "" {
+			certPath = configDir
+		}
+
+		if certPath != "" {
+			setDockerTLSFiles(&resolved,
+				filepath.Join(certPath, "ca.pem"),
+				filepath.Join(certPath, "cert.pem"),
+				filepath.Join(certPath, "key.pem"))
+		}
+
+		resolved.TLSVerify = resolved.TLSVerify || getenv("DOCKER_TLS_VERIFY") != ""
+		source = "DOCKER_HOST"
+		return
+	}
+
+	if configDir != "" {
+		var found bool
+
+		found, err = loadDockerContext(&resolved, configDir, getenv("DOCKER_CONTEXT"))
+		if err != nil || found {
+			source = "context"
+			return
+		}
+	}
+
+	resolved.Host = client.DefaultDockerHost
+	source = "default"
+	return
+}
+
+// loadDockerContext fills the endpoint of the daemon out of the
+// docker CLI context `name` or, when empty, the current one. It
+// reports whether there was a context (other than the default one,
+// which stands for the local socket) to load.
+func loadDockerContext(cfg *DockerConfig, configDir, name string) (found bool, err error) {
+	if name == "" {
+		name, err = currentDockerContext(configDir)
+		if err != nil {
+			return
+		}
+	}
+
+	if name == "" || name == "default" {
+		return
+	}
+
+	var (
+		digest = sha256.Sum256([]byte(name))
+		id     = hex.EncodeToString(digest[:])
+		meta   dockerContextMeta
+	)
+
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't read docker context %s", name)
+		return
+	}
+
+	err = json.Unmarshal(content, &meta)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Malformed docker context %s", name)
+		return
+	}
+
+	if meta.Endpoints.Docker.Host == "" {
+		err = errors.Errorf(
+			"Docker context %s has no docker endpoint", name)
+		return
+	}
+
+	cfg.Host = meta.Endpoints.Docker.Host
+
+	var tlsDir = filepath.Join(configDir, "contexts", "tls", id, "docker")
+	if _, err := os.Stat(tlsDir); err == nil {
+		setDockerTLSFiles(cfg,
+			existingFile(filepath.Join(tlsDir, "ca.pem")),
+			existingFile(filepath.Join(tlsDir, "cert.pem")),
+			existingFile(filepath.Join(tlsDir, "key.pem")))
+		cfg.TLSVerify = cfg.TLSVerify || !meta.Endpoints.Docker.SkipTLSVerify
+	}
+
+	found = true
+	return
+}
+
+// currentDockerContext reads the name of the context selected with
+// `docker context use` from the CLI configuration file.
+func currentDockerContext(configDir string) (name string, err error) {
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Malformed docker configuration file")
+		return
+	}
+
+	name = config.CurrentContext
+	return
+}
+
+// setDockerTLSFiles sets the TLS files that the configuration
+// doesn't explicitly set.
+func setDockerTLSFiles(cfg *DockerConfig, ca, cert, key string) {
+	if cfg.TLSCACert == "" {
+		cfg.TLSCACert = ca
+	}
+
+	if cfg.TLSCert == "" {
+		cfg.TLSCert = cert
+	}
+
+	if cfg.TLSKey == "" {
+		cfg.TLSKey = key
+	}
+}
+
+// existingFile returns `path` if there's a file there.
+func existingFile(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
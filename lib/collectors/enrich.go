@@ -0,0 +1,312 @@
+package collectors
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// restartCountAttribute is the attribute enriched container events
+// carry the restart count of their container under.
+const restartCountAttribute = "restartCount"
+
+// imageSizeAttribute is the attribute enriched image events carry
+// the size (in bytes) of their image under.
+const imageSizeAttribute = "size"
+
+const (
+	defaultEnrichCacheSize = 1000
+	defaultEnrichCacheTTL  = 30 * time.Second
+	enrichInspectTimeout   = 2 * time.Second
+)
+
+// enrichFields are the pieces of metadata out of the inspection of a
+// container that can be merged into the attributes of its events.
+var enrichFields = map[string]func(container types.ContainerJSON, attrs map[string]string){
+	// name sets `name`, the name of the container.
+	"name": func(container types.ContainerJSON, attrs map[string]string) {
+		if container.ContainerJSONBase != nil {
+			attrs["name"] = strings.TrimPrefix(container.Name, "/")
+		}
+	},
+
+	// image sets `image.id`, the id (sha256 digest) of the image the
+	// container runs, whatever reference it was created from.
+	"image": func(container types.ContainerJSON, attrs map[string]string) {
+		if container.ContainerJSONBase != nil {
+			attrs["image.id"] = container.Image
+		}
+	},
+
+	// labels sets every label of the container, except those
+	// clashing with the attributes set by the other fields.
+	"labels": func(container types.ContainerJSON, attrs map[string]string) {
+		if container.Config == nil {
+			return
+		}
+
+		for key, value := range container.Config.Labels {
+			if _, present := attrs[key]; !present {
+				attrs[key] = value
+			}
+		}
+	},
+
+	// restarts sets `restartCount`, the number of times the
+	// container was restarted by its restart policy.
+	"restarts": func(container types.ContainerJSON, attrs map[string]string) {
+		if container.ContainerJSONBase != nil {
+			attrs[restartCountAttribute] = strconv.Itoa(container.RestartCount)
+		}
+	},
+
+	// networks sets `networks`, the comma separated names of the
+	// networks the container is attached to.
+	"networks": func(container types.ContainerJSON, attrs map[string]string) {
+		if container.NetworkSettings == nil {
+			return
+		}
+
+		var names = make([]string, 0, len(container.NetworkSettings.Networks))
+		for name := range container.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		attrs["networks"] = strings.Join(names, ",")
+	},
+}
+
+// imageEnrichFields are the pieces of metadata out of the inspection
+// of an image that can be merged into the attributes of its events.
+var imageEnrichFields = map[string]func(image types.ImageInspect, attrs map[string]string){
+	// size sets `size`, the size (in bytes) of the image.
+	"size": func(image types.ImageInspect, attrs map[string]string) {
+		attrs[imageSizeAttribute] = strconv.FormatInt(image.Size, 10)
+	},
+}
+
+type EnrichConfig struct {
+	// Fields are the pieces of metadata (`name`, `image`, `labels`,
+	// `restarts` and `networks`) merged into the attributes of container
+	// events, and of images (`size`) merged into the attributes of
+	// image events. Events aren't enriched when empty.
+	Fields []string
+
+	// CacheSize is the number of containers whose metadata is
+	// kept around.
+	CacheSize int
+
+	// CacheTTL is how long the metadata of a container is reused
+	// before the container gets inspected again.
+	CacheTTL time.Duration
+}
+
+// enricher merges the metadata of containers (and images), as
+// reported by inspecting them, into the attributes of their events.
+// Inspections are cached by id so that the burst of events of a
+// container (create, start, ...) costs a single call, which also
+// lets events of containers that are already gone (e.g., `destroy`)
+// be enriched.
+type enricher struct {
+	logger      *log.Entry
+	docker      *client.Client
+	fields      []func(types.ContainerJSON, map[string]string)
+	imageFields []func(types.ImageInspect, map[string]string)
+	size        int
+	ttl         time.Duration
+
+	mu    sync.Mutex
+	cache map[string]enrichment
+}
+
+// enrichment is the cached metadata of a container.
+type enrichment struct {
+	attrs   map[string]string
+	expires time.Time
+}
+
+// newEnricher creates an enricher inspecting containers through
+// `docker`, or nil when no field is to be merged.
+func newEnricher(docker *client.Client, cfg EnrichConfig, logger *log.Entry) (e *enricher, err error) {
+	if len(cfg.Fields) == 0 {
+		return
+	}
+
+	e = &enricher{
+		logger: logger,
+		docker: docker,
+		size:   cfg.CacheSize,
+		ttl:    cfg.CacheTTL,
+		cache:  map[string]enrichment{},
+	}
+
+	for _, field := range cfg.Fields {
+		if fn, present := enrichFields[field]; present {
+			e.fields = append(e.fields, fn)
+			continue
+		}
+
+		if fn, present := imageEnrichFields[field]; present {
+			e.imageFields = append(e.imageFields, fn)
+			continue
+		}
+
+		err = errors.Errorf(
+			"Unknown enrichment field %s", field)
+		return
+	}
+
+	if e.size <= 0 {
+		e.size = defaultEnrichCacheSize
+	}
+
+	if e.ttl <= 0 {
+		e.ttl = defaultEnrichCacheTTL
+	}
+
+	return
+}
+
+// enrich merges the metadata of the container (or image) of an event
+// into its attributes, never overriding the ones set by the daemon.
+// Events are left untouched when their actor can't be inspected.
+func (e *enricher) enrich(ctx context.Context, ev events.Message) events.Message {
+	if e == nil || ev.Actor.ID == "" {
+		return ev
+	}
+
+	var inspect func(ctx context.Context, id string) (map[string]string, error)
+	switch {
+	case ev.Type == events.ContainerEventType && len(e.fields) > 0:
+		inspect = e.inspectContainer
+	case ev.Type == events.ImageEventType && len(e.imageFields) > 0:
+		inspect = e.inspectImage
+	default:
+		return ev
+	}
+
+	attrs, err := e.lookup(ctx, ev.Type+"/"+ev.Actor.ID, ev.Actor.ID, inspect)
+	if err != nil {
+		e.logger.
+			WithError(err).
+			WithField(ev.Type, ev.Actor.ID).
+			Debug("couldn't enrich event")
+		return ev
+	}
+
+	var merged = make(map[string]string, len(ev.Actor.Attributes)+len(attrs))
+	for key, value := range attrs {
+		merged[key] = value
+	}
+	for key, value := range ev.Actor.Attributes {
+		merged[key] = value
+	}
+
+	ev.Actor.Attributes = merged
+	return ev
+}
+
+// lookup returns the metadata of the actor `id`, cached under `key`,
+// inspecting it with `inspect` unless it's cached.
+func (e *enricher) lookup(ctx context.Context, key, id string,
+	inspect func(ctx context.Context, id string) (map[string]string, error)) (attrs map[string]string, err error) {
+	var now = time.Now()
+
+	e.mu.Lock()
+	cached, present := e.cache[key]
+	e.mu.Unlock()
+
+	if present && now.Before(cached.expires) {
+		attrs = cached.attrs
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, enrichInspectTimeout)
+	defer cancel()
+
+	attrs, err = inspect(ctx, id)
+	if err != nil {
+		if present {
+			// The actor is most likely gone, what was known
+			// about it is still better than nothing.
+			attrs = cached.attrs
+			err = nil
+		}
+		return
+	}
+
+	e.store(key, attrs, now)
+	return
+}
+
+// inspectContainer retrieves the metadata of the container `id`.
+func (e *enricher) inspectContainer(ctx context.Context, id string) (attrs map[string]string, err error) {
+	container, err := e.docker.ContainerInspect(ctx, id)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't inspect container")
+		return
+	}
+
+	attrs = map[string]string{}
+	for _, field := range e.fields {
+		field(container, attrs)
+	}
+
+	return
+}
+
+// inspectImage retrieves the metadata of the image `id`.
+func (e *enricher) inspectImage(ctx context.Context, id string) (attrs map[string]string, err error) {
+	image, _, err := e.docker.ImageInspectWithRaw(ctx, id)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't inspect image")
+		return
+	}
+
+	attrs = map[string]string{}
+	for _, field := range e.imageFields {
+		field(image, attrs)
+	}
+
+	return
+}
+
+// store caches the metadata of an actor, making room for it by
+// evicting expired entries or, when there are none, arbitrary ones.
+func (e *enricher) store(key string, attrs map[string]string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, present := e.cache[key]; !present && len(e.cache) >= e.size {
+		for key, cached := range e.cache {
+			if now.After(cached.expires) {
+				delete(e.cache, key)
+			}
+		}
+
+		for key := range e.cache {
+			if len(e.cache) < e.size {
+				break
+			}
+			delete(e.cache, key)
+		}
+	}
+
+	e.cache[key] = enrichment{
+		attrs:   attrs,
+		expires: now.Add(e.ttl),
+	}
+}
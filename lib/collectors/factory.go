@@ -8,6 +8,8 @@ func New(collectorType string, config interface{}) (collector Collector, err err
 	switch collectorType {
 	case "docker":
 		collector, err = NewDocker(config.(DockerConfig))
+	case "file":
+		collector, err = NewFile(config.(FileConfig))
 	default:
 		err = errors.Errorf(
 			"Unknown collector type %s", collectorType)
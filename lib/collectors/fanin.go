@@ -0,0 +1,173 @@
+package collectors
+
+import (
+	"context"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/client"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ Collector = (*FanIn)(nil)
+
+// HostAttribute is the actor attribute the events collected by a
+// FanIn out of several daemons are tagged with, naming the daemon
+// each event came from.
+const HostAttribute = "devents.host"
+
+// FanIn merges the events of several collectors (usually one per
+// docker daemon) into a single stream. Each collector subscribes
+// (and reconnects) on its own, so a daemon going away doesn't affect
+// the others.
+type FanIn struct {
+	names   []string
+	sources map[string]Collector
+}
+
+// NewFanIn creates a FanIn out of `sources`, keyed by the name of
+// the host they collect from. When there's more than one source the
+// events get tagged with that name under HostAttribute.
+func NewFanIn(sources map[string]Collector) (fanIn FanIn, err error) {
+	if len(sources) == 0 {
+		err = errors.New("At least one collector must be provided")
+		return
+	}
+
+	for name := range sources {
+		fanIn.names = append(fanIn.names, name)
+	}
+	sort.Strings(fanIn.names)
+
+	fanIn.sources = sources
+	return
+}
+
+// Metrics returns the prometheus collectors of every source that
+// exposes them.
+func (f FanIn) Metrics() (metrics []prometheus.Collector) {
+	for _, name := range f.names {
+		if source, ok := f.sources[name].(interface {
+			Metrics() []prometheus.Collector
+		}); ok {
+			metrics = append(metrics, source.Metrics()...)
+		}
+	}
+
+	return
+}
+
+// Connected reports whether every source that keeps track of its
+// connection is currently connected.
+func (f FanIn) Connected() bool {
+	for _, name := range f.names {
+		if source, ok := f.sources[name].(interface {
+			Connected() bool
+		}); ok && !source.Connected() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Collect collects the events of every source, forwarding them (and
+// their errors) as they come. Both channels are closed once every
+// source has closed its own.
+func (f FanIn) Collect(ctx context.Context) (<-chan events.Message, <-chan error) {
+	if len(f.names) == 1 {
+		return f.sources[f.names[0]].Collect(ctx)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		evs  = make(chan events.Message)
+		errs = make(chan error, len(f.names))
+	)
+
+	for _, name := range f.names {
+		inEvs, inErrs := f.sources[name].Collect(ctx)
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			f.forward(ctx, name, inEvs, inErrs, evs, errs)
+		}(name)
+	}
+
+	go func() {
+		wg.Wait()
+		close(evs)
+		close(errs)
+	}()
+
+	return evs, errs
+}
+
+// forward tags the events of the source `name` and pipes them into
+// `out` until the source closes its events channel.
+func (f FanIn) forward(ctx context.Context, name string,
+	in <-chan events.Message, inErrs <-chan error,
+	out chan<- events.Message, outErrs chan<- error) {
+	for {
+		select {
+		case err, ok := <-inErrs:
+			if !ok {
+				inErrs = nil
+				continue
+			}
+
+			select {
+			case outErrs <- errors.Wrapf(err, "docker %s", name):
+			default:
+			}
+		case ev, ok := <-in:
+			if !ok {
+				return
+			}
+
+			if ev.Actor.Attributes == nil {
+				ev.Actor.Attributes = map[string]string{}
+			}
+			ev.Actor.Attributes[HostAttribute] = name
+
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// DaemonName derives a name for the daemon at `host` (e.g.,
+// `docker-1` for tcp://docker-1:2376), falling back to the name of
+// the local machine for daemons reached through local sockets.
+func DaemonName(host string) (name string, err error) {
+	proto, addr, _, err := client.ParseHost(host)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Malformed docker host %s", host)
+		return
+	}
+
+	if proto == "tcp" {
+		name, _, err = net.SplitHostPort(addr)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Malformed docker host %s", host)
+		}
+		return
+	}
+
+	name, err = os.Hostname()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't retrieve hostname")
+	}
+	return
+}
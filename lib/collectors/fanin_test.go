@@ -0,0 +1,196 @@
+package collectors_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// receive reads `n` events off `evs`, failing if they don't come.
+func receive(t *testing.T, evs <-chan events.Message, n int) (received []events.Message) {
+	t.Helper()
+
+	for len(received) < n {
+		select {
+		case ev, ok := <-evs:
+			if !ok {
+				t.Fatalf("expected %d events, got %d before the channel closed", n, len(received))
+			}
+			received = append(received, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %d events, got %d", n, len(received))
+		}
+	}
+
+	return
+}
+
+func TestFanIn(t *testing.T) {
+	var (
+		a = collectorstest.NewMock(4)
+		b = collectorstest.NewMock(4)
+	)
+
+	fanIn, err := collectors.NewFanIn(map[string]collectors.Collector{
+		"docker-a": a,
+		"docker-b": b,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	evs, errs := fanIn.Collect(ctx)
+
+	a.Push(events.Message{Type: "container", Action: "start", Actor: events.Actor{ID: "a1"}})
+	b.Push(events.Message{Type: "container", Action: "start", Actor: events.Actor{
+		ID:         "b1",
+		Attributes: map[string]string{"name": "web"},
+	}})
+
+	var hosts = map[string]string{}
+	for _, ev := range receive(t, evs, 2) {
+		hosts[ev.Actor.ID] = ev.Actor.Attributes[collectors.HostAttribute]
+	}
+
+	if hosts["a1"] != "docker-a" || hosts["b1"] != "docker-b" {
+		t.Errorf("expected events to be tagged with their daemon, got %v", hosts)
+	}
+
+	// errors are forwarded naming their daemon
+	b.Fail(errors.New("stream closed"))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "docker-b") {
+			t.Errorf("expected the error to name its daemon, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the error to be forwarded")
+	}
+
+	// a daemon going away doesn't affect the others
+	a.Close()
+	b.Push(events.Message{Type: "container", Action: "die", Actor: events.Actor{ID: "b1"}})
+	if ev := receive(t, evs, 1)[0]; ev.Action != "die" {
+		t.Errorf("expected the events of docker-b to keep coming, got %+v", ev)
+	}
+
+	// the channels are closed once every source is done
+	b.Close()
+	select {
+	case _, ok := <-evs:
+		if ok {
+			t.Fatal("expected the events channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the events channel to be closed")
+	}
+}
+
+func TestFanInSingleSource(t *testing.T) {
+	var mock = collectorstest.NewMock(1)
+
+	fanIn, err := collectors.NewFanIn(map[string]collectors.Collector{"docker-a": mock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, _ := fanIn.Collect(context.Background())
+
+	mock.Push(events.Message{Type: "container", Action: "start"})
+	if ev := receive(t, evs, 1)[0]; ev.Actor.Attributes[collectors.HostAttribute] != "" {
+		t.Errorf("expected the events of a single daemon not to be tagged, got %+v", ev)
+	}
+}
+
+func TestFanInHostLabel(t *testing.T) {
+	var (
+		a        = collectorstest.NewMock(2)
+		b        = collectorstest.NewMock(2)
+		registry = prometheus.NewRegistry()
+	)
+
+	fanIn, err := collectors.NewFanIn(map[string]collectors.Collector{
+		"docker-a": a,
+		"docker-b": b,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agg, err := aggregators.NewPrometheus(aggregators.PrometheusConfig{
+		Path:          "/metrics",
+		Registry:      registry,
+		HostAttribute: collectors.HostAttribute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Push(events.Message{Type: "container", Action: "start"}, events.Message{Type: "container", Action: "die"})
+	b.Push(events.Message{Type: "container", Action: "start"})
+	a.Close()
+	b.Close()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	evs, errs := fanIn.Collect(ctx)
+	if err := agg.Run(ctx, evs, errs); err != nil {
+		t.Fatal(err)
+	}
+
+	var counted = eventsCounted(t, registry, "host")
+	if counted["docker-a"] != 2 || counted["docker-b"] != 1 {
+		t.Errorf("expected events counted per daemon, got %v", counted)
+	}
+}
+
+func TestNewFanInEmpty(t *testing.T) {
+	_, err := collectors.NewFanIn(nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDaemonName(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		host     string
+		expected string
+	}{
+		{host: "tcp://docker-1:2376", expected: "docker-1"},
+		{host: "tcp://10.0.0.2:2375", expected: "10.0.0.2"},
+		{host: "unix:///var/run/docker.sock", expected: hostname},
+	}
+
+	for _, tc := range testCases {
+		name, err := collectors.DaemonName(tc.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.host, tc.expected, name)
+		}
+	}
+
+	if _, err := collectors.DaemonName("docker-1:2376"); err == nil {
+		t.Error("expected a host without a scheme to be rejected")
+	}
+}
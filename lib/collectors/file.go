@@ -0,0 +1,169 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var _ Collector = (*File)(nil)
+
+// maxFileLine is the size of the longest line (event) read by the
+// file collector.
+const maxFileLine = 1024 * 1024
+
+type FileConfig struct {
+	// Path is the file holding the events as newline delimited
+	// JSON objects (as written by `docker events --format
+	// '{{json .}}'` or the stdout aggregator in dump mode). `-`
+	// reads them from stdin.
+	Path string
+
+	// Pace spaces the events out as they originally happened,
+	// according to their timestamps, instead of reading them as
+	// fast as possible.
+	Pace bool
+}
+
+// File collects events from a file, allowing captured events to be
+// replayed offline (e.g., to try out an aggregator or to reproduce
+// an issue). Both channels are closed once the whole file is read.
+type File struct {
+	logger *log.Entry
+	path   string
+	pace   bool
+}
+
+func NewFile(cfg FileConfig) (collector File, err error) {
+	if cfg.Path == "" {
+		err = errors.New("A path to read events from must be specified")
+		return
+	}
+
+	if cfg.Path != "-" {
+		_, err = os.Stat(cfg.Path)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't access events file %s", cfg.Path)
+			return
+		}
+	}
+
+	collector.path = cfg.Path
+	collector.pace = cfg.Pace
+	collector.logger = log.WithField("collector", "file")
+	return
+}
+
+// Collect reads the events of the file, forwarding the lines that
+// can't be decoded as errors.
+func (f File) Collect(ctx context.Context) (<-chan events.Message, <-chan error) {
+	var (
+		evs  = make(chan events.Message)
+		errs = make(chan error, 1)
+	)
+
+	go func() {
+		defer close(evs)
+		defer close(errs)
+
+		var in io.Reader = os.Stdin
+		if f.path != "-" {
+			file, err := os.Open(f.path)
+			if err != nil {
+				errs <- errors.Wrapf(err,
+					"Couldn't open events file %s", f.path)
+				return
+			}
+			defer file.Close()
+
+			in = file
+		}
+
+		err := f.read(ctx, in, evs, errs)
+		if err != nil && ctx.Err() == nil {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+
+		f.logger.Info("finished reading events")
+	}()
+
+	return evs, errs
+}
+
+// read decodes the events of `in` into `evs` until it's exhausted or
+// `ctx` gets cancelled.
+func (f File) read(ctx context.Context, in io.Reader, evs chan<- events.Message, errs chan<- error) (err error) {
+	var (
+		scanner = bufio.NewScanner(in)
+		line    = 0
+		last    time.Time
+	)
+
+	scanner.Buffer(make([]byte, 0, 64*1024), maxFileLine)
+	for scanner.Scan() {
+		var ev events.Message
+
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		err = json.Unmarshal(scanner.Bytes(), &ev)
+		if err != nil {
+			select {
+			case errs <- errors.Wrapf(err, "Malformed event at line %d", line):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if f.pace {
+			var ts = eventTime(ev)
+			if !last.IsZero() && ts.After(last) {
+				select {
+				case <-time.After(ts.Sub(last)):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			last = ts
+		}
+
+		select {
+		case evs <- ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't read events")
+	}
+
+	return
+}
+
+// eventTime returns the time the event happened at, as precisely as
+// it's known.
+func eventTime(ev events.Message) time.Time {
+	if ev.TimeNano != 0 {
+		return time.Unix(0, ev.TimeNano)
+	}
+
+	return time.Unix(ev.Time, 0)
+}
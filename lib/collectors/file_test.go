@@ -0,0 +1,179 @@
+package collectors_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/docker/docker/api/types/events"
+)
+
+// collectAll collects every event and error of `collector` until it
+// closes its channels.
+func collectAll(t *testing.T, collector collectors.Collector) (evs []events.Message, errs []error) {
+	t.Helper()
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inEvs, inErrs := collector.Collect(ctx)
+	for inEvs != nil || inErrs != nil {
+		select {
+		case ev, ok := <-inEvs:
+			if !ok {
+				inEvs = nil
+				continue
+			}
+			evs = append(evs, ev)
+		case err, ok := <-inErrs:
+			if !ok {
+				inErrs = nil
+				continue
+			}
+			errs = append(errs, err)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the channels to be closed")
+		}
+	}
+
+	return
+}
+
+// writeEventsFile writes `content` to a file, returning its path.
+func writeEventsFile(t *testing.T, content string) string {
+	t.Helper()
+
+	var path = filepath.Join(t.TempDir(), "events.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFileReplaysDump(t *testing.T) {
+	var captured = []events.Message{
+		{Type: "container", Action: "start", TimeNano: 1500000000000000001, Actor: events.Actor{
+			ID:         "abc",
+			Attributes: map[string]string{"name": "web", "image": "nginx"},
+		}},
+		{Type: "network", Action: "connect", Time: 1500000001, Actor: events.Actor{ID: "def"}},
+		{Type: "container", Action: "exec_start: sh -c ls", TimeNano: 1500000002000000000},
+	}
+
+	// the stdout aggregator in dump mode captures what the file
+	// collector reads back
+	var dump bytes.Buffer
+
+	stdout, err := aggregators.NewStdout(aggregators.StdoutConfig{Dump: true, Writer: &dump})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = collectorstest.Run(context.Background(), stdout, captured...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := collectors.NewFile(collectors.FileConfig{Path: writeEventsFile(t, dump.String())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, errs := collectAll(t, file)
+	if len(errs) != 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	if !reflect.DeepEqual(evs, captured) {
+		t.Errorf("expected the captured events back, got %+v", evs)
+	}
+}
+
+func TestFileMalformedLines(t *testing.T) {
+	file, err := collectors.NewFile(collectors.FileConfig{Path: writeEventsFile(t, strings.Join([]string{
+		`{"Type":"container","Action":"start"}`,
+		``,
+		`{"Type":`,
+		`{"Type":"container","Action":"die"}`,
+	}, "\n"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, errs := collectAll(t, file)
+	if len(evs) != 2 || evs[0].Action != "start" || evs[1].Action != "die" {
+		t.Errorf("expected the well formed events, got %+v", evs)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 3") {
+		t.Errorf("expected the malformed line to be reported, got %v", errs)
+	}
+}
+
+func TestFilePace(t *testing.T) {
+	var content = strings.Join([]string{
+		`{"Type":"container","Action":"create","timeNano":1500000000000000000}`,
+		`{"Type":"container","Action":"start","timeNano":1500000000100000000}`,
+		`{"Type":"container","Action":"die","timeNano":1500000000200000000}`,
+	}, "\n")
+
+	for _, pace := range []bool{false, true} {
+		file, err := collectors.NewFile(collectors.FileConfig{Path: writeEventsFile(t, content), Pace: pace})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var start = time.Now()
+		if evs, _ := collectAll(t, file); len(evs) != 3 {
+			t.Fatalf("expected 3 events, got %d", len(evs))
+		}
+
+		var elapsed = time.Since(start)
+		if pace && elapsed < 200*time.Millisecond {
+			t.Errorf("expected the events to be spaced out as they happened, took %s", elapsed)
+		}
+		if !pace && elapsed >= 200*time.Millisecond {
+			t.Errorf("expected the events to be read right away, took %s", elapsed)
+		}
+	}
+}
+
+func TestFileStdin(t *testing.T) {
+	stdin, err := os.Open(writeEventsFile(t, `{"Type":"container","Action":"start"}`+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	var previous = os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = previous }()
+
+	file, err := collectors.NewFile(collectors.FileConfig{Path: "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evs, _ := collectAll(t, file)
+	if len(evs) != 1 || evs[0].Action != "start" {
+		t.Errorf("expected the event from stdin, got %+v", evs)
+	}
+}
+
+func TestNewFileInvalid(t *testing.T) {
+	for _, path := range []string{"", filepath.Join(t.TempDir(), "missing.json")} {
+		if _, err := collectors.NewFile(collectors.FileConfig{Path: path}); err == nil {
+			t.Errorf("expected %q to be rejected", path)
+		}
+	}
+}
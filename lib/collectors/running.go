@@ -0,0 +1,150 @@
+package collectors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/pkg/errors"
+)
+
+// runningListTimeout bounds how long listing the running containers
+// of a daemon may take.
+const runningListTimeout = 10 * time.Second
+
+// RunningLister is implemented by the collectors able to tell the
+// containers running at the moment, which lets the state tracked out
+// of the events (e.g., the number of running containers) be seeded
+// with the containers started before devents.
+type RunningLister interface {
+	// Running describes each running container as the `start`
+	// event it would have been started with.
+	Running(ctx context.Context) ([]events.Message, error)
+}
+
+var (
+	_ RunningLister = (*Docker)(nil)
+	_ RunningLister = (*FanIn)(nil)
+	_ RunningLister = (*Transform)(nil)
+)
+
+// Running lists the containers running in the daemon, restricted to
+// those the events of the collector could be about.
+func (d Docker) Running(ctx context.Context) (evs []events.Message, err error) {
+	if !d.filtersAllow("type", events.ContainerEventType) || !d.filtersAllow("event", "start") {
+		return
+	}
+
+	var options = types.ContainerListOptions{Filters: filters.NewArgs()}
+	for _, label := range d.filters.Get("label") {
+		options.Filters.Add("label", label)
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, runningListTimeout)
+	defer cancel()
+
+	containers, err := d.docker.ContainerList(listCtx, options)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't list running containers")
+		return
+	}
+
+	var now = time.Now()
+	for _, container := range containers {
+		if d.filters.Include("container") && !d.filters.ExactMatch("container", container.ID) {
+			continue
+		}
+
+		var attrs = map[string]string{"image": container.Image}
+		for key, value := range container.Labels {
+			attrs[key] = value
+		}
+		if len(container.Names) > 0 {
+			attrs["name"] = strings.TrimPrefix(container.Names[0], "/")
+		}
+
+		var ev = events.Message{
+			Type:   events.ContainerEventType,
+			Action: "start",
+			Actor: events.Actor{
+				ID:         container.ID,
+				Attributes: attrs,
+			},
+			Time:     now.Unix(),
+			TimeNano: now.UnixNano(),
+		}
+
+		evs = append(evs, d.enricher.enrich(ctx, ev))
+	}
+
+	return
+}
+
+// filtersAllow reports whether the daemon filters under `key` let
+// the events with `value` through.
+func (d Docker) filtersAllow(key, value string) bool {
+	return !d.filters.Include(key) || d.filters.ExactMatch(key, value)
+}
+
+// Running lists the containers running in every source able to tell
+// them, tagging them with the host they run on as their events are.
+func (f FanIn) Running(ctx context.Context) (evs []events.Message, err error) {
+	for _, name := range f.names {
+		source, ok := f.sources[name].(RunningLister)
+		if !ok {
+			continue
+		}
+
+		var running []events.Message
+		running, err = source.Running(ctx)
+		if err != nil {
+			if len(f.names) > 1 {
+				err = errors.Wrapf(err, "docker %s", name)
+			}
+			return
+		}
+
+		if len(f.names) > 1 {
+			for _, ev := range running {
+				ev.Actor.Attributes[HostAttribute] = name
+			}
+		}
+
+		evs = append(evs, running...)
+	}
+
+	return
+}
+
+// Running lists the containers running according to the wrapped
+// collector, transformed as their events would be.
+func (t Transform) Running(ctx context.Context) (evs []events.Message, err error) {
+	lister, ok := t.collector.(RunningLister)
+	if !ok {
+		return
+	}
+
+	running, err := lister.Running(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, ev := range running {
+		if t.transformer != nil {
+			var keep bool
+
+			ev, keep = t.transformer.Transform(ev)
+			if !keep {
+				continue
+			}
+		}
+
+		evs = append(evs, ev)
+	}
+
+	return
+}
@@ -0,0 +1,77 @@
+package collectors
+
+import (
+	"context"
+
+	"github.com/cirocosta/devents/lib/transformers"
+	"github.com/docker/docker/api/types/events"
+)
+
+var _ Collector = (*Transform)(nil)
+
+// Transform wraps a collector running every event it collects through
+// a transformer (usually a pipeline of them) before handing it over,
+// discarding those the transformer drops.
+type Transform struct {
+	collector   Collector
+	transformer transformers.Transformer
+}
+
+func NewTransform(collector Collector, transformer transformers.Transformer) Transform {
+	return Transform{
+		collector:   collector,
+		transformer: transformer,
+	}
+}
+
+// Collect collects the events of the wrapped collector, forwarding
+// them as transformed. Errors are forwarded untouched.
+func (t Transform) Collect(ctx context.Context) (<-chan events.Message, <-chan error) {
+	inEvs, inErrs := t.collector.Collect(ctx)
+	if t.transformer == nil {
+		return inEvs, inErrs
+	}
+
+	var (
+		evs  = make(chan events.Message)
+		errs = make(chan error, 1)
+	)
+
+	go func() {
+		defer close(evs)
+		defer close(errs)
+
+		for {
+			select {
+			case err, ok := <-inErrs:
+				if !ok {
+					inErrs = nil
+					continue
+				}
+
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			case ev, ok := <-inEvs:
+				if !ok {
+					return
+				}
+
+				ev, keep := t.transformer.Transform(ev)
+				if !keep {
+					continue
+				}
+
+				select {
+				case evs <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return evs, errs
+}
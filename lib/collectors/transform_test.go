@@ -0,0 +1,117 @@
+package collectors_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/cirocosta/devents/lib/collectors/collectorstest"
+	"github.com/cirocosta/devents/lib/transformers"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// eventsCounted returns the value of events_total by the value of
+// its `label` label out of what `registry` gathers.
+func eventsCounted(t *testing.T, registry *prometheus.Registry, label string) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counted = map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "devents_events_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label {
+					counted[pair.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	return counted
+}
+
+// runTransformed runs the prometheus aggregator over `evs` as let
+// through by `transformer`, returning what it counted by type.
+func runTransformed(t *testing.T, transformer transformers.Transformer, evs ...events.Message) map[string]float64 {
+	t.Helper()
+
+	var registry = prometheus.NewRegistry()
+
+	agg, err := aggregators.NewPrometheus(aggregators.PrometheusConfig{
+		Path:     "/metrics",
+		Registry: registry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mock = collectorstest.NewMock(len(evs))
+	mock.Push(evs...)
+	mock.Close()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	transformedEvs, transformedErrs := collectors.NewTransform(mock, transformer).Collect(ctx)
+	err = agg.Run(ctx, transformedEvs, transformedErrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return eventsCounted(t, registry, "type")
+}
+
+func TestTransformFilterTypes(t *testing.T) {
+	filter, err := transformers.NewFilter(transformers.FilterConfig{
+		Types: []string{"container", "volume"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counted = runTransformed(t, filter,
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "network", Action: "connect"},
+		events.Message{Type: "image", Action: "pull"},
+		events.Message{Type: "volume", Action: "create"},
+		events.Message{Type: "network", Action: "disconnect"},
+		events.Message{Type: "container", Action: "die"},
+	)
+
+	var expected = map[string]float64{"container": 2, "volume": 1}
+	if len(counted) != len(expected) {
+		t.Errorf("expected only %v to be counted, got %v", expected, counted)
+	}
+	for evType, count := range expected {
+		if counted[evType] != count {
+			t.Errorf("expected %g %s events, got %g", count, evType, counted[evType])
+		}
+	}
+}
+
+func TestTransformAllTypesByDefault(t *testing.T) {
+	filter, err := transformers.NewFilter(transformers.FilterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counted = runTransformed(t, filter,
+		events.Message{Type: "container", Action: "start"},
+		events.Message{Type: "network", Action: "connect"},
+		events.Message{Type: "plugin", Action: "enable"},
+	)
+
+	if len(counted) != 3 {
+		t.Errorf("expected every type to be counted, got %v", counted)
+	}
+}
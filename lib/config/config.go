@@ -0,0 +1,1003 @@
+// Package config loads the settings of devents out of the command
+// line, a YAML file and the environment.
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/cirocosta/devents/lib/collectors"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of devents. Each field can be set
+// through the command line flag named after it in lowercase (e.g.,
+// `--metricsport` for MetricsPort), through the same key in the
+// YAML file given via `--config` or through the environment variable
+// named by its `env` tag, which is the name of the field in uppercase
+// with a `DEVENTS_` prefix (e.g., `DEVENTS_METRICSPORT`).
+//
+// Lists are given to environment variables as comma separated values
+// unless the field has an `envsep` tag naming another separator
+// (rules contain commas themselves).
+type Config struct {
+	Config                     string        `arg:"env:DEVENTS_CONFIG,help:path to a YAML file holding the configuration" env:"DEVENTS_CONFIG" yaml:"-"`
+	LogLevel                   string        `arg:"help:minimum level of the logs (debug|info|warn|error) (also -log.level)" env:"DEVENTS_LOGLEVEL"`
+	LogFormat                  string        `arg:"help:format of the logs (text|json)" env:"DEVENTS_LOGFORMAT"`
+	BufferSize                 int           `arg:"help:number of events buffered for each aggregator before new ones get dropped" env:"DEVENTS_BUFFERSIZE"`
+	ShutdownTimeout            time.Duration `arg:"help:time given to the aggregators to process buffered events when shutting down" env:"DEVENTS_SHUTDOWNTIMEOUT"`
+	DeadLetter                 bool          `arg:"help:write the events that the webhook/kafka/elasticsearch aggregators fail to deliver to dead letter files" env:"DEVENTS_DEADLETTER"`
+	DeadLetterDir              string        `arg:"help:directory holding the dead letter files (one <aggregator>.json per aggregator)" env:"DEVENTS_DEADLETTERDIR"`
+	FluentdHost                string        `arg:"help:fluentd host to connect to" env:"DEVENTS_FLUENTDHOST"`
+	FluentdTag                 string        `arg:"help:fluentd tag to add to the messages" env:"DEVENTS_FLUENTDTAG"`
+	FluentdPort                int           `arg:"help:fluentd port to connect to" env:"DEVENTS_FLUENTDPORT"`
+	DockerHost                 []string      `arg:"separate,help:docker daemon to connect to (can be specified multiple times and defaults to DOCKER_HOST or the current docker context or the local socket)" env:"DEVENTS_DOCKERHOST"`
+	DockerTLSCACert            string        `arg:"help:certificate authority the docker daemon certificate is verified against" env:"DEVENTS_DOCKERTLSCACERT"`
+	DockerTLSCert              string        `arg:"help:client certificate presented to the docker daemon" env:"DEVENTS_DOCKERTLSCERT"`
+	DockerTLSKey               string        `arg:"help:key of the client certificate presented to the docker daemon" env:"DEVENTS_DOCKERTLSKEY"`
+	DockerTLSVerify            bool          `arg:"help:use TLS and verify the certificate of the docker daemon" env:"DEVENTS_DOCKERTLSVERIFY"`
+	DockerMaxBackoff           time.Duration `arg:"help:maximum time to wait between reconnections to the docker daemon" env:"DEVENTS_DOCKERMAXBACKOFF"`
+	DockerFilter               []string      `arg:"separate,help:filter (key=value) applied by the docker daemon to the events sent (can be specified multiple times)" env:"DEVENTS_DOCKERFILTER"`
+	DockerSince                string        `arg:"help:replay the events since this time (RFC3339 or relative to now like -1h)" env:"DEVENTS_DOCKERSINCE"`
+	DockerUntil                string        `arg:"help:stop once the events up to this time (RFC3339 or relative to now like -5m) are processed" env:"DEVENTS_DOCKERUNTIL"`
+	DockerEnrich               []string      `arg:"separate,help:container (name|image|labels|restarts|networks) and image (size) metadata merged into their events by inspecting them (can be specified multiple times)" env:"DEVENTS_DOCKERENRICH"`
+	DockerEnrichCacheSize      int           `arg:"help:number of inspected containers whose metadata is cached" env:"DEVENTS_DOCKERENRICHCACHESIZE"`
+	DockerEnrichCacheTTL       time.Duration `arg:"help:time the metadata of an inspected container is cached for" env:"DEVENTS_DOCKERENRICHCACHETTL"`
+	EventsFile                 string        `arg:"help:file (or - for stdin) with newline delimited JSON events to read instead of the docker daemon" env:"DEVENTS_EVENTSFILE"`
+	EventsFilePace             bool          `arg:"help:replay the events of eventsfile at the pace they originally happened" env:"DEVENTS_EVENTSFILEPACE"`
+	EventType                  []string      `arg:"separate,help:type of the events processed (can be specified multiple times and defaults to all types)" env:"DEVENTS_EVENTTYPE"`
+	EventLabel                 []string      `arg:"separate,help:label (key=value) the actor of the events processed must have (can be specified multiple times)" env:"DEVENTS_EVENTLABEL"`
+	EventLabelExclude          bool          `arg:"help:discard the events matching every eventlabel instead of keeping them" env:"DEVENTS_EVENTLABELEXCLUDE"`
+	EventRename                []string      `arg:"separate,help:rename (from=to) of an attribute of the events (can be specified multiple times)" env:"DEVENTS_EVENTRENAME"`
+	EventAttribute             []string      `arg:"separate,help:attribute (key=value) set on every event (can be specified multiple times)" env:"DEVENTS_EVENTATTRIBUTE"`
+	EventRedact                []string      `arg:"separate,help:regular expression matching the keys of the attributes masked from the events (can be specified multiple times)" env:"DEVENTS_EVENTREDACT"`
+	EventRedactDrop            bool          `arg:"help:remove the attributes matching eventredact instead of masking them" env:"DEVENTS_EVENTREDACTDROP"`
+	EventDedupWindow           time.Duration `arg:"help:window during which events of the same type/action/actor following the first are dropped (disabled when 0)" env:"DEVENTS_EVENTDEDUPWINDOW"`
+	EventSample                []string      `arg:"separate,help:type or type:action of the events sampled (can be specified multiple times and defaults to every event)" env:"DEVENTS_EVENTSAMPLE"`
+	EventSampleRatio           int           `arg:"help:let one in every eventsampleratio sampled events of each type/action through (disabled when 0)" env:"DEVENTS_EVENTSAMPLERATIO"`
+	EventSampleByActor         bool          `arg:"help:sample by ratio the actors (e.g. containers) instead of their events" env:"DEVENTS_EVENTSAMPLEBYACTOR"`
+	EventSampleRate            float64       `arg:"help:sampled events of each type let through per second (disabled when 0)" env:"DEVENTS_EVENTSAMPLERATE"`
+	EventSampleBurst           int           `arg:"help:sampled events of each type let through at once before being rate limited (defaults to the rate)" env:"DEVENTS_EVENTSAMPLEBURST"`
+	EventSampleAggregator      []string      `arg:"separate,help:aggregators whose events are sampled (can be specified multiple times and defaults to every aggregator)" env:"DEVENTS_EVENTSAMPLEAGGREGATOR"`
+	Transformer                []string      `arg:"separate,help:transformers the events go through in order (filter|relabel|redact|dedup) (can be specified multiple times and defaults to all of them in that order)" env:"DEVENTS_TRANSFORMER"`
+	Aggregator                 []string      `arg:"-a,separate,help:aggregators to use (stdout|fluentd|prometheus|statsd|dogstatsd|influxdb|influxdb2|graphite|elasticsearch|kafka|nats|webhook|slack|file|syslog|loki|sqlite|postgres|pubsub|cloudwatchlogs|emf|otlpmetrics|otlplogs|sentry|websocket|sse|grpc|pushgateway|telegram|mqtt)" env:"DEVENTS_AGGREGATOR"`
+	MetricsPath                string        `arg:"help:path to use for prometheus scrapping (also -prometheus.path)" env:"DEVENTS_METRICSPATH"`
+	MetricsPort                int           `arg:"help:port to listen for prometheus scrapping (also -prometheus.port)" env:"DEVENTS_METRICSPORT"`
+	MetricsLabel               []string      `arg:"separate,help:includes labels from containers|images in the timeseries (comma separated or repeated) (also -prometheus.labels)" env:"DEVENTS_METRICSLABEL"`
+	MetricsTypeLabel           []string      `arg:"separate,help:includes attributes from events of a given type in the timeseries (<type>=<attribute>)" env:"DEVENTS_METRICSTYPELABEL"`
+	MetricsProcessingBuckets   []float64     `arg:"separate,help:bucket (in seconds) of the event processing duration histogram (can be specified multiple times in increasing order)" env:"DEVENTS_METRICSPROCESSINGBUCKETS"`
+	MetricsLifetimeBuckets     []float64     `arg:"separate,help:bucket (in seconds) of the container lifetime histogram (can be specified multiple times in increasing order)" env:"DEVENTS_METRICSLIFETIMEBUCKETS"`
+	MetricsSeriesTTL           time.Duration `arg:"help:delete the series of container/image/... actions not updated for that long (disabled when 0)" env:"DEVENTS_METRICSSERIESTTL"`
+	MetricsExemplarAttribute   string        `arg:"help:attribute holding the trace id attached as an exemplar to the counters of an event (disabled when empty)" env:"DEVENTS_METRICSEXEMPLARATTRIBUTE"`
+	MetricsRawActions          bool          `arg:"help:keep the full command of exec_* container actions in the action label" env:"DEVENTS_METRICSRAWACTIONS"`
+	MetricsCompose             bool          `arg:"help:label container metrics with the docker compose project and service of the containers" env:"DEVENTS_METRICSCOMPOSE"`
+	MetricsSwarm               bool          `arg:"help:label container metrics with the swarm service and stack of the containers" env:"DEVENTS_METRICSSWARM"`
+	MetricsName                bool          `arg:"help:label container metrics with the name of the containers" env:"DEVENTS_METRICSNAME"`
+	MetricsNameLimit           int           `arg:"help:names told apart by each container metric labelled by name before labelling the others __overflow__" env:"DEVENTS_METRICSNAMELIMIT"`
+	MetricsNetworkContainer    bool          `arg:"help:label network actions with the container connected to or disconnected from the network" env:"DEVENTS_METRICSNETWORKCONTAINER"`
+	MetricsVolumeMounts        bool          `arg:"help:count volume mounts and unmounts by volume and container" env:"DEVENTS_METRICSVOLUMEMOUNTS"`
+	MetricsImageRepo           []string      `arg:"separate,help:repository whose image actions are labelled with the registry/repo/tag of the image (can be specified multiple times)" env:"DEVENTS_METRICSIMAGEREPO"`
+	MetricsNamespace           string        `arg:"help:namespace to prefix metric names with" env:"DEVENTS_METRICSNAMESPACE"`
+	MetricsSubsystem           string        `arg:"help:subsystem to prefix metric names with" env:"DEVENTS_METRICSSUBSYSTEM"`
+	MetricsHost                string        `arg:"help:value of the host label of every metric (defaults to the hostname)" env:"DEVENTS_METRICSHOST"`
+	MetricsTLSCert             string        `arg:"help:certificate file to serve prometheus metrics over TLS" env:"DEVENTS_METRICSTLSCERT"`
+	MetricsTLSKey              string        `arg:"help:key file to serve prometheus metrics over TLS" env:"DEVENTS_METRICSTLSKEY"`
+	HealthPath                 string        `arg:"help:path to serve the liveness probe from (alongside prometheus metrics)" env:"DEVENTS_HEALTHPATH"`
+	ReadyPath                  string        `arg:"help:path to serve the readiness probe from (alongside prometheus metrics)" env:"DEVENTS_READYPATH"`
+	MetricsUser                string        `arg:"help:username required to access prometheus metrics" env:"DEVENTS_METRICSUSER"`
+	MetricsPassword            string        `arg:"env,help:password required to access prometheus metrics" env:"DEVENTS_METRICSPASSWORD"`
+	StatsdHost                 string        `arg:"help:statsd host to send metrics to" env:"DEVENTS_STATSDHOST"`
+	StatsdPort                 int           `arg:"help:statsd port to send metrics to" env:"DEVENTS_STATSDPORT"`
+	StatsdPrefix               string        `arg:"help:prefix of the metrics sent to statsd" env:"DEVENTS_STATSDPREFIX"`
+	StatsdTag                  []string      `arg:"separate,help:static tags (key:value) to add to statsd metrics (DogStatsD extension)" env:"DEVENTS_STATSDTAG"`
+	DogstatsdHost              string        `arg:"help:dogstatsd host to send metrics to" env:"DEVENTS_DOGSTATSDHOST"`
+	DogstatsdPort              int           `arg:"help:dogstatsd port to send metrics to" env:"DEVENTS_DOGSTATSDPORT"`
+	DogstatsdPrefix            string        `arg:"help:prefix of the metrics sent to dogstatsd" env:"DEVENTS_DOGSTATSDPREFIX"`
+	DogstatsdTag               []string      `arg:"separate,help:static tags (key:value) to add to dogstatsd metrics" env:"DEVENTS_DOGSTATSDTAG"`
+	DogstatsdAttribute         []string      `arg:"separate,help:event attributes allowed to become dogstatsd tags" env:"DEVENTS_DOGSTATSDATTRIBUTE"`
+	InfluxdbURL                string        `arg:"help:address of the influxdb (v1) server to write to" env:"DEVENTS_INFLUXDBURL"`
+	InfluxdbDatabase           string        `arg:"help:influxdb database to write events to" env:"DEVENTS_INFLUXDBDATABASE"`
+	InfluxdbRetentionPolicy    string        `arg:"help:influxdb retention policy to write events with" env:"DEVENTS_INFLUXDBRETENTIONPOLICY"`
+	InfluxdbUser               string        `arg:"help:influxdb username" env:"DEVENTS_INFLUXDBUSER"`
+	InfluxdbPassword           string        `arg:"env,help:influxdb password" env:"DEVENTS_INFLUXDBPASSWORD"`
+	InfluxdbBatchSize          int           `arg:"help:maximum number of points written to influxdb at once" env:"DEVENTS_INFLUXDBBATCHSIZE"`
+	InfluxdbFlushInterval      time.Duration `arg:"help:maximum time points wait before being written to influxdb" env:"DEVENTS_INFLUXDBFLUSHINTERVAL"`
+	Influxdb2URL               string        `arg:"help:address of the influxdb (v2) server to write to" env:"DEVENTS_INFLUXDB2URL"`
+	Influxdb2Org               string        `arg:"help:influxdb (v2) organization" env:"DEVENTS_INFLUXDB2ORG"`
+	Influxdb2Bucket            string        `arg:"help:influxdb (v2) bucket to write events to" env:"DEVENTS_INFLUXDB2BUCKET"`
+	Influxdb2Token             string        `arg:"env,help:influxdb (v2) API token" env:"DEVENTS_INFLUXDB2TOKEN"`
+	Influxdb2BatchSize         int           `arg:"help:maximum number of points written to influxdb (v2) at once" env:"DEVENTS_INFLUXDB2BATCHSIZE"`
+	Influxdb2FlushInterval     time.Duration `arg:"help:maximum time points wait before being written to influxdb (v2)" env:"DEVENTS_INFLUXDB2FLUSHINTERVAL"`
+	GraphiteHost               string        `arg:"help:host of the graphite (carbon) server" env:"DEVENTS_GRAPHITEHOST"`
+	GraphitePort               int           `arg:"help:port of the graphite (carbon) plaintext listener" env:"DEVENTS_GRAPHITEPORT"`
+	GraphitePrefix             string        `arg:"help:prefix of the metrics sent to graphite" env:"DEVENTS_GRAPHITEPREFIX"`
+	GraphiteFlushInterval      time.Duration `arg:"help:interval between sends of the counters to graphite" env:"DEVENTS_GRAPHITEFLUSHINTERVAL"`
+	ElasticsearchURL           string        `arg:"help:address of the elasticsearch cluster to index events into" env:"DEVENTS_ELASTICSEARCHURL"`
+	ElasticsearchIndex         string        `arg:"help:name of the index (formatted with the event time using go's reference layout)" env:"DEVENTS_ELASTICSEARCHINDEX"`
+	ElasticsearchUser          string        `arg:"help:elasticsearch username" env:"DEVENTS_ELASTICSEARCHUSER"`
+	ElasticsearchPassword      string        `arg:"env,help:elasticsearch password" env:"DEVENTS_ELASTICSEARCHPASSWORD"`
+	ElasticsearchBatchSize     int           `arg:"help:maximum number of documents per bulk request" env:"DEVENTS_ELASTICSEARCHBATCHSIZE"`
+	ElasticsearchFlushInterval time.Duration `arg:"help:maximum time documents wait before being indexed" env:"DEVENTS_ELASTICSEARCHFLUSHINTERVAL"`
+	KafkaBroker                []string      `arg:"separate,help:address of a kafka broker (can be specified multiple times)" env:"DEVENTS_KAFKABROKER"`
+	KafkaTopic                 string        `arg:"help:kafka topic to produce events to" env:"DEVENTS_KAFKATOPIC"`
+	KafkaKey                   string        `arg:"help:what kafka messages are keyed by (actor|type|none)" env:"DEVENTS_KAFKAKEY"`
+	KafkaCompression           string        `arg:"help:compression codec of kafka messages (none|gzip|snappy|lz4)" env:"DEVENTS_KAFKACOMPRESSION"`
+	KafkaFlushInterval         time.Duration `arg:"help:maximum time messages wait before being produced to kafka" env:"DEVENTS_KAFKAFLUSHINTERVAL"`
+	KafkaTLS                   bool          `arg:"help:use tls when connecting to the kafka brokers" env:"DEVENTS_KAFKATLS"`
+	KafkaUser                  string        `arg:"help:kafka SASL/PLAIN username" env:"DEVENTS_KAFKAUSER"`
+	KafkaPassword              string        `arg:"env,help:kafka SASL/PLAIN password" env:"DEVENTS_KAFKAPASSWORD"`
+	KafkaFormat                string        `arg:"help:encoding of the kafka messages (json|cloudevents)" env:"DEVENTS_KAFKAFORMAT"`
+	NatsServer                 []string      `arg:"separate,help:url of a nats server (can be specified multiple times)" env:"DEVENTS_NATSSERVER"`
+	NatsSubject                string        `arg:"help:template of the nats subject events are published to" env:"DEVENTS_NATSSUBJECT"`
+	NatsUser                   string        `arg:"help:nats username" env:"DEVENTS_NATSUSER"`
+	NatsPassword               string        `arg:"env,help:nats password" env:"DEVENTS_NATSPASSWORD"`
+	NatsToken                  string        `arg:"env,help:nats authentication token" env:"DEVENTS_NATSTOKEN"`
+	WebhookURL                 string        `arg:"help:url events are POSTed to" env:"DEVENTS_WEBHOOKURL"`
+	WebhookHeader              []string      `arg:"separate,help:extra header (Name: value) sent to the webhook (can be specified multiple times)" env:"DEVENTS_WEBHOOKHEADER"`
+	WebhookTimeout             time.Duration `arg:"help:timeout of webhook requests" env:"DEVENTS_WEBHOOKTIMEOUT"`
+	WebhookRetryAttempts       int           `arg:"help:attempts at delivering an event to the webhook when requests fail with transient errors" env:"DEVENTS_WEBHOOKRETRYATTEMPTS"`
+	WebhookRetryBackoff        time.Duration `arg:"help:time waited before retrying a failed webhook request (doubling after every attempt)" env:"DEVENTS_WEBHOOKRETRYBACKOFF"`
+	WebhookEvent               []string      `arg:"separate,help:events sent to the webhook as type or type:action or *:action (can be specified multiple times)" env:"DEVENTS_WEBHOOKEVENT"`
+	WebhookSecret              string        `arg:"env,help:secret used to sign webhook requests with HMAC-SHA256" env:"DEVENTS_WEBHOOKSECRET"`
+	WebhookFormat              string        `arg:"help:encoding of the webhook requests (json|cloudevents)" env:"DEVENTS_WEBHOOKFORMAT"`
+	SlackWebhookURL            string        `arg:"env,help:slack incoming webhook url" env:"DEVENTS_SLACKWEBHOOKURL"`
+	SlackRule                  []string      `arg:"separate,help:rule selecting the events notified to slack (see README)" env:"DEVENTS_SLACKRULE" envsep:";"`
+	SlackTemplate              string        `arg:"help:go template of the slack messages" env:"DEVENTS_SLACKTEMPLATE"`
+	SlackInterval              time.Duration `arg:"help:minimum time between two slack messages" env:"DEVENTS_SLACKINTERVAL"`
+	FilePath                   string        `arg:"help:file events are appended to" env:"DEVENTS_FILEPATH"`
+	FileMaxSize                int64         `arg:"help:size (in bytes) after which the events file is rotated" env:"DEVENTS_FILEMAXSIZE"`
+	FileMaxAge                 time.Duration `arg:"help:age after which the events file is rotated" env:"DEVENTS_FILEMAXAGE"`
+	FileMaxBackups             int           `arg:"help:number of rotated events files to keep" env:"DEVENTS_FILEMAXBACKUPS"`
+	FileCompress               bool          `arg:"help:gzip rotated events files" env:"DEVENTS_FILECOMPRESS"`
+	SyslogNetwork              string        `arg:"help:network used to reach the syslog server (udp|tcp)" env:"DEVENTS_SYSLOGNETWORK"`
+	SyslogAddress              string        `arg:"help:address (host:port) of the syslog server" env:"DEVENTS_SYSLOGADDRESS"`
+	SyslogFacility             string        `arg:"help:syslog facility of the messages (e.g. daemon or local0)" env:"DEVENTS_SYSLOGFACILITY"`
+	SyslogAppName              string        `arg:"help:app name of the syslog messages" env:"DEVENTS_SYSLOGAPPNAME"`
+	LokiURL                    string        `arg:"help:address of the loki server to push events to" env:"DEVENTS_LOKIURL"`
+	LokiTenant                 string        `arg:"help:loki tenant (sent as X-Scope-OrgID)" env:"DEVENTS_LOKITENANT"`
+	LokiHost                   string        `arg:"help:value of the host label of the loki streams (defaults to the hostname)" env:"DEVENTS_LOKIHOST"`
+	LokiBatchSize              int           `arg:"help:maximum number of lines pushed to loki at once" env:"DEVENTS_LOKIBATCHSIZE"`
+	LokiFlushInterval          time.Duration `arg:"help:maximum time lines wait before being pushed to loki" env:"DEVENTS_LOKIFLUSHINTERVAL"`
+	StdoutPretty               bool          `arg:"help:pretty print the events written to stdout" env:"DEVENTS_STDOUTPRETTY"`
+	StdoutDump                 bool          `arg:"help:write the events to stdout exactly as received (readable by eventsfile)" env:"DEVENTS_STDOUTDUMP"`
+	SqlitePath                 string        `arg:"help:sqlite database events are stored in" env:"DEVENTS_SQLITEPATH"`
+	SqliteRetention            time.Duration `arg:"help:how long events are kept in sqlite (0 keeps them forever)" env:"DEVENTS_SQLITERETENTION"`
+	SqliteBatchSize            int           `arg:"help:maximum number of events inserted into sqlite per transaction" env:"DEVENTS_SQLITEBATCHSIZE"`
+	SqliteFlushInterval        time.Duration `arg:"help:maximum time events wait before being inserted into sqlite" env:"DEVENTS_SQLITEFLUSHINTERVAL"`
+	PostgresDSN                string        `arg:"env,help:connection string of the postgres database" env:"DEVENTS_POSTGRESDSN"`
+	PostgresTable              string        `arg:"help:postgres table events are written to" env:"DEVENTS_POSTGRESTABLE"`
+	PostgresBatchSize          int           `arg:"help:maximum number of events copied into postgres at once" env:"DEVENTS_POSTGRESBATCHSIZE"`
+	PostgresFlushInterval      time.Duration `arg:"help:maximum time events wait before being copied into postgres" env:"DEVENTS_POSTGRESFLUSHINTERVAL"`
+	PubsubProject              string        `arg:"help:google cloud project of the pubsub topic" env:"DEVENTS_PUBSUBPROJECT"`
+	PubsubTopic                string        `arg:"help:pubsub topic events are published to" env:"DEVENTS_PUBSUBTOPIC"`
+	PubsubCredentials          string        `arg:"help:service account key file used to publish to pubsub" env:"DEVENTS_PUBSUBCREDENTIALS"`
+	PubsubOrderingKey          string        `arg:"help:ordering key of the pubsub messages (none|actor|type)" env:"DEVENTS_PUBSUBORDERINGKEY"`
+	PubsubFlushInterval        time.Duration `arg:"help:maximum time messages wait before being published to pubsub" env:"DEVENTS_PUBSUBFLUSHINTERVAL"`
+	PubsubFormat               string        `arg:"help:encoding of the pubsub messages (json|cloudevents)" env:"DEVENTS_PUBSUBFORMAT"`
+	CloudeventsSource          string        `arg:"help:source of the events encoded as cloudevents" env:"DEVENTS_CLOUDEVENTSSOURCE"`
+	CloudwatchRegion           string        `arg:"env:AWS_REGION,help:aws region of cloudwatch" env:"DEVENTS_CLOUDWATCHREGION"`
+	CloudwatchLogGroup         string        `arg:"help:cloudwatch logs group events are sent to" env:"DEVENTS_CLOUDWATCHLOGGROUP"`
+	CloudwatchLogStream        string        `arg:"help:template of the cloudwatch logs stream name (has access to .Host)" env:"DEVENTS_CLOUDWATCHLOGSTREAM"`
+	CloudwatchFlushInterval    time.Duration `arg:"help:maximum time events wait before being sent to cloudwatch logs" env:"DEVENTS_CLOUDWATCHFLUSHINTERVAL"`
+	EmfNamespace               string        `arg:"help:cloudwatch namespace of the emf metrics" env:"DEVENTS_EMFNAMESPACE"`
+	EmfDimension               []string      `arg:"separate,help:actor attribute turned into an emf dimension (can be specified multiple times)" env:"DEVENTS_EMFDIMENSION"`
+	EmfMaxDimensionValues      int           `arg:"help:maximum number of distinct values of each emf attribute dimension" env:"DEVENTS_EMFMAXDIMENSIONVALUES"`
+	EmfFlushInterval           time.Duration `arg:"help:interval between emissions of the emf metrics" env:"DEVENTS_EMFFLUSHINTERVAL"`
+	OtlpEndpoint               string        `arg:"help:address of the OTLP/HTTP receiver (e.g. http://otel-collector:4318)" env:"DEVENTS_OTLPENDPOINT"`
+	OtlpHeader                 []string      `arg:"separate,help:header (Name=value) sent with OTLP exports (can be specified multiple times)" env:"DEVENTS_OTLPHEADER"`
+	OtlpResourceAttribute      []string      `arg:"separate,help:resource attribute (key=value) of the OTLP exports (can be specified multiple times)" env:"DEVENTS_OTLPRESOURCEATTRIBUTE"`
+	OtlpExportInterval         time.Duration `arg:"help:interval between exports of the OTLP metrics" env:"DEVENTS_OTLPEXPORTINTERVAL"`
+	OtlpLogsBatchSize          int           `arg:"help:maximum number of log records exported at once" env:"DEVENTS_OTLPLOGSBATCHSIZE"`
+	OtlpLogsFlushInterval      time.Duration `arg:"help:maximum time log records wait before being exported" env:"DEVENTS_OTLPLOGSFLUSHINTERVAL"`
+	SentryDSN                  string        `arg:"env,help:sentry DSN failures are reported to" env:"DEVENTS_SENTRYDSN"`
+	SentryEnvironment          string        `arg:"help:sentry environment of the captured events" env:"DEVENTS_SENTRYENVIRONMENT"`
+	SentryRule                 []string      `arg:"separate,help:rule selecting the events captured by sentry (see README)" env:"DEVENTS_SENTRYRULE" envsep:";"`
+	SentryDedupWindow          time.Duration `arg:"help:period during which identical failures are captured only once" env:"DEVENTS_SENTRYDEDUPWINDOW"`
+	WebsocketAddr              string        `arg:"help:address the websocket server binds to" env:"DEVENTS_WEBSOCKETADDR"`
+	WebsocketPath              string        `arg:"help:path websocket clients connect to" env:"DEVENTS_WEBSOCKETPATH"`
+	WebsocketToken             string        `arg:"env,help:token websocket clients must present" env:"DEVENTS_WEBSOCKETTOKEN"`
+	WebsocketEvent             []string      `arg:"separate,help:events broadcast to websocket clients as type or type:action or *:action (can be specified multiple times)" env:"DEVENTS_WEBSOCKETEVENT"`
+	SseAddr                    string        `arg:"help:address the server-sent events server binds to" env:"DEVENTS_SSEADDR"`
+	SsePath                    string        `arg:"help:path of the server-sent events stream" env:"DEVENTS_SSEPATH"`
+	SseBufferSize              int           `arg:"help:number of recent events kept for clients resuming the stream" env:"DEVENTS_SSEBUFFERSIZE"`
+	GrpcAddr                   string        `arg:"help:address the grpc server binds to" env:"DEVENTS_GRPCADDR"`
+	GrpcTlsCert                string        `arg:"help:path to the certificate served by the grpc server" env:"DEVENTS_GRPCTLSCERT"`
+	GrpcTlsKey                 string        `arg:"help:path to the key of the grpc server certificate" env:"DEVENTS_GRPCTLSKEY"`
+	GrpcBufferSize             int           `arg:"help:number of events queued per grpc client before it gets disconnected" env:"DEVENTS_GRPCBUFFERSIZE"`
+	PushgatewayURL             string        `arg:"help:address of the prometheus pushgateway" env:"DEVENTS_PUSHGATEWAYURL"`
+	PushgatewayJob             string        `arg:"help:job the metrics are pushed under" env:"DEVENTS_PUSHGATEWAYJOB"`
+	PushgatewayGrouping        []string      `arg:"separate,help:grouping label (key=value) of the pushed metrics (can be specified multiple times)" env:"DEVENTS_PUSHGATEWAYGROUPING"`
+	PushgatewayInterval        time.Duration `arg:"help:interval between pushes to the pushgateway" env:"DEVENTS_PUSHGATEWAYINTERVAL"`
+	TelegramToken              string        `arg:"env,help:token of the telegram bot sending the notifications" env:"DEVENTS_TELEGRAMTOKEN"`
+	TelegramChatID             string        `arg:"help:telegram chat notified when a rule doesn't name one" env:"DEVENTS_TELEGRAMCHATID"`
+	TelegramRule               []string      `arg:"separate,help:rule selecting the events notified to telegram (see README)" env:"DEVENTS_TELEGRAMRULE" envsep:";"`
+	TelegramTemplate           string        `arg:"help:go template of the telegram messages" env:"DEVENTS_TELEGRAMTEMPLATE"`
+	TelegramInterval           time.Duration `arg:"help:minimum time between two telegram messages" env:"DEVENTS_TELEGRAMINTERVAL"`
+	MqttBroker                 string        `arg:"help:url of the mqtt broker (e.g. tcp://localhost:1883)" env:"DEVENTS_MQTTBROKER"`
+	MqttClientID               string        `arg:"help:client id of the mqtt connection" env:"DEVENTS_MQTTCLIENTID"`
+	MqttUser                   string        `arg:"help:username of the mqtt connection" env:"DEVENTS_MQTTUSER"`
+	MqttPassword               string        `arg:"env,help:password of the mqtt connection" env:"DEVENTS_MQTTPASSWORD"`
+	MqttTopic                  string        `arg:"help:go template of the topic events are published to" env:"DEVENTS_MQTTTOPIC"`
+	MqttQos                    int           `arg:"help:quality of service level (0 or 1 or 2) of the published events" env:"DEVENTS_MQTTQOS"`
+	MqttRetain                 bool          `arg:"help:have the broker retain the last event of each topic" env:"DEVENTS_MQTTRETAIN"`
+}
+
+func (a Config) ToLogrusFields() logrus.Fields {
+	return logrus.Fields{
+		"log-level":                    a.LogLevel,
+		"log-format":                   a.LogFormat,
+		"buffer-size":                  a.BufferSize,
+		"shutdown-timeout":             a.ShutdownTimeout,
+		"dead-letter":                  a.DeadLetter,
+		"dead-letter-dir":              a.DeadLetterDir,
+		"fluentd-host":                 a.FluentdHost,
+		"fluentd-tag":                  a.FluentdTag,
+		"fluentd-port":                 a.FluentdPort,
+		"docker-host":                  a.DockerHost,
+		"docker-tls-ca-cert":           a.DockerTLSCACert,
+		"docker-tls-cert":              a.DockerTLSCert,
+		"docker-tls-key":               a.DockerTLSKey,
+		"docker-tls-verify":            a.DockerTLSVerify,
+		"docker-max-backoff":           a.DockerMaxBackoff,
+		"docker-filter":                a.DockerFilter,
+		"docker-since":                 a.DockerSince,
+		"docker-until":                 a.DockerUntil,
+		"docker-enrich":                a.DockerEnrich,
+		"docker-enrich-cache-size":     a.DockerEnrichCacheSize,
+		"docker-enrich-cache-ttl":      a.DockerEnrichCacheTTL,
+		"events-file":                  a.EventsFile,
+		"events-file-pace":             a.EventsFilePace,
+		"event-type":                   a.EventType,
+		"event-label":                  a.EventLabel,
+		"event-label-exclude":          a.EventLabelExclude,
+		"event-rename":                 a.EventRename,
+		"event-attribute":              a.EventAttribute,
+		"event-redact":                 a.EventRedact,
+		"event-redact-drop":            a.EventRedactDrop,
+		"event-dedup-window":           a.EventDedupWindow,
+		"event-sample":                 a.EventSample,
+		"event-sample-ratio":           a.EventSampleRatio,
+		"event-sample-by-actor":        a.EventSampleByActor,
+		"event-sample-rate":            a.EventSampleRate,
+		"event-sample-burst":           a.EventSampleBurst,
+		"event-sample-aggregator":      a.EventSampleAggregator,
+		"transformer":                  a.Transformer,
+		"aggregator":                   a.Aggregator,
+		"metrics-path":                 a.MetricsPath,
+		"metrics-port":                 a.MetricsPort,
+		"metrics-label":                a.MetricsLabel,
+		"metrics-type-label":           a.MetricsTypeLabel,
+		"metrics-raw-actions":          a.MetricsRawActions,
+		"metrics-compose":              a.MetricsCompose,
+		"metrics-swarm":                a.MetricsSwarm,
+		"metrics-name":                 a.MetricsName,
+		"metrics-name-limit":           a.MetricsNameLimit,
+		"metrics-network-container":    a.MetricsNetworkContainer,
+		"metrics-volume-mounts":        a.MetricsVolumeMounts,
+		"metrics-processing-buckets":   a.MetricsProcessingBuckets,
+		"metrics-lifetime-buckets":     a.MetricsLifetimeBuckets,
+		"metrics-series-ttl":           a.MetricsSeriesTTL,
+		"metrics-exemplar-attribute":   a.MetricsExemplarAttribute,
+		"metrics-image-repo":           a.MetricsImageRepo,
+		"metrics-namespace":            a.MetricsNamespace,
+		"metrics-subsystem":            a.MetricsSubsystem,
+		"metrics-host":                 a.MetricsHost,
+		"metrics-tls-cert":             a.MetricsTLSCert,
+		"metrics-tls-key":              a.MetricsTLSKey,
+		"metrics-user":                 a.MetricsUser,
+		"health-path":                  a.HealthPath,
+		"ready-path":                   a.ReadyPath,
+		"statsd-host":                  a.StatsdHost,
+		"statsd-port":                  a.StatsdPort,
+		"statsd-prefix":                a.StatsdPrefix,
+		"statsd-tag":                   a.StatsdTag,
+		"dogstatsd-host":               a.DogstatsdHost,
+		"dogstatsd-port":               a.DogstatsdPort,
+		"dogstatsd-prefix":             a.DogstatsdPrefix,
+		"dogstatsd-tag":                a.DogstatsdTag,
+		"dogstatsd-attribute":          a.DogstatsdAttribute,
+		"influxdb-url":                 a.InfluxdbURL,
+		"influxdb-database":            a.InfluxdbDatabase,
+		"influxdb-retention-policy":    a.InfluxdbRetentionPolicy,
+		"influxdb-user":                a.InfluxdbUser,
+		"influxdb-batch-size":          a.InfluxdbBatchSize,
+		"influxdb-flush-interval":      a.InfluxdbFlushInterval,
+		"influxdb2-url":                a.Influxdb2URL,
+		"influxdb2-org":                a.Influxdb2Org,
+		"influxdb2-bucket":             a.Influxdb2Bucket,
+		"influxdb2-batch-size":         a.Influxdb2BatchSize,
+		"influxdb2-flush-interval":     a.Influxdb2FlushInterval,
+		"graphite-host":                a.GraphiteHost,
+		"graphite-port":                a.GraphitePort,
+		"graphite-prefix":              a.GraphitePrefix,
+		"graphite-flush-interval":      a.GraphiteFlushInterval,
+		"elasticsearch-url":            a.ElasticsearchURL,
+		"elasticsearch-index":          a.ElasticsearchIndex,
+		"elasticsearch-user":           a.ElasticsearchUser,
+		"elasticsearch-batch-size":     a.ElasticsearchBatchSize,
+		"elasticsearch-flush-interval": a.ElasticsearchFlushInterval,
+		"kafka-broker":                 a.KafkaBroker,
+		"kafka-topic":                  a.KafkaTopic,
+		"kafka-key":                    a.KafkaKey,
+		"kafka-compression":            a.KafkaCompression,
+		"kafka-flush-interval":         a.KafkaFlushInterval,
+		"kafka-tls":                    a.KafkaTLS,
+		"kafka-user":                   a.KafkaUser,
+		"kafka-format":                 a.KafkaFormat,
+		"nats-server":                  a.NatsServer,
+		"nats-subject":                 a.NatsSubject,
+		"nats-user":                    a.NatsUser,
+		"webhook-url":                  a.WebhookURL,
+		"webhook-timeout":              a.WebhookTimeout,
+		"webhook-retry-attempts":       a.WebhookRetryAttempts,
+		"webhook-retry-backoff":        a.WebhookRetryBackoff,
+		"webhook-event":                a.WebhookEvent,
+		"webhook-format":               a.WebhookFormat,
+		"slack-rule":                   a.SlackRule,
+		"slack-template":               a.SlackTemplate,
+		"slack-interval":               a.SlackInterval,
+		"file-path":                    a.FilePath,
+		"file-max-size":                a.FileMaxSize,
+		"file-max-age":                 a.FileMaxAge,
+		"file-max-backups":             a.FileMaxBackups,
+		"file-compress":                a.FileCompress,
+		"syslog-network":               a.SyslogNetwork,
+		"syslog-address":               a.SyslogAddress,
+		"syslog-facility":              a.SyslogFacility,
+		"syslog-app-name":              a.SyslogAppName,
+		"loki-url":                     a.LokiURL,
+		"loki-tenant":                  a.LokiTenant,
+		"loki-host":                    a.LokiHost,
+		"loki-batch-size":              a.LokiBatchSize,
+		"loki-flush-interval":          a.LokiFlushInterval,
+		"stdout-pretty":                a.StdoutPretty,
+		"stdout-dump":                  a.StdoutDump,
+		"sqlite-path":                  a.SqlitePath,
+		"sqlite-retention":             a.SqliteRetention,
+		"sqlite-batch-size":            a.SqliteBatchSize,
+		"sqlite-flush-interval":        a.SqliteFlushInterval,
+		"postgres-table":               a.PostgresTable,
+		"postgres-batch-size":          a.PostgresBatchSize,
+		"postgres-flush-interval":      a.PostgresFlushInterval,
+		"pubsub-project":               a.PubsubProject,
+		"pubsub-topic":                 a.PubsubTopic,
+		"pubsub-credentials":           a.PubsubCredentials,
+		"pubsub-ordering-key":          a.PubsubOrderingKey,
+		"pubsub-flush-interval":        a.PubsubFlushInterval,
+		"pubsub-format":                a.PubsubFormat,
+		"cloudevents-source":           a.CloudeventsSource,
+		"cloudwatch-region":            a.CloudwatchRegion,
+		"cloudwatch-log-group":         a.CloudwatchLogGroup,
+		"cloudwatch-log-stream":        a.CloudwatchLogStream,
+		"cloudwatch-flush-interval":    a.CloudwatchFlushInterval,
+		"emf-namespace":                a.EmfNamespace,
+		"emf-dimension":                a.EmfDimension,
+		"emf-max-dimension-values":     a.EmfMaxDimensionValues,
+		"emf-flush-interval":           a.EmfFlushInterval,
+		"otlp-endpoint":                a.OtlpEndpoint,
+		"otlp-resource-attribute":      a.OtlpResourceAttribute,
+		"otlp-export-interval":         a.OtlpExportInterval,
+		"otlp-logs-batch-size":         a.OtlpLogsBatchSize,
+		"otlp-logs-flush-interval":     a.OtlpLogsFlushInterval,
+		"sentry-environment":           a.SentryEnvironment,
+		"sentry-rule":                  a.SentryRule,
+		"sentry-dedup-window":          a.SentryDedupWindow,
+		"websocket-addr":               a.WebsocketAddr,
+		"websocket-path":               a.WebsocketPath,
+		"websocket-event":              a.WebsocketEvent,
+		"sse-addr":                     a.SseAddr,
+		"sse-path":                     a.SsePath,
+		"sse-buffer-size":              a.SseBufferSize,
+		"grpc-addr":                    a.GrpcAddr,
+		"grpc-tls-cert":                a.GrpcTlsCert,
+		"grpc-buffer-size":             a.GrpcBufferSize,
+		"pushgateway-url":              a.PushgatewayURL,
+		"pushgateway-job":              a.PushgatewayJob,
+		"pushgateway-grouping":         a.PushgatewayGrouping,
+		"pushgateway-interval":         a.PushgatewayInterval,
+		"telegram-chat-id":             a.TelegramChatID,
+		"telegram-rule":                a.TelegramRule,
+		"telegram-template":            a.TelegramTemplate,
+		"telegram-interval":            a.TelegramInterval,
+		"mqtt-broker":                  a.MqttBroker,
+		"mqtt-client-id":               a.MqttClientID,
+		"mqtt-topic":                   a.MqttTopic,
+		"mqtt-qos":                     a.MqttQos,
+		"mqtt-retain":                  a.MqttRetain,
+	}
+}
+
+// Validate checks the configuration, reporting every problem found
+// at once.
+func (a Config) Validate() (err error) {
+	var problems aggregators.ValidationErrors
+
+	if err := a.ConfigureLogger(logrus.New()); err != nil {
+		problems = append(problems, err)
+	}
+
+	if a.BufferSize < 0 {
+		problems = append(problems, errors.Errorf(
+			"Invalid buffer-size %d, expected a positive number", a.BufferSize))
+	}
+
+	if a.DeadLetter && a.DeadLetterDir == "" {
+		problems = append(problems, errors.New(
+			"A dead-letter-dir must be specified when dead-lettering events"))
+	}
+
+	if len(a.Aggregator) == 0 {
+		problems = append(problems, errors.New(
+			"At least one aggregator must be specified"))
+	}
+
+	for _, agg := range a.EventSampleAggregator {
+		if !a.hasAggregator(agg) {
+			problems = append(problems, errors.Errorf(
+				"Sampled aggregator %s isn't one of the aggregators", agg))
+		}
+	}
+
+	if _, _, err := a.DockerRange(time.Now()); err != nil {
+		problems = append(problems, err)
+	}
+
+	if (a.DockerTLSCert == "") != (a.DockerTLSKey == "") {
+		problems = append(problems, errors.New(
+			"Both docker-tls-cert and docker-tls-key must be specified to authenticate to the docker daemon"))
+	}
+
+	if (a.MetricsTLSCert == "") != (a.MetricsTLSKey == "") {
+		problems = append(problems, errors.New(
+			"Both metrics-tls-cert and metrics-tls-key must be specified to enable TLS"))
+	}
+
+	if (a.MetricsUser == "") != (a.MetricsPassword == "") {
+		problems = append(problems, errors.New(
+			"Both metrics-user and metrics-password must be specified to enable basic auth"))
+	}
+
+	if prometheusCfg, err := a.PrometheusConfig(); err != nil {
+		problems = append(problems, err)
+	} else if a.hasAggregator("prometheus") {
+		if err := prometheusCfg.Validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if _, err := a.SlackRules(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if _, err := a.SentryRules(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if _, err := a.TelegramRules(); err != nil {
+		problems = append(problems, err)
+	}
+
+	return problems.Err()
+}
+
+// ConfigureLogger sets the level and the format of `logger`
+// according to the log settings. The format must only be set before
+// `logger` gets used concurrently.
+func (a Config) ConfigureLogger(logger *logrus.Logger) (err error) {
+	level, err := logrus.ParseLevel(a.LogLevel)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid log-level")
+		return
+	}
+
+	var formatter logrus.Formatter
+	switch a.LogFormat {
+	case "", "text":
+		formatter = &logrus.TextFormatter{}
+	case "json":
+		formatter = &logrus.JSONFormatter{}
+	default:
+		err = errors.Errorf(
+			"Invalid log-format %s, expected text or json", a.LogFormat)
+		return
+	}
+
+	logger.SetLevel(level)
+	logger.Formatter = formatter
+	return
+}
+
+// hasAggregator reports whether the aggregator `name` is enabled.
+func (a Config) hasAggregator(name string) bool {
+	for _, agg := range a.Aggregator {
+		if agg == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DockerRange parses the times (if any) of the events to replay,
+// resolving the relative ones against `now`.
+func (a Config) DockerRange(now time.Time) (since, until time.Time, err error) {
+	since, err = parseTime(a.DockerSince, now)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid docker-since")
+		return
+	}
+
+	until, err = parseTime(a.DockerUntil, now)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid docker-until")
+		return
+	}
+
+	if !until.IsZero() && until.Before(since) {
+		err = errors.Errorf(
+			"docker-until (%s) must not be before docker-since (%s)",
+			a.DockerUntil, a.DockerSince)
+		return
+	}
+
+	return
+}
+
+// parseTime parses either an RFC3339 timestamp or a duration
+// relative to `now` (e.g., `-1h` for an hour ago). An empty value
+// yields the zero time.
+func parseTime(value string, now time.Time) (t time.Time, err error) {
+	if value == "" {
+		return
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+
+	t, err = time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		err = errors.Errorf(
+			"Malformed time %s, expected an RFC3339 timestamp or a duration like -1h",
+			value)
+		return
+	}
+
+	return
+}
+
+// PrometheusConfig builds the configuration of the prometheus
+// aggregator out of the metrics settings.
+func (a Config) PrometheusConfig() (cfg aggregators.PrometheusConfig, err error) {
+	typeLabels, err := a.MetricsTypeLabels()
+	if err != nil {
+		return
+	}
+
+	host, err := a.MetricsHostLabel()
+	if err != nil {
+		return
+	}
+
+	cfg = aggregators.PrometheusConfig{
+		Path:          a.MetricsPath,
+		Port:          a.MetricsPort,
+		Labels:        a.MetricsLabels(),
+		TypeLabels:    typeLabels,
+		Namespace:     a.MetricsNamespace,
+		Subsystem:     a.MetricsSubsystem,
+		TLSCertFile:   a.MetricsTLSCert,
+		TLSKeyFile:    a.MetricsTLSKey,
+		BasicAuthUser: a.MetricsUser,
+		BasicAuthPass: a.MetricsPassword,
+		HealthPath:    a.HealthPath,
+		ReadyPath:     a.ReadyPath,
+		RawActions:    a.MetricsRawActions,
+		ComposeLabels: a.MetricsCompose,
+		SwarmLabels:   a.MetricsSwarm,
+		ImageRepos:    a.MetricsImageRepo,
+		Host:          host,
+
+		NameLabel:             a.MetricsName,
+		NameLimit:             a.MetricsNameLimit,
+		NetworkContainerLabel: a.MetricsNetworkContainer,
+		VolumeMounts:          a.MetricsVolumeMounts,
+		ProcessingBuckets:     a.MetricsProcessingBuckets,
+		LifetimeBuckets:       a.MetricsLifetimeBuckets,
+		SeriesTTL:             a.MetricsSeriesTTL,
+		ExemplarAttribute:     a.MetricsExemplarAttribute,
+	}
+
+	if len(a.DockerHost) > 1 {
+		cfg.HostAttribute = collectors.HostAttribute
+	}
+	return
+}
+
+// MetricsHostLabel returns the value of the `host` label of the
+// metrics, defaulting to the name of the machine.
+func (a Config) MetricsHostLabel() (host string, err error) {
+	if a.MetricsHost != "" {
+		host = a.MetricsHost
+		return
+	}
+
+	host, err = os.Hostname()
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't retrieve hostname for the host label")
+	}
+	return
+}
+
+// MetricsLabels returns the container labels specified via
+// MetricsLabel, splitting the comma separated ones.
+func (a Config) MetricsLabels() (labels []string) {
+	for _, entry := range a.MetricsLabel {
+		for _, label := range strings.Split(entry, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	return
+}
+
+// MetricsTypeLabels parses the `<type>=<attribute>` pairs specified
+// via MetricsTypeLabel into a map of event type to attributes.
+func (a Config) MetricsTypeLabels() (labels map[string][]string, err error) {
+	labels = map[string][]string{}
+
+	for _, pair := range a.MetricsTypeLabel {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			err = errors.Errorf(
+				"Malformed metrics-type-label %s, expected <type>=<attribute>", pair)
+			return
+		}
+
+		labels[parts[0]] = append(labels[parts[0]], parts[1])
+	}
+
+	return
+}
+
+// SlackRules parses the rules specified via SlackRule.
+func (a Config) SlackRules() (rules []aggregators.SlackRule, err error) {
+	for _, spec := range a.SlackRule {
+		var rule aggregators.SlackRule
+
+		rule, err = aggregators.ParseSlackRule(spec)
+		if err != nil {
+			return
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return
+}
+
+// SentryRules parses the rules specified via SentryRule.
+func (a Config) SentryRules() (rules []aggregators.SentryRule, err error) {
+	for _, spec := range a.SentryRule {
+		var rule aggregators.SentryRule
+
+		rule, err = aggregators.ParseSentryRule(spec)
+		if err != nil {
+			return
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return
+}
+
+// TelegramRules parses the rules specified via TelegramRule.
+func (a Config) TelegramRules() (rules []aggregators.TelegramRule, err error) {
+	for _, spec := range a.TelegramRule {
+		var rule aggregators.TelegramRule
+
+		rule, err = aggregators.ParseTelegramRule(spec)
+		if err != nil {
+			return
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return
+}
+
+// LoadFile sets the fields of the configuration from the YAML file at
+// `path`, whose keys are the names of the flags (e.g., `metricsport`).
+// Fields not present in the file are left untouched while unknown keys
+// are rejected so that typos don't go unnoticed.
+func (a *Config) LoadFile(path string) (err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't read configuration file %s", path)
+		return
+	}
+
+	err = yaml.UnmarshalStrict(content, a)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid configuration file %s", path)
+		return
+	}
+
+	return
+}
+
+// LoadEnv sets the fields of the configuration from the variables of
+// `environ` (as returned by os.Environ) named by their `env` tags.
+func (a *Config) LoadEnv(environ []string) (err error) {
+	var values = map[string]string{}
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+
+	var (
+		dst = reflect.ValueOf(a).Elem()
+		typ = dst.Type()
+	)
+
+	for i := 0; i < typ.NumField(); i++ {
+		var (
+			field = typ.Field(i)
+			name  = field.Tag.Get("env")
+		)
+
+		if name == "" {
+			continue
+		}
+
+		value, present := values[name]
+		if !present {
+			continue
+		}
+
+		err = setEnvField(dst.Field(i), field, value)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Invalid value for environment variable %s", name)
+			return
+		}
+	}
+
+	return
+}
+
+// setEnvField parses the value of an environment variable into a
+// configuration field, lists being split on the separator of their
+// `envsep` tag (a comma by default).
+func setEnvField(dst reflect.Value, field reflect.StructField, value string) (err error) {
+	if dst.Kind() != reflect.Slice {
+		var parsed reflect.Value
+
+		parsed, err = parseEnvValue(dst.Type(), value)
+		if err != nil {
+			return
+		}
+
+		dst.Set(parsed)
+		return
+	}
+
+	var separator = field.Tag.Get("envsep")
+	if separator == "" {
+		separator = ","
+	}
+
+	var list = reflect.MakeSlice(dst.Type(), 0, 0)
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		var parsed reflect.Value
+
+		parsed, err = parseEnvValue(dst.Type().Elem(), item)
+		if err != nil {
+			err = errors.Wrapf(err, "Invalid list item %q", item)
+			return
+		}
+
+		list = reflect.Append(list, parsed)
+	}
+
+	dst.Set(list)
+	return
+}
+
+// parseEnvValue parses a single (non-list) value of type `typ` out of
+// an environment variable.
+func parseEnvValue(typ reflect.Type, value string) (parsed reflect.Value, err error) {
+	parsed = reflect.New(typ).Elem()
+
+	if typ == reflect.TypeOf(time.Duration(0)) {
+		var duration time.Duration
+
+		duration, err = time.ParseDuration(value)
+		parsed.SetInt(int64(duration))
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		parsed.SetString(value)
+	case reflect.Int, reflect.Int64:
+		var number int64
+
+		number, err = strconv.ParseInt(value, 10, typ.Bits())
+		parsed.SetInt(number)
+	case reflect.Float64:
+		var number float64
+
+		number, err = strconv.ParseFloat(value, 64)
+		parsed.SetFloat(number)
+	case reflect.Bool:
+		var flag bool
+
+		flag, err = strconv.ParseBool(value)
+		parsed.SetBool(flag)
+	default:
+		err = errors.Errorf("unsupported field type %s", typ)
+	}
+
+	return
+}
+
+// Overlay sets the fields named `fields` (e.g., those returned by
+// GivenFields) of `b` on top of those of the configuration, e.g. for
+// the flags to take precedence over the configuration file. Fields
+// are set even when zero, so that `--flag=false` or `--flag=0`
+// override what the file says.
+func (a *Config) Overlay(b Config, fields []string) {
+	var (
+		dst = reflect.ValueOf(a).Elem()
+		src = reflect.ValueOf(b)
+	)
+
+	for _, name := range fields {
+		var field = src.FieldByName(name)
+		if !field.IsValid() {
+			continue
+		}
+
+		dst.FieldByName(name).Set(field)
+	}
+}
+
+// flagAliases are alternative names of some flags, in the
+// `-backend.setting` style, mapped to the flags they stand for.
+var flagAliases = map[string]string{
+	"prometheus.port":   "metricsport",
+	"prometheus.path":   "metricspath",
+	"prometheus.labels": "metricslabel",
+	"log.level":         "loglevel",
+}
+
+// ExpandFlagAliases rewrites the aliases of flags in `args` (e.g.,
+// `-prometheus.port=9090`) into the flags they stand for (e.g.,
+// `--metricsport=9090`).
+func ExpandFlagAliases(args []string) (expanded []string) {
+	for idx, arg := range args {
+		if arg == "--" {
+			return append(expanded, args[idx:]...)
+		}
+
+		name, value := splitFlag(arg)
+		if flag, ok := flagAliases[name]; ok {
+			arg = "--" + flag + value
+		}
+
+		expanded = append(expanded, arg)
+	}
+
+	return
+}
+
+// GivenFields returns the names of the fields of the configuration
+// explicitly set by `args`, either through their flags (or aliases)
+// or through the environment variables some flags read (looked up
+// with `lookupEnv`), whatever their values.
+func GivenFields(args []string, lookupEnv func(string) (string, bool)) (fields []string) {
+	var (
+		typ   = reflect.TypeOf(Config{})
+		flags = map[string]string{}
+		given = map[string]bool{}
+	)
+
+	for i := 0; i < typ.NumField(); i++ {
+		var field = typ.Field(i)
+
+		flags[strings.ToLower(field.Name)] = field.Name
+		for _, key := range strings.Split(field.Tag.Get("arg"), ",") {
+			switch {
+			case strings.HasPrefix(key, "--"):
+				flags[key[2:]] = field.Name
+			case strings.HasPrefix(key, "-"):
+				flags[key[1:]] = field.Name
+			case key == "env":
+				if _, ok := lookupEnv(strings.ToUpper(field.Name)); ok {
+					given[field.Name] = true
+				}
+			case strings.HasPrefix(key, "env:"):
+				if _, ok := lookupEnv(key[len("env:"):]); ok {
+					given[field.Name] = true
+				}
+			}
+		}
+	}
+
+	for _, arg := range ExpandFlagAliases(args) {
+		if arg == "--" {
+			break
+		}
+
+		if name, _ := splitFlag(arg); name != "" {
+			if field, ok := flags[name]; ok {
+				given[field] = true
+			}
+		}
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		if given[typ.Field(i).Name] {
+			fields = append(fields, typ.Field(i).Name)
+		}
+	}
+
+	return
+}
+
+// splitFlag splits a command line argument into the name of the flag
+// it is, without its dashes, and its inline value (`=value`), if
+// any. The name is empty when the argument isn't a flag.
+func splitFlag(arg string) (name, value string) {
+	if !strings.HasPrefix(arg, "-") {
+		return
+	}
+
+	name = strings.TrimLeft(arg, "-")
+	if idx := strings.Index(name, "="); idx != -1 {
+		name, value = name[:idx], name[idx:]
+	}
+
+	return
+}
+
+// Changed returns the names of the fields whose values differ
+// between `a` and `b`.
+func (a Config) Changed(b Config) (fields []string) {
+	var (
+		before = reflect.ValueOf(a)
+		after  = reflect.ValueOf(b)
+	)
+
+	for i := 0; i < before.NumField(); i++ {
+		if !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			fields = append(fields, before.Type().Field(i).Name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigLoadEnv(t *testing.T) {
+	var cfg Config
+
+	err := cfg.LoadEnv([]string{
+		"DEVENTS_METRICSPORT=9191",
+		"DEVENTS_METRICSPATH=/custom",
+		"DEVENTS_METRICSLABEL=container, image",
+		"DEVENTS_FILEMAXSIZE=10485760",
+		"DEVENTS_SLACKRULE=action=die,channel=#ops;action=oom",
+		"DEVENTS_DEADLETTER=true",
+		"DEVENTS_EVENTSAMPLERATE=2.5",
+		"DEVENTS_UNKNOWN=ignored",
+		"OTHER_METRICSPORT=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MetricsPort != 9191 {
+		t.Errorf("expected port 9191, got %d", cfg.MetricsPort)
+	}
+
+	if cfg.MetricsPath != "/custom" {
+		t.Errorf("expected path /custom, got %s", cfg.MetricsPath)
+	}
+
+	if !reflect.DeepEqual(cfg.MetricsLabel, []string{"container", "image"}) {
+		t.Errorf("expected labels container and image, got %v", cfg.MetricsLabel)
+	}
+
+	if cfg.FileMaxSize != 10485760 {
+		t.Errorf("expected max size 10485760, got %d", cfg.FileMaxSize)
+	}
+
+	if !reflect.DeepEqual(cfg.SlackRule, []string{"action=die,channel=#ops", "action=oom"}) {
+		t.Errorf("expected rules split on ;, got %v", cfg.SlackRule)
+	}
+
+	if cfg.EventSampleRate != 2.5 {
+		t.Errorf("expected sample rate 2.5, got %g", cfg.EventSampleRate)
+	}
+
+	if !cfg.DeadLetter {
+		t.Errorf("expected deadletter to be set")
+	}
+}
+
+// TestConfigEnvNames makes sure that every setting is read from the
+// environment variable the README documents for it.
+func TestConfigEnvNames(t *testing.T) {
+	var typ = reflect.TypeOf(Config{})
+
+	for i := 0; i < typ.NumField(); i++ {
+		var (
+			field    = typ.Field(i)
+			expected = "DEVENTS_" + strings.ToUpper(field.Name)
+		)
+
+		if name := field.Tag.Get("env"); name != expected {
+			t.Errorf("%s: expected environment variable %s, got %q", field.Name, expected, name)
+		}
+	}
+}
+
+func TestConfigLoadEnvKeepsUnsetFields(t *testing.T) {
+	var cfg = Config{MetricsPort: 9090, MetricsPath: "/metrics"}
+
+	err := cfg.LoadEnv([]string{"DEVENTS_METRICSPORT=9191"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.MetricsPort != 9191 || cfg.MetricsPath != "/metrics" {
+		t.Errorf("expected only the port to change, got %d %s",
+			cfg.MetricsPort, cfg.MetricsPath)
+	}
+}
+
+func TestConfigLoadEnvInvalid(t *testing.T) {
+	for _, entry := range []string{
+		"DEVENTS_METRICSPORT=abc",
+		"DEVENTS_FILEMAXSIZE=big",
+		"DEVENTS_DEADLETTER=maybe",
+	} {
+		var cfg Config
+
+		if err := cfg.LoadEnv([]string{entry}); err == nil {
+			t.Errorf("expected %s to be rejected", entry)
+		}
+	}
+}
+
+func TestSetEnvField(t *testing.T) {
+	var target struct {
+		Duration time.Duration
+		Floats   []float64
+		Ints     []int
+		Maps     []map[string]string
+	}
+
+	var (
+		dst = reflect.ValueOf(&target).Elem()
+		typ = dst.Type()
+	)
+
+	for i, value := range []string{"1m30s", "0.1, 1,10", "1,2"} {
+		if err := setEnvField(dst.Field(i), typ.Field(i), value); err != nil {
+			t.Fatalf("%s: %v", typ.Field(i).Name, err)
+		}
+	}
+
+	if target.Duration != 90*time.Second {
+		t.Errorf("expected 1m30s, got %s", target.Duration)
+	}
+
+	if !reflect.DeepEqual(target.Floats, []float64{0.1, 1, 10}) {
+		t.Errorf("expected floats 0.1 1 10, got %v", target.Floats)
+	}
+
+	if !reflect.DeepEqual(target.Ints, []int{1, 2}) {
+		t.Errorf("expected ints 1 2, got %v", target.Ints)
+	}
+
+	if err := setEnvField(dst.Field(1), typ.Field(1), "0.1,abc"); err == nil {
+		t.Errorf("expected an invalid float item to be rejected")
+	}
+
+	if err := setEnvField(dst.Field(3), typ.Field(3), "a=b"); err == nil {
+		t.Errorf("expected an unsupported item type to be rejected")
+	}
+}
+
+func TestConfigLoadEnvBuckets(t *testing.T) {
+	var cfg Config
+
+	err := cfg.LoadEnv([]string{
+		"DEVENTS_METRICSPROCESSINGBUCKETS=0.001,0.01,0.1",
+		"DEVENTS_METRICSLIFETIMEBUCKETS=60, 3600",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prometheus, err := cfg.PrometheusConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(prometheus.ProcessingBuckets, []float64{0.001, 0.01, 0.1}) {
+		t.Errorf("expected processing buckets 0.001 0.01 0.1, got %v", prometheus.ProcessingBuckets)
+	}
+
+	if !reflect.DeepEqual(prometheus.LifetimeBuckets, []float64{60, 3600}) {
+		t.Errorf("expected lifetime buckets 60 3600, got %v", prometheus.LifetimeBuckets)
+	}
+}
+
+func TestExpandFlagAliases(t *testing.T) {
+	var expanded = ExpandFlagAliases([]string{
+		"-prometheus.port=9090",
+		"--prometheus.path", "/custom",
+		"-prometheus.labels", "image,com.docker.compose.service",
+		"-log.level=debug",
+		"--metricsport", "9091",
+		"--", "-log.level",
+	})
+
+	var expected = []string{
+		"--metricsport=9090",
+		"--metricspath", "/custom",
+		"--metricslabel", "image,com.docker.compose.service",
+		"--loglevel=debug",
+		"--metricsport", "9091",
+		"--", "-log.level",
+	}
+
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("expected %v, got %v", expected, expanded)
+	}
+}
+
+func TestGivenFields(t *testing.T) {
+	var env = map[string]string{
+		"WEBHOOKSECRET":  "s3cr3t",
+		"DEVENTS_CONFIG": "devents.yaml",
+	}
+
+	var fields = GivenFields([]string{
+		"-a", "prometheus",
+		"--metricsrawactions=false",
+		"-prometheus.port", "0",
+		"--", "--metricspath",
+	}, func(name string) (value string, ok bool) {
+		value, ok = env[name]
+		return
+	})
+
+	var expected = []string{"Config", "Aggregator", "MetricsPort", "MetricsRawActions", "WebhookSecret"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+}
+
+func TestConfigOverlay(t *testing.T) {
+	var cfg = Config{
+		MetricsPort:       9090,
+		MetricsPath:       "/metrics",
+		MetricsRawActions: true,
+	}
+
+	cfg.Overlay(Config{MetricsPort: 9191}, []string{"MetricsPort", "MetricsRawActions"})
+
+	if cfg.MetricsPort != 9191 {
+		t.Errorf("expected port 9191, got %d", cfg.MetricsPort)
+	}
+
+	if cfg.MetricsRawActions {
+		t.Errorf("expected an explicit false to override the setting")
+	}
+
+	if cfg.MetricsPath != "/metrics" {
+		t.Errorf("expected the path not given to be kept, got %s", cfg.MetricsPath)
+	}
+}
+
+func TestConfigDockerRange(t *testing.T) {
+	var now = time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	var testCases = []struct {
+		desc         string
+		since, until string
+		expectSince  time.Time
+		expectUntil  time.Time
+		fail         bool
+	}{
+		{desc: "unset"},
+		{
+			desc:        "relative",
+			since:       "-1h",
+			until:       "-5m",
+			expectSince: now.Add(-time.Hour),
+			expectUntil: now.Add(-5 * time.Minute),
+		},
+		{
+			desc:        "rfc3339",
+			since:       "2017-07-14T00:00:00Z",
+			until:       "2017-07-14T01:30:00.5+01:00",
+			expectSince: time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC),
+			expectUntil: time.Date(2017, 7, 14, 0, 30, 0, 500000000, time.UTC),
+		},
+		{desc: "since only", since: "-30s", expectSince: now.Add(-30 * time.Second)},
+		{desc: "malformed since", since: "yesterday", fail: true},
+		{desc: "malformed until", until: "2017-07-14", fail: true},
+		{desc: "until before since", since: "-1h", until: "-2h", fail: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var cfg = Config{DockerSince: tc.since, DockerUntil: tc.until}
+
+			since, until, err := cfg.DockerRange(now)
+			if tc.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !since.Equal(tc.expectSince) || !until.Equal(tc.expectUntil) {
+				t.Errorf("expected %s-%s, got %s-%s", tc.expectSince, tc.expectUntil, since, until)
+			}
+		})
+	}
+}
+
+func TestConfigureLogger(t *testing.T) {
+	var testCases = []struct {
+		desc   string
+		level  string
+		format string
+		debug  bool
+	}{
+		{desc: "debug", level: "debug", format: "json", debug: true},
+		{desc: "info", level: "info", format: "json", debug: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var (
+				out    bytes.Buffer
+				logger = logrus.New()
+				cfg    = Config{LogLevel: tc.level, LogFormat: tc.format}
+			)
+
+			logger.Out = &out
+			if err := cfg.ConfigureLogger(logger); err != nil {
+				t.Fatal(err)
+			}
+
+			logger.WithField("component", "test").Debug("debugging")
+			logger.WithField("component", "test").Info("informing")
+
+			var debug bool
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("expected json logs, got %q", line)
+				}
+
+				if entry["component"] != "test" {
+					t.Errorf("expected the fields to be kept, got %v", entry)
+				}
+
+				if entry["level"] == "debug" {
+					debug = true
+				}
+			}
+
+			if debug != tc.debug {
+				t.Errorf("expected debug lines to be emitted: %t, got %q", tc.debug, out.String())
+			}
+		})
+	}
+}
+
+func TestConfigureLoggerInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{LogLevel: "verbose"},
+		{LogLevel: "info", LogFormat: "xml"},
+	} {
+		if err := cfg.ConfigureLogger(logrus.New()); err == nil {
+			t.Errorf("expected %s/%s to be rejected", cfg.LogLevel, cfg.LogFormat)
+		}
+	}
+}
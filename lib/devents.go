@@ -1,31 +1,63 @@
 package lib
 
 import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
 	"github.com/cirocosta/devents/lib/aggregators"
 	"github.com/cirocosta/devents/lib/collectors"
-	"github.com/docker/docker/api/types/events"
+	"github.com/cirocosta/devents/lib/config"
+	"github.com/cirocosta/devents/lib/transformers"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Devents struct {
-	collector   collectors.Collector
-	aggregators []aggregators.Aggregator
+	config     config.Config
+	collector  collectors.Collector
+	dispatcher aggregators.Dispatcher
 }
 
-func New(cfg Config) (dev Devents, err error) {
-	log.WithField("type", "docker").Info("initializing collector")
-	collector, err := collectors.NewDocker(struct{}{})
+func New(cfg config.Config) (dev Devents, err error) {
+	host, err := cfg.MetricsHostLabel()
+	if err != nil {
+		return
+	}
+
+	collector, err := newCollector(cfg, host)
 	if err != nil {
-		err = errors.Wrapf(err,
-			"Couldn't instantiate docker collector")
 		return
 	}
 
+	var deduplicated = newDeduplicated(cfg, host)
+
+	pipeline, err := newPipeline(cfg, deduplicated)
+	if err != nil {
+		return
+	}
+
+	var transformed = collectors.NewTransform(collector, pipeline)
+
+	var registry = prometheus.NewRegistry()
+
+	var (
+		aggs         = map[string]aggregators.Aggregator{}
+		deadLettered = newDeadLettered(cfg, host)
+	)
 	for _, agg := range cfg.Aggregator {
 		var aggregator aggregators.Aggregator
 
+		if _, present := aggs[agg]; present {
+			err = errors.Errorf(
+				"Aggregator %s specified more than once", agg)
+			return
+		}
+
 		switch agg {
 		case "fluentd":
 			aggregator, err = aggregators.NewFluentd(aggregators.FluentdConfig{
@@ -34,12 +66,290 @@ func New(cfg Config) (dev Devents, err error) {
 				TagPrefix: cfg.FluentdTag,
 			})
 		case "stdout":
-			aggregator, err = aggregators.NewStdout()
+			aggregator, err = aggregators.NewStdout(aggregators.StdoutConfig{
+				Pretty: cfg.StdoutPretty,
+				Dump:   cfg.StdoutDump,
+			})
 		case "prometheus":
-			aggregator, err = aggregators.NewPrometheus(aggregators.PrometheusConfig{
-				Path:   cfg.MetricsPath,
-				Port:   cfg.MetricsPort,
-				Labels: cfg.MetricsLabel,
+			var prometheusCfg aggregators.PrometheusConfig
+
+			prometheusCfg, err = cfg.PrometheusConfig()
+			if err != nil {
+				return
+			}
+
+			prometheusCfg.Registry = registry
+			prometheusCfg.Logger = log.StandardLogger()
+			prometheusCfg.DockerConnected = collector.Connected
+			prometheusCfg.RunningContainers = transformed.Running
+			aggregator, err = aggregators.NewPrometheus(prometheusCfg)
+		case "statsd":
+			aggregator, err = aggregators.NewStatsD(aggregators.StatsDConfig{
+				Host:   cfg.StatsdHost,
+				Port:   cfg.StatsdPort,
+				Prefix: cfg.StatsdPrefix,
+				Tags:   cfg.StatsdTag,
+			})
+		case "dogstatsd":
+			aggregator, err = aggregators.NewDogStatsD(aggregators.DogStatsDConfig{
+				Host:       cfg.DogstatsdHost,
+				Port:       cfg.DogstatsdPort,
+				Prefix:     cfg.DogstatsdPrefix,
+				Tags:       cfg.DogstatsdTag,
+				Attributes: cfg.DogstatsdAttribute,
+			})
+		case "influxdb":
+			aggregator, err = aggregators.NewInfluxDB(aggregators.InfluxDBConfig{
+				URL:             cfg.InfluxdbURL,
+				Database:        cfg.InfluxdbDatabase,
+				RetentionPolicy: cfg.InfluxdbRetentionPolicy,
+				Username:        cfg.InfluxdbUser,
+				Password:        cfg.InfluxdbPassword,
+				BatchSize:       cfg.InfluxdbBatchSize,
+				FlushInterval:   cfg.InfluxdbFlushInterval,
+			})
+		case "influxdb2":
+			aggregator, err = aggregators.NewInfluxDB2(aggregators.InfluxDB2Config{
+				URL:           cfg.Influxdb2URL,
+				Org:           cfg.Influxdb2Org,
+				Bucket:        cfg.Influxdb2Bucket,
+				Token:         cfg.Influxdb2Token,
+				BatchSize:     cfg.Influxdb2BatchSize,
+				FlushInterval: cfg.Influxdb2FlushInterval,
+			})
+		case "graphite":
+			aggregator, err = aggregators.NewGraphite(aggregators.GraphiteConfig{
+				Host:          cfg.GraphiteHost,
+				Port:          cfg.GraphitePort,
+				Prefix:        cfg.GraphitePrefix,
+				FlushInterval: cfg.GraphiteFlushInterval,
+			})
+		case "elasticsearch":
+			aggregator, err = aggregators.NewElasticsearch(aggregators.ElasticsearchConfig{
+				URL:           cfg.ElasticsearchURL,
+				Index:         cfg.ElasticsearchIndex,
+				Username:      cfg.ElasticsearchUser,
+				Password:      cfg.ElasticsearchPassword,
+				BatchSize:     cfg.ElasticsearchBatchSize,
+				FlushInterval: cfg.ElasticsearchFlushInterval,
+				DeadLetter:    deadLetterConfig(cfg, agg, deadLettered),
+			})
+		case "kafka":
+			aggregator, err = aggregators.NewKafka(aggregators.KafkaConfig{
+				Brokers:       cfg.KafkaBroker,
+				Topic:         cfg.KafkaTopic,
+				Key:           cfg.KafkaKey,
+				Compression:   cfg.KafkaCompression,
+				FlushInterval: cfg.KafkaFlushInterval,
+				TLS:           cfg.KafkaTLS,
+				SASLUser:      cfg.KafkaUser,
+				SASLPassword:  cfg.KafkaPassword,
+				Format:        cfg.KafkaFormat,
+				Source:        cfg.CloudeventsSource,
+				DeadLetter:    deadLetterConfig(cfg, agg, deadLettered),
+			})
+		case "nats":
+			aggregator, err = aggregators.NewNATS(aggregators.NATSConfig{
+				Servers:  cfg.NatsServer,
+				Subject:  cfg.NatsSubject,
+				Username: cfg.NatsUser,
+				Password: cfg.NatsPassword,
+				Token:    cfg.NatsToken,
+			})
+		case "webhook":
+			aggregator, err = aggregators.NewWebhook(aggregators.WebhookConfig{
+				URL:           cfg.WebhookURL,
+				Headers:       cfg.WebhookHeader,
+				Timeout:       cfg.WebhookTimeout,
+				RetryAttempts: cfg.WebhookRetryAttempts,
+				RetryBackoff:  cfg.WebhookRetryBackoff,
+				Events:        cfg.WebhookEvent,
+				Secret:        cfg.WebhookSecret,
+				Format:        cfg.WebhookFormat,
+				Source:        cfg.CloudeventsSource,
+				DeadLetter:    deadLetterConfig(cfg, agg, deadLettered),
+			})
+		case "slack":
+			var rules []aggregators.SlackRule
+			rules, err = cfg.SlackRules()
+			if err != nil {
+				return
+			}
+
+			aggregator, err = aggregators.NewSlack(aggregators.SlackConfig{
+				WebhookURL: cfg.SlackWebhookURL,
+				Rules:      rules,
+				Template:   cfg.SlackTemplate,
+				Interval:   cfg.SlackInterval,
+			})
+		case "file":
+			aggregator, err = aggregators.NewFile(aggregators.FileConfig{
+				Path:       cfg.FilePath,
+				MaxSize:    cfg.FileMaxSize,
+				MaxAge:     cfg.FileMaxAge,
+				MaxBackups: cfg.FileMaxBackups,
+				Compress:   cfg.FileCompress,
+			})
+		case "syslog":
+			aggregator, err = aggregators.NewSyslog(aggregators.SyslogConfig{
+				Network:  cfg.SyslogNetwork,
+				Address:  cfg.SyslogAddress,
+				Facility: cfg.SyslogFacility,
+				AppName:  cfg.SyslogAppName,
+			})
+		case "loki":
+			aggregator, err = aggregators.NewLoki(aggregators.LokiConfig{
+				URL:           cfg.LokiURL,
+				TenantID:      cfg.LokiTenant,
+				Host:          cfg.LokiHost,
+				BatchSize:     cfg.LokiBatchSize,
+				FlushInterval: cfg.LokiFlushInterval,
+			})
+		case "sqlite":
+			aggregator, err = aggregators.NewSQLite(aggregators.SQLiteConfig{
+				Path:          cfg.SqlitePath,
+				Retention:     cfg.SqliteRetention,
+				BatchSize:     cfg.SqliteBatchSize,
+				FlushInterval: cfg.SqliteFlushInterval,
+			})
+		case "postgres":
+			aggregator, err = aggregators.NewPostgres(aggregators.PostgresConfig{
+				DSN:           cfg.PostgresDSN,
+				Table:         cfg.PostgresTable,
+				BatchSize:     cfg.PostgresBatchSize,
+				FlushInterval: cfg.PostgresFlushInterval,
+			})
+		case "pubsub":
+			aggregator, err = aggregators.NewPubSub(aggregators.PubSubConfig{
+				Project:         cfg.PubsubProject,
+				Topic:           cfg.PubsubTopic,
+				CredentialsFile: cfg.PubsubCredentials,
+				OrderingKey:     cfg.PubsubOrderingKey,
+				FlushInterval:   cfg.PubsubFlushInterval,
+				Format:          cfg.PubsubFormat,
+				Source:          cfg.CloudeventsSource,
+			})
+		case "cloudwatchlogs":
+			aggregator, err = aggregators.NewCloudWatchLogs(aggregators.CloudWatchLogsConfig{
+				Region:        cfg.CloudwatchRegion,
+				LogGroup:      cfg.CloudwatchLogGroup,
+				LogStream:     cfg.CloudwatchLogStream,
+				FlushInterval: cfg.CloudwatchFlushInterval,
+			})
+		case "emf":
+			aggregator, err = aggregators.NewEMF(aggregators.EMFConfig{
+				Namespace:          cfg.EmfNamespace,
+				Dimensions:         cfg.EmfDimension,
+				MaxDimensionValues: cfg.EmfMaxDimensionValues,
+				FlushInterval:      cfg.EmfFlushInterval,
+			})
+		case "otlpmetrics":
+			aggregator, err = aggregators.NewOTLPMetrics(aggregators.OTLPMetricsConfig{
+				Endpoint:           cfg.OtlpEndpoint,
+				Headers:            cfg.OtlpHeader,
+				ResourceAttributes: cfg.OtlpResourceAttribute,
+				ExportInterval:     cfg.OtlpExportInterval,
+			})
+		case "otlplogs":
+			aggregator, err = aggregators.NewOTLPLogs(aggregators.OTLPLogsConfig{
+				Endpoint:           cfg.OtlpEndpoint,
+				Headers:            cfg.OtlpHeader,
+				ResourceAttributes: cfg.OtlpResourceAttribute,
+				BatchSize:          cfg.OtlpLogsBatchSize,
+				FlushInterval:      cfg.OtlpLogsFlushInterval,
+			})
+		case "sentry":
+			var rules []aggregators.SentryRule
+			rules, err = cfg.SentryRules()
+			if err != nil {
+				return
+			}
+
+			aggregator, err = aggregators.NewSentry(aggregators.SentryConfig{
+				DSN:         cfg.SentryDSN,
+				Environment: cfg.SentryEnvironment,
+				Rules:       rules,
+				DedupWindow: cfg.SentryDedupWindow,
+				Release:     Version,
+			})
+		case "websocket":
+			aggregator, err = aggregators.NewWebSocket(aggregators.WebSocketConfig{
+				Addr:   cfg.WebsocketAddr,
+				Path:   cfg.WebsocketPath,
+				Token:  cfg.WebsocketToken,
+				Events: cfg.WebsocketEvent,
+			})
+		case "sse":
+			aggregator, err = aggregators.NewSSE(aggregators.SSEConfig{
+				Addr:       cfg.SseAddr,
+				Path:       cfg.SsePath,
+				BufferSize: cfg.SseBufferSize,
+			})
+		case "grpc":
+			aggregator, err = aggregators.NewGRPC(aggregators.GRPCConfig{
+				Addr:        cfg.GrpcAddr,
+				TLSCertFile: cfg.GrpcTlsCert,
+				TLSKeyFile:  cfg.GrpcTlsKey,
+				BufferSize:  cfg.GrpcBufferSize,
+			})
+		case "pushgateway":
+			var typeLabels map[string][]string
+
+			typeLabels, err = cfg.MetricsTypeLabels()
+			if err != nil {
+				return
+			}
+
+			var metrics = aggregators.PrometheusConfig{
+				Labels:        cfg.MetricsLabels(),
+				TypeLabels:    typeLabels,
+				Namespace:     cfg.MetricsNamespace,
+				Subsystem:     cfg.MetricsSubsystem,
+				RawActions:    cfg.MetricsRawActions,
+				SeriesTTL:     cfg.MetricsSeriesTTL,
+				ComposeLabels: cfg.MetricsCompose,
+				SwarmLabels:   cfg.MetricsSwarm,
+				ImageRepos:    cfg.MetricsImageRepo,
+				Host:          host,
+
+				DockerConnected:   collector.Connected,
+				RunningContainers: transformed.Running,
+			}
+
+			if len(cfg.DockerHost) > 1 {
+				metrics.HostAttribute = collectors.HostAttribute
+			}
+
+			aggregator, err = aggregators.NewPushgateway(aggregators.PushgatewayConfig{
+				URL:      cfg.PushgatewayURL,
+				Job:      cfg.PushgatewayJob,
+				Grouping: cfg.PushgatewayGrouping,
+				Interval: cfg.PushgatewayInterval,
+				Metrics:  metrics,
+			})
+		case "telegram":
+			var rules []aggregators.TelegramRule
+			rules, err = cfg.TelegramRules()
+			if err != nil {
+				return
+			}
+
+			aggregator, err = aggregators.NewTelegram(aggregators.TelegramConfig{
+				Token:    cfg.TelegramToken,
+				ChatID:   cfg.TelegramChatID,
+				Rules:    rules,
+				Template: cfg.TelegramTemplate,
+				Interval: cfg.TelegramInterval,
+			})
+		case "mqtt":
+			aggregator, err = aggregators.NewMQTT(aggregators.MQTTConfig{
+				Broker:   cfg.MqttBroker,
+				ClientID: cfg.MqttClientID,
+				Username: cfg.MqttUser,
+				Password: cfg.MqttPassword,
+				Topic:    cfg.MqttTopic,
+				QoS:      cfg.MqttQos,
+				Retain:   cfg.MqttRetain,
 			})
 		default:
 			err = errors.Errorf(
@@ -52,59 +362,386 @@ func New(cfg Config) (dev Devents, err error) {
 				"Couldn't instantiate aggregator %s", agg)
 			return
 		}
-		dev.aggregators = append(dev.aggregators, aggregator)
+		aggs[agg] = aggregator
+	}
+
+	var sampled = newSampled(cfg, host)
+
+	samplers, err := newSamplers(cfg, sampled)
+	if err != nil {
+		return
+	}
+
+	dev.dispatcher, err = aggregators.NewDispatcher(aggregators.DispatcherConfig{
+		BufferSize:   cfg.BufferSize,
+		DrainTimeout: cfg.ShutdownTimeout,
+		Namespace:    cfg.MetricsNamespace,
+		Subsystem:    cfg.MetricsSubsystem,
+		Host:         host,
+		Aggregators:  aggs,
+		Transformers: samplers,
+	})
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Couldn't instantiate dispatcher")
+		return
+	}
+
+	var metrics = []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		newBuildInfo(cfg, host),
+		deadLettered,
+		deduplicated,
+		sampled,
+	}
+	metrics = append(metrics, collector.Metrics()...)
+	metrics = append(metrics, dev.dispatcher.Metrics()...)
+	for _, metric := range metrics {
+		err = registry.Register(metric)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't register internal metrics")
+			return
+		}
 	}
 
-	dev.collector = collector
+	dev.collector = transformed
+	dev.config = cfg
 	return
 }
 
-func (dev Devents) Run() {
-	var evChannels []chan events.Message
-	var errChannels []chan error
+// newCollector creates a docker collector for each of the configured
+// daemons, merging their events, or a file collector when events are
+// to be read from a file.
+func newCollector(cfg config.Config, metricsHost string) (collector collectors.FanIn, err error) {
+	if cfg.EventsFile != "" {
+		log.
+			WithField("type", "file").
+			WithField("path", cfg.EventsFile).
+			Info("initializing collector")
 
-	for idx := range dev.aggregators {
-		evChannels = append(evChannels, make(chan events.Message, 1))
-		defer close(evChannels[idx])
+		var file collectors.File
+		file, err = collectors.NewFile(collectors.FileConfig{
+			Path: cfg.EventsFile,
+			Pace: cfg.EventsFilePace,
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't instantiate file collector")
+			return
+		}
+
+		return collectors.NewFanIn(map[string]collectors.Collector{"": file})
 	}
 
-	for idx := range dev.aggregators {
-		errChannels = append(errChannels, make(chan error, 1))
-		defer close(errChannels[idx])
+	since, until, err := cfg.DockerRange(time.Now())
+	if err != nil {
+		return
 	}
 
-	for idx, agg := range dev.aggregators {
-		go agg.Run(evChannels[idx], errChannels[idx])
+	var hosts = cfg.DockerHost
+	if len(hosts) == 0 {
+		// Let the collector find the daemon out of the
+		// environment.
+		hosts = []string{""}
 	}
 
-	log.Info("starting main ev loop")
-	cevents, cerrors := dev.collector.Collect()
-
-	for {
-		select {
-		case err := <-cerrors:
-			log.WithError(err).Error("error received")
-			for _, chann := range errChannels {
-				chann <- err
+	var sources = map[string]collectors.Collector{}
+	for _, host := range hosts {
+		var name string
+
+		if len(hosts) > 1 {
+			name, err = collectors.DaemonName(host)
+			if err != nil {
+				return
 			}
 
-			log.WithError(err).Fatal("Errored waiting for events")
-			return
-		case ev := <-cevents:
-			log.Info("event received")
-			for idx, chann := range evChannels {
-				select {
-				case chann <- ev:
-					log.Info("event sent to channel", idx)
-				default:
-					log.Info("didnt send to channel", idx)
-				}
+			if _, present := sources[name]; present {
+				err = errors.Errorf(
+					"More than one docker host named %s", name)
+				return
 			}
 		}
+
+		// A single daemon is labelled after the host devents
+		// runs on, as the rest of the metrics.
+		var label = name
+		if label == "" {
+			label = metricsHost
+		}
+
+		log.
+			WithField("type", "docker").
+			WithField("host", host).
+			Info("initializing collector")
+		sources[name], err = collectors.NewDocker(collectors.DockerConfig{
+			Host:       host,
+			Name:       label,
+			TLSCACert:  cfg.DockerTLSCACert,
+			TLSCert:    cfg.DockerTLSCert,
+			TLSKey:     cfg.DockerTLSKey,
+			TLSVerify:  cfg.DockerTLSVerify,
+			MaxBackoff: cfg.DockerMaxBackoff,
+			Namespace:  cfg.MetricsNamespace,
+			Subsystem:  cfg.MetricsSubsystem,
+			Filters:    cfg.DockerFilter,
+			Since:      since,
+			Until:      until,
+			Enrich: collectors.EnrichConfig{
+				Fields:    cfg.DockerEnrich,
+				CacheSize: cfg.DockerEnrichCacheSize,
+				CacheTTL:  cfg.DockerEnrichCacheTTL,
+			},
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't instantiate docker collector for %s", host)
+			return
+		}
+	}
+
+	return collectors.NewFanIn(sources)
+}
+
+// defaultTransformers are the transformers events go through when
+// none are explicitly given.
+var defaultTransformers = []string{"filter", "relabel", "redact", "dedup"}
+
+// newPipeline creates the pipeline of transformers the events go
+// through, in the order given by the configuration, counting the
+// events dropped as duplicates under `deduplicated`.
+func newPipeline(cfg config.Config, deduplicated prometheus.Counter) (pipeline transformers.Pipeline, err error) {
+	var names = cfg.Transformer
+	if len(names) == 0 {
+		names = defaultTransformers
+	}
+
+	var seen = map[string]bool{}
+	for _, name := range names {
+		var transformer transformers.Transformer
+
+		if seen[name] {
+			err = errors.Errorf(
+				"Transformer %s specified more than once", name)
+			return
+		}
+		seen[name] = true
+
+		switch name {
+		case "filter":
+			transformer, err = transformers.NewFilter(transformers.FilterConfig{
+				Types:         cfg.EventType,
+				Labels:        cfg.EventLabel,
+				ExcludeLabels: cfg.EventLabelExclude,
+			})
+		case "relabel":
+			transformer, err = transformers.NewRelabel(transformers.RelabelConfig{
+				Rename: cfg.EventRename,
+				Set:    cfg.EventAttribute,
+			})
+		case "redact":
+			transformer, err = transformers.NewRedact(transformers.RedactConfig{
+				Keys: cfg.EventRedact,
+				Drop: cfg.EventRedactDrop,
+			})
+		case "dedup":
+			transformer, err = transformers.NewDedup(transformers.DedupConfig{
+				Window:  cfg.EventDedupWindow,
+				Counter: deduplicated,
+			})
+		default:
+			err = errors.Errorf(
+				"Unknown transformer type %s", name)
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't instantiate transformer %s", name)
+			return
+		}
+
+		pipeline = append(pipeline, transformer)
+	}
+
+	return
+}
+
+// newSamplers creates a sampling transformer for each of the
+// aggregators whose events are sampled, counting the events each
+// samples out under `sampled`. Aggregators get samplers of their own
+// so that they sample independently of each other.
+func newSamplers(cfg config.Config, sampled *prometheus.CounterVec) (samplers map[string]transformers.Transformer, err error) {
+	if cfg.EventSampleRatio == 0 && cfg.EventSampleRate == 0 {
+		return
+	}
+
+	var names = cfg.EventSampleAggregator
+	if len(names) == 0 {
+		names = cfg.Aggregator
+	}
+
+	samplers = map[string]transformers.Transformer{}
+	for _, name := range names {
+		samplers[name], err = transformers.NewSample(transformers.SampleConfig{
+			Events:  cfg.EventSample,
+			Ratio:   cfg.EventSampleRatio,
+			ByActor: cfg.EventSampleByActor,
+			Rate:    cfg.EventSampleRate,
+			Burst:   cfg.EventSampleBurst,
+			Counter: sampled.WithLabelValues(name),
+		})
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Couldn't instantiate sampler of aggregator %s", name)
+			return
+		}
+	}
+
+	return
+}
+
+// Run collects events and dispatches them to the aggregators until
+// either the collector stops (e.g., once the events up to the until
+// time are replayed) or `ctx` gets cancelled.
+func (dev Devents) Run(ctx context.Context) (err error) {
+	log.Info("starting main ev loop")
+	cevents, cerrors := dev.collector.Collect(ctx)
+
+	err = dev.dispatcher.Run(ctx, cevents, cerrors)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Errored waiting for events")
+		return
+	}
+
+	return
+}
+
+// Reload applies what can be changed from `cfg` without restarting:
+// the log level and the TLS certificates (re-read from the same
+// files) of the aggregators serving them. Any other change is
+// ignored with a warning.
+func (dev Devents) Reload(cfg config.Config) (err error) {
+	for _, field := range dev.config.Changed(cfg) {
+		switch field {
+		case "Config", "LogLevel":
+			continue
+		}
+
+		log.
+			WithField("setting", strings.ToLower(field)).
+			Warn("setting can't be changed without restarting, ignoring")
+	}
+
+	level, err := log.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		err = errors.Wrapf(err,
+			"Invalid log-level")
+		return
 	}
+
+	log.SetLevel(level)
+	return dev.dispatcher.Reload()
 }
 
 // Close closes all aggregators and collectors
 func (dev Devents) Close() (err error) {
 	return
 }
+
+// defaultSubsystem is the subsystem of the metrics devents exposes
+// about itself when none is configured, matching the aggregators'.
+const defaultSubsystem = "devents"
+
+// metricsSubsystem returns the subsystem configured for the metrics,
+// defaulting to defaultSubsystem.
+func metricsSubsystem(cfg config.Config) string {
+	if cfg.MetricsSubsystem == "" {
+		return defaultSubsystem
+	}
+
+	return cfg.MetricsSubsystem
+}
+
+// hostLabels returns the `host` constant label of the metrics devents
+// exposes about itself, which, like for those of the aggregators, is
+// only added when there's a host.
+func hostLabels(host string) prometheus.Labels {
+	if host == "" {
+		return nil
+	}
+
+	return prometheus.Labels{"host": host}
+}
+
+// newBuildInfo creates a constant gauge whose labels describe the
+// build of devents that's running.
+func newBuildInfo(cfg config.Config, host string) prometheus.Collector {
+	var labels = prometheus.Labels{
+		"version":    Version,
+		"commit":     Commit,
+		"go_version": runtime.Version(),
+	}
+
+	if host != "" {
+		labels["host"] = host
+	}
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "build_info",
+		Help:        "Build information of the running devents, always 1",
+		Namespace:   cfg.MetricsNamespace,
+		Subsystem:   metricsSubsystem(cfg),
+		ConstLabels: labels,
+	}, func() float64 { return 1 })
+}
+
+// newDeadLettered creates the counter of the events that aggregators
+// failed to deliver and wrote to their dead letter files.
+func newDeadLettered(cfg config.Config, host string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "dead_lettered_events_total",
+		Help:        "Events that couldn't be delivered and were dead-lettered",
+		Namespace:   cfg.MetricsNamespace,
+		Subsystem:   metricsSubsystem(cfg),
+		ConstLabels: hostLabels(host),
+	}, []string{"aggregator"})
+}
+
+// newDeduplicated creates the counter of the events dropped as
+// duplicates by the dedup transformer.
+func newDeduplicated(cfg config.Config, host string) prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "deduplicated_events_total",
+		Help:        "Events dropped as duplicates of a recent event",
+		Namespace:   cfg.MetricsNamespace,
+		Subsystem:   metricsSubsystem(cfg),
+		ConstLabels: hostLabels(host),
+	})
+}
+
+// newSampled creates the counter of the events sampled out before
+// reaching an aggregator.
+func newSampled(cfg config.Config, host string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "sampled_events_total",
+		Help:        "Events sampled out before reaching an aggregator",
+		Namespace:   cfg.MetricsNamespace,
+		Subsystem:   metricsSubsystem(cfg),
+		ConstLabels: hostLabels(host),
+	}, []string{"aggregator"})
+}
+
+// deadLetterConfig configures the dead letter file of the aggregator
+// `name` (`<dead-letter-dir>/<name>.json`), counting its events under
+// `counter`.
+func deadLetterConfig(cfg config.Config, name string, counter *prometheus.CounterVec) (deadLetter aggregators.DeadLetterConfig) {
+	if !cfg.DeadLetter {
+		return
+	}
+
+	deadLetter.Path = filepath.Join(cfg.DeadLetterDir, name+".json")
+	deadLetter.Counter = counter.WithLabelValues(name)
+	return
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/cirocosta/devents/lib/config"
+	"github.com/cirocosta/devents/lib/transformers"
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewPipeline(t *testing.T) {
+	pipeline, err := newPipeline(config.Config{
+		Transformer: []string{"relabel", "filter"},
+		EventRename: []string{"com.example.monitor=monitor"},
+		EventLabel:  []string{"monitor=true"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pipeline) != 2 {
+		t.Fatalf("expected 2 transformers, got %d", len(pipeline))
+	}
+	if _, ok := pipeline[0].(transformers.Relabel); !ok {
+		t.Errorf("expected relabel to come first, got %T", pipeline[0])
+	}
+	if _, ok := pipeline[1].(transformers.Filter); !ok {
+		t.Errorf("expected filter to come second, got %T", pipeline[1])
+	}
+
+	_, keep := pipeline.Transform(events.Message{
+		Type:  "container",
+		Actor: events.Actor{Attributes: map[string]string{"com.example.monitor": "true"}},
+	})
+	if !keep {
+		t.Error("expected the renamed label to be matched")
+	}
+}
+
+func TestNewPipelineDefaults(t *testing.T) {
+	pipeline, err := newPipeline(config.Config{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pipeline) != len(defaultTransformers) {
+		t.Errorf("expected the %d default transformers, got %d", len(defaultTransformers), len(pipeline))
+	}
+}
+
+func TestNewPipelineInvalid(t *testing.T) {
+	for _, names := range [][]string{
+		{"filter", "filter"},
+		{"enrich"},
+	} {
+		if _, err := newPipeline(config.Config{Transformer: names}, nil); err == nil {
+			t.Errorf("expected %v to be rejected", names)
+		}
+	}
+}
+
+func TestHostLabel(t *testing.T) {
+	for _, host := range []string{"", "docker-1"} {
+		var registry = prometheus.NewRegistry()
+
+		registry.MustRegister(
+			newBuildInfo(config.Config{}, host),
+			newDeduplicated(config.Config{}, host),
+		)
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, family := range families {
+			var value, present = "", false
+			for _, label := range family.Metric[0].Label {
+				if label.GetName() == "host" {
+					value, present = label.GetValue(), true
+				}
+			}
+
+			if present != (host != "") || value != host {
+				t.Errorf("%s: expected host label %q, got %q (present: %t)",
+					family.GetName(), host, value, present)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package transformers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type DedupConfig struct {
+	// Window is how long, after an event goes through, events of
+	// the same type and action of the same actor are dropped as
+	// duplicates. Events aren't deduplicated when zero.
+	Window time.Duration
+
+	// Counter, when set, counts the events dropped as duplicates.
+	Counter prometheus.Counter
+}
+
+// Dedup drops the bursts of identical events (e.g., those of a
+// flapping health check), letting a single event of each type, action
+// and actor through per window. Windows are measured by the time the
+// events happened at, so that replayed events are deduplicated the
+// same way as live ones.
+type Dedup struct {
+	window  time.Duration
+	counter prometheus.Counter
+
+	mu    sync.Mutex
+	seen  map[dedupKey]time.Time
+	swept time.Time
+}
+
+// dedupKey identifies the events considered duplicates of each other.
+type dedupKey struct {
+	typ    string
+	action string
+	actor  string
+}
+
+var _ Transformer = (*Dedup)(nil)
+
+func NewDedup(cfg DedupConfig) (dedup *Dedup, err error) {
+	if cfg.Window < 0 {
+		err = errors.Errorf(
+			"Deduplication window must not be negative, got %s", cfg.Window)
+		return
+	}
+
+	dedup = &Dedup{
+		window:  cfg.Window,
+		counter: cfg.Counter,
+		seen:    map[dedupKey]time.Time{},
+	}
+	return
+}
+
+// Transform drops the event if one of the same type, action and actor
+// went through less than a window ago.
+func (d *Dedup) Transform(ev events.Message) (events.Message, bool) {
+	if d.window == 0 {
+		return ev, true
+	}
+
+	var (
+		key = dedupKey{ev.Type, ev.Action, ev.Actor.ID}
+		now = eventTime(ev)
+	)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+
+	expires, present := d.seen[key]
+	if present && now.Before(expires) {
+		if d.counter != nil {
+			d.counter.Inc()
+		}
+		return ev, false
+	}
+
+	d.seen[key] = now.Add(d.window)
+	return ev, true
+}
+
+// sweep forgets, at most once per window, the events whose windows
+// are over so that actors that are gone don't pile up.
+func (d *Dedup) sweep(now time.Time) {
+	if now.Sub(d.swept) < d.window {
+		return
+	}
+
+	for key, expires := range d.seen {
+		if !now.Before(expires) {
+			delete(d.seen, key)
+		}
+	}
+
+	d.swept = now
+}
+
+// eventTime returns the time the event happened at, as precisely as
+// it's known, or the current time when the event carries none.
+func eventTime(ev events.Message) time.Time {
+	if ev.TimeNano != 0 {
+		return time.Unix(0, ev.TimeNano)
+	}
+
+	if ev.Time != 0 {
+		return time.Unix(ev.Time, 0)
+	}
+
+	return time.Now()
+}
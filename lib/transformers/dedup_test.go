@@ -0,0 +1,102 @@
+package transformers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDedup(t *testing.T) {
+	var counter = prometheus.NewCounter(prometheus.CounterOpts{Name: "deduplicated_events_total"})
+
+	dedup, err := NewDedup(DedupConfig{Window: 10 * time.Second, Counter: counter})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		start = time.Unix(1500000000, 0)
+		at    = func(offset time.Duration, action, actor string) events.Message {
+			return events.Message{
+				Type:     "container",
+				Action:   action,
+				TimeNano: start.Add(offset).UnixNano(),
+				Actor:    events.Actor{ID: actor},
+			}
+		}
+	)
+
+	var testCases = []struct {
+		desc string
+		ev   events.Message
+		keep bool
+	}{
+		{desc: "first", ev: at(0, "health_status: unhealthy", "abc"), keep: true},
+		{desc: "duplicate", ev: at(time.Second, "health_status: unhealthy", "abc"), keep: false},
+		{desc: "other actor", ev: at(2*time.Second, "health_status: unhealthy", "def"), keep: true},
+		{desc: "other action", ev: at(3*time.Second, "die", "abc"), keep: true},
+		{desc: "end of window", ev: at(9*time.Second, "health_status: unhealthy", "abc"), keep: false},
+		{desc: "expired", ev: at(10*time.Second, "health_status: unhealthy", "abc"), keep: true},
+		{desc: "new window", ev: at(15*time.Second, "health_status: unhealthy", "abc"), keep: false},
+	}
+
+	for _, tc := range testCases {
+		if _, keep := dedup.Transform(tc.ev); keep != tc.keep {
+			t.Errorf("%s: expected keep to be %t", tc.desc, tc.keep)
+		}
+	}
+
+	if count := testutil.ToFloat64(counter); count != 3 {
+		t.Errorf("expected 3 duplicates to be counted, got %g", count)
+	}
+}
+
+func TestDedupForgetsExpired(t *testing.T) {
+	dedup, err := NewDedup(DedupConfig{Window: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var start = time.Unix(1500000000, 0)
+	for i := 0; i < 100; i++ {
+		dedup.Transform(events.Message{
+			Type:     "container",
+			Action:   "die",
+			TimeNano: start.UnixNano(),
+			Actor:    events.Actor{ID: fmt.Sprintf("c%d", i)},
+		})
+	}
+
+	dedup.Transform(events.Message{Type: "container", Action: "die", TimeNano: start.Add(time.Minute).UnixNano()})
+
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	if len(dedup.seen) != 1 {
+		t.Errorf("expected the expired events to be forgotten, %d remain", len(dedup.seen))
+	}
+}
+
+func TestDedupDisabled(t *testing.T) {
+	dedup, err := NewDedup(DedupConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ev = events.Message{Type: "container", Action: "die", TimeNano: 1}
+	for i := 0; i < 3; i++ {
+		if _, keep := dedup.Transform(ev); !keep {
+			t.Fatal("expected events not to be deduplicated without a window")
+		}
+	}
+}
+
+func TestNewDedupNegativeWindow(t *testing.T) {
+	if _, err := NewDedup(DedupConfig{Window: -time.Second}); err == nil {
+		t.Fatal("expected a negative window to be rejected")
+	}
+}
@@ -0,0 +1,26 @@
+package transformers
+
+import (
+	"github.com/pkg/errors"
+)
+
+func New(transformerType string, config interface{}) (transformer Transformer, err error) {
+	switch transformerType {
+	case "filter":
+		transformer, err = NewFilter(config.(FilterConfig))
+	case "relabel":
+		transformer, err = NewRelabel(config.(RelabelConfig))
+	case "redact":
+		transformer, err = NewRedact(config.(RedactConfig))
+	case "dedup":
+		transformer, err = NewDedup(config.(DedupConfig))
+	case "sample":
+		transformer, err = NewSample(config.(SampleConfig))
+	default:
+		err = errors.Errorf(
+			"Unknown transformer type %s", transformerType)
+		return
+	}
+
+	return
+}
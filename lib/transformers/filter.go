@@ -0,0 +1,116 @@
+package transformers
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+// eventTypes are the types of the events emitted by the docker
+// daemon.
+var eventTypes = map[string]bool{
+	events.ContainerEventType: true,
+	events.DaemonEventType:    true,
+	events.ImageEventType:     true,
+	events.NetworkEventType:   true,
+	events.PluginEventType:    true,
+	events.VolumeEventType:    true,
+	"config":                  true,
+	"node":                    true,
+	"secret":                  true,
+	"service":                 true,
+}
+
+type FilterConfig struct {
+	// Types are the types of the events (e.g., `container` or
+	// `image`) let through. Every type is let through when empty.
+	Types []string
+
+	// Labels are `key=value` matchers over the attributes of the
+	// actor of the events (where the labels of containers end
+	// up), all of which must match for an event to be selected.
+	// Events missing an attribute don't match it.
+	Labels []string
+
+	// ExcludeLabels discards the events selected by Labels
+	// instead of discarding those that aren't.
+	ExcludeLabels bool
+}
+
+// Filter discards the events that shouldn't reach the aggregators.
+// Unlike the filters of the docker collector, which are applied by
+// the daemon, these are applied by devents itself and thus work with
+// any collector.
+type Filter struct {
+	types         map[string]bool
+	labels        map[string]string
+	excludeLabels bool
+}
+
+var _ Transformer = (*Filter)(nil)
+
+func NewFilter(cfg FilterConfig) (filter Filter, err error) {
+	if len(cfg.Types) > 0 {
+		filter.types = map[string]bool{}
+	}
+
+	for _, evType := range cfg.Types {
+		if !eventTypes[evType] {
+			err = errors.Errorf(
+				"Unknown event type %s", evType)
+			return
+		}
+
+		filter.types[evType] = true
+	}
+
+	if len(cfg.Labels) > 0 {
+		filter.labels = map[string]string{}
+	}
+
+	for _, label := range cfg.Labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			err = errors.Errorf(
+				"Malformed label matcher %s, expected key=value", label)
+			return
+		}
+
+		filter.labels[parts[0]] = parts[1]
+	}
+
+	filter.excludeLabels = cfg.ExcludeLabels
+	return
+}
+
+// Transform lets through only the events matching the filter.
+func (f Filter) Transform(ev events.Message) (events.Message, bool) {
+	return ev, f.matches(ev)
+}
+
+// matches reports whether the event is let through by the filter.
+func (f Filter) matches(ev events.Message) bool {
+	if f.types != nil && !f.types[ev.Type] {
+		return false
+	}
+
+	if f.labels == nil {
+		return true
+	}
+
+	return f.matchesLabels(ev) != f.excludeLabels
+}
+
+// matchesLabels reports whether the actor of the event has every
+// attribute the label matchers require.
+func (f Filter) matchesLabels(ev events.Message) bool {
+	for key, value := range f.labels {
+		actual, present := ev.Actor.Attributes[key]
+		if !present || actual != value {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,123 @@
+package transformers
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestFilterTypes(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Types: []string{"container", "network"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testCases = []struct {
+		evType string
+		keep   bool
+	}{
+		{evType: "container", keep: true},
+		{evType: "network", keep: true},
+		{evType: "image", keep: false},
+		{evType: "", keep: false},
+	}
+
+	for _, tc := range testCases {
+		_, keep := filter.Transform(events.Message{Type: tc.evType, Action: "create"})
+		if keep != tc.keep {
+			t.Errorf("%q: expected keep to be %t", tc.evType, tc.keep)
+		}
+	}
+}
+
+func TestNewFilterUnknownType(t *testing.T) {
+	_, err := NewFilter(FilterConfig{Types: []string{"containers"}})
+	if err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+}
+
+func TestFilterLabels(t *testing.T) {
+	var (
+		matching = events.Actor{Attributes: map[string]string{
+			"com.example.monitor": "true",
+			"com.example.team":    "infra",
+			"name":                "web",
+		}}
+		mismatching = events.Actor{Attributes: map[string]string{
+			"com.example.monitor": "false",
+			"com.example.team":    "infra",
+		}}
+		partial = events.Actor{Attributes: map[string]string{
+			"com.example.monitor": "true",
+		}}
+		missing = events.Actor{Attributes: map[string]string{
+			"name": "web",
+		}}
+	)
+
+	var testCases = []struct {
+		desc    string
+		exclude bool
+		actor   events.Actor
+		keep    bool
+	}{
+		{desc: "match", actor: matching, keep: true},
+		{desc: "non-match", actor: mismatching, keep: false},
+		{desc: "partial match", actor: partial, keep: false},
+		{desc: "missing label", actor: missing, keep: false},
+		{desc: "no attributes", actor: events.Actor{}, keep: false},
+		{desc: "excluded match", exclude: true, actor: matching, keep: false},
+		{desc: "excluded non-match", exclude: true, actor: mismatching, keep: true},
+		{desc: "excluded partial match", exclude: true, actor: partial, keep: true},
+		{desc: "excluded missing label", exclude: true, actor: missing, keep: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			filter, err := NewFilter(FilterConfig{
+				Labels:        []string{"com.example.monitor=true", "com.example.team=infra"},
+				ExcludeLabels: tc.exclude,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, keep := filter.Transform(events.Message{Type: "container", Action: "start", Actor: tc.actor})
+			if keep != tc.keep {
+				t.Errorf("expected keep to be %t", tc.keep)
+			}
+		})
+	}
+}
+
+func TestFilterLabelsAndTypes(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{
+		Types:         []string{"container"},
+		Labels:        []string{"com.example.monitor=true"},
+		ExcludeLabels: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// types are filtered regardless of the label mode
+	_, keep := filter.Transform(events.Message{Type: "network", Action: "connect"})
+	if keep {
+		t.Error("expected the type filter to apply in exclude mode")
+	}
+
+	_, keep = filter.Transform(events.Message{Type: "container", Action: "start"})
+	if !keep {
+		t.Error("expected an unlabeled container to be kept in exclude mode")
+	}
+}
+
+func TestNewFilterMalformedLabel(t *testing.T) {
+	for _, label := range []string{"com.example.monitor", "=true"} {
+		_, err := NewFilter(FilterConfig{Labels: []string{label}})
+		if err == nil {
+			t.Errorf("%s: expected an error", label)
+		}
+	}
+}
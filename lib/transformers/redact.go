@@ -0,0 +1,96 @@
+package transformers
+
+import (
+	"regexp"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+// redactedValue replaces the values of the redacted attributes.
+const redactedValue = "***"
+
+type RedactConfig struct {
+	// Keys are regular expressions matched (case insensitively)
+	// against the keys of the attributes of the events, e.g.
+	// `password|token|secret`. The value of every attribute whose
+	// key matches any of them is masked.
+	Keys []string
+
+	// Drop removes the matching attributes altogether instead of
+	// masking their values.
+	Drop bool
+}
+
+// Redact masks (or drops) the attributes of the events that might
+// carry sensitive values (e.g., labels holding credentials) so that
+// they don't leak through the aggregators.
+type Redact struct {
+	keys []*regexp.Regexp
+	drop bool
+}
+
+var _ Transformer = (*Redact)(nil)
+
+func NewRedact(cfg RedactConfig) (redact Redact, err error) {
+	for _, key := range cfg.Keys {
+		var re *regexp.Regexp
+
+		re, err = regexp.Compile("(?i)" + key)
+		if err != nil {
+			err = errors.Wrapf(err,
+				"Malformed redacted key expression %s", key)
+			return
+		}
+
+		redact.keys = append(redact.keys, re)
+	}
+
+	redact.drop = cfg.Drop
+	return
+}
+
+// Transform masks the sensitive attributes of the event, leaving the
+// attributes of the original event untouched.
+func (r Redact) Transform(ev events.Message) (events.Message, bool) {
+	if len(r.keys) == 0 {
+		return ev, true
+	}
+
+	var attrs map[string]string
+	for key := range ev.Actor.Attributes {
+		if !r.matches(key) {
+			continue
+		}
+
+		if attrs == nil {
+			attrs = make(map[string]string, len(ev.Actor.Attributes))
+			for key, value := range ev.Actor.Attributes {
+				attrs[key] = value
+			}
+		}
+
+		if r.drop {
+			delete(attrs, key)
+		} else {
+			attrs[key] = redactedValue
+		}
+	}
+
+	if attrs != nil {
+		ev.Actor.Attributes = attrs
+	}
+
+	return ev, true
+}
+
+// matches reports whether the attribute `key` is sensitive.
+func (r Redact) matches(key string) bool {
+	for _, re := range r.keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
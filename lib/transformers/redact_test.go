@@ -0,0 +1,94 @@
+package transformers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestRedact(t *testing.T) {
+	var attrs = map[string]string{
+		"DB_PASSWORD":         "hunter2",
+		"com.example.token":   "abc",
+		"aws_secret_key":      "def",
+		"name":                "web",
+		"image":               "nginx",
+		"com.example.monitor": "true",
+	}
+
+	var testCases = []struct {
+		desc     string
+		drop     bool
+		expected map[string]string
+	}{
+		{
+			desc: "mask",
+			expected: map[string]string{
+				"DB_PASSWORD":         "***",
+				"com.example.token":   "***",
+				"aws_secret_key":      "***",
+				"name":                "web",
+				"image":               "nginx",
+				"com.example.monitor": "true",
+			},
+		},
+		{
+			desc: "drop",
+			drop: true,
+			expected: map[string]string{
+				"name":                "web",
+				"image":               "nginx",
+				"com.example.monitor": "true",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			redact, err := NewRedact(RedactConfig{
+				Keys: []string{"password", "TOKEN", "secret"},
+				Drop: tc.drop,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, keep := redact.Transform(events.Message{Actor: events.Actor{Attributes: attrs}})
+			if !keep {
+				t.Fatal("expected redacting to keep the event")
+			}
+
+			if !reflect.DeepEqual(out.Actor.Attributes, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, out.Actor.Attributes)
+			}
+
+			if attrs["DB_PASSWORD"] != "hunter2" {
+				t.Error("expected the original attributes to be left untouched")
+			}
+		})
+	}
+}
+
+func TestRedactAnchored(t *testing.T) {
+	redact, err := NewRedact(RedactConfig{Keys: []string{"^env\\."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := redact.Transform(events.Message{Actor: events.Actor{Attributes: map[string]string{
+		"env.API_KEY":     "abc",
+		"com.example.env": "prod",
+	}}})
+
+	var expected = map[string]string{"env.API_KEY": "***", "com.example.env": "prod"}
+	if !reflect.DeepEqual(out.Actor.Attributes, expected) {
+		t.Errorf("expected %v, got %v", expected, out.Actor.Attributes)
+	}
+}
+
+func TestNewRedactMalformed(t *testing.T) {
+	if _, err := NewRedact(RedactConfig{Keys: []string{"pass("}}); err == nil {
+		t.Fatal("expected a malformed expression to be rejected")
+	}
+}
@@ -0,0 +1,102 @@
+package transformers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+)
+
+type RelabelConfig struct {
+	// Rename are `from=to` pairs renaming the attribute `from` of
+	// the actor of the events to `to` (e.g., to give a short name
+	// to a lengthy label before it's used by the aggregators).
+	Rename []string
+
+	// Set are `key=value` attributes set on the actor of every
+	// event, overriding those it already has.
+	Set []string
+}
+
+// Relabel renames and sets attributes of the actor of the events.
+type Relabel struct {
+	renames []string
+	rename  map[string]string
+	set     map[string]string
+}
+
+var _ Transformer = (*Relabel)(nil)
+
+func NewRelabel(cfg RelabelConfig) (relabel Relabel, err error) {
+	relabel.rename, err = parsePairs(cfg.Rename, "rename", "from=to")
+	if err != nil {
+		return
+	}
+
+	relabel.set, err = parsePairs(cfg.Set, "attribute", "key=value")
+	if err != nil {
+		return
+	}
+
+	for from, to := range relabel.rename {
+		if to == "" {
+			err = errors.Errorf(
+				"Malformed rename %s=, expected from=to", from)
+			return
+		}
+
+		relabel.renames = append(relabel.renames, from)
+	}
+	sort.Strings(relabel.renames)
+
+	return
+}
+
+// Transform renames and sets the attributes of the event, leaving
+// the attributes of the original event untouched.
+func (r Relabel) Transform(ev events.Message) (events.Message, bool) {
+	if len(r.rename) == 0 && len(r.set) == 0 {
+		return ev, true
+	}
+
+	var attrs = make(map[string]string, len(ev.Actor.Attributes)+len(r.set))
+	for key, value := range ev.Actor.Attributes {
+		attrs[key] = value
+	}
+
+	for _, from := range r.renames {
+		value, present := attrs[from]
+		if !present {
+			continue
+		}
+
+		delete(attrs, from)
+		attrs[r.rename[from]] = value
+	}
+
+	for key, value := range r.set {
+		attrs[key] = value
+	}
+
+	ev.Actor.Attributes = attrs
+	return ev, true
+}
+
+// parsePairs parses `key=value` pairs into a map.
+func parsePairs(pairs []string, what, format string) (parsed map[string]string, err error) {
+	parsed = map[string]string{}
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			err = errors.Errorf(
+				"Malformed %s %s, expected %s", what, pair, format)
+			return
+		}
+
+		parsed[parts[0]] = parts[1]
+	}
+
+	return
+}
@@ -0,0 +1,232 @@
+package transformers
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type SampleConfig struct {
+	// Events are the events sampled, each entry being either a
+	// type (`container`), a type and an action (`container:exec_start`)
+	// or an action of any type (`*:exec_start`). Actions are
+	// compared up to their first colon, so that `exec_start`
+	// covers every command and `health_status` every status.
+	// Every event is sampled when empty, the rest go through.
+	Events []string
+
+	// Ratio lets one in every Ratio events of each type and action
+	// through. Events aren't sampled by ratio when lower than 2.
+	Ratio int
+
+	// ByActor samples the actors (e.g., containers) instead of
+	// their events when sampling by ratio: either every event of
+	// an actor goes through or none does, so that what's let
+	// through tells the whole story of the actors it concerns.
+	ByActor bool
+
+	// Rate is the number of events of each type let through per
+	// second, on average, once the Burst allowed upfront is used
+	// up. Events aren't rate limited when zero.
+	Rate  float64
+	Burst int
+
+	// Counter, when set, counts the events sampled out.
+	Counter prometheus.Counter
+}
+
+// Sample keeps the volume of events manageable on busy hosts by
+// letting only a fraction of them through, either a fixed ratio of
+// them, a limited rate of them per type, or both.
+type Sample struct {
+	events  []sampleEntry
+	ratio   uint32
+	byActor bool
+	rate    float64
+	burst   float64
+	counter prometheus.Counter
+
+	mu      sync.Mutex
+	counts  map[string]uint32
+	buckets map[string]*tokenBucket
+}
+
+// sampleEntry selects the events sampled by type and action, an
+// empty action matching any.
+type sampleEntry struct {
+	typ    string
+	action string
+}
+
+// tokenBucket rate limits the events of a type.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var _ Transformer = (*Sample)(nil)
+
+func NewSample(cfg SampleConfig) (sample *Sample, err error) {
+	if cfg.Ratio < 0 {
+		err = errors.Errorf(
+			"Sampling ratio must not be negative, got %d", cfg.Ratio)
+		return
+	}
+
+	if cfg.Rate < 0 || cfg.Burst < 0 {
+		err = errors.Errorf(
+			"Sampling rate and burst must not be negative, got %g and %d",
+			cfg.Rate, cfg.Burst)
+		return
+	}
+
+	sample = &Sample{
+		byActor: cfg.ByActor,
+		rate:    cfg.Rate,
+		burst:   float64(cfg.Burst),
+		counter: cfg.Counter,
+		counts:  map[string]uint32{},
+		buckets: map[string]*tokenBucket{},
+	}
+
+	if cfg.Ratio > 1 {
+		sample.ratio = uint32(cfg.Ratio)
+	}
+
+	if sample.burst == 0 {
+		sample.burst = math.Max(1, math.Ceil(sample.rate))
+	}
+
+	for _, entry := range cfg.Events {
+		var parsed = sampleEntry{typ: entry}
+		if idx := strings.Index(entry, ":"); idx != -1 {
+			parsed.typ, parsed.action = entry[:idx], entry[idx+1:]
+		}
+
+		if parsed.action == "*" {
+			parsed.action = ""
+		}
+
+		if parsed.typ != "*" && !eventTypes[parsed.typ] {
+			err = errors.Errorf(
+				"Unknown event type %s in sampled event %s", parsed.typ, entry)
+			return
+		}
+
+		sample.events = append(sample.events, parsed)
+	}
+
+	return
+}
+
+// Transform lets the event through if it's not sampled or if it's
+// one of those sampled in.
+func (s *Sample) Transform(ev events.Message) (events.Message, bool) {
+	if s.ratio == 0 && s.rate == 0 {
+		return ev, true
+	}
+
+	var action = sampledAction(ev.Action)
+	if !s.selects(ev.Type, action) {
+		return ev, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.sampleRatio(ev, action) || !s.sampleRate(ev) {
+		if s.counter != nil {
+			s.counter.Inc()
+		}
+		return ev, false
+	}
+
+	return ev, true
+}
+
+// selects reports whether events of the given type and action are
+// sampled.
+func (s *Sample) selects(evType, action string) bool {
+	if len(s.events) == 0 {
+		return true
+	}
+
+	for _, entry := range s.events {
+		if entry.typ != "*" && entry.typ != evType {
+			continue
+		}
+
+		if entry.action != "" && entry.action != action {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// sampleRatio reports whether the event is one in every ratio of its
+// type and action, or belongs to one in every ratio actors.
+func (s *Sample) sampleRatio(ev events.Message, action string) bool {
+	if s.ratio == 0 {
+		return true
+	}
+
+	if s.byActor && ev.Actor.ID != "" {
+		var hash = fnv.New32a()
+		hash.Write([]byte(ev.Actor.ID))
+		return hash.Sum32()%s.ratio == 0
+	}
+
+	var (
+		key   = ev.Type + ":" + action
+		count = s.counts[key]
+	)
+
+	s.counts[key] = (count + 1) % s.ratio
+	return count == 0
+}
+
+// sampleRate reports whether the rate of events of the type of the
+// event allows it through.
+func (s *Sample) sampleRate(ev events.Message) bool {
+	if s.rate == 0 {
+		return true
+	}
+
+	var now = time.Now()
+
+	bucket, present := s.buckets[ev.Type]
+	if !present {
+		bucket = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[ev.Type] = bucket
+	}
+
+	bucket.tokens = math.Min(s.burst,
+		bucket.tokens+now.Sub(bucket.last).Seconds()*s.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+	return true
+}
+
+// sampledAction is the part of the action the sampled events are
+// selected and counted by.
+func sampledAction(action string) string {
+	if idx := strings.Index(action, ":"); idx != -1 {
+		return action[:idx]
+	}
+
+	return action
+}
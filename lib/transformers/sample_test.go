@@ -0,0 +1,141 @@
+package transformers
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestSampleRatio(t *testing.T) {
+	sample, err := NewSample(SampleConfig{Ratio: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var passed int
+	for i := 0; i < 1000; i++ {
+		_, ok := sample.Transform(events.Message{
+			Type:   events.ContainerEventType,
+			Action: "exec_start: sh -c true",
+			Actor:  events.Actor{ID: fmt.Sprintf("c%d", i)},
+		})
+		if ok {
+			passed++
+		}
+	}
+
+	if passed != 100 {
+		t.Errorf("expected 100 in 1000 events through, got %d", passed)
+	}
+}
+
+func TestSampleByActor(t *testing.T) {
+	sample, err := NewSample(SampleConfig{Ratio: 4, ByActor: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const actors = 4000
+
+	var passed int
+	for i := 0; i < actors; i++ {
+		var id = fmt.Sprintf("container-%d", i)
+
+		_, first := sample.Transform(events.Message{
+			Type: events.ContainerEventType, Action: "start",
+			Actor: events.Actor{ID: id},
+		})
+		_, second := sample.Transform(events.Message{
+			Type: events.ContainerEventType, Action: "die",
+			Actor: events.Actor{ID: id},
+		})
+
+		if first != second {
+			t.Fatalf("expected every event of %s to share its fate", id)
+		}
+
+		if first {
+			passed++
+		}
+	}
+
+	// With a ratio of 4 a quarter of the actors should go through,
+	// give or take four standard deviations of the binomial.
+	var (
+		expected  = actors / 4.0
+		deviation = math.Sqrt(actors * 0.25 * 0.75)
+	)
+
+	if math.Abs(float64(passed)-expected) > 4*deviation {
+		t.Errorf("expected about %g actors through, got %d", expected, passed)
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	sample, err := NewSample(SampleConfig{Rate: 0.001, Burst: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var passed = map[string]int{}
+	for i := 0; i < 20; i++ {
+		for _, typ := range []string{events.ContainerEventType, events.NetworkEventType} {
+			if _, ok := sample.Transform(events.Message{Type: typ, Action: "create"}); ok {
+				passed[typ]++
+			}
+		}
+	}
+
+	if passed[events.ContainerEventType] != 5 || passed[events.NetworkEventType] != 5 {
+		t.Errorf("expected the burst of 5 of each type through, got %v", passed)
+	}
+}
+
+func TestSampleEvents(t *testing.T) {
+	sample, err := NewSample(SampleConfig{
+		Events: []string{"container:exec_start", "*:destroy"},
+		Ratio:  1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		typ, action string
+		sampled     bool
+	}{
+		{events.ContainerEventType, "exec_start: ls", true},
+		{events.ImageEventType, "destroy", true},
+		{events.ContainerEventType, "start", false},
+		{events.NetworkEventType, "connect", false},
+	} {
+		var passed int
+		for i := 0; i < 3; i++ {
+			if _, ok := sample.Transform(events.Message{Type: tc.typ, Action: tc.action}); ok {
+				passed++
+			}
+		}
+
+		if tc.sampled && passed != 1 {
+			t.Errorf("expected %s:%s to be sampled, %d went through", tc.typ, tc.action, passed)
+		}
+
+		if !tc.sampled && passed != 3 {
+			t.Errorf("expected %s:%s to go through, %d went through", tc.typ, tc.action, passed)
+		}
+	}
+}
+
+func TestNewSampleInvalid(t *testing.T) {
+	for _, cfg := range []SampleConfig{
+		{Ratio: -1},
+		{Rate: -1},
+		{Events: []string{"unknown"}},
+	} {
+		if _, err := NewSample(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
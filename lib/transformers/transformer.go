@@ -0,0 +1,36 @@
+// Package transformers provides the steps events go through on their
+// way from the collector to the aggregators, each of which can alter
+// or discard them.
+package transformers
+
+import (
+	"github.com/docker/docker/api/types/events"
+)
+
+// Transformer transforms a single event, returning the event that
+// should carry on through the pipeline and whether it should (false
+// drops the event).
+type Transformer interface {
+	Transform(ev events.Message) (events.Message, bool)
+}
+
+// Pipeline is an ordered chain of transformers, each one receiving
+// what the previous one returned. An event dropped by a transformer
+// doesn't reach the ones after it.
+type Pipeline []Transformer
+
+var _ Transformer = (Pipeline)(nil)
+
+// Transform runs the event through every transformer in order.
+func (p Pipeline) Transform(ev events.Message) (events.Message, bool) {
+	for _, transformer := range p {
+		var keep bool
+
+		ev, keep = transformer.Transform(ev)
+		if !keep {
+			return ev, false
+		}
+	}
+
+	return ev, true
+}
@@ -0,0 +1,134 @@
+package transformers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// recorder records the actions of the events it sees, letting them
+// through.
+type recorder struct {
+	seen *[]string
+}
+
+func (r recorder) Transform(ev events.Message) (events.Message, bool) {
+	*r.seen = append(*r.seen, ev.Action)
+	return ev, true
+}
+
+func TestPipelineOrder(t *testing.T) {
+	relabel, err := NewRelabel(RelabelConfig{Rename: []string{"com.example.monitor=monitor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := NewFilter(FilterConfig{Labels: []string{"monitor=true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ev = events.Message{
+		Type:   "container",
+		Action: "start",
+		Actor:  events.Actor{Attributes: map[string]string{"com.example.monitor": "true"}},
+	}
+
+	// the filter only sees the renamed label when running after
+	// the relabeling
+	if _, keep := (Pipeline{relabel, filter}).Transform(ev); !keep {
+		t.Error("expected the event to be kept when relabeled first")
+	}
+
+	if _, keep := (Pipeline{filter, relabel}).Transform(ev); keep {
+		t.Error("expected the event to be dropped when filtered first")
+	}
+}
+
+func TestPipelineDropStops(t *testing.T) {
+	filter, err := NewFilter(FilterConfig{Types: []string{"container"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		before, after []string
+		pipeline      = Pipeline{recorder{&before}, filter, recorder{&after}}
+	)
+
+	for _, ev := range []events.Message{
+		{Type: "container", Action: "start"},
+		{Type: "network", Action: "connect"},
+		{Type: "container", Action: "die"},
+	} {
+		pipeline.Transform(ev)
+	}
+
+	if !reflect.DeepEqual(before, []string{"start", "connect", "die"}) {
+		t.Errorf("expected every event to reach the first transformer, got %v", before)
+	}
+
+	if !reflect.DeepEqual(after, []string{"start", "die"}) {
+		t.Errorf("expected dropped events not to reach later transformers, got %v", after)
+	}
+}
+
+func TestEmptyPipeline(t *testing.T) {
+	var ev = events.Message{Type: "container", Action: "start"}
+
+	out, keep := Pipeline(nil).Transform(ev)
+	if !keep || !reflect.DeepEqual(out, ev) {
+		t.Errorf("expected the event to go through untouched, got %+v", out)
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	relabel, err := NewRelabel(RelabelConfig{
+		Rename: []string{"com.docker.compose.service=service"},
+		Set:    []string{"env=prod", "name=overridden"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attrs = map[string]string{
+		"com.docker.compose.service": "web",
+		"name":                       "web_1",
+		"image":                      "nginx",
+	}
+
+	out, keep := relabel.Transform(events.Message{Actor: events.Actor{Attributes: attrs}})
+	if !keep {
+		t.Fatal("expected relabeling to keep the event")
+	}
+
+	var expected = map[string]string{
+		"service": "web",
+		"name":    "overridden",
+		"image":   "nginx",
+		"env":     "prod",
+	}
+	if !reflect.DeepEqual(out.Actor.Attributes, expected) {
+		t.Errorf("expected %v, got %v", expected, out.Actor.Attributes)
+	}
+
+	if attrs["com.docker.compose.service"] != "web" || len(attrs) != 3 {
+		t.Errorf("expected the original attributes to be left untouched, got %v", attrs)
+	}
+}
+
+func TestNew(t *testing.T) {
+	transformer, err := New("relabel", RelabelConfig{Set: []string{"env=prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := transformer.(Relabel); !ok {
+		t.Errorf("expected a relabel transformer, got %T", transformer)
+	}
+
+	if _, err := New("enrich", nil); err == nil {
+		t.Error("expected an unknown type to be rejected")
+	}
+}
@@ -0,0 +1,10 @@
+package lib
+
+// Version and Commit identify the build of devents. They're meant
+// to be set at build time, e.g.:
+//
+//	go build -ldflags "-X github.com/cirocosta/devents/lib.Version=1.0.0"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
@@ -1,34 +1,150 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	arg "github.com/alexflint/go-arg"
 	lib "github.com/cirocosta/devents/lib"
+	"github.com/cirocosta/devents/lib/config"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	config = lib.Config{
-		DockerHost:   "unix://var/run/docker.sock",
-		FluentdTag:   "devents",
-		FluentdHost:  "localhost",
-		FluentdPort:  24224,
-		Aggregator:   []string{},
-		MetricsPath:  "/metrics",
-		MetricsPort:  9103,
-		MetricsLabel: []string{"image"},
+	defaults = config.Config{
+		DockerMaxBackoff:           30 * time.Second,
+		FluentdTag:                 "devents",
+		FluentdHost:                "localhost",
+		FluentdPort:                24224,
+		Aggregator:                 []string{},
+		MetricsPath:                "/metrics",
+		MetricsPort:                9103,
+		MetricsLabel:               []string{"image"},
+		MetricsSubsystem:           "devents",
+		HealthPath:                 "/healthz",
+		ReadyPath:                  "/ready",
+		StatsdHost:                 "localhost",
+		StatsdPort:                 8125,
+		StatsdPrefix:               "devents",
+		DogstatsdHost:              "localhost",
+		DogstatsdPort:              8125,
+		DogstatsdPrefix:            "devents",
+		InfluxdbURL:                "http://localhost:8086",
+		InfluxdbDatabase:           "devents",
+		InfluxdbBatchSize:          500,
+		InfluxdbFlushInterval:      5 * time.Second,
+		Influxdb2URL:               "http://localhost:8086",
+		Influxdb2BatchSize:         500,
+		Influxdb2FlushInterval:     5 * time.Second,
+		GraphiteHost:               "localhost",
+		GraphitePort:               2003,
+		GraphitePrefix:             "devents",
+		GraphiteFlushInterval:      10 * time.Second,
+		ElasticsearchURL:           "http://localhost:9200",
+		ElasticsearchIndex:         "docker-events-2006.01.02",
+		ElasticsearchBatchSize:     500,
+		ElasticsearchFlushInterval: 5 * time.Second,
+		KafkaTopic:                 "docker-events",
+		KafkaKey:                   "actor",
+		KafkaCompression:           "none",
+		KafkaFlushInterval:         500 * time.Millisecond,
+		NatsSubject:                "docker.events.{{.Type}}.{{.Action}}",
+		WebhookTimeout:             10 * time.Second,
+		WebhookRetryAttempts:       3,
+		WebhookRetryBackoff:        500 * time.Millisecond,
+		SlackInterval:              time.Second,
+		FilePath:                   "/var/log/devents/events.log",
+		FileMaxSize:                100 * 1024 * 1024,
+		FileMaxBackups:             5,
+		SyslogNetwork:              "udp",
+		SyslogAddress:              "localhost:514",
+		SyslogFacility:             "daemon",
+		SyslogAppName:              "devents",
+		LokiURL:                    "http://localhost:3100",
+		LokiBatchSize:              500,
+		LokiFlushInterval:          5 * time.Second,
+		SqlitePath:                 "/var/lib/devents/events.db",
+		SqliteRetention:            7 * 24 * time.Hour,
+		SqliteBatchSize:            500,
+		SqliteFlushInterval:        time.Second,
+		PostgresTable:              "docker_events",
+		PostgresBatchSize:          500,
+		PostgresFlushInterval:      5 * time.Second,
+		PubsubTopic:                "docker-events",
+		PubsubOrderingKey:          "none",
+		PubsubFlushInterval:        time.Second,
+		CloudwatchLogGroup:         "docker-events",
+		CloudwatchLogStream:        "{{.Host}}",
+		CloudwatchFlushInterval:    5 * time.Second,
+		EmfNamespace:               "devents",
+		EmfMaxDimensionValues:      100,
+		EmfFlushInterval:           time.Minute,
+		OtlpEndpoint:               "http://localhost:4318",
+		OtlpExportInterval:         time.Minute,
+		OtlpLogsBatchSize:          500,
+		OtlpLogsFlushInterval:      5 * time.Second,
+		SentryDedupWindow:          time.Minute,
+		WebsocketAddr:              ":9104",
+		WebsocketPath:              "/events",
+		SseAddr:                    ":9105",
+		SsePath:                    "/events",
+		SseBufferSize:              1000,
+		GrpcAddr:                   ":9106",
+		PushgatewayJob:             "devents",
+		PushgatewayInterval:        15 * time.Second,
+		TelegramInterval:           time.Second,
+		MqttBroker:                 "tcp://localhost:1883",
+		MqttClientID:               "devents",
+		MqttTopic:                  "docker/events/{{.Type}}/{{.Action}}",
+		LogLevel:                   "info",
+		LogFormat:                  "text",
+		BufferSize:                 100,
+		ShutdownTimeout:            10 * time.Second,
+		DeadLetterDir:              "dead-letters",
+		DockerEnrichCacheSize:      1000,
+		DockerEnrichCacheTTL:       30 * time.Second,
+		MetricsNameLimit:           100,
 	}
 )
 
 func main() {
-	arg.MustParse(&config)
-	var logger = log.WithFields(config.ToLogrusFields())
-	if err := config.Validate(); err != nil {
+	var cfg = defaults
+
+	// Parsing the command line a second time, without the defaults,
+	// gives the values of the settings given through flags (or the
+	// environment variables they read), which take precedence over
+	// the `DEVENTS_*` variables, which take precedence over the
+	// configuration file, which takes precedence over the defaults.
+	os.Args = append(os.Args[:1], config.ExpandFlagAliases(os.Args[1:])...)
+	arg.MustParse(&cfg)
+
+	var (
+		flags config.Config
+		given = config.GivenFields(os.Args[1:], os.LookupEnv)
+	)
+	arg.Parse(&flags)
+
+	var err error
+	cfg, err = load(defaults, flags, given)
+	if err != nil {
+		log.
+			WithError(err).
+			Fatal("Couldn't load configuration")
+	}
+
+	var logger = log.WithFields(cfg.ToLogrusFields())
+	if err := cfg.Validate(); err != nil {
 		logger.
 			WithError(err).
 			Fatal("Invalid configuration. See `devents -h`")
 	}
 
-	dev, err := lib.New(config)
+	cfg.ConfigureLogger(log.StandardLogger())
+
+	dev, err := lib.New(cfg)
 	if err != nil {
 		logger.
 			WithError(err).
@@ -36,6 +152,94 @@ func main() {
 	}
 	defer dev.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownOnSignal(logger, cancel)
+
+	var hangups = make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			logger.Info("reloading configuration")
+			reload(dev, defaults, flags, given)
+		}
+	}()
+
 	logger.Info("starting")
-	dev.Run()
+	err = dev.Run(ctx)
+	if err != nil {
+		logger.
+			WithError(err).
+			Fatal("Devents stopped unexpectedly")
+	}
+
+	logger.Info("stopped")
+}
+
+// shutdownOnSignal calls `cancel` on the first SIGTERM or SIGINT,
+// letting the buffered events drain, and exits right away on the
+// second one.
+func shutdownOnSignal(logger *log.Entry, cancel context.CancelFunc) {
+	var signals = make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.
+			WithField("signal", sig).
+			Info("shutting down")
+		cancel()
+
+		// A second signal doesn't wait for the buffered events.
+		sig = <-signals
+		logger.
+			WithField("signal", sig).
+			Fatal("forced shutdown")
+	}()
+}
+
+// load builds the configuration out of the defaults, the configuration
+// file, the `DEVENTS_*` environment variables and the `given` flags.
+func load(defaults, flags config.Config, given []string) (cfg config.Config, err error) {
+	cfg = defaults
+	if flags.Config != "" {
+		err = cfg.LoadFile(flags.Config)
+		if err != nil {
+			return
+		}
+	}
+
+	err = cfg.LoadEnv(os.Environ())
+	if err != nil {
+		return
+	}
+
+	cfg.Overlay(flags, given)
+	return
+}
+
+// reload loads the configuration again and applies it to `dev`,
+// keeping the current one when the new one is invalid.
+func reload(dev lib.Devents, defaults, flags config.Config, given []string) {
+	cfg, err := load(defaults, flags, given)
+	if err == nil {
+		err = cfg.Validate()
+	}
+
+	if err != nil {
+		log.
+			WithError(err).
+			Error("Invalid configuration, keeping the current one")
+		return
+	}
+
+	err = dev.Reload(cfg)
+	if err != nil {
+		log.
+			WithError(err).
+			Error("Couldn't fully reload configuration")
+		return
+	}
+
+	log.Info("configuration reloaded")
 }
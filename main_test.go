@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cirocosta/devents/lib/aggregators"
+	"github.com/docker/docker/api/types/events"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// slowAggregator takes its time processing each event, recording
+// the actions of those it processed.
+type slowAggregator struct {
+	mu        sync.Mutex
+	processed []string
+}
+
+func (a *slowAggregator) Run(ctx context.Context, evs <-chan events.Message, errs <-chan error) error {
+	for ev := range evs {
+		time.Sleep(10 * time.Millisecond)
+
+		a.mu.Lock()
+		a.processed = append(a.processed, ev.Action)
+		a.mu.Unlock()
+	}
+
+	return nil
+}
+
+func TestShutdownOnSignalDrains(t *testing.T) {
+	var agg = new(slowAggregator)
+
+	dispatcher, err := aggregators.NewDispatcher(aggregators.DispatcherConfig{
+		BufferSize:   10,
+		DrainTimeout: 5 * time.Second,
+		Aggregators:  map[string]aggregators.Aggregator{"slow": agg},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		evs         = make(chan events.Message)
+		done        = make(chan error, 1)
+		actions     = []string{"create", "start", "pause", "unpause", "die"}
+	)
+	defer cancel()
+
+	// Once done, the signals go back to terminating the process
+	// rather than being taken as the second, forcing, one.
+	shutdownOnSignal(log.WithField("test", t.Name()), cancel)
+	defer signal.Reset(syscall.SIGTERM, syscall.SIGINT)
+
+	go func() { done <- dispatcher.Run(ctx, evs, nil) }()
+
+	// the events are buffered faster than they're processed
+	for _, action := range actions {
+		evs <- events.Message{Type: "container", Action: action}
+	}
+
+	err = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the signal to stop the dispatcher")
+	}
+
+	if ctx.Err() == nil {
+		t.Error("expected the signal to cancel the context")
+	}
+
+	agg.mu.Lock()
+	defer agg.mu.Unlock()
+
+	if len(agg.processed) != len(actions) {
+		t.Errorf("expected every buffered event to be processed, got %v", agg.processed)
+	}
+}